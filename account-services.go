@@ -3,6 +3,7 @@ package main
 import (
 	m "github.com/andreyvit/buddyd/model"
 	"github.com/andreyvit/edb"
+	"golang.org/x/exp/maps"
 )
 
 func (app *App) initAccount(rc *RC, account *m.Account) {
@@ -25,3 +26,107 @@ func (app *App) initAccountMiddleware(rc *RC) (any, error) {
 	}
 	return nil, nil
 }
+
+// createAccount sets up a new account, optionally starting from a copy of
+// the template account's settings and library.
+func (app *App) createAccount(rc *RC, name string, template *m.Account) *m.Account {
+	account := &m.Account{
+		ID:   app.NewID(),
+		Name: name,
+	}
+	if template != nil {
+		account.EmbeddingType = template.EmbeddingType
+		account.Retrieval = template.Retrieval
+		account.UserMemory = template.UserMemory
+		account.Tools = maps.Clone(template.Tools)
+		account.CheckInTemplates = maps.Clone(template.CheckInTemplates)
+		account.Prompt = template.Prompt
+		account.Language = template.Language
+	}
+	edb.Put(rc, account)
+	app.initAccount(rc, account)
+	if template != nil {
+		app.copyAccountLibrary(rc, template.ID, account.ID)
+	}
+	return account
+}
+
+// copyAccountLibrary copies the folders, items, content and embeddings of
+// one account into the (freshly initialized) library of another.
+func (app *App) copyAccountLibrary(rc *RC, fromID, toID m.AccountID) {
+	src := loadAccountLibrary(rc, fromID)
+	dst := loadAccountLibrary(rc, toID)
+	if src.RootFolder() == nil || dst.RootFolder() == nil {
+		return
+	}
+
+	folderIDs := map[m.FolderID]m.FolderID{src.RootFolderID: dst.RootFolderID}
+	queue := []*m.Folder{src.RootFolder()}
+	for len(queue) > 0 {
+		fldr := queue[0]
+		queue = queue[1:]
+		parent := dst.Folder(folderIDs[fldr.ID])
+		for _, childID := range fldr.ChildenIDs {
+			child := src.Folder(childID)
+			if child == nil {
+				continue
+			}
+			copied := &m.Folder{
+				ID:        app.NewID(),
+				AccountID: toID,
+				Name:      child.Name,
+				Slug:      child.Slug,
+				ParentID:  parent.ID,
+			}
+			parent.ChildenIDs = append(parent.ChildenIDs, copied.ID)
+			dst.AddFolder(copied)
+			folderIDs[child.ID] = copied.ID
+			queue = append(queue, child)
+		}
+	}
+	for _, fldr := range dst.Folders {
+		edb.Put(rc, fldr)
+	}
+
+	itemIDs := make(map[m.ItemID]m.ItemID)
+	for _, item := range edb.All(edb.ExactIndexScan[m.Item](rc, ItemsByAccount, fromID)) {
+		copied := *item
+		copied.ID = app.NewID()
+		copied.AccountID = toID
+		if id, ok := folderIDs[item.FolderID]; ok {
+			copied.FolderID = id
+		} else {
+			copied.FolderID = dst.RootFolderID
+		}
+		itemIDs[item.ID] = copied.ID
+		edb.Put(rc, &copied)
+	}
+
+	contentIDs := make(map[m.ContentID]m.ContentID)
+	for _, c := range edb.All(edb.ExactIndexScan[m.Content](rc, ContentByAccount, fromID)) {
+		itemID, ok := itemIDs[c.ItemID]
+		if !ok {
+			continue
+		}
+		copied := *c
+		copied.ID = app.NewID()
+		copied.AccountID = toID
+		copied.ItemID = itemID
+		contentIDs[c.ID] = copied.ID
+		edb.Put(rc, &copied)
+	}
+
+	for oldItemID, itemID := range itemIDs {
+		for _, emb := range edb.All(edb.ExactIndexScan[m.ContentEmbedding](rc, EmbeddingsByItem, oldItemID)) {
+			contentID, ok := contentIDs[emb.ContentID]
+			if !ok {
+				continue
+			}
+			copied := *emb
+			copied.ContentID = contentID
+			copied.AccountID = toID
+			copied.ItemID = itemID
+			edb.Put(rc, &copied)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/forms"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+type ConnectorVM struct {
+	*m.Connector
+	WebhookURL string
+	LinkURL    string // Telegram only
+}
+
+func (app *App) listAdminConnectors(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	conns := edb.All(edb.ExactIndexScan[m.Connector](rc, ConnectorsByAccount, rc.AccountID()))
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Name < conns[j].Name
+	})
+	baseURL := strings.TrimSuffix(app.Settings().BaseURL, "/")
+	vms := make([]*ConnectorVM, len(conns))
+	for i, conn := range conns {
+		vms[i] = &ConnectorVM{
+			Connector:  conn,
+			WebhookURL: baseURL + app.URL("webhooks.connector", ":connector", conn.ID),
+		}
+		if conn.Kind == m.ConnectorKindTelegram {
+			vms[i].LinkURL = app.connectorLinkURL(conn)
+		}
+	}
+	return &mvp.ViewData{
+		View:         "admin/connectors",
+		Title:        "Connectors",
+		SemanticPath: "admin/connectors",
+		Data: struct {
+			Connectors []*ConnectorVM
+		}{
+			Connectors: vms,
+		},
+	}, nil
+}
+
+func (app *App) handleNewConnectorForm(rc *RC, in *struct {
+	IsSaving bool `json:"-" form:",issave"`
+}) (any, error) {
+	conn := &m.Connector{
+		AccountID: rc.AccountID(),
+		Kind:      m.ConnectorKindSlack,
+	}
+	return app.doConnectorForm(rc, conn, in.IsSaving)
+}
+
+func (app *App) handleConnectorForm(rc *RC, in *struct {
+	IsSaving    bool     `json:"-" form:",issave"`
+	ConnectorID flake.ID `form:"connector,path" json:"-"`
+}) (any, error) {
+	conn := loadAdminConnector(rc, in.ConnectorID)
+	if conn == nil {
+		return nil, httperrors.Errorf(404, "", "Connector not found")
+	}
+	return app.doConnectorForm(rc, conn, in.IsSaving)
+}
+
+func (app *App) deleteConnector(rc *RC, in *struct {
+	ConnectorID flake.ID `form:"connector,path" json:"-"`
+}) (any, error) {
+	conn := loadAdminConnector(rc, in.ConnectorID)
+	if conn == nil {
+		return nil, httperrors.Errorf(404, "", "Connector not found")
+	}
+	rc.DBTx().DeleteByKey(Connectors, conn.ID)
+	return app.Redirect("admin.connectors"), nil
+}
+
+func loadAdminConnector(rc *RC, id m.ConnectorID) *m.Connector {
+	conn := edb.Get[m.Connector](rc, id)
+	if conn == nil || conn.AccountID != rc.AccountID() {
+		return nil
+	}
+	return conn
+}
+
+func (app *App) doConnectorForm(rc *RC, conn *m.Connector, isSaving bool) (any, error) {
+	kind := conn.Kind.String()
+	name := conn.Name
+	enabled := !conn.Disabled
+	botToken := conn.BotToken
+	botUsername := conn.BotUsername
+	secret := conn.Secret
+	apiBaseURL := conn.APIBaseURL
+
+	children := []forms.Child{
+		&forms.Item{
+			Name:  "name",
+			Label: "Name",
+			Child: &forms.InputText{
+				Binding:     forms.Var(&name),
+				Placeholder: "Community Slack",
+			},
+		},
+	}
+	if conn.ID == 0 {
+		children = append(children, &forms.Item{
+			Name:  "kind",
+			Label: "Platform (slack or telegram)",
+			Child: &forms.InputText{
+				Binding: forms.Var(&kind),
+			},
+		})
+	}
+	children = append(children,
+		&forms.Item{
+			Name:  "enabled",
+			Label: "Enabled",
+			Child: &forms.Checkbox{
+				Binding: forms.Var(&enabled),
+			},
+		},
+		&forms.Item{
+			Name:  "bot_token",
+			Label: "Bot token",
+			Child: &forms.InputText{
+				Binding:     forms.Var(&botToken),
+				Placeholder: "xoxb-… or 123456:ABC-…",
+			},
+		},
+		&forms.Item{
+			Name:  "secret",
+			Label: "Slack signing secret (Telegram webhook secret is generated if empty)",
+			Child: &forms.InputText{
+				Binding: forms.Var(&secret),
+			},
+		},
+		&forms.Item{
+			Name:  "bot_username",
+			Label: "Telegram bot username",
+			Child: &forms.InputText{
+				Binding:     forms.Var(&botUsername),
+				Placeholder: "LibroAIBot",
+			},
+		},
+		&forms.Item{
+			Name:  "api_base_url",
+			Label: "API base URL (leave empty for the platform default)",
+			Child: &forms.InputText{
+				Binding: forms.Var(&apiBaseURL),
+			},
+		},
+		saveFormButtonBar(),
+	)
+
+	form := &forms.Form{
+		Group: forms.Group{
+			Styles: []*forms.Style{
+				adminFormStyle,
+				horizontalFormStyle,
+			},
+			Children: children,
+		},
+	}
+
+	if isSaving && form.ProcessRequest(rc.Request.Request) {
+		if conn.ID == 0 {
+			k, err := m.ParseConnectorKind(kind)
+			if err != nil {
+				return nil, httperrors.BadRequest.Msg(err.Error())
+			}
+			conn.ID = app.NewID()
+			conn.Kind = k
+			conn.CreationTime = rc.Now
+		}
+		conn.Name = strings.TrimSpace(name)
+		conn.Disabled = !enabled
+		conn.BotToken = strings.TrimSpace(botToken)
+		conn.BotUsername = strings.TrimPrefix(strings.TrimSpace(botUsername), "@")
+		conn.Secret = strings.TrimSpace(secret)
+		conn.APIBaseURL = strings.TrimSpace(apiBaseURL)
+		if conn.Name == "" {
+			conn.Name = conn.Kind.Title()
+		}
+		if conn.BotToken == "" {
+			return nil, httperrors.BadRequest.Msg("bot token is required")
+		}
+		if conn.Secret == "" {
+			if conn.Kind == m.ConnectorKindSlack {
+				return nil, httperrors.BadRequest.Msg("signing secret is required")
+			}
+			conn.Secret = randomConnectorSecret()
+		}
+		edb.Put(rc, conn)
+		return app.Redirect("admin.connectors"), nil
+	}
+
+	title := conn.Name
+	if conn.ID == 0 {
+		title = "New Connector"
+	}
+	return &mvp.ViewData{
+		View:         "form",
+		Title:        title,
+		SemanticPath: "admin/connectors",
+		Data: struct {
+			Form template.HTML
+		}{
+			Form: app.RenderForm(rc.BaseRC(), form),
+		},
+	}, nil
+}
+
+func randomConnectorSecret() string {
+	var b [24]byte
+	must(rand.Read(b[:]))
+	return hex.EncodeToString(b[:])
+}
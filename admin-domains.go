@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	"golang.org/x/exp/slices"
+
+	"github.com/andreyvit/buddyd/internal/domainverify"
+	m "github.com/andreyvit/buddyd/model"
+)
+
+const domainVerificationTimeout = 10 * time.Second
+
+type AccountDomainVM struct {
+	*m.AccountDomain
+	Record string
+}
+
+func (app *App) listAdminDomains(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	if err := rc.Check(m.PermissionManageAccount, nil); err != nil {
+		return nil, mvp.ErrForbidden.Wrap(err)
+	}
+	account := rc.Account.Account
+	vms := make([]*AccountDomainVM, len(account.Domains))
+	for i, d := range account.Domains {
+		vms[i] = &AccountDomainVM{
+			AccountDomain: d,
+			Record:        domainverify.Record(d.Token),
+		}
+	}
+	return &mvp.ViewData{
+		View:         "admin/domains",
+		Title:        "Domains",
+		SemanticPath: "admin/domains",
+		Data: struct {
+			Domains      []*AccountDomainVM
+			SignupPolicy m.SignupPolicy
+		}{
+			Domains:      vms,
+			SignupPolicy: account.SignupPolicy,
+		},
+	}, nil
+}
+
+func (app *App) addAdminDomain(rc *RC, in *struct {
+	Domain string `json:"domain"`
+}) (any, error) {
+	if err := rc.Check(m.PermissionManageAccount, nil); err != nil {
+		return nil, mvp.ErrForbidden.Wrap(err)
+	}
+	domain, err := domainverify.NormalizeDomain(in.Domain)
+	if err != nil {
+		return nil, httperrors.BadRequest.Msg("enter a domain like example.com")
+	}
+	account := rc.Account.Account
+	if account.Domain(domain) == nil {
+		account.Domains = append(account.Domains, &m.AccountDomain{
+			Domain:       domain,
+			Token:        domainverify.NewToken(),
+			CreationTime: rc.Now,
+		})
+		edb.Put(rc, account)
+	}
+	return app.Redirect("admin.domains"), nil
+}
+
+// verifyAdminDomain looks up the domain's TXT records right away, so that
+// the owner knows whether their DNS change has propagated.
+func (app *App) verifyAdminDomain(rc *RC, in *struct {
+	Domain string `form:"domain,path" json:"-"`
+}) (any, error) {
+	if err := rc.Check(m.PermissionManageAccount, nil); err != nil {
+		return nil, mvp.ErrForbidden.Wrap(err)
+	}
+	account := rc.Account.Account
+	d := account.Domain(in.Domain)
+	if d == nil {
+		return nil, httperrors.Errorf(404, "", "Domain not found")
+	}
+
+	ctx, cancel := context.WithTimeout(rc, domainVerificationTimeout)
+	defer cancel()
+	err := domainverify.Verify(ctx, app.domainResolver, d.Domain, d.Token)
+
+	d.LastCheckTime = rc.Now
+	if err != nil {
+		flogger.Log(rc, "Domain %s of account %v not verified: %v", d.Domain, account.ID, err)
+		d.LastCheckError = err.Error()
+	} else {
+		flogger.Log(rc, "Domain %s of account %v verified", d.Domain, account.ID)
+		d.LastCheckError = ""
+		if !d.IsVerified() {
+			d.VerificationTime = rc.Now
+		}
+	}
+	edb.Put(rc, account)
+	return app.Redirect("admin.domains"), nil
+}
+
+func (app *App) deleteAdminDomain(rc *RC, in *struct {
+	Domain string `form:"domain,path" json:"-"`
+}) (any, error) {
+	if err := rc.Check(m.PermissionManageAccount, nil); err != nil {
+		return nil, mvp.ErrForbidden.Wrap(err)
+	}
+	account := rc.Account.Account
+	if i := slices.IndexFunc(account.Domains, func(d *m.AccountDomain) bool {
+		return d.Domain == in.Domain
+	}); i >= 0 {
+		account.Domains = slices.Delete(account.Domains, i, i+1)
+	}
+	edb.Put(rc, account)
+	return app.Redirect("admin.domains"), nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// flagNearDuplicates records the near-duplicate pairs between fresh embeddings
+// and the rest of the account's library for admin review. Pairs that have
+// already been flagged (including dismissed ones) are not flagged again.
+// Returns the number of newly flagged pairs.
+func (app *App) flagNearDuplicates(rc *RC, accountID m.AccountID, typ m.EmbeddingType, fresh []*m.ContentEmbedding, threshold float64) int {
+	all := loadAccountEmbeddings(rc, accountID, typ, 0)
+	var n int
+	for _, pair := range m.FindNearDuplicates(fresh, all.Embeddings, threshold) {
+		key := m.MakeContentPairKey(pair.Fresh.ContentID, pair.Existing.ContentID)
+		if edb.Lookup[m.ContentDuplicate](rc, ContentDuplicatesByPair, key) != nil {
+			continue
+		}
+		edb.Put(rc, &m.ContentDuplicate{
+			ID:                app.NewID(),
+			AccountID:         accountID,
+			ContentID:         pair.Fresh.ContentID,
+			ItemID:            pair.Fresh.ItemID,
+			DuplicateOfID:     pair.Existing.ContentID,
+			DuplicateOfItemID: pair.Existing.ItemID,
+			Similarity:        pair.Similarity,
+			DetectionTime:     rc.Now,
+		})
+		n++
+	}
+	return n
+}
+
+func (app *App) listContentDuplicates(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	var dups []*m.ContentDuplicateVM
+	for _, dup := range edb.All(edb.ExactIndexScan[m.ContentDuplicate](rc, ContentDuplicatesByAccount, rc.AccountID())) {
+		if !dup.IsPending() {
+			continue
+		}
+		vm := &m.ContentDuplicateVM{
+			ContentDuplicate: dup,
+			Content:          edb.Get[m.Content](rc, dup.ContentID),
+			Item:             edb.Get[m.Item](rc, dup.ItemID),
+			DuplicateOf:      edb.Get[m.Content](rc, dup.DuplicateOfID),
+			DuplicateOfItem:  edb.Get[m.Item](rc, dup.DuplicateOfItemID),
+		}
+		if vm.Content == nil || vm.DuplicateOf == nil {
+			continue // one of the chunks has been deleted or re-imported since
+		}
+		dups = append(dups, vm)
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		return dups[i].Similarity > dups[j].Similarity
+	})
+
+	return &mvp.ViewData{
+		View:         "admin/duplicates",
+		Title:        "Near-Duplicate Content",
+		SemanticPath: "admin/duplicates",
+		Data: struct {
+			Duplicates []*m.ContentDuplicateVM
+		}{
+			Duplicates: dups,
+		},
+	}, nil
+}
+
+func (app *App) handleContentDuplicateAction(rc *RC, in *struct {
+	DupID  flake.ID `form:"dup,path" json:"-"`
+	Action string   `json:"action"`
+}) (any, error) {
+	dup := edb.Get[m.ContentDuplicate](rc, in.DupID)
+	if dup == nil || dup.AccountID != rc.AccountID() {
+		return nil, httperrors.Errorf(404, "", "Duplicate not found")
+	}
+
+	switch in.Action {
+	case "dismiss":
+		dup.State = m.ContentDuplicateDismissed
+	case "delete":
+		deleteContent(rc, dup.ContentID)
+		dup.State = m.ContentDuplicateResolved
+	case "delete-original":
+		deleteContent(rc, dup.DuplicateOfID)
+		dup.State = m.ContentDuplicateResolved
+	default:
+		return nil, httperrors.BadRequest.Msg("invalid action")
+	}
+	edb.Put(rc, dup)
+	return app.Redirect("admin.duplicates"), nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/forms"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+func (app *App) listGoldenSets(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	sets := edb.All(edb.ExactIndexScan[m.GoldenSet](rc, GoldenSetsByAccount, rc.AccountID()))
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i].Name < sets[j].Name
+	})
+	return &mvp.ViewData{
+		View:         "admin/golden",
+		Title:        "Golden Sets",
+		SemanticPath: "admin/golden",
+		Data: struct {
+			Sets []*m.GoldenSet
+		}{
+			Sets: sets,
+		},
+	}, nil
+}
+
+func (app *App) handleNewGoldenSetForm(rc *RC, in *struct {
+	IsSaving bool `json:"-" form:",issave"`
+}) (any, error) {
+	gs := &m.GoldenSet{
+		AccountID: rc.AccountID(),
+	}
+	return app.doGoldenSetForm(rc, gs, in.IsSaving)
+}
+
+func (app *App) handleGoldenSetForm(rc *RC, in *struct {
+	IsSaving bool     `json:"-" form:",issave"`
+	SetID    flake.ID `form:"set,path" json:"-"`
+}) (any, error) {
+	gs := edb.Get[m.GoldenSet](rc, in.SetID)
+	if gs == nil || gs.AccountID != rc.AccountID() {
+		return nil, httperrors.Errorf(404, "", "Golden set not found")
+	}
+	return app.doGoldenSetForm(rc, gs, in.IsSaving)
+}
+
+func (app *App) doGoldenSetForm(rc *RC, gs *m.GoldenSet, isSaving bool) (any, error) {
+	items := edb.All(edb.ExactIndexScan[m.Item](rc, ItemsByAccount, rc.AccountID()))
+	itemsByID := make(map[m.ItemID]*m.Item, len(items))
+	itemsByName := make(map[string][]*m.Item, len(items))
+	for _, item := range items {
+		itemsByID[item.ID] = item
+		key := strings.ToLower(item.Name)
+		itemsByName[key] = append(itemsByName[key], item)
+	}
+
+	name := gs.Name
+	questionsStr := m.FormatGoldenQuestions(gs.Questions, func(id m.ItemID) string {
+		if item := itemsByID[id]; item != nil {
+			return item.Name
+		}
+		return fmt.Sprintf("(deleted item %v)", id)
+	})
+
+	form := &forms.Form{
+		Group: forms.Group{
+			Styles: []*forms.Style{
+				adminFormStyle,
+				verticalFormStyle,
+			},
+			Children: []forms.Child{
+				&forms.Item{
+					Name:  "name",
+					Label: "Name",
+					Child: &forms.InputText{
+						Binding:     forms.Var(&name),
+						Placeholder: "Onboarding questions",
+					},
+				},
+				&forms.Item{
+					Name:  "questions",
+					Label: "Questions (one per paragraph; expected items on lines starting with >)",
+					Child: &forms.InputText{
+						Template: "control-textarea",
+						TagOpts: forms.TagOpts{
+							Attrs: map[string]any{"rows": 25},
+						},
+						Binding:     forms.Var(&questionsStr),
+						Placeholder: "How do I plan my week?\n> Weekly Planning",
+					},
+				},
+				saveFormButtonBar(),
+			},
+		},
+	}
+
+	if isSaving && form.ProcessRequest(rc.Request.Request) {
+		questions, err := m.ParseGoldenQuestions(questionsStr, gs.Questions, func(name string) (m.ItemID, error) {
+			matches := itemsByName[strings.ToLower(name)]
+			switch len(matches) {
+			case 0:
+				return 0, fmt.Errorf("unknown item %q", name)
+			case 1:
+				return matches[0].ID, nil
+			default:
+				return 0, fmt.Errorf("ambiguous item name %q (%d items)", name, len(matches))
+			}
+		})
+		if err != nil {
+			return nil, httperrors.BadRequest.Msg(err.Error())
+		}
+		if strings.TrimSpace(name) == "" {
+			return nil, httperrors.BadRequest.Msg("name is required")
+		}
+
+		if gs.ID == 0 {
+			gs.ID = app.NewID()
+		}
+		gs.Name = strings.TrimSpace(name)
+		gs.Questions = questions
+		edb.Put(rc, gs)
+		return app.Redirect("admin.golden.edit", ":set", gs.ID), nil
+	}
+
+	title := gs.Name
+	if gs.ID == 0 {
+		title = "New Golden Set"
+	}
+	return &mvp.ViewData{
+		View:         "form",
+		Title:        title,
+		SemanticPath: "admin/golden",
+		Data: struct {
+			Form template.HTML
+		}{
+			Form: app.RenderForm(rc.BaseRC(), form),
+		},
+	}, nil
+}
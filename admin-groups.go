@@ -0,0 +1,245 @@
+package main
+
+import (
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/forms"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+type UserGroupVM struct {
+	*m.UserGroup
+	MemberCount int
+}
+
+func loadAccountGroups(rc *RC, accountID m.AccountID) []*m.UserGroup {
+	groups := edb.All(edb.ExactIndexScan[m.UserGroup](rc, UserGroupsByAccount, accountID))
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+func (app *App) listAdminGroups(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	accountID := rc.AccountID()
+	groups := loadAccountGroups(rc, accountID)
+	vms := make([]*UserGroupVM, len(groups))
+	for i, g := range groups {
+		vms[i] = &UserGroupVM{UserGroup: g}
+	}
+	for c := edb.ExactIndexScan[m.User](rc, UsersByAccount, accountID); c.Next(); {
+		memb := c.Row().Membership(accountID)
+		for _, vm := range vms {
+			if memb.InGroup(vm.ID) {
+				vm.MemberCount++
+			}
+		}
+	}
+	return &mvp.ViewData{
+		View:         "admin/groups",
+		Title:        "Groups",
+		SemanticPath: "admin/groups",
+		Data: struct {
+			Groups []*UserGroupVM
+		}{
+			Groups: vms,
+		},
+	}, nil
+}
+
+func (app *App) handleNewGroupForm(rc *RC, in *struct {
+	IsSaving bool `json:"-" form:",issave"`
+}) (any, error) {
+	g := &m.UserGroup{
+		AccountID: rc.AccountID(),
+	}
+	return app.doGroupForm(rc, g, in.IsSaving)
+}
+
+func (app *App) handleGroupForm(rc *RC, in *struct {
+	IsSaving bool     `json:"-" form:",issave"`
+	GroupID  flake.ID `form:"group,path" json:"-"`
+}) (any, error) {
+	g := loadAdminGroup(rc, in.GroupID)
+	if g == nil {
+		return nil, httperrors.Errorf(404, "", "Group not found")
+	}
+	return app.doGroupForm(rc, g, in.IsSaving)
+}
+
+func (app *App) deleteGroup(rc *RC, in *struct {
+	GroupID flake.ID `form:"group,path" json:"-"`
+}) (any, error) {
+	g := loadAdminGroup(rc, in.GroupID)
+	if g == nil {
+		return nil, httperrors.Errorf(404, "", "Group not found")
+	}
+	for c := edb.ExactIndexScan[m.User](rc, UsersByAccount, g.AccountID); c.Next(); {
+		u := c.Row()
+		if memb := u.Membership(g.AccountID); memb != nil && memb.RemoveFromGroup(g.ID) {
+			edb.Put(rc, u)
+		}
+	}
+	for _, fldr := range loadAccountFolders(rc, g.AccountID) {
+		if fldr.ACL == nil {
+			continue
+		}
+		if acl := fldr.ACL.WithoutGroup(g.ID); acl != nil {
+			fldr.ACL = acl
+			edb.Put(rc, fldr)
+		}
+	}
+	rc.DBTx().DeleteByKey(UserGroups, g.ID)
+	return app.Redirect("admin.groups"), nil
+}
+
+func loadAdminGroup(rc *RC, id m.UserGroupID) *m.UserGroup {
+	g := edb.Get[m.UserGroup](rc, id)
+	if g == nil || g.AccountID != rc.AccountID() {
+		return nil
+	}
+	return g
+}
+
+func (app *App) doGroupForm(rc *RC, g *m.UserGroup, isSaving bool) (any, error) {
+	members := make(map[string]*m.User)
+	var memberEmails []string
+	for c := edb.ExactIndexScan[m.User](rc, UsersByAccount, g.AccountID); c.Next(); {
+		u := c.Row()
+		members[u.EmailNorm] = u
+		if g.ID != 0 && u.Membership(g.AccountID).InGroup(g.ID) {
+			memberEmails = append(memberEmails, u.Email)
+		}
+	}
+	sort.Strings(memberEmails)
+
+	name := g.Name
+	prompt := g.Prompt
+	var limitStr string
+	if g.MonthlyLimit > 0 {
+		limitStr = strconv.Itoa(g.MonthlyLimit)
+	}
+	membersStr := strings.Join(memberEmails, "\n")
+
+	form := &forms.Form{
+		Group: forms.Group{
+			Styles: []*forms.Style{
+				adminFormStyle,
+				horizontalFormStyle,
+			},
+			Children: []forms.Child{
+				&forms.Item{
+					Name:  "name",
+					Label: "Name",
+					Child: &forms.InputText{
+						Binding:     forms.Var(&name),
+						Placeholder: "Spring 2026 cohort",
+					},
+				},
+				&forms.Item{
+					Name:  "prompt",
+					Label: "Bot prompt for members (leave empty to use the account's prompt)",
+					Child: &forms.InputText{
+						Template: "control-textarea",
+						TagOpts: forms.TagOpts{
+							Attrs: map[string]any{"rows": 6},
+						},
+						Binding: forms.Var(&prompt),
+					},
+				},
+				&forms.Item{
+					Name:  "monthly_limit",
+					Label: "Questions per member per month (leave empty for no limit)",
+					Child: &forms.InputText{
+						Binding: forms.Var(&limitStr),
+					},
+				},
+				&forms.Item{
+					Name:  "members",
+					Label: "Member emails",
+					Child: &forms.InputText{
+						Template: "control-textarea",
+						TagOpts: forms.TagOpts{
+							Attrs: map[string]any{"rows": 15},
+						},
+						Binding: forms.Var(&membersStr),
+					},
+				},
+				saveFormButtonBar(),
+			},
+		},
+	}
+
+	if isSaving && form.ProcessRequest(rc.Request.Request) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, httperrors.BadRequest.Msg("name is required")
+		}
+		if other := m.FindUserGroup(loadAccountGroups(rc, g.AccountID), name); other != nil && other.ID != g.ID {
+			return nil, httperrors.BadRequest.Msg("another group is already called " + other.Name)
+		}
+		var limit int
+		if s := strings.TrimSpace(limitStr); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 {
+				return nil, httperrors.BadRequest.Msg("monthly limit must be a non-negative number")
+			}
+			limit = v
+		}
+
+		wanted := make(map[string]bool)
+		for _, email := range strings.Fields(membersStr) {
+			canon := mvp.CanonicalEmail(email)
+			if members[canon] == nil {
+				return nil, httperrors.BadRequest.Msg(email + " is not a member of this account")
+			}
+			wanted[canon] = true
+		}
+
+		if g.ID == 0 {
+			g.ID = app.NewID()
+			g.CreationTime = rc.Now
+		}
+		g.Name = name
+		g.Prompt = strings.TrimSpace(prompt)
+		g.MonthlyLimit = limit
+		edb.Put(rc, g)
+
+		for canon, u := range members {
+			memb := u.Membership(g.AccountID)
+			var modified bool
+			if wanted[canon] {
+				modified = memb.AddToGroup(g.ID)
+			} else {
+				modified = memb.RemoveFromGroup(g.ID)
+			}
+			if modified {
+				edb.Put(rc, u)
+			}
+		}
+		return app.Redirect("admin.groups"), nil
+	}
+
+	title := g.Name
+	if g.ID == 0 {
+		title = "New Group"
+	}
+	return &mvp.ViewData{
+		View:         "form",
+		Title:        title,
+		SemanticPath: "admin/groups",
+		Data: struct {
+			Form template.HTML
+		}{
+			Form: app.RenderForm(rc.BaseRC(), form),
+		},
+	}, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/forms"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+func (app *App) handleAdminSettings(rc *RC, in *struct {
+	IsSaving bool `json:"-" form:",issave"`
+}) (any, error) {
+	account := rc.Account.Account
+	userMemory := account.UserMemory
+	prompt := editablePromptFor(account)
+
+	canManage := rc.Can(m.PermissionManageAccount, nil)
+	name := account.Name
+	logoURL := account.Branding.LogoURL
+	assistantName := account.Branding.AssistantName
+	accentColor := account.Branding.AccentColor
+	language := account.Language
+	signupPolicy := account.SignupPolicy.String()
+
+	var children []forms.Child
+	if canManage {
+		children = append(children,
+			&forms.Item{
+				Name:  "name",
+				Label: "Account name",
+				Child: &forms.InputText{
+					Binding: forms.Var(&name),
+				},
+			},
+			&forms.Item{
+				Name:  "logo_url",
+				Label: "Logo URL",
+				Child: &forms.InputText{
+					Binding:     forms.Var(&logoURL),
+					Placeholder: "https://example.com/logo.svg",
+				},
+			},
+			&forms.Item{
+				Name:  "assistant_name",
+				Label: "Assistant name",
+				Child: &forms.InputText{
+					Binding:     forms.Var(&assistantName),
+					Placeholder: m.DefaultAssistantName,
+				},
+			},
+			&forms.Item{
+				Name:  "accent_color",
+				Label: "Accent color",
+				Child: &forms.InputText{
+					Binding:     forms.Var(&accentColor),
+					Placeholder: "#7e22ce",
+				},
+			},
+			&forms.Item{
+				Name:  "language",
+				Label: "Default language of bot answers",
+				Child: &forms.InputText{
+					Binding:     forms.Var(&language),
+					Placeholder: "English",
+				},
+			},
+			&forms.Item{
+				Name:  "signup_policy",
+				Label: "Sign-up policy (whitelist, domains to admit verified email domains, or open to also admit anyone via " + app.signupLinkURL(account) + ")",
+				Child: &forms.InputText{
+					Binding: forms.Var(&signupPolicy),
+				},
+			},
+		)
+	}
+	children = append(children,
+		&forms.Item{
+			Name:  "prompt",
+			Label: "Bot prompt (text after || goes after the library context)",
+			Child: &forms.InputText{
+				Template: "control-textarea",
+				TagOpts: forms.TagOpts{
+					Attrs: map[string]any{"rows": 6},
+				},
+				Binding: forms.Var(&prompt),
+			},
+		},
+		&forms.Item{
+			Name:  "user_memory",
+			Label: "Remember facts about users across chats",
+			Child: &forms.Checkbox{
+				Binding: forms.Var(&userMemory),
+			},
+		},
+	)
+	toolAccess := make([]string, len(chatTools))
+	for i, tool := range chatTools {
+		toolAccess[i] = account.Tools[tool.Name].String()
+		children = append(children, &forms.Item{
+			Name:  "tool_" + tool.Name,
+			Label: "Tool " + tool.Name + " (off, staff or everyone)",
+			Child: &forms.InputText{
+				Binding:     forms.Var(&toolAccess[i]),
+				Placeholder: "off",
+			},
+		})
+	}
+	checkInTemplates := make([]string, len(m.CheckInKinds))
+	for i, kind := range m.CheckInKinds {
+		checkInTemplates[i] = checkInTemplateFor(account, kind)
+		children = append(children, &forms.Item{
+			Name:  "checkin_" + kind.String(),
+			Label: kind.Title() + " check-in prompt",
+			Child: &forms.InputText{
+				Template: "control-textarea",
+				TagOpts: forms.TagOpts{
+					Attrs: map[string]any{"rows": 4},
+				},
+				Binding: forms.Var(&checkInTemplates[i]),
+			},
+		})
+	}
+	children = append(children, saveFormButtonBar())
+
+	form := &forms.Form{
+		Group: forms.Group{
+			Styles: []*forms.Style{
+				adminFormStyle,
+				horizontalFormStyle,
+			},
+			Children: children,
+		},
+	}
+
+	if in.IsSaving && form.ProcessRequest(rc.Request.Request) {
+		if canManage {
+			policy, err := m.ParseSignupPolicy(signupPolicy)
+			if err != nil {
+				return nil, httperrors.BadRequest.Msg(err.Error())
+			}
+			accentColor = strings.TrimSpace(accentColor)
+			if accentColor != "" && !m.IsHexColor(accentColor) {
+				return nil, httperrors.BadRequest.Msg("accent color must look like #7e22ce")
+			}
+			logoURL = strings.TrimSpace(logoURL)
+			if logoURL != "" && !strings.HasPrefix(logoURL, "https://") && !strings.HasPrefix(logoURL, "/") {
+				return nil, httperrors.BadRequest.Msg("logo URL must start with https://")
+			}
+			if n := strings.TrimSpace(name); n != "" {
+				account.Name = n
+			}
+			account.Branding = m.AccountBranding{
+				LogoURL:       logoURL,
+				AssistantName: strings.TrimSpace(assistantName),
+				AccentColor:   accentColor,
+			}
+			account.Language = strings.TrimSpace(language)
+			account.SignupPolicy = policy
+		}
+
+		tools := make(m.ToolPermissions)
+		for i, tool := range chatTools {
+			access := m.ToolAccessOff
+			if s := strings.TrimSpace(toolAccess[i]); s != "" {
+				var err error
+				access, err = m.ParseToolAccess(s)
+				if err != nil {
+					return nil, httperrors.BadRequest.Msg(err.Error())
+				}
+			}
+			if access != m.ToolAccessOff {
+				tools[tool.Name] = access
+			}
+		}
+
+		account.CheckInTemplates = nil
+		for i, kind := range m.CheckInKinds {
+			t := strings.TrimSpace(checkInTemplates[i])
+			if t != "" && t != defaultCheckInTemplates[kind] {
+				if account.CheckInTemplates == nil {
+					account.CheckInTemplates = make(map[string]string)
+				}
+				account.CheckInTemplates[kind.String()] = t
+			}
+		}
+
+		account.Prompt = ""
+		if p := strings.TrimSpace(prompt); p != "" && p != prompt1 {
+			account.Prompt = p
+		}
+		account.UserMemory = userMemory
+		account.Tools = tools
+		edb.Put(rc, account)
+		return app.Redirect("admin.settings"), nil
+	}
+
+	return &mvp.ViewData{
+		View:         "form",
+		Title:        "Settings",
+		SemanticPath: "admin/settings",
+		Data: struct {
+			Form template.HTML
+		}{
+			Form: app.RenderForm(rc.BaseRC(), form),
+		},
+	}, nil
+}
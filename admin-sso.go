@@ -0,0 +1,176 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/forms"
+	"github.com/andreyvit/mvp/httperrors"
+
+	"github.com/andreyvit/buddyd/internal/sso"
+	m "github.com/andreyvit/buddyd/model"
+)
+
+func (app *App) handleAdminSSO(rc *RC, in *struct {
+	IsSaving bool `json:"-" form:",issave"`
+}) (any, error) {
+	if err := rc.Check(m.PermissionManageAccount, nil); err != nil {
+		return nil, mvp.ErrForbidden.Wrap(err)
+	}
+	accountID := rc.AccountID()
+	cfg := edb.Get[m.SSOConfig](rc, accountID)
+	if cfg == nil {
+		cfg = &m.SSOConfig{AccountID: accountID}
+	}
+
+	protocol := cfg.Protocol.String()
+	oidcIssuer := cfg.OIDCIssuer
+	oidcClientID := cfg.OIDCClientID
+	oidcClientSecret := cfg.OIDCClientSecret
+	samlEntityID := cfg.SAMLIdPEntityID
+	samlSSOURL := cfg.SAMLIdPSSOURL
+	samlCert := cfg.SAMLIdPCertificate
+	groupsAttr := cfg.GroupsAttribute
+	groupRoles := m.FormatSSOGroupRoles(cfg.GroupRoles)
+
+	form := &forms.Form{
+		Group: forms.Group{
+			Styles: []*forms.Style{
+				adminFormStyle,
+				horizontalFormStyle,
+			},
+			Children: []forms.Child{
+				&forms.Item{
+					Name:  "protocol",
+					Label: "Protocol (none, oidc or saml); users can only sign in with emails in verified domains, sign-in page is " + app.signupLinkURL(rc.Account.Account),
+					Child: &forms.InputText{
+						Binding: forms.Var(&protocol),
+					},
+				},
+				&forms.Item{
+					Name:  "oidc_issuer",
+					Label: "OIDC issuer URL (redirect URL is " + app.ssoURL("sso.oidc.callback", accountID) + ")",
+					Child: &forms.InputText{
+						Binding:     forms.Var(&oidcIssuer),
+						Placeholder: "https://example.okta.com",
+					},
+				},
+				&forms.Item{
+					Name:  "oidc_client_id",
+					Label: "OIDC client ID",
+					Child: &forms.InputText{
+						Binding: forms.Var(&oidcClientID),
+					},
+				},
+				&forms.Item{
+					Name:  "oidc_client_secret",
+					Label: "OIDC client secret",
+					Child: &forms.InputText{
+						Binding: forms.Var(&oidcClientSecret),
+					},
+				},
+				&forms.Item{
+					Name:  "saml_idp_sso_url",
+					Label: "SAML IdP sign-in URL (our metadata is at " + app.ssoURL("sso.saml.metadata", accountID) + ", ACS URL is " + app.ssoURL("sso.saml.acs", accountID) + ")",
+					Child: &forms.InputText{
+						Binding: forms.Var(&samlSSOURL),
+					},
+				},
+				&forms.Item{
+					Name:  "saml_idp_entity_id",
+					Label: "SAML IdP entity ID",
+					Child: &forms.InputText{
+						Binding: forms.Var(&samlEntityID),
+					},
+				},
+				&forms.Item{
+					Name:  "saml_idp_certificate",
+					Label: "SAML IdP signing certificate (PEM)",
+					Child: &forms.InputText{
+						Template: "control-textarea",
+						TagOpts: forms.TagOpts{
+							Attrs: map[string]any{"rows": 6},
+						},
+						Binding: forms.Var(&samlCert),
+					},
+				},
+				&forms.Item{
+					Name:  "groups_attribute",
+					Label: "Groups claim or attribute (leave empty for the default)",
+					Child: &forms.InputText{
+						Binding:     forms.Var(&groupsAttr),
+						Placeholder: "groups",
+					},
+				},
+				&forms.Item{
+					Name:  "group_roles",
+					Label: "Group roles, one “group = role” per line (consumer, assistant or admin); the first matching line wins, others get consumer",
+					Child: &forms.InputText{
+						Template: "control-textarea",
+						TagOpts: forms.TagOpts{
+							Attrs: map[string]any{"rows": 4},
+						},
+						Binding: forms.Var(&groupRoles),
+					},
+				},
+				saveFormButtonBar(),
+			},
+		},
+	}
+
+	if in.IsSaving && form.ProcessRequest(rc.Request.Request) {
+		p, err := m.ParseSSOProtocol(protocol)
+		if err != nil {
+			return nil, httperrors.BadRequest.Msg(err.Error())
+		}
+		roles, err := m.ParseSSOGroupRoles(groupRoles)
+		if err != nil {
+			return nil, httperrors.BadRequest.Msg(err.Error())
+		}
+		cfg.Protocol = p
+		cfg.OIDCIssuer = strings.TrimSpace(oidcIssuer)
+		cfg.OIDCClientID = strings.TrimSpace(oidcClientID)
+		cfg.OIDCClientSecret = strings.TrimSpace(oidcClientSecret)
+		cfg.SAMLIdPEntityID = strings.TrimSpace(samlEntityID)
+		cfg.SAMLIdPSSOURL = strings.TrimSpace(samlSSOURL)
+		cfg.SAMLIdPCertificate = strings.TrimSpace(samlCert)
+		cfg.GroupsAttribute = strings.TrimSpace(groupsAttr)
+		cfg.GroupRoles = roles
+		cfg.UpdateTime = rc.Now
+
+		switch cfg.Protocol {
+		case m.SSOProtocolOIDC:
+			if !isHTTPSURL(cfg.OIDCIssuer) || cfg.OIDCClientID == "" {
+				return nil, httperrors.BadRequest.Msg("OIDC needs an https:// issuer URL and a client ID")
+			}
+		case m.SSOProtocolSAML:
+			if !isHTTPSURL(cfg.SAMLIdPSSOURL) {
+				return nil, httperrors.BadRequest.Msg("SAML needs an https:// IdP sign-in URL")
+			}
+			if _, err := sso.ParseCertificatePEM(cfg.SAMLIdPCertificate); err != nil {
+				return nil, httperrors.BadRequest.Msg("SAML IdP certificate: " + err.Error())
+			}
+		}
+		edb.Put(rc, cfg)
+		return app.Redirect("admin.sso"), nil
+	}
+
+	return &mvp.ViewData{
+		View:         "form",
+		Title:        "Single Sign-On",
+		SemanticPath: "admin/sso",
+		Data: struct {
+			Form template.HTML
+		}{
+			Form: app.RenderForm(rc.BaseRC(), form),
+		},
+	}, nil
+}
+
+func isHTTPSURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
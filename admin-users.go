@@ -116,6 +116,7 @@ func (app *App) handleAdminWhitelist(rc *mvp.RC, in *struct {
 
 	sort.Strings(whitelist)
 	whitelistStr := strings.Join(whitelist, "\n")
+	var groupName string
 
 	form := &forms.Form{
 		Multipart: true,
@@ -140,6 +141,13 @@ func (app *App) handleAdminWhitelist(rc *mvp.RC, in *struct {
 								Placeholder: "",
 							},
 						},
+						&forms.Item{
+							Name:  "group",
+							Label: "Add these people to group (created if missing)",
+							Child: &forms.InputText{
+								Binding: forms.Var(&groupName),
+							},
+						},
 					},
 				},
 
@@ -149,6 +157,19 @@ func (app *App) handleAdminWhitelist(rc *mvp.RC, in *struct {
 	}
 
 	if in.IsSaving && form.ProcessRequest(rc.Request.Request) {
+		var group *m.UserGroup
+		if groupName = strings.TrimSpace(groupName); groupName != "" {
+			group = m.FindUserGroup(edb.All(edb.ExactIndexScan[m.UserGroup](rc, UserGroupsByAccount, accountID)), groupName)
+			if group == nil {
+				group = &m.UserGroup{
+					ID:           app.NewID(),
+					AccountID:    accountID,
+					Name:         groupName,
+					CreationTime: rc.Now,
+				}
+				edb.Put(rc, group)
+			}
+		}
 		for _, email := range strings.Fields(whitelistStr) {
 			canon := mvp.CanonicalEmail(email)
 			u := all[canon]
@@ -180,6 +201,9 @@ func (app *App) handleAdminWhitelist(rc *mvp.RC, in *struct {
 				memb.Status = m.UserStatusActive // TODO: invitation flow?
 				modified = true
 			}
+			if group != nil && memb.AddToGroup(group.ID) {
+				modified = true
+			}
 			if modified {
 				edb.Put(rc, u)
 			}
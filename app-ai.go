@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// aiProvider returns the AI backend: OpenAI, or an in-process fake when
+// Settings.FakeAI is set.
+func (app *App) aiProvider() m.Provider {
+	if app.Settings().FakeAI {
+		return app.fakeAI
+	}
+	return openAIProvider{app}
+}
+
+type openAIProvider struct {
+	app *App
+}
+
+func (p openAIProvider) ComputeEmbedding(ctx context.Context, text string, typ m.EmbeddingType) (m.Embedding, openai.Price, error) {
+	switch typ {
+	case m.EmbeddingTypeAda002:
+		embedding, usage, err := openai.ComputeEmbedding(ctx, text, p.app.httpClient, p.app.Settings().OpenAICreds)
+		if err != nil {
+			return nil, 0, fmt.Errorf("embeddings: %w", err)
+		}
+		return embedding, openai.Cost(usage.PromptTokens, usage.CompletionTokens, EmbeddingModel), nil
+	case m.EmbeddingTypeHash:
+		return m.HashEmbedding(text), 0, nil
+	default:
+		return nil, 0, fmt.Errorf("embeddings: unsupported embedding type %v", typ)
+	}
+}
+
+func (p openAIProvider) Chat(ctx context.Context, req *m.ChatRequest) (*m.ChatResponse, error) {
+	opt := openai.DefaultChatOptions()
+	opt.Model = req.Model
+	opt.MaxTokens = req.MaxTokens
+	opt.Temperature = req.Temperature
+	if req.Function != nil {
+		opt.Functions = []any{req.Function}
+		opt.FunctionCallMode = &openai.ForceFunctionCall{Name: req.FunctionName}
+	}
+
+	msgs, usage, err := openai.Chat(ctx, req.Messages, opt, p.app.httpClient, p.app.Settings().OpenAICreds)
+	resp := &m.ChatResponse{
+		Cost: openai.Cost(usage.PromptTokens, usage.CompletionTokens, opt.Model),
+	}
+	if err != nil {
+		return resp, err
+	}
+	if len(msgs) == 0 {
+		return resp, fmt.Errorf("ChatGPT returned no messages")
+	}
+	resp.Text = msgs[0].Content
+	if req.Function != nil {
+		err = msgs[0].UnmarshalCallArguments(&resp.FunctionArgs)
+		if err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
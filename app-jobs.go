@@ -6,8 +6,31 @@ import (
 )
 
 var (
-	jobProduceAnswer = jobSchema.Define("ProduceAnswer", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobProduceAnswer     = jobSchema.Define("ProduceAnswer", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobMigrateEmbeddings = jobSchema.Define("MigrateEmbeddings", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobReplayAnswers     = jobSchema.Define("ReplayAnswers", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobExtractMemories   = jobSchema.Define("ExtractMemories", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobEmbedMemories     = jobSchema.Define("EmbedMemories", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobRunCheckIns       = jobSchema.Define("RunCheckIns", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral, mvpjobs.Cron(everyMinute))
+	jobEmailAnswer       = jobSchema.Define("EmailAnswer", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobConnectorMessage  = jobSchema.Define("ConnectorMessage", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobCleanupSignIns    = jobSchema.Define("CleanupSignIns", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral, mvpjobs.Cron(everyMinute))
+	jobTouchSession      = jobSchema.Define("TouchSession", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral)
+	jobExpireSessions    = jobSchema.Define("ExpireSessions", nil, mvpjobs.Repeatable, mvpjobs.Ephemeral, mvpjobs.Cron(everyMinute))
 )
 
+// everyMinute is the schedule of the periodic jobs that act on a timetable
+// stored in the database (check-ins, reminders) or clean up expired state.
+const everyMinute = "* * * * *"
+
 func (app *App) registerJobs(b mvp.JobRegistry) {
+	b.RegisterHandler(jobRunCheckIns, func(rc *mvp.RC) error {
+		return app.runDueCheckIns(fullRC.From(rc))
+	})
+	b.RegisterHandler(jobCleanupSignIns, func(rc *mvp.RC) error {
+		return app.deleteExpiredSignInAttempts(fullRC.From(rc))
+	})
+	b.RegisterHandler(jobExpireSessions, func(rc *mvp.RC) error {
+		return app.deleteIdleSessions(fullRC.From(rc))
+	})
 }
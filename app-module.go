@@ -35,5 +35,6 @@ func setupHooks(app *App) {
 	app.Hooks.ResetAuth(expandable.Wrap2(resetAuth, fullApp, fullRC))
 	app.Hooks.PostAuth(expandable.Wrap2E(loadSessionAndUser, fullApp, fullRC))
 	app.Hooks.SiteRoutes(mvp.DefaultSite, app.registerRoutes)
+	app.Hooks.Jobs(app.registerJobs)
 	app.Hooks.Helpers(app.registerViewHelpers)
 }
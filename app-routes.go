@@ -7,6 +7,7 @@ func (app *App) registerRoutes(b *mvp.RouteBuilder) {
 
 	b.UseIn("authenticate", app.AuthenticateRequestMiddleware)
 	b.Use(app.initAccountMiddleware)
+	b.Use(app.readOnlyImpersonationMiddleware)
 
 	b.Route("landing.home", "GET /", app.showLandingHome)
 	b.Route("landing.signup", "POST /start", app.handleLandingSignup)
@@ -14,7 +15,19 @@ func (app *App) registerRoutes(b *mvp.RouteBuilder) {
 	b.Route("test", "GET /test/", app.showTestPage)
 	b.Route("signin", "GET /signin/", app.showSignIn)
 	b.Route("signin.process", "POST /signin/", app.handleSignIn, mvp.RateLimitPresetSpam)
+	b.Route("signin.passkey", "POST /signin/passkey/", app.startPasskeySignIn, mvp.RateLimitPresetSpam)
+	b.Route("signin.passkey.verify", "POST /signin/passkey/verify", app.handlePasskeySignIn, mvp.RateLimitPresetSpam)
 	b.Route("signout", "POST /signout/", app.handleSignOut)
+	b.Route("impersonation.stop", "POST /impersonation/stop", app.stopImpersonation)
+
+	b.Route("sso.start", "POST /sso/:account/", app.startSSO, mvp.RateLimitPresetSpam)
+	b.Route("sso.oidc.callback", "GET /sso/:account/oidc/callback", app.showOIDCCallback)
+	b.Route("sso.oidc.finish", "POST /sso/:account/oidc/callback", app.finishOIDC)
+	b.Route("sso.saml.acs", "POST /sso/:account/saml/acs", app.handleSAMLResponse)
+	b.Route("sso.saml.metadata", "GET /sso/:account/saml/metadata", app.showSAMLMetadata)
+
+	b.Route("webhooks.postmark.inbound", "POST /webhooks/postmark/inbound/:token", app.handlePostmarkInbound)
+	b.Route("webhooks.connector", "POST /webhooks/connectors/:connector", app.handleConnectorWebhook)
 
 	b.Route("switch_account.show", "GET /accounts/", app.showAccountSwitcher)
 	b.Route("switch_account", "POST /accounts/:newaccount/switch", app.switchAccount)
@@ -31,17 +44,56 @@ func (app *App) registerRoutes(b *mvp.RouteBuilder) {
 		b.Route("chat.view", "GET /c/:chat", app.showChat)
 		b.Route("chat.messages.send", "POST /c/:chat/send", app.sendChatMessage)
 		b.Route("chat.messages.action", "POST /c/:chat/m/:message/action", app.markChatMessage)
+		b.Route("chat.typing", "POST /c/:chat/typing", app.handleChatTyping)
 		b.Route("chat.action", "POST /c/:chat/:action", app.handleChatAction)
 
-		b.Route("chat.sse", "GET /c/:chat/events/", app.handleChatEventStream).UseIn("authorize", nil)
+		b.Route("chat.sse", "GET /c/:chat/events/", app.handleChatEventStream)
+
+		b.Route("connect", "GET /connect/:connector", app.showConnectorLink)
+		b.Route("connect.start", "POST /connect/:connector", app.startConnectorLink)
+	})
+
+	b.Group("/memory", func(b *mvp.RouteBuilder) {
+		b.UseIn("authorize", requireLoggedIn)
+		b.Use(loadUserChatListMiddleware)
+
+		b.Route("memory.list", "GET /", app.showUserMemories)
+		b.Route("memory.clear", "POST /clear", app.clearUserMemories)
+		b.Route("memory.save", "POST /:memory/", app.saveUserMemory)
+		b.Route("memory.delete", "POST /:memory/delete", app.deleteUserMemory)
+	})
+
+	b.Group("/account", func(b *mvp.RouteBuilder) {
+		b.UseIn("authorize", requireLoggedIn)
+		b.Use(loadUserChatListMiddleware)
+
+		b.Route("passkeys.list", "GET /passkeys/", app.listPasskeys)
+		b.Route("passkeys.new", "POST /passkeys/new", app.startPasskeyRegistration)
+		b.Route("passkeys.register", "POST /passkeys/", app.registerPasskey)
+		b.Route("passkeys.delete", "POST /passkeys/:passkey/delete", app.deletePasskey)
+
+		b.Route("sessions.list", "GET /sessions/", app.listSessions)
+		b.Route("sessions.revoke_all", "POST /sessions/revoke-all", app.revokeAllSessions)
+		b.Route("sessions.revoke", "POST /sessions/:session/revoke", app.revokeSession)
+	})
+
+	b.Group("/checkins", func(b *mvp.RouteBuilder) {
+		b.UseIn("authorize", requireLoggedIn)
+		b.Use(loadUserChatListMiddleware)
+
+		b.Route("checkins.list", "GET /", app.showCheckIns)
+		b.Route("checkins.save", "POST /:kind/", app.saveCheckIn)
+		b.Route("checkins.action", "POST /:kind/:action", app.handleCheckInAction)
 	})
 
 	b.Group("/lib", func(b *mvp.RouteBuilder) {
-		b.UseIn("authorize", requireAdmin)
+		b.UseIn("authorize", requireLibraryAccess)
 		b.Use(loadAccountLibraryMiddleware)
 
 		b.Route("lib.home", "GET /", app.showLibraryRootFolder)
 		b.Route("lib.folder", "GET /folders/:folder/", app.showLibraryFolder)
+		b.Route("lib.folder.access", "GET /folders/:folder/access", app.handleLibraryFolderAccess)
+		b.Route("lib.folder.access.save", "POST /folders/:folder/access", app.handleLibraryFolderAccess)
 		b.Route("lib.item", "GET /items/:item/", app.showLibraryItem)
 	})
 
@@ -50,7 +102,19 @@ func (app *App) registerRoutes(b *mvp.RouteBuilder) {
 		b.Use(loadAllChatListMiddleware)
 
 		b.Route("mod.activity", "GET /", app.showAccountActivity)
+		b.Route("mod.filter", "POST /filter", app.setModChatFilter)
 		b.Route("mod.chat.view", "GET /c/:chat", app.showModChat)
+		b.Route("mod.chat.sse", "GET /c/:chat/events/", app.handleModChatEventStream)
+		b.Route("mod.chat.takeover", "POST /c/:chat/takeover", app.takeOverChat)
+		b.Route("mod.chat.handback", "POST /c/:chat/handback", app.handBackChat)
+		b.Route("mod.chat.send", "POST /c/:chat/send", app.sendStaffMessage)
+		b.Route("mod.chat.notes.add", "POST /c/:chat/notes/", app.addChatNote)
+		b.Route("mod.chat.notes.delete", "POST /c/:chat/notes/:note/delete", app.deleteChatNote)
+
+		b.Route("mod.replays", "GET /replays/", app.listReplayRuns)
+		b.Route("mod.replays.new", "GET /replays/new/", app.handleNewReplayRun)
+		b.Route("mod.replays.create", "POST /replays/new/", app.handleNewReplayRun)
+		b.Route("mod.replays.view", "GET /replays/:run/", app.showReplayRun)
 	})
 
 	b.Group("/admin", func(b *mvp.RouteBuilder) {
@@ -59,12 +123,48 @@ func (app *App) registerRoutes(b *mvp.RouteBuilder) {
 		b.Route("admin.users", "GET /", app.listAdminUsers)
 		b.Route("admin.whitelist", "GET /whitelist/", app.handleAdminWhitelist)
 		b.Route("admin.whitelist.save", "POST /whitelist/", app.handleAdminWhitelist)
+		b.Route("admin.settings", "GET /settings/", app.handleAdminSettings)
+		b.Route("admin.settings.save", "POST /settings/", app.handleAdminSettings)
+
+		b.Route("admin.domains", "GET /domains/", app.listAdminDomains)
+		b.Route("admin.domains.add", "POST /domains/", app.addAdminDomain)
+		b.Route("admin.domains.verify", "POST /domains/:domain/verify", app.verifyAdminDomain)
+		b.Route("admin.domains.delete", "POST /domains/:domain/delete", app.deleteAdminDomain)
+
+		b.Route("admin.sso", "GET /sso/", app.handleAdminSSO)
+		b.Route("admin.sso.save", "POST /sso/", app.handleAdminSSO)
+
+		b.Route("admin.connectors", "GET /connectors/", app.listAdminConnectors)
+		b.Route("admin.connectors.new", "GET /connectors/new/", app.handleNewConnectorForm)
+		b.Route("admin.connectors.new.save", "POST /connectors/new/", app.handleNewConnectorForm)
+		b.Route("admin.connectors.edit", "GET /connectors/:connector/", app.handleConnectorForm)
+		b.Route("admin.connectors.save", "POST /connectors/:connector/", app.handleConnectorForm)
+		b.Route("admin.connectors.delete", "POST /connectors/:connector/delete", app.deleteConnector)
+
+		b.Route("admin.groups", "GET /groups/", app.listAdminGroups)
+		b.Route("admin.groups.new", "GET /groups/new/", app.handleNewGroupForm)
+		b.Route("admin.groups.new.save", "POST /groups/new/", app.handleNewGroupForm)
+		b.Route("admin.groups.edit", "GET /groups/:group/", app.handleGroupForm)
+		b.Route("admin.groups.save", "POST /groups/:group/", app.handleGroupForm)
+		b.Route("admin.groups.delete", "POST /groups/:group/delete", app.deleteGroup)
+
+		b.Route("admin.golden", "GET /golden/", app.listGoldenSets)
+		b.Route("admin.golden.new", "GET /golden/new/", app.handleNewGoldenSetForm)
+		b.Route("admin.golden.new.save", "POST /golden/new/", app.handleNewGoldenSetForm)
+		b.Route("admin.golden.edit", "GET /golden/:set/", app.handleGoldenSetForm)
+		b.Route("admin.golden.save", "POST /golden/:set/", app.handleGoldenSetForm)
+
+		b.Route("admin.duplicates", "GET /duplicates/", app.listContentDuplicates)
+		b.Route("admin.duplicates.action", "POST /duplicates/:dup/", app.handleContentDuplicateAction)
 	})
 
 	b.Group("/superadmin", func(b *mvp.RouteBuilder) {
 		b.UseIn("authorize", requireSuperadmin)
 
 		b.Route("superadmin.accounts", "GET /", app.listSuperadminAccounts)
+		b.Route("superadmin.waitlist.approve", "POST /waitlist/:waitlister/approve", app.approveWaitlister)
+		b.Route("superadmin.impersonate", "POST /users/:user/impersonate", app.startImpersonation)
+		b.Route("superadmin.audit", "GET /audit/", app.showAuditLog)
 		// b.Route("superadmin.superadmins.save", "POST /superadmins/", app.saveSuperadmin)
 
 		b.Group("/maintenance", func(b *mvp.RouteBuilder) {
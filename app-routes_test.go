@@ -0,0 +1,94 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// unauthorizedGroups lists the route groups that deliberately have no
+// authorize middleware of their own.
+var unauthorizedGroups = map[string]bool{
+	"/funcs": true, // view funcs check access themselves
+}
+
+// TestRouteGroupsAuthorize makes sure that every route group in
+// registerRoutes, or a group enclosing it, installs an authorize middleware,
+// so that forgetting one doesn't silently open a group to anonymous users.
+func TestRouteGroupsAuthorize(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "app-routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checkGroups func(body *ast.BlockStmt, authorized bool)
+	checkGroups = func(body *ast.BlockStmt, authorized bool) {
+		for _, stmt := range body.List {
+			call := builderCall(stmt, "Group")
+			if call == nil || len(call.Args) != 2 {
+				continue
+			}
+			var prefix string
+			if lit, ok := call.Args[0].(*ast.BasicLit); ok {
+				prefix, _ = strconv.Unquote(lit.Value)
+			}
+			fn, ok := call.Args[1].(*ast.FuncLit)
+			if !ok {
+				t.Errorf("%s: group %s is not a function literal", fset.Position(call.Pos()), prefix)
+				continue
+			}
+			groupAuthorized := authorized || hasAuthorize(fn.Body)
+			if !groupAuthorized && !unauthorizedGroups[prefix] {
+				t.Errorf("%s: group %s has no authorize middleware", fset.Position(call.Pos()), prefix)
+			}
+			checkGroups(fn.Body, groupAuthorized)
+		}
+	}
+
+	var found bool
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "registerRoutes" {
+			found = true
+			checkGroups(fn.Body, false)
+		}
+	}
+	if !found {
+		t.Fatalf("registerRoutes not found")
+	}
+}
+
+func hasAuthorize(body *ast.BlockStmt) bool {
+	for _, stmt := range body.List {
+		call := builderCall(stmt, "UseIn")
+		if call == nil || len(call.Args) != 2 {
+			continue
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Value == `"authorize"` {
+			return true
+		}
+	}
+	return false
+}
+
+// builderCall returns stmt if it is a b.<method>(...) call.
+func builderCall(stmt ast.Stmt, method string) *ast.CallExpr {
+	expr, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return nil
+	}
+	call, ok := expr.X.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != method {
+		return nil
+	}
+	if recv, ok := sel.X.(*ast.Ident); !ok || recv.Name != "b" {
+		return nil
+	}
+	return call
+}
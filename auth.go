@@ -25,6 +25,10 @@ func loadSessionAndUser(app *App, rc *RC) error {
 		if rc.Session == nil {
 			return fmt.Errorf("session no longer exists")
 		}
+		if !rc.Session.IsActive(rc.Now, app.Settings().SessionIdleTimeout.Value()) {
+			return fmt.Errorf("session has been signed out or has expired")
+		}
+		app.noteSessionActivity(rc)
 	}
 	if auth.ActorRef.Type == mvpm.TypeUser {
 		rc.OriginalUser = edb.Get[m.User](rc, auth.ActorRef.ID)
@@ -70,6 +74,16 @@ func requireAdmin(rc *RC) (any, error) {
 	return nil, nil
 }
 
+func requireLibraryAccess(rc *RC) (any, error) {
+	if !rc.IsLoggedIn() {
+		return rc.App().Redirect("signin"), nil
+	}
+	if err := rc.Check(m.PermissionViewLibrary, nil); err != nil {
+		return nil, mvp.ErrForbidden.Wrap(err)
+	}
+	return nil, nil
+}
+
 func requireLoggedIn(rc *RC) (any, error) {
 	if !rc.IsLoggedIn() {
 		return redirectToLogIn(rc), nil
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+	"github.com/andreyvit/openai"
+
+	"github.com/andreyvit/buddyd/internal/connectors"
+	m "github.com/andreyvit/buddyd/model"
+)
+
+const (
+	maxWebhookBodySize = 1 << 20
+
+	// connectorStreamInterval throttles the edits of an answer being streamed
+	// into Slack or Telegram, which rate-limit message updates.
+	connectorStreamInterval = 1500 * time.Millisecond
+
+	connectorPendingSuffix = " …"
+
+	// connectorLinkTTL is how long a Telegram link token stays usable.
+	connectorLinkTTL = 15 * time.Minute
+)
+
+// watchChatStream calls fn with the text of the bot answer being streamed in
+// the chat, until the returned stop function is called.
+func (app *App) watchChatStream(chatID m.ChatID, fn func(text string)) (stop func()) {
+	app.chatStreamMut.Lock()
+	defer app.chatStreamMut.Unlock()
+	if app.chatStreamListeners == nil {
+		app.chatStreamListeners = make(map[m.ChatID]func(string))
+	}
+	app.chatStreamListeners[chatID] = fn
+	return func() {
+		app.chatStreamMut.Lock()
+		defer app.chatStreamMut.Unlock()
+		delete(app.chatStreamListeners, chatID)
+	}
+}
+
+func (app *App) notifyChatStream(chatID m.ChatID, text string) {
+	app.chatStreamMut.Lock()
+	fn := app.chatStreamListeners[chatID]
+	app.chatStreamMut.Unlock()
+	if fn != nil {
+		fn(text)
+	}
+}
+
+func (app *App) connectorClient(conn *m.Connector) connectors.Client {
+	switch conn.Kind {
+	case m.ConnectorKindSlack:
+		return &connectors.SlackClient{BaseURL: conn.APIBaseURL, Token: conn.BotToken, HTTPClient: app.httpClient}
+	case m.ConnectorKindTelegram:
+		return &connectors.TelegramClient{BaseURL: conn.APIBaseURL, Token: conn.BotToken, HTTPClient: app.httpClient}
+	default:
+		panic(fmt.Errorf("unsupported connector kind %v", conn.Kind))
+	}
+}
+
+// handleConnectorWebhook receives Slack events and Telegram updates. Answering
+// takes longer than the platforms are willing to wait, so it happens in a job.
+func (app *App) handleConnectorWebhook(rc *RC, in *struct {
+	ConnectorID flake.ID `form:"connector,path" json:"-"`
+}) (any, error) {
+	conn := edb.Get[m.Connector](rc, in.ConnectorID)
+	if conn == nil || conn.Disabled {
+		return nil, httperrors.NotFound
+	}
+	req := rc.Request.Request
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	var msg *connectors.Message
+	switch conn.Kind {
+	case m.ConnectorKindSlack:
+		if err := connectors.VerifySlackSignature(conn.Secret, req.Header, body, rc.Now); err != nil {
+			return nil, httperrors.Errorf(401, "", "%v", err)
+		}
+		env, err := connectors.ParseSlackEnvelope(body)
+		if err != nil {
+			return nil, httperrors.BadRequest.Msg(err.Error())
+		}
+		if env.Type == "url_verification" {
+			rc.RespWriter.Header().Set("Content-Type", "text/plain")
+			rc.RespWriter.Write([]byte(env.Challenge))
+			return mvp.ResponseHandled{}, nil
+		}
+		if !connectors.IsSlackRetry(req.Header) {
+			msg, _ = env.UserMessage()
+		}
+	case m.ConnectorKindTelegram:
+		if err := connectors.VerifyTelegramSecret(conn.Secret, req.Header); err != nil {
+			return nil, httperrors.Errorf(401, "", "%v", err)
+		}
+		upd, err := connectors.ParseTelegramUpdate(body)
+		if err != nil {
+			return nil, httperrors.BadRequest.Msg(err.Error())
+		}
+		msg, _ = upd.UserMessage(conn.BotUsername)
+	}
+
+	if msg != nil {
+		app.EnqueueConnectorMessage(rc, conn.ID, msg)
+	}
+	rc.RespWriter.WriteHeader(http.StatusOK)
+	return mvp.ResponseHandled{}, nil
+}
+
+func (app *App) EnqueueConnectorMessage(rc *RC, connID m.ConnectorID, msg *connectors.Message) {
+	key := m.ConnectorKey(connID, msg.Conversation+"/"+msg.MessageID)
+	app.EnqueueEphemeral(jobConnectorMessage, key, func(rc *mvp.RC) error {
+		return app.runConnectorMessage(fullRC.From(rc), connID, msg)
+	})
+}
+
+func (app *App) runConnectorMessage(rc *RC, connID m.ConnectorID, msg *connectors.Message) error {
+	var conn *m.Connector
+	app.MustRead(rc.BaseRC(), func() {
+		conn = edb.Get[m.Connector](rc, connID)
+	})
+	if conn == nil || conn.Disabled {
+		return nil
+	}
+	client := app.connectorClient(conn)
+	reply := func(text string) error {
+		_, err := client.Post(rc, msg.Conversation, msg.Thread, text)
+		return err
+	}
+
+	if param, ok := connectors.StartParam(msg.Text); ok && conn.Kind == m.ConnectorKindTelegram {
+		user, err := app.linkTelegramUser(rc, conn, msg, param)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return reply("This link is invalid or has expired. Please open the Telegram link from your LibroAI account again.")
+		}
+		return reply(fmt.Sprintf("Hi %s, you're all set. Ask me anything!", user.FirstName()))
+	}
+
+	user, err := app.resolveConnectorUser(rc, conn, client, msg)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		if conn.Kind == m.ConnectorKindTelegram {
+			return reply(fmt.Sprintf("To chat with me here, link your LibroAI account first: %s", app.connectorLinkURL(conn)))
+		}
+		return reply("I couldn't find a LibroAI account for your email. Please ask your admin to invite you.")
+	}
+	if openai.TokenCount(msg.Text, DefaultModel) > MaxMsgTokenCount {
+		return reply("Sorry, this message is too long for me.")
+	}
+	var limitErr error
+	app.MustRead(rc.BaseRC(), func() {
+		limitErr = checkMonthlyLimit(rc, conn.AccountID, user)
+	})
+	if limitErr != nil {
+		return reply(fmt.Sprintf("Sorry, %v.", limitErr))
+	}
+
+	threadKey := m.ConnectorKey(conn.ID, msg.ThreadKey())
+	var chat *m.Chat
+	var cc *m.ChatContent
+	err = app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		chat = edb.Lookup[m.Chat](rc, ChatsByExternalThread, threadKey)
+		if chat == nil {
+			chat = &m.Chat{
+				ID:             app.NewID(),
+				AccountID:      conn.AccountID,
+				UserID:         user.ID,
+				ConnectorID:    conn.ID,
+				ExternalThread: threadKey,
+			}
+		}
+		cc = loadChatContent(rc, chat.ID)
+		app.addUserMsg(app.addTurn(cc, m.MessageRoleUser), msg.Text)
+		if u := edb.Get[m.User](rc, user.ID); u != nil {
+			countQuestion(rc, conn.AccountID, u)
+		}
+		if !chat.BotPaused {
+			app.addBotPendingMsg(app.addTurn(cc, m.MessageRoleBot))
+		}
+		edb.Put(rc, chat, cc)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	pushChatContent(rc, chat, cc)
+	if chat.BotPaused {
+		return nil
+	}
+	return app.answerOnConnector(rc, client, msg, chat.ID)
+}
+
+// answerOnConnector runs the rollforward, streaming the answer into a
+// placeholder message on the platform.
+func (app *App) answerOnConnector(rc *RC, client connectors.Client, msg *connectors.Message, chatID m.ChatID) error {
+	replyID, err := client.Post(rc, msg.Conversation, msg.Thread, strings.TrimSpace(connectorPendingSuffix))
+	if err != nil {
+		// still answer in the web UI
+		flogger.Log(rc, "WARNING: posting to connector failed: %v", err)
+	}
+
+	var lastEdit time.Time
+	stop := app.watchChatStream(chatID, func(text string) {
+		if replyID == "" || time.Since(lastEdit) < connectorStreamInterval {
+			return
+		}
+		lastEdit = time.Now()
+		if err := client.Edit(rc, msg.Conversation, replyID, text+connectorPendingSuffix); err != nil {
+			flogger.Log(rc, "WARNING: streaming to connector failed: %v", err)
+		}
+	})
+	err = app.runChatRollforward(rc, chatID)
+	stop()
+	if err != nil {
+		flogger.Log(rc, "WARNING: answering connector message failed: %v", err)
+	}
+
+	text := "Sorry, I couldn't answer that. Please try again."
+	app.MustRead(rc.BaseRC(), func() {
+		cc := loadChatContent(rc, chatID)
+		if t := cc.LastTurn(); t != nil {
+			if last := t.LastMessage(); last.Role == m.MessageRoleBot && last.State == m.MessageStateFinished && last.Text != "" {
+				text = last.Text
+			}
+		}
+	})
+	if replyID == "" {
+		_, err = client.Post(rc, msg.Conversation, msg.Thread, text)
+	} else {
+		err = client.Edit(rc, msg.Conversation, replyID, text)
+	}
+	return err
+}
+
+// resolveConnectorUser finds the LibroAI user behind a platform user. Slack
+// users are matched by email; Telegram users have to link their account.
+func (app *App) resolveConnectorUser(rc *RC, conn *m.Connector, client connectors.Client, msg *connectors.Message) (*m.User, error) {
+	var user *m.User
+	app.MustRead(rc.BaseRC(), func() {
+		if ident := edb.Lookup[m.ConnectorIdentity](rc, ConnectorIdentitiesByKey, m.ConnectorKey(conn.ID, msg.UserID)); ident != nil {
+			user = edb.Get[m.User](rc, ident.UserID)
+		}
+	})
+	if user != nil {
+		return activeMember(user, conn.AccountID), nil
+	}
+
+	slack, ok := client.(*connectors.SlackClient)
+	if !ok {
+		return nil, nil
+	}
+	email, err := slack.UserEmail(rc, msg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if email == "" {
+		return nil, nil
+	}
+	err = app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		user = activeMember(edb.Lookup[m.User](rc, UsersByEmail, mvp.CanonicalEmail(email)), conn.AccountID)
+		if user != nil {
+			app.putConnectorIdentity(rc, conn, msg.UserID, user.ID)
+		}
+		return nil
+	})
+	return user, err
+}
+
+// linkTelegramUser consumes a one-time link token handed out by
+// startConnectorLink, whether or not the link succeeds.
+func (app *App) linkTelegramUser(rc *RC, conn *m.Connector, msg *connectors.Message, token string) (*m.User, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, nil
+	}
+	var user *m.User
+	err := app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		link := edb.Get[m.ConnectorLink](rc, token)
+		if link == nil {
+			return nil
+		}
+		rc.DBTx().DeleteByKey(ConnectorLinks, link.Token)
+		if link.ConnectorID != conn.ID || link.IsExpired(rc.Now) {
+			return nil
+		}
+		user = activeMember(edb.Get[m.User](rc, link.UserID), conn.AccountID)
+		if user != nil {
+			app.putConnectorIdentity(rc, conn, msg.UserID, user.ID)
+		}
+		return nil
+	})
+	return user, err
+}
+
+func (app *App) putConnectorIdentity(rc *RC, conn *m.Connector, externalUserID string, userID m.UserID) {
+	ident := edb.Lookup[m.ConnectorIdentity](rc, ConnectorIdentitiesByKey, m.ConnectorKey(conn.ID, externalUserID))
+	if ident == nil {
+		ident = &m.ConnectorIdentity{
+			ID:             app.NewID(),
+			ConnectorID:    conn.ID,
+			ExternalUserID: externalUserID,
+			CreationTime:   rc.Now,
+		}
+	}
+	ident.UserID = userID
+	edb.Put(rc, ident)
+}
+
+func activeMember(user *m.User, accountID m.AccountID) *m.User {
+	if user == nil {
+		return nil
+	}
+	if memb := user.Membership(accountID); memb == nil || !memb.Status.ActiveOrInvited() {
+		return nil
+	}
+	return user
+}
+
+func (app *App) connectorLinkURL(conn *m.Connector) string {
+	return strings.TrimSuffix(app.Settings().BaseURL, "/") + app.URL("connect", ":connector", conn.ID)
+}
+
+// showConnectorLink asks a signed-in user to confirm linking their Telegram
+// account. The link token is only created on confirmation, since GET requests
+// cannot write.
+func (app *App) showConnectorLink(rc *RC, in *struct {
+	ConnectorID flake.ID `form:"connector,path" json:"-"`
+}) (any, error) {
+	conn := loadLinkableConnector(rc, in.ConnectorID)
+	if conn == nil {
+		return nil, httperrors.NotFound
+	}
+	return &mvp.ViewData{
+		View:  "chat/connect",
+		Title: "Link Telegram",
+		Data: struct {
+			Connector *m.Connector
+		}{
+			Connector: conn,
+		},
+	}, nil
+}
+
+// startConnectorLink sends the user to the Telegram bot with a one-time token
+// that links their Telegram account.
+func (app *App) startConnectorLink(rc *RC, in *struct {
+	ConnectorID flake.ID `form:"connector,path" json:"-"`
+}) (any, error) {
+	conn := loadLinkableConnector(rc, in.ConnectorID)
+	if conn == nil {
+		return nil, httperrors.NotFound
+	}
+	link := &m.ConnectorLink{
+		Token:       randomConnectorSecret(),
+		ConnectorID: conn.ID,
+		UserID:      rc.UserID(),
+		ExpiryTime:  rc.Now.Add(connectorLinkTTL),
+	}
+	edb.Put(rc, link)
+	return &mvp.Redirect{
+		Path: fmt.Sprintf("https://t.me/%s?start=%s", conn.BotUsername, link.Token),
+	}, nil
+}
+
+func loadLinkableConnector(rc *RC, id m.ConnectorID) *m.Connector {
+	conn := edb.Get[m.Connector](rc, id)
+	if conn == nil || conn.Disabled || conn.AccountID != rc.AccountID() || conn.Kind != m.ConnectorKindTelegram || conn.BotUsername == "" {
+		return nil
+	}
+	return conn
+}
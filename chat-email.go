@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// chatReplyAddress returns the address that routes email replies into the
+// chat, or an empty string if inbound email isn't configured.
+func (app *App) chatReplyAddress(chatID m.ChatID) string {
+	settings := app.Settings()
+	if settings.InboundEmailDomain == "" || settings.InboundEmailSecret == "" {
+		return ""
+	}
+	return m.ChatReplyMailbox(settings.InboundEmailSecret, chatID) + "@" + settings.InboundEmailDomain
+}
+
+// handlePostmarkInbound accepts email replies forwarded by Postmark. Postmark
+// retries on errors, so emails we cannot use are logged and acknowledged.
+func (app *App) handlePostmarkInbound(rc *RC, in *struct {
+	Token string `form:"token,path" json:"-"`
+	m.PostmarkInboundEmail
+}) (any, error) {
+	secret := app.Settings().InboundEmailSecret
+	if !m.InboundEmailTokenMatches(in.Token, secret) {
+		return nil, httperrors.NotFound
+	}
+	email := &in.PostmarkInboundEmail
+	err := app.acceptEmailReply(rc, email, secret)
+	if err != nil {
+		flogger.Log(rc, "WARNING: ignoring inbound email %s from %s: %v", email.MessageID, email.FromFull.Email, err)
+	}
+	rc.RespWriter.WriteHeader(http.StatusOK)
+	return mvp.ResponseHandled{}, nil
+}
+
+func (app *App) acceptEmailReply(rc *RC, email *m.PostmarkInboundEmail, secret string) error {
+	reply, err := email.AcceptReply(secret, emailReplyStore{rc})
+	if err != nil {
+		return err
+	}
+	if openai.TokenCount(reply.Text, DefaultModel) > MaxMsgTokenCount {
+		return fmt.Errorf("message too long")
+	}
+	chat, sender := reply.Chat, reply.Sender
+	if err := checkMonthlyLimit(rc, chat.AccountID, sender); err != nil {
+		return err
+	}
+
+	cc := loadChatContent(rc, chat.ID)
+	app.addUserMsg(app.addTurn(cc, m.MessageRoleUser), reply.Text)
+	countQuestion(rc, chat.AccountID, sender)
+	if reply.WakesBot() {
+		app.addBotPendingMsg(app.addTurn(cc, m.MessageRoleBot))
+	}
+	edb.Put(rc, chat, cc)
+	pushChatContent(rc, chat, cc)
+
+	flogger.Log(rc, "Accepted email reply from %s into chat %v", sender.Email, chat.ID)
+	if reply.WakesBot() {
+		app.EnqueueEmailAnswer(rc, chat.ID)
+	}
+	return nil
+}
+
+// emailReplyStore looks up email reply records in the database.
+type emailReplyStore struct {
+	rc *RC
+}
+
+func (s emailReplyStore) Chat(id m.ChatID) *m.Chat {
+	return edb.Get[m.Chat](s.rc, id)
+}
+
+func (s emailReplyStore) UserByEmail(email string) *m.User {
+	return edb.Lookup[m.User](s.rc, UsersByEmail, mvp.CanonicalEmail(email))
+}
+
+func (s emailReplyStore) Account(id m.AccountID) *m.Account {
+	return edb.Get[m.Account](s.rc, id)
+}
+
+// EnqueueEmailAnswer produces the answer to an email reply and sends it back
+// by email.
+func (app *App) EnqueueEmailAnswer(rc *RC, chatID m.ChatID) {
+	app.EnqueueEphemeral(jobEmailAnswer, chatID.String(), func(rc *mvp.RC) error {
+		return app.runEmailAnswer(fullRC.From(rc), chatID)
+	})
+}
+
+func (app *App) runEmailAnswer(rc *RC, chatID m.ChatID) error {
+	err := app.runChatRollforward(rc, chatID)
+	if err != nil {
+		return err
+	}
+
+	var chat *m.Chat
+	var user *m.User
+	var text string
+	app.MustRead(rc.BaseRC(), func() {
+		chat = edb.Get[m.Chat](rc, chatID)
+		user = edb.Get[m.User](rc, chat.UserID)
+		cc := loadChatContent(rc, chatID)
+		if n := len(cc.Turns); n > 0 {
+			msg := cc.Turns[n-1].LastMessage()
+			if msg.Role == m.MessageRoleBot && msg.State == m.MessageStateFinished {
+				text = msg.Text
+			}
+		}
+	})
+	if user == nil || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	app.emailBotMessage(rc, user, chat, "Re: "+chat.TitleWithFallback(), text, "reply")
+	return nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/andreyvit/edb"
 	"github.com/andreyvit/mvp"
@@ -51,11 +53,13 @@ func (app *App) doShowChat(rc *RC, chat *m.Chat) (*mvp.ViewData, error) {
 func (app *App) showModChat(rc *RC, in *struct {
 	ChatID flake.ID `form:"chat,path" json:"-"`
 }) (*mvp.ViewData, error) {
-	chat, err := loadChat(rc, in.ChatID, false)
+	chat, err := loadModChat(rc, in.ChatID)
 	if err != nil {
 		return nil, err
 	}
 	content := loadChatContent(rc, chat.ID)
+	chatVM := m.WrapChat(chat, content)
+	chatVM.SetModeratorView()
 	return &mvp.ViewData{
 		View:         "chat/chat",
 		Title:        "Chat",
@@ -64,10 +68,12 @@ func (app *App) showModChat(rc *RC, in *struct {
 			IsModerator bool
 			IsNewChat   bool
 			Chat        *m.ChatVM
+			Notes       []*m.ChatNoteVM
 		}{
 			IsModerator: true,
 			IsNewChat:   false,
-			Chat:        m.WrapChat(chat, content),
+			Chat:        chatVM,
+			Notes:       loadChatNotes(rc, content),
 		},
 	}, nil
 }
@@ -87,20 +93,35 @@ func (app *App) sendChatMessage(rc *RC, in *struct {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkMonthlyLimit(rc, rc.AccountID(), rc.User); err != nil {
+		return nil, httperrors.Errorf(429, "", "Sorry, %v.", err)
+	}
 	cc := loadChatContent(rc, chat.ID)
 	if chat.ID == 0 {
 		chat.ID = app.NewID()
 		cc.ChatID = chat.ID
+
+		// starting a new chat ends the previous conversation
+		if rc.Account.UserMemory && len(rc.Chats) > 0 {
+			app.EnqueueMemoryExtraction(rc, rc.Chats[0].ID)
+		}
 	}
 
 	userTurn := app.addTurn(cc, m.MessageRoleUser)
 	app.addUserMsg(userTurn, in.Message)
+	countQuestion(rc, rc.AccountID(), rc.User)
 
-	botTurn := app.addTurn(cc, m.MessageRoleBot)
-	app.addBotPendingMsg(botTurn)
+	if !chat.BotPaused {
+		botTurn := app.addTurn(cc, m.MessageRoleBot)
+		app.addBotPendingMsg(botTurn)
+	}
 
 	edb.Put(rc, chat, cc)
 	app.EnqueueChatRollforward(rc, chat.ID)
+	pushChatContent(rc, chat, cc)
+	pushPresence(rc, chat.ID, &m.PresenceVM{
+		ElementID: m.TypingPresenceElementID,
+	})
 
 	return app.Redirect("chat.view", ":chat", chat.ID), nil
 }
@@ -123,6 +144,9 @@ func (app *App) markChatMessage(rc *RC, in *struct {
 	var rollforward bool
 	switch in.Action {
 	case "regen":
+		if chat.BotPaused {
+			return nil, httperrors.BadRequest.Msg("a coach has taken over this chat")
+		}
 		if !turn.IsLastMessagePending() {
 			app.addBotPendingMsg(turn)
 		}
@@ -145,10 +169,30 @@ func (app *App) markChatMessage(rc *RC, in *struct {
 	if rollforward {
 		app.EnqueueChatRollforward(rc, chat.ID)
 	}
+	pushChatContent(rc, chat, cc)
 
 	return app.Redirect("chat.view", ":chat", chat.ID), nil
 }
 
+// typingPresenceDuration is how long a "typing" line stays up after the last notification.
+const typingPresenceDuration = 6 * time.Second
+
+func (app *App) handleChatTyping(rc *RC, in *struct {
+	ChatID flake.ID `form:"chat,path" json:"-"`
+}) (any, error) {
+	chat := must(loadChat(rc, in.ChatID, false))
+	if chat.UserID != rc.UserID() {
+		return nil, httperrors.BadRequest.Msg("only the author can type in this chat")
+	}
+	pushPresence(rc, chat.ID, &m.PresenceVM{
+		ElementID: m.TypingPresenceElementID,
+		Text:      fmt.Sprintf("%s is typing…", rc.User.FirstName()),
+		Until:     rc.Now.Add(typingPresenceDuration),
+	})
+	rc.RespWriter.WriteHeader(http.StatusNoContent)
+	return mvp.ResponseHandled{}, nil
+}
+
 func (app *App) handleChatAction(rc *RC, in *struct {
 	ChatID flake.ID `form:"chat,path" json:"-"`
 	Action string   `form:"action,path" json:"-"`
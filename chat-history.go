@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp/flogger"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// chatHistory describes which earlier turns of a chat are sent to the model.
+type chatHistory struct {
+	Summary *m.ChatSummary // nil if nothing has been summarized yet
+	Start   int            // turns [Start, End) are sent verbatim
+	End     int
+	Dropped int // turns that are neither summarized nor sent
+
+	Turns []*m.RecordedMsg // all turns before End
+}
+
+func (h *chatHistory) RecordedSummary() *m.RecordedMsg {
+	if h.Summary == nil || h.Summary.Text == "" {
+		return nil
+	}
+	return &m.RecordedMsg{
+		Role: m.MessageRoleSystem,
+		Text: chatSummaryIntro + h.Summary.Text,
+	}
+}
+
+// AppendToolCalls accounts for tool turns inserted right after the history.
+func (h *chatHistory) AppendToolCalls(calls []*m.ToolCall) {
+	for _, call := range calls {
+		h.Turns = append(h.Turns, &m.RecordedMsg{Role: m.MessageRoleTool, Text: call.Transcript()})
+	}
+	h.End += len(calls)
+}
+
+func (h *chatHistory) Stats() *m.PromptStats {
+	return &m.PromptStats{
+		VerbatimTurns:   h.End - h.Start,
+		SummarizedTurns: h.Summary.CoveredTurnsOrZero(),
+		DroppedTurns:    h.Dropped,
+	}
+}
+
+// prepareChatHistory picks the turns before end that fit into the history token
+// budget, extending the chat's rolling summary to cover older turns if needed.
+func (app *App) prepareChatHistory(rc *RC, chatID m.ChatID, end int) (*chatHistory, error) {
+	var summary *m.ChatSummary
+	var turns []*m.RecordedMsg
+	var turnTokens []int
+	err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+		cc := edb.Get[m.ChatContent](rc, chatID)
+		summary = cc.Summary
+		for i, t := range cc.Turns {
+			if i >= end {
+				break
+			}
+			msg := t.LastMessage()
+			turns = append(turns, &m.RecordedMsg{Role: msg.Role, Text: msg.Text})
+			turnTokens = append(turnTokens, openai.ChatTokenCount([]openai.Msg{{Role: msg.Role.OpenAIRole(), Content: msg.Text}}, DefaultModel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	end = len(turns)
+
+	covered := summary.CoveredTurnsOrZero()
+	if covered > end {
+		// regenerating an earlier answer: the summary describes later turns,
+		// so just send as many recent turns as fit
+		start := m.PlanHistory(turnTokens, 0, MaxHistoryTokenCount, MaxHistoryTokenCount)
+		return &chatHistory{Start: start, End: end, Dropped: start, Turns: turns}, nil
+	}
+
+	start := m.PlanHistory(turnTokens, covered, MaxHistoryTokenCount, HistoryLowWatermarkTokenCount)
+	if start == covered {
+		return &chatHistory{Summary: summary, Start: start, End: end, Turns: turns}, nil
+	}
+
+	newSummary, spent, err := app.summarizeTurns(rc, summary, turns[covered:start])
+	if err != nil {
+		// answer anyway, we'll retry summarization on the next turn
+		flogger.Log(rc, "WARNING: chat summarization failed: %v", err)
+		return &chatHistory{Summary: summary, Start: start, End: end, Dropped: start - covered, Turns: turns}, nil
+	}
+	newSummary.CoveredTurns = start
+	flogger.Log(rc, "ChatRollforward(%v): summarized turns %d..%d into %d tokens", chatID, covered, start, newSummary.TokenCount)
+
+	err = app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		chat := edb.Get[m.Chat](rc, chatID)
+		cc := edb.Get[m.ChatContent](rc, chatID)
+		chat.Cost += spent
+		if cc.Summary.CoveredTurnsOrZero() == covered {
+			cc.Summary = newSummary
+		}
+		edb.Put(rc, chat, cc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &chatHistory{Summary: newSummary, Start: start, End: end, Turns: turns}, nil
+}
+
+// summarizeTurns folds the given turns into the previous summary (which may be nil).
+func (app *App) summarizeTurns(rc *RC, prev *m.ChatSummary, turns []*m.RecordedMsg) (*m.ChatSummary, openai.Price, error) {
+	var buf strings.Builder
+	if prev != nil && prev.Text != "" {
+		buf.WriteString("PREVIOUS SUMMARY:\n\n")
+		buf.WriteString(prev.Text)
+		buf.WriteString("\n\n")
+	}
+	buf.WriteString("NEW PART OF THE CONVERSATION:\n\n")
+	for _, t := range turns {
+		fmt.Fprintf(&buf, "%s: %s\n\n", transcriptSpeaker(t.Role), t.Text)
+	}
+
+	opt := openai.DefaultChatOptions()
+	opt.Model = DefaultModel
+	opt.MaxTokens = MaxSummaryTokenCount
+	opt.Temperature = 0
+
+	history := []openai.Msg{
+		openai.SystemMsg(chatSummarySystemPrompt),
+		{Role: openai.User, Content: buf.String()},
+	}
+	msgs, usage, err := openai.Chat(rc, history, opt, app.httpClient, app.Settings().OpenAICreds)
+	spent := openai.Cost(usage.PromptTokens, usage.CompletionTokens, opt.Model)
+	if err != nil {
+		return nil, spent, err
+	}
+	if len(msgs) == 0 || strings.TrimSpace(msgs[0].Content) == "" {
+		return nil, spent, fmt.Errorf("ChatGPT returned an empty summary")
+	}
+
+	sum := &m.ChatSummary{
+		Text: strings.TrimSpace(msgs[0].Content),
+		Cost: spent,
+	}
+	if prev != nil {
+		sum.Updates = prev.Updates
+		sum.Cost += prev.Cost
+	}
+	sum.Updates++
+	sum.TokenCount = openai.TokenCount(sum.Text, DefaultModel)
+	return sum, spent, nil
+}
+
+// transcriptSpeaker labels messages in the plain-text transcripts shown to helper prompts.
+func transcriptSpeaker(role m.MessageRole) string {
+	switch role {
+	case m.MessageRoleUser:
+		return "User"
+	case m.MessageRoleStaff:
+		return "Coach"
+	case m.MessageRoleTool:
+		return "Tool"
+	default:
+		return "Assistant"
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/andreyvit/edb"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// checkMonthlyLimit returns an error once the user has asked as many
+// questions this month as the strictest of their groups allows. Questions
+// are counted across all of the user's chats in the account.
+func checkMonthlyLimit(rc *RC, accountID m.AccountID, user *m.User) error {
+	memb := user.Membership(accountID)
+	limit := m.MonthlyLimit(loadAccountGroups(rc, accountID), memb)
+	if limit > 0 && memb.QuestionsInMonth(rc.Now) >= limit {
+		return fmt.Errorf("you have used all %d questions available to you this month", limit)
+	}
+	return nil
+}
+
+// countQuestion adds a question to the user's monthly count. Must be called
+// in a write transaction, with the user loaded in that transaction.
+func countQuestion(rc *RC, accountID m.AccountID, user *m.User) {
+	if memb := user.Membership(accountID); memb != nil {
+		memb.CountQuestion(rc.Now)
+		edb.Put(rc, user)
+	}
+}
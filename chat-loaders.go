@@ -25,6 +25,15 @@ func loadChat(rc *RC, chatID m.ChatID, allowNew bool) (*m.Chat, error) {
 	return chat, nil
 }
 
+// loadModChat loads any chat of the current account, for moderators.
+func loadModChat(rc *RC, chatID m.ChatID) (*m.Chat, error) {
+	chat := edb.Get[m.Chat](rc, chatID)
+	if chat == nil || chat.AccountID != rc.AccountID() {
+		return nil, httperrors.Errorf(404, "chat_not_found", "This chat does not exist.")
+	}
+	return chat, nil
+}
+
 func loadChatContent(rc *RC, chatID m.ChatID) *m.ChatContent {
 	if chatID == 0 {
 		return &m.ChatContent{}
@@ -42,3 +42,38 @@ func (app *App) addBotPendingMsg(turn *m.Turn) *m.Message {
 	turn.Versions = append(turn.Versions, msg)
 	return msg
 }
+
+// addBotMsg adds a finished bot message that hasn't been produced by the
+// usual rollforward, e.g. a scheduled check-in.
+func (app *App) addBotMsg(turn *m.Turn, content string) *m.Message {
+	if turn.Role != m.MessageRoleBot {
+		panic("cannot add bot msg to user turn")
+	}
+	msg := &m.Message{
+		ID:        app.NewID(),
+		Role:      m.MessageRoleBot,
+		State:     m.MessageStateFinished,
+		Text:      content,
+		TurnID:    turn.ID,
+		TurnIndex: turn.Index,
+	}
+	turn.Versions = append(turn.Versions, msg)
+	return msg
+}
+
+func (app *App) addStaffMsg(turn *m.Turn, content string, author *m.User) *m.Message {
+	if turn.Role != m.MessageRoleStaff {
+		panic("cannot add staff msg to non-staff turn")
+	}
+	msg := &m.Message{
+		ID:         app.NewID(),
+		Role:       m.MessageRoleStaff,
+		Text:       content,
+		TurnID:     turn.ID,
+		TurnIndex:  turn.Index,
+		AuthorID:   author.ID,
+		AuthorName: author.Name,
+	}
+	turn.Versions = append(turn.Versions, msg)
+	return msg
+}
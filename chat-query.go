@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// rewriteSearchQueries asks the LLM to turn the latest user turn of hist into
+// a standalone search query (plus up to maxSubQueries sub-queries).
+func (app *App) rewriteSearchQueries(rc *RC, hist *chatHistory, maxSubQueries int) ([]string, openai.Price, error) {
+	start := hist.End - queryRewriteHistoryTurns
+	if start < hist.Start {
+		start = hist.Start
+	}
+
+	var buf strings.Builder
+	if sum := hist.RecordedSummary(); sum != nil {
+		buf.WriteString(sum.Text)
+		buf.WriteString("\n\n")
+	}
+	for _, t := range hist.Turns[start:hist.End] {
+		fmt.Fprintf(&buf, "%s: %s\n\n", transcriptSpeaker(t.Role), t.Text)
+	}
+	if maxSubQueries > 0 {
+		fmt.Fprintf(&buf, "(Produce at most %d sub-queries.)", maxSubQueries)
+	} else {
+		buf.WriteString("(Do not produce sub-queries.)")
+	}
+
+	opt := openai.DefaultChatOptions()
+	opt.Model = DefaultModel
+	opt.MaxTokens = MaxMsgTokenCount
+	opt.Temperature = 0
+	opt.Functions = []any{queryRewriteFunc}
+	opt.FunctionCallMode = &openai.ForceFunctionCall{Name: queryRewriteFuncName}
+
+	history := []openai.Msg{
+		openai.SystemMsg(queryRewriteSystemPrompt),
+		{Role: openai.User, Content: buf.String()},
+	}
+	msgs, usage, err := openai.Chat(rc, history, opt, app.httpClient, app.Settings().OpenAICreds)
+	spent := openai.Cost(usage.PromptTokens, usage.CompletionTokens, opt.Model)
+	if err != nil {
+		return nil, spent, err
+	}
+
+	var result QueryRewriteFuncResult
+	err = msgs[0].UnmarshalCallArguments(&result)
+	if err != nil {
+		return nil, spent, err
+	}
+	query := strings.TrimSpace(result.Query)
+	if query == "" {
+		return nil, spent, fmt.Errorf("ChatGPT returned an empty search query")
+	}
+
+	queries := []string{query}
+	for _, q := range result.SubQueries {
+		if len(queries) > maxSubQueries {
+			break
+		}
+		if q = strings.TrimSpace(q); q != "" && !strings.EqualFold(q, query) {
+			queries = append(queries, q)
+		}
+	}
+	return queries, spent, nil
+}
+
+// embedSearchQueries computes embeddings of the rewritten queries. Returns
+// the queries that were embedded successfully along with their embeddings.
+func (app *App) embedSearchQueries(rc *RC, queries []string, typ m.EmbeddingType) ([]string, []m.Embedding, openai.Price, error) {
+	var cost openai.Price
+	var embedded []string
+	var embs []m.Embedding
+	for _, q := range queries {
+		emb, spent, err := app.computeEmbedding(rc, q, typ)
+		cost += spent
+		if err != nil {
+			return embedded, embs, cost, err
+		}
+		embedded = append(embedded, q)
+		embs = append(embs, emb)
+	}
+	return embedded, embs, cost, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// rerankContext rescores the top retrieved entries against query using
+// the account's reranker, dropping the ones below the relevance threshold.
+// Returns the kept entries (best first) and their scores.
+func (app *App) rerankContext(rc *RC, opts m.RetrievalOptions, query string, entries m.EntriesAndDistances) (m.EntriesAndDistances, []float64, openai.Price, error) {
+	n := len(entries.Entries)
+	if opts.RerankCandidates > 0 && opts.RerankCandidates < n {
+		n = opts.RerankCandidates
+	}
+	candidates := m.EntriesAndDistances{
+		Entries:   entries.Entries[:n],
+		Distances: entries.Distances[:n],
+	}
+
+	texts := make([]string, n)
+	app.MustRead(rc.BaseRC(), func() {
+		for i, e := range candidates.Entries {
+			if c := edb.Get[m.Content](rc, e.ContentID); c != nil {
+				texts[i] = c.Text
+			}
+		}
+	})
+
+	var scores []float64
+	var cost openai.Price
+	switch opts.Reranker {
+	case m.RerankerLexical:
+		scores = make([]float64, n)
+		for i, text := range texts {
+			scores[i] = m.LexicalRelevance(query, text)
+		}
+	case m.RerankerLLM:
+		var err error
+		scores, cost, err = app.judgeRelevance(rc, query, texts)
+		if err != nil {
+			return entries, nil, cost, err
+		}
+	default:
+		panic(fmt.Errorf("unknown reranker %v", opts.Reranker))
+	}
+
+	reranked, keptScores := m.RerankEntries(candidates, scores, opts.RerankThreshold)
+	return reranked, keptScores, cost, nil
+}
+
+// judgeRelevance asks the LLM to rate each of texts against query, returning scores from 0 to 1.
+func (app *App) judgeRelevance(rc *RC, query string, texts []string) ([]float64, openai.Price, error) {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "QUERY: %s\n\n", query)
+	for i, text := range texts {
+		if r := []rune(text); len(r) > rerankPassageChars {
+			text = string(r[:rerankPassageChars]) + "…"
+		}
+		fmt.Fprintf(&buf, "PASSAGE %d:\n%s\n\n", i+1, text)
+	}
+
+	opt := openai.DefaultChatOptions()
+	opt.Model = DefaultModel
+	opt.MaxTokens = 16 + 4*len(texts)
+	opt.Temperature = 0
+	opt.Functions = []any{rerankFunc}
+	opt.FunctionCallMode = &openai.ForceFunctionCall{Name: rerankFuncName}
+
+	history := []openai.Msg{
+		openai.SystemMsg(rerankSystemPrompt),
+		{Role: openai.User, Content: buf.String()},
+	}
+	msgs, usage, err := openai.Chat(rc, history, opt, app.httpClient, app.Settings().OpenAICreds)
+	spent := openai.Cost(usage.PromptTokens, usage.CompletionTokens, opt.Model)
+	if err != nil {
+		return nil, spent, err
+	}
+
+	var result RerankFuncResult
+	err = msgs[0].UnmarshalCallArguments(&result)
+	if err != nil {
+		return nil, spent, err
+	}
+	if len(result.Scores) != len(texts) {
+		return nil, spent, fmt.Errorf("ChatGPT returned %d relevance scores for %d passages", len(result.Scores), len(texts))
+	}
+	scores := make([]float64, len(texts))
+	for i, s := range result.Scores {
+		if s < 0 {
+			s = 0
+		} else if s > 10 {
+			s = 10
+		}
+		scores[i] = s / 10
+	}
+	return scores, spent, nil
+}
@@ -26,11 +26,45 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 	var unembeddedMsgs []*m.Message
 	var pendingBotMsg *m.Message
 	var needTitle bool
+	var embType m.EmbeddingType
+	var retrievalOpts m.RetrievalOptions
+	var memoryEnabled bool
+	var promptTemplate string
+	var tools []*chatTool
+	var toolCtx *toolContext
+	var historyEnd int
 	err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
 		chat := edb.Get[m.Chat](rc, chatID)
 		cc := edb.Get[m.ChatContent](rc, chatID)
-		unembeddedMsgs = findMessagesWithMissingEmbeddings(cc)
+		account := edb.Get[m.Account](rc, chat.AccountID)
+		embType = account.EffectiveEmbeddingType()
+		retrievalOpts = account.Retrieval
+		memoryEnabled = account.UserMemory
+		author := edb.Get[m.User](rc, chat.UserID)
+		var promptGroup *m.UserGroup
+		if author != nil {
+			promptGroup = m.PromptGroup(loadAccountGroups(rc, chat.AccountID), author.Membership(chat.AccountID))
+		}
+		promptTemplate = promptTemplateFor(account, promptGroup)
+		if account.Tools.Any() {
+			isStaff := author != nil && author.MembershipRole(chat.AccountID).HasBackofficeAccess()
+			tools = allowedChatTools(account.Tools, isStaff)
+			toolCtx = &toolContext{
+				AccountID: chat.AccountID,
+				UserID:    chat.UserID,
+				ChatID:    chat.ID,
+				EmbType:   embType,
+			}
+		}
+		unembeddedMsgs = findMessagesWithMissingEmbeddings(cc, embType)
 		pendingBotMsg = findPendingBotMessage(cc)
+		if pendingBotMsg != nil {
+			historyEnd = pendingBotMsg.TurnIndex
+			if len(tools) > 0 {
+				// tool calls of an earlier version of the answer get replaced below
+				historyEnd = cc.ToolTurnsStart(historyEnd)
+			}
+		}
 		needTitle = chat.IsGeneratingTitle()
 		return nil
 	})
@@ -41,7 +75,7 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 		var embeddingErr error
 		var embeddingCost openai.Price
 		for _, msg := range unembeddedMsgs {
-			cost, err := app.computeMsgEmbedding(rc, msg)
+			cost, err := app.computeMsgEmbedding(rc, msg, embType)
 			embeddingCost += cost
 			embeddingErr = multierr.Append(embeddingErr, err)
 		}
@@ -54,7 +88,7 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 			chat.Cost += embeddingCost
 			for _, msg := range unembeddedMsgs {
 				if newMsg := cc.FreshMessage(msg); newMsg != nil {
-					newMsg.EmbeddingAda002 = msg.EmbeddingAda002
+					newMsg.SetEmbedding(embType, msg.Embedding(embType))
 				}
 			}
 			edb.Put(rc, chat, cc)
@@ -70,28 +104,124 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 	}
 
 	if pendingBotMsg != nil {
-		var history []openai.Msg
+		pushPresence(rc, chatID, &m.PresenceVM{
+			ElementID: m.ThinkingPresenceElementID,
+			Text:      "Thinking…",
+		})
+		defer pushPresence(rc, chatID, &m.PresenceVM{
+			ElementID: m.ThinkingPresenceElementID,
+		})
+
+		hist, err := app.prepareChatHistory(rc, chatID, historyEnd)
+		if err != nil {
+			return err
+		}
+
+		var searchQueries []string
+		var searchEmbs []m.Embedding
+		var searchCost openai.Price
+		if retrievalOpts.QueryRewriting {
+			queries, spent, err := app.rewriteSearchQueries(rc, hist, retrievalOpts.MaxSubQueries)
+			searchCost += spent
+			if err == nil {
+				queries, searchEmbs, spent, err = app.embedSearchQueries(rc, queries, embType)
+				searchCost += spent
+				searchQueries = queries
+			}
+			if err != nil {
+				// fall back to retrieval by raw user messages
+				flogger.Log(rc, "WARNING: query rewriting failed: %v", err)
+				searchQueries, searchEmbs = nil, nil
+			}
+			flogger.Log(rc, "ChatRollforward(%v): search queries: %q", chatID, searchQueries)
+		}
+
+		var candidates m.EntriesAndDistances
+		var memories []*m.UserMemory
+		err = app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+			chat := edb.Get[m.Chat](rc, chatID)
+			cc := edb.Get[m.ChatContent](rc, chatID)
+			embs := loadAccountEmbeddings(rc, chat.AccountID, embType, chat.UserID)
+			candidates = RetrieveContext(cc, pendingBotMsg.TurnIndex, embs, searchEmbs, retrievalSettingsFor(retrievalOpts))
+			if memoryEnabled {
+				memories = selectPromptMemories(rc, chat, RetrievalQueries(cc, pendingBotMsg.TurnIndex, embType, searchEmbs), embType)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var scores []float64
+		if retrievalOpts.Reranker != m.RerankerNone {
+			query := hist.Turns[hist.End-1].Text
+			if len(searchQueries) > 0 {
+				query = searchQueries[0]
+			}
+			reranked, rerankScores, spent, err := app.rerankContext(rc, retrievalOpts, query, candidates)
+			searchCost += spent
+			if err != nil {
+				// fall back to retrieval order
+				flogger.Log(rc, "WARNING: reranking failed: %v", err)
+			} else {
+				flogger.Log(rc, "ChatRollforward(%v): reranking kept %d of %d entries", chatID, len(reranked.Entries), len(candidates.Entries))
+				candidates, scores = reranked, rerankScores
+			}
+		}
+
+		if len(tools) > 0 {
+			calls, spent, err := app.runToolCalls(rc, toolCtx, tools, hist)
+			searchCost += spent + toolCtx.Cost
+			if err != nil {
+				// answer with whatever has been found so far
+				flogger.Log(rc, "WARNING: tool calling failed: %v", err)
+			}
+			if len(calls) > 0 || historyEnd < pendingBotMsg.TurnIndex {
+				flogger.Log(rc, "ChatRollforward(%v): %d tool calls", chatID, len(calls))
+				pendingBotMsg, err = app.recordToolCalls(rc, chatID, pendingBotMsg, calls)
+				if err != nil {
+					return err
+				}
+				hist.AppendToolCalls(calls)
+			}
+		}
+
+		var pres PromptResult
+		rec := &m.AnswerRecording{
+			ID:             app.NewID(),
+			ChatID:         chatID,
+			MessageID:      pendingBotMsg.ID,
+			PromptTemplate: promptTemplate,
+		}
 		err = app.InTx(&rc.RC, mvpm.SafeReader, func() error {
 			chat := edb.Get[m.Chat](rc, chatID)
 			cc := edb.Get[m.ChatContent](rc, chatID)
-			embs := loadAccountEmbeddings(rc, chat.AccountID)
 
-			pres, err := app.BuildSystemPrompt(rc, prompt1, cc, pendingBotMsg.TurnIndex, embs)
+			var err error
+			pres, err = app.BuildSystemPrompt(rc, promptTemplate, candidates, scores, memories)
 			if err != nil {
 				return err
 			}
 
 			flogger.Log(rc, "Prompt: %s", pres.Prompt)
 
-			history = append(history, openai.SystemMsg(pres.Prompt))
+			rec.AccountID = chat.AccountID
+			rec.SystemPrompt = pres.Prompt
+			rec.ContextContentIDs = pres.ContextContentIDs
+			if sum := hist.RecordedSummary(); sum != nil {
+				rec.History = append(rec.History, sum)
+			}
 			for i, t := range cc.Turns {
-				if i >= pendingBotMsg.TurnIndex {
+				if i < hist.Start {
+					continue
+				}
+				if i >= hist.End {
 					break
 				}
 				msg := t.LastMessage()
-				history = append(history, openai.Msg{
-					Role:    msg.Role.OpenAIRole(),
-					Content: msg.Text,
+				rec.History = append(rec.History, &m.RecordedMsg{
+					Role: msg.Role,
+					Text: msg.Text,
 				})
 			}
 			return nil
@@ -99,6 +229,15 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 		if err != nil {
 			return err
 		}
+		history := rec.ChatHistory(rec.SystemPrompt)
+
+		stats := hist.Stats()
+		stats.SystemTokens = openai.ChatTokenCount(history[:1], DefaultModel)
+		if sum := hist.RecordedSummary(); sum != nil {
+			stats.SummaryTokens = openai.ChatTokenCount([]openai.Msg{history[1]}, DefaultModel)
+		}
+		stats.TotalTokens = openai.ChatTokenCount(history, DefaultModel)
+		stats.HistoryTokens = stats.TotalTokens - stats.SystemTokens - stats.SummaryTokens
 
 		opt := openai.DefaultChatOptions()
 		opt.Model = DefaultModel
@@ -109,17 +248,34 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 			flogger.Log(rc, "openai chunk: <<<%s>>>", delta)
 			pendingBotMsg.Text = msg.Content
 			pushMessage(rc, chatID, pendingBotMsg)
+			app.notifyChatStream(chatID, msg.Content)
 			return nil
 		})
 
-		spent := openai.Cost(openai.ChatTokenCount(history, opt.Model), openai.MsgTokenCount(newBotMsg, opt.Model), opt.Model)
+		promptTokens, completionTokens := openai.ChatTokenCount(history, opt.Model), openai.MsgTokenCount(newBotMsg, opt.Model)
+		spent := openai.Cost(promptTokens, completionTokens, opt.Model)
+
+		rec.Time = rc.Now
+		rec.Model = opt.Model
+		rec.Temperature = opt.Temperature
+		rec.MaxTokens = opt.MaxTokens
+		rec.PromptTokens = promptTokens
+		rec.CompletionTokens = completionTokens
+		rec.Cost = spent
+		if newBotMsgErr != nil {
+			rec.Failed = true
+		} else {
+			rec.Answer = newBotMsg.Content
+		}
 
+		var chat *m.Chat
+		var cc *m.ChatContent
 		err = app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
-			chat := edb.Get[m.Chat](rc, chatID)
-			cc := edb.Get[m.ChatContent](rc, chatID)
+			chat = edb.Get[m.Chat](rc, chatID)
+			cc = edb.Get[m.ChatContent](rc, chatID)
 			msg := cc.FreshMessage(pendingBotMsg)
 
-			chat.Cost += spent
+			chat.Cost += spent + searchCost
 
 			if msg == nil {
 				flogger.Log(rc, "WARNING: bot message not found for pendingBotMsg %v %v", pendingBotMsg.ID, pendingBotMsg)
@@ -131,16 +287,24 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 					msg.Text = newBotMsg.Content
 					msg.State = m.MessageStateFinished
 				}
+				msg.ContextContentIDs = pres.ContextContentIDs
+				msg.ContextDistances = pres.ContextDistances
+				msg.ContextScores = pres.ContextScores
+				msg.MemoryIDs = pres.MemoryIDs
+				msg.PromptStats = stats
+				msg.SearchQueries = searchQueries
 				pendingBotMsg = msg
 			}
-			edb.Put(rc, chat, cc)
+			edb.Put(rc, chat, cc, rec)
 			return nil
 		})
 		if err != nil {
 			return err
 		}
-		if pendingBotMsg != nil {
-			pushMessage(rc, chatID, pendingBotMsg)
+		pushChatContent(rc, chat, cc)
+
+		if memoryEnabled && len(cc.Turns)-chat.MemoryTurns >= memoryExtractionMinTurns {
+			app.EnqueueMemoryExtraction(rc, chatID)
 		}
 	}
 
@@ -225,12 +389,47 @@ func (app *App) runChatRollforward(rc *RC, chatID m.ChatID) error {
 }
 
 func pushMessage(rc *RC, chatID m.ChatID, msg *m.Message) {
+	for _, ch := range []mvplive.Channel{chatChannel(chatID), chatModChannel(chatID)} {
+		mvp.PushPartial(rc, &mvp.ViewData{
+			View: "chat/_message",
+			Data: m.WrapMessage(msg, chatID),
+		}, msg.HTMLElementID(), ch, mvplive.Envelope{
+			DedupKey: msg.ID.String(),
+		})
+	}
+}
+
+// pushChatContent re-renders the whole message list in every tab watching the chat.
+// The moderator view goes to a separate staff-only channel. The dedup keys make
+// sure a reconnecting tab gets the latest state when missed events are replayed.
+func pushChatContent(rc *RC, chat *m.Chat, cc *m.ChatContent) {
+	vm := m.WrapChat(chat, cc)
 	mvp.PushPartial(rc, &mvp.ViewData{
-		View: "chat/_message",
-		Data: m.WrapMessage(msg, chatID),
-	}, msg.HTMLElementID(), chatChannel(chatID), mvplive.Envelope{
-		DedupKey: msg.ID.String(),
+		View: "chat/_messages",
+		Data: vm,
+	}, vm.MessageListHTMLElementID(), chatChannel(chat.ID), mvplive.Envelope{
+		DedupKey: "messages",
 	})
+
+	modVM := m.WrapChat(chat, cc)
+	modVM.SetModeratorView()
+	mvp.PushPartial(rc, &mvp.ViewData{
+		View: "chat/_messages",
+		Data: modVM,
+	}, modVM.MessageListHTMLElementID(), chatModChannel(chat.ID), mvplive.Envelope{
+		DedupKey: "messages",
+	})
+}
+
+func pushPresence(rc *RC, chatID m.ChatID, p *m.PresenceVM) {
+	for _, ch := range []mvplive.Channel{chatChannel(chatID), chatModChannel(chatID)} {
+		mvp.PushPartial(rc, &mvp.ViewData{
+			View: "chat/_presence",
+			Data: p,
+		}, p.ElementID, ch, mvplive.Envelope{
+			DedupKey: p.ElementID,
+		})
+	}
 }
 
 func pushChatTitle(rc *RC, chat *m.Chat) {
@@ -245,8 +444,8 @@ func pushChatTitle(rc *RC, chat *m.Chat) {
 		View:         "chat/_nav_item_mod",
 		Data:         chat,
 		SemanticPath: chat.ModChatSempath(),
-	}, chat.ModNavItemHTMLElementID(), chatChannel(chat.ID), mvplive.Envelope{
-		DedupKey: "title-mod",
+	}, chat.ModNavItemHTMLElementID(), chatModChannel(chat.ID), mvplive.Envelope{
+		DedupKey: "title",
 	})
 }
 
@@ -257,12 +456,19 @@ func chatChannel(chatID m.ChatID) mvplive.Channel {
 	}
 }
 
-func findMessagesWithMissingEmbeddings(cc *m.ChatContent) []*m.Message {
+func chatModChannel(chatID m.ChatID) mvplive.Channel {
+	return mvplive.Channel{
+		Family: chatModChannelFamily,
+		Topic:  chatID.String(),
+	}
+}
+
+func findMessagesWithMissingEmbeddings(cc *m.ChatContent, typ m.EmbeddingType) []*m.Message {
 	var unembeddedMsgs []*m.Message
 	for _, turn := range cc.Turns {
 		if turn.Role == m.MessageRoleUser {
 			for _, msg := range turn.Versions {
-				if msg.EmbeddingAda002 == nil {
+				if msg.Embedding(typ) == nil {
 					unembeddedMsgs = append(unembeddedMsgs, msg)
 				}
 			}
@@ -283,12 +489,11 @@ func findPendingBotMessage(cc *m.ChatContent) *m.Message {
 	return nil
 }
 
-func (app *App) computeMsgEmbedding(ctx context.Context, msg *m.Message) (openai.Price, error) {
-	embedding, usage, err := openai.ComputeEmbedding(ctx, msg.Text, app.httpClient, app.Settings().OpenAICreds)
+func (app *App) computeMsgEmbedding(ctx context.Context, msg *m.Message, typ m.EmbeddingType) (openai.Price, error) {
+	embedding, cost, err := app.computeEmbedding(ctx, msg.Text, typ)
 	if err != nil {
-		return 0, fmt.Errorf("embeddings: %w", err)
+		return 0, err
 	}
-	msg.EmbeddingAda002 = embedding
-	cost := openai.Cost(usage.PromptTokens, usage.CompletionTokens, EmbeddingModel)
+	msg.SetEmbedding(typ, embedding)
 	return cost, nil
 }
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/edb"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// chatTool is a tool the bot can call while producing an answer.
+type chatTool struct {
+	Name        string
+	Description string // for the model, including the arguments taken
+	Run         func(app *App, rc *RC, tc *toolContext, args *ToolArgs) (string, error)
+}
+
+type toolContext struct {
+	AccountID m.AccountID
+	UserID    m.UserID
+	ChatID    m.ChatID
+	EmbType   m.EmbeddingType
+	Cost      openai.Price // spent by the tools themselves, e.g. on embeddings
+}
+
+const (
+	toolSearchResultCount = 5
+	maxReminderDays       = 365
+)
+
+var chatTools = []*chatTool{
+	{
+		Name:        "search_library",
+		Description: `finds library passages matching "query"; pass "folder" to only search within a library folder.`,
+		Run:         (*App).runSearchLibraryTool,
+	},
+	{
+		Name:        "item_link",
+		Description: `returns the link to the library item named "item" (a lesson, video or document), to share with the user.`,
+		Run:         (*App).runItemLinkTool,
+	},
+	{
+		Name:        "create_reminder",
+		Description: `schedules a follow-up reminder with "text" to be sent to the user in "days" days; use only when the user asks to be reminded.`,
+		Run:         (*App).runCreateReminderTool,
+	},
+}
+
+func findChatTool(tools []*chatTool, name string) *chatTool {
+	for _, tool := range tools {
+		if tool.Name == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// allowedChatTools returns the tools the bot may call in a chat of an author
+// with (isStaff) or without backoffice access.
+func allowedChatTools(perms m.ToolPermissions, isStaff bool) []*chatTool {
+	var result []*chatTool
+	for _, tool := range chatTools {
+		if perms.Allows(tool.Name, isStaff) {
+			result = append(result, tool)
+		}
+	}
+	return result
+}
+
+// runToolCalls lets the bot call tools before answering the latest turn of hist,
+// up to MaxToolCallsPerAnswer times. Returns the calls made so far even on error.
+func (app *App) runToolCalls(rc *RC, tc *toolContext, tools []*chatTool, hist *chatHistory) ([]*m.ToolCall, openai.Price, error) {
+	choice := &m.ToolChoice{
+		Provider:     app.aiProvider(),
+		Model:        DefaultModel,
+		MaxTokens:    MaxMsgTokenCount,
+		SystemPrompt: toolChoiceSystemPromptFor(tools),
+		Function:     toolChoiceFuncFor(tools),
+		FunctionName: toolChoiceFuncName,
+		AnswerTool:   toolChoiceAnswer,
+		Transcript:   toolChoiceTranscript(hist),
+	}
+	runner := &chatToolRunner{app: app, rc: rc, tc: tc, tools: tools}
+	calls, err := m.RunToolCalls(rc, choice, runner, MaxToolCallsPerAnswer)
+	return calls, choice.Cost, err
+}
+
+// chatToolRunner runs the tools chosen by the bot.
+type chatToolRunner struct {
+	app   *App
+	rc    *RC
+	tc    *toolContext
+	tools []*chatTool
+}
+
+func (r *chatToolRunner) Allows(tool string) bool {
+	return findChatTool(r.tools, tool) != nil
+}
+
+func (r *chatToolRunner) Run(call *m.ToolCall) (string, error) {
+	var args ToolArgs
+	err := json.Unmarshal([]byte(call.Arguments), &args)
+	if err != nil {
+		return "", err
+	}
+	result, err := findChatTool(r.tools, call.Tool).Run(r.app, r.rc, r.tc, &args)
+	if err != nil {
+		return "", err
+	}
+	return truncateToTokens(result, MaxToolResultTokenCount), nil
+}
+
+func toolChoiceTranscript(hist *chatHistory) string {
+	var buf strings.Builder
+	if sum := hist.RecordedSummary(); sum != nil {
+		buf.WriteString(sum.Text)
+		buf.WriteString("\n\n")
+	}
+	for _, t := range hist.Turns[hist.Start:hist.End] {
+		fmt.Fprintf(&buf, "%s: %s\n\n", transcriptSpeaker(t.Role), t.Text)
+	}
+	return buf.String()
+}
+
+func truncateToTokens(text string, maxTokens int) string {
+	for len(text) > 0 && openai.TokenCount(text, DefaultModel) > maxTokens {
+		text = strings.ToValidUTF8(text[:len(text)*3/4], "")
+	}
+	return text
+}
+
+// recordToolCalls saves the calls as tool turns right before the pending bot
+// message, replacing the tool turns of an earlier version of the answer.
+// Returns the fresh copy of the bot message, which has moved.
+func (app *App) recordToolCalls(rc *RC, chatID m.ChatID, pendingBotMsg *m.Message, calls []*m.ToolCall) (*m.Message, error) {
+	var freshMsg *m.Message
+	var chat *m.Chat
+	var cc *m.ChatContent
+	err := app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		chat = edb.Get[m.Chat](rc, chatID)
+		cc = edb.Get[m.ChatContent](rc, chatID)
+		freshMsg = cc.FreshMessage(pendingBotMsg)
+		if freshMsg == nil {
+			return fmt.Errorf("bot message %v not found", pendingBotMsg.ID)
+		}
+
+		turns := make([]*m.Turn, 0, len(calls))
+		for _, call := range calls {
+			turn := &m.Turn{
+				ID:   app.NewID(),
+				Role: m.MessageRoleTool,
+			}
+			turn.Versions = []*m.Message{{
+				ID:       app.NewID(),
+				Role:     m.MessageRoleTool,
+				State:    m.MessageStateFinished,
+				Text:     call.Transcript(),
+				TurnID:   turn.ID,
+				ToolCall: call,
+			}}
+			turns = append(turns, turn)
+		}
+		cc.ReplaceToolTurns(freshMsg.TurnIndex, turns...)
+
+		edb.Put(rc, cc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	pushChatContent(rc, chat, cc)
+	return freshMsg, nil
+}
+
+func (app *App) runSearchLibraryTool(rc *RC, tc *toolContext, args *ToolArgs) (string, error) {
+	if strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	emb, spent, err := app.computeEmbedding(rc, args.Query, tc.EmbType)
+	tc.Cost += spent
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	err = app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+		embs := loadAccountEmbeddings(rc, tc.AccountID, tc.EmbType, tc.UserID)
+		if args.Folder != "" {
+			lib := loadAccountLibrary(rc, tc.AccountID)
+			lib = lib.Restrict(lib.AccessibleFolders(edb.Get[m.User](rc, tc.UserID), tc.AccountID))
+			fldr := lib.FindFolder(args.Folder)
+			if fldr == nil {
+				return fmt.Errorf("no folder named %q", args.Folder)
+			}
+			folderIDs := lib.Subtree(fldr.ID)
+			itemFolders := loadItemFolders(rc, tc.AccountID)
+			embs = embs.FilterItems(func(id m.ItemID) bool {
+				return folderIDs[itemFolders[id]]
+			})
+		}
+
+		found := embs.Select(emb, toolSearchResultCount, MaxContextDistance)
+		for _, e := range found.Entries {
+			c := edb.Get[m.Content](rc, e.ContentID)
+			if c == nil {
+				continue
+			}
+			if item := edb.Get[m.Item](rc, e.ItemID); item != nil {
+				fmt.Fprintf(&buf, "From %q:\n", item.Name)
+			}
+			fmt.Fprintf(&buf, "%s\n\n", c.Text)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if buf.Len() == 0 {
+		return "Nothing found.", nil
+	}
+	return buf.String(), nil
+}
+
+func (app *App) runItemLinkTool(rc *RC, tc *toolContext, args *ToolArgs) (string, error) {
+	name := strings.TrimSpace(args.Item)
+	if name == "" {
+		return "", fmt.Errorf("item is required")
+	}
+
+	var found *m.Item
+	app.MustRead(rc.BaseRC(), func() {
+		folders := loadAccountLibrary(rc, tc.AccountID).AccessibleFolders(edb.Get[m.User](rc, tc.UserID), tc.AccountID)
+		for _, item := range edb.All(edb.ExactIndexScan[m.Item](rc, ItemsByAccount, tc.AccountID)) {
+			if folders != nil && !folders[item.FolderID] {
+				continue
+			}
+			if strings.EqualFold(item.Name, name) {
+				found = item
+				break
+			}
+			if found == nil && strings.Contains(strings.ToLower(item.Name), strings.ToLower(name)) {
+				found = item
+			}
+		}
+	})
+	switch {
+	case found == nil:
+		return "", fmt.Errorf("no item named %q", name)
+	case found.Link == "":
+		return fmt.Sprintf("%q has no link.", found.Name), nil
+	default:
+		return fmt.Sprintf("%q: %s", found.Name, found.Link), nil
+	}
+}
+
+func (app *App) runCreateReminderTool(rc *RC, tc *toolContext, args *ToolArgs) (string, error) {
+	text := strings.TrimSpace(args.Text)
+	if text == "" {
+		return "", fmt.Errorf("text is required")
+	}
+	if args.Days < 1 || args.Days > maxReminderDays {
+		return "", fmt.Errorf("days must be between 1 and %d", maxReminderDays)
+	}
+
+	reminder := &m.Reminder{
+		ID:           app.NewID(),
+		AccountID:    tc.AccountID,
+		UserID:       tc.UserID,
+		ChatID:       tc.ChatID,
+		Text:         text,
+		CreationTime: rc.Now,
+		DueTime:      rc.Now.Add(time.Duration(args.Days) * 24 * time.Hour),
+	}
+	err := app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		edb.Put(rc, reminder)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Reminder scheduled for %s.", reminder.DueTime.Format("Monday, Jan 2")), nil
+}
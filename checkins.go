@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// runDueCheckIns posts the check-ins and reminders that are due.
+func (app *App) runDueCheckIns(rc *RC) error {
+	var schedules []m.CheckInScheduleID
+	var reminders []m.ReminderID
+	err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+		// the indexes are ordered by due time, so stop at the first one not due yet
+		for c := edb.IndexScan[m.CheckInSchedule](rc, CheckInSchedulesByNextRun, edb.FullScan()); c.Next(); {
+			if !c.Row().IsDue(rc.Now) {
+				break
+			}
+			schedules = append(schedules, c.Row().ID)
+		}
+		for c := edb.IndexScan[m.Reminder](rc, RemindersByDueTime, edb.FullScan()); c.Next(); {
+			if rc.Now.Before(c.Row().DueTime) {
+				break
+			}
+			reminders = append(reminders, c.Row().ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range schedules {
+		if err := app.runCheckIn(rc, id); err != nil {
+			flogger.Log(rc, "WARNING: check-in %v failed: %v", id, err)
+		}
+	}
+	for _, id := range reminders {
+		if err := app.deliverReminder(rc, id); err != nil {
+			flogger.Log(rc, "WARNING: reminder %v failed: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (app *App) runCheckIn(rc *RC, scheduleID m.CheckInScheduleID) error {
+	var s *m.CheckInSchedule
+	var account *m.Account
+	var user *m.User
+	var template string
+	var recent []*m.RecordedMsg
+	var active bool
+	err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+		s = edb.Get[m.CheckInSchedule](rc, scheduleID)
+		if s == nil || !s.IsDue(rc.Now) {
+			return nil
+		}
+		account = edb.Get[m.Account](rc, s.AccountID)
+		user = edb.Get[m.User](rc, s.UserID)
+		if user != nil {
+			memb := user.Membership(s.AccountID)
+			active = memb != nil && memb.Status.ActiveOrInvited() && !account.Disabled
+		}
+		template = checkInTemplateFor(account, s.Kind)
+		if s.ChatID != 0 {
+			cc := loadChatContent(rc, s.ChatID)
+			start := len(cc.Turns) - checkInHistoryTurns
+			if start < 0 {
+				start = 0
+			}
+			for _, t := range cc.Turns[start:] {
+				msg := t.LastMessage()
+				recent = append(recent, &m.RecordedMsg{Role: msg.Role, Text: msg.Text})
+			}
+		}
+		return nil
+	})
+	if err != nil || s == nil || !s.IsDue(rc.Now) {
+		return err
+	}
+
+	var text string
+	var spent openai.Price
+	if active {
+		text, spent, err = app.generateCheckIn(rc, s, template, user, recent)
+		if err != nil {
+			// still move on to the next run to avoid retrying every tick
+			flogger.Log(rc, "WARNING: check-in generation failed: %v", err)
+		}
+	}
+
+	var chat *m.Chat
+	var cc *m.ChatContent
+	err = app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		s = edb.Get[m.CheckInSchedule](rc, scheduleID)
+		s.LastRunTime = rc.Now
+		s.NextRunTime = s.NextRunAfter(rc.Now)
+		if text != "" {
+			chat = edb.Get[m.Chat](rc, s.ChatID)
+			if chat == nil {
+				chat = &m.Chat{
+					ID:              app.NewID(),
+					AccountID:       s.AccountID,
+					UserID:          s.UserID,
+					Title:           s.Kind.Title(),
+					TitleCustomized: true,
+				}
+				s.ChatID = chat.ID
+			}
+			cc = loadChatContent(rc, chat.ID)
+			app.addBotMsg(app.addTurn(cc, m.MessageRoleBot), text)
+			chat.Cost += spent
+			edb.Put(rc, chat, cc)
+		}
+		edb.Put(rc, s)
+		return nil
+	})
+	if err != nil || chat == nil {
+		return err
+	}
+
+	pushChatContent(rc, chat, cc)
+	app.emailBotMessage(rc, user, chat, account.EmailSubject(s.Kind.Title()), text, "checkin")
+	return nil
+}
+
+func (app *App) generateCheckIn(rc *RC, s *m.CheckInSchedule, template string, user *m.User, recent []*m.RecordedMsg) (string, openai.Price, error) {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "The user's first name is %s. It is %s for them.\n\n", user.FirstName(), rc.Now.In(s.Location()).Format("Monday, Jan 2, 15:04"))
+	if len(recent) > 0 {
+		buf.WriteString("Earlier in this chat:\n\n")
+		for _, t := range recent {
+			fmt.Fprintf(&buf, "%s: %s\n\n", transcriptSpeaker(t.Role), t.Text)
+		}
+	}
+
+	opt := openai.DefaultChatOptions()
+	opt.Model = DefaultModel
+	opt.MaxTokens = MaxResponseTokenCount
+	opt.Temperature = 0.75
+
+	history := []openai.Msg{
+		openai.SystemMsg(template + "\n\n" + checkInFormatPrompt),
+		{Role: openai.User, Content: buf.String()},
+	}
+	msgs, usage, err := openai.Chat(rc, history, opt, app.httpClient, app.Settings().OpenAICreds)
+	spent := openai.Cost(usage.PromptTokens, usage.CompletionTokens, opt.Model)
+	if err != nil {
+		return "", spent, err
+	}
+	text := strings.TrimSpace(msgs[0].Content)
+	if text == "" {
+		return "", spent, fmt.Errorf("ChatGPT returned an empty check-in")
+	}
+	return text, spent, nil
+}
+
+func (app *App) deliverReminder(rc *RC, reminderID m.ReminderID) error {
+	var r *m.Reminder
+	var account *m.Account
+	var user *m.User
+	var chat *m.Chat
+	var cc *m.ChatContent
+	text := ""
+	err := app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		r = edb.Get[m.Reminder](rc, reminderID)
+		if r == nil || r.IsSent() {
+			r = nil
+			return nil
+		}
+		r.SentTime = rc.Now
+		edb.Put(rc, r)
+
+		account = edb.Get[m.Account](rc, r.AccountID)
+		user = edb.Get[m.User](rc, r.UserID)
+		chat = edb.Get[m.Chat](rc, r.ChatID)
+		if user == nil || chat == nil {
+			return nil
+		}
+		text = "Reminder: " + r.Text
+		cc = loadChatContent(rc, chat.ID)
+		app.addBotMsg(app.addTurn(cc, m.MessageRoleBot), text)
+		edb.Put(rc, cc)
+		return nil
+	})
+	if err != nil || r == nil || cc == nil {
+		return err
+	}
+
+	pushChatContent(rc, chat, cc)
+	app.emailBotMessage(rc, user, chat, account.EmailSubject("Reminder"), text, "reminder")
+	return nil
+}
+
+// emailBotMessage notifies the user of a message the bot has posted on its own.
+// Replying to the email continues the chat when inbound email is configured.
+func (app *App) emailBotMessage(rc *RC, user *m.User, chat *m.Chat, subject, text, category string) {
+	chatURL := strings.TrimSuffix(app.Settings().BaseURL, "/") + app.URL("chat.view", ":chat", chat.ID)
+	replyTo := app.chatReplyAddress(chat.ID)
+	flogger.Log(rc, "Emailing %s a bot message in chat %v", user.Email, chat.ID)
+	app.SendEmail(rc, &mvp.Email{
+		To:      user.Email,
+		ReplyTo: replyTo,
+		Subject: subject,
+		View:    "emails/bot-message",
+		Data: map[string]any{
+			"Name":      user.FirstName(),
+			"ChatTitle": chat.TitleWithFallback(),
+			"Text":      text,
+			"URL":       chatURL,
+			"CanReply":  replyTo != "",
+		},
+		Category: category,
+	})
+}
+
+type CheckInVM struct {
+	Kind     m.CheckInKind
+	Schedule *m.CheckInSchedule // nil if the user hasn't agreed to this check-in
+}
+
+func (vm *CheckInVM) LocalTimeString() string {
+	if vm.Schedule != nil {
+		return vm.Schedule.LocalTimeString()
+	} else if vm.Kind.IsWeekly() {
+		return m.FormatLocalTime(18 * 60)
+	} else {
+		return m.FormatLocalTime(8 * 60)
+	}
+}
+
+func (vm *CheckInVM) Weekday() time.Weekday {
+	if vm.Schedule != nil {
+		return vm.Schedule.Weekday
+	}
+	return time.Sunday
+}
+
+func (vm *CheckInVM) TimeZone() string {
+	if vm.Schedule != nil {
+		return vm.Schedule.TimeZone
+	}
+	return ""
+}
+
+var weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+func loadCheckInSchedule(rc *RC, kind m.CheckInKind) *m.CheckInSchedule {
+	for _, s := range edb.All(edb.ExactIndexScan[m.CheckInSchedule](rc, CheckInSchedulesByAccountUser, m.AccountUser(rc.AccountID(), rc.UserID()))) {
+		if s.Kind == kind {
+			return s
+		}
+	}
+	return nil
+}
+
+func (app *App) showCheckIns(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	var checkIns []*CheckInVM
+	for _, kind := range m.CheckInKinds {
+		checkIns = append(checkIns, &CheckInVM{
+			Kind:     kind,
+			Schedule: loadCheckInSchedule(rc, kind),
+		})
+	}
+	return &mvp.ViewData{
+		View:         "checkins/checkins",
+		Title:        "Check-ins",
+		SemanticPath: "chat/checkins",
+		Data: struct {
+			CheckIns []*CheckInVM
+			Weekdays []time.Weekday
+		}{
+			CheckIns: checkIns,
+			Weekdays: weekdays,
+		},
+	}, nil
+}
+
+func (app *App) saveCheckIn(rc *RC, in *struct {
+	Kind     string `form:"kind,path" json:"-"`
+	Time     string `json:"time"`
+	Weekday  int    `json:"weekday"`
+	TimeZone string `json:"timezone"`
+}) (any, error) {
+	kind, err := m.ParseCheckInKind(in.Kind)
+	if err != nil {
+		return nil, httperrors.NotFound
+	}
+	localTime, err := m.ParseLocalTime(in.Time)
+	if err != nil {
+		return nil, httperrors.BadRequest.Msg(err.Error())
+	}
+	if in.Weekday < 0 || in.Weekday > 6 {
+		return nil, httperrors.BadRequest.Msg("invalid weekday")
+	}
+	tz := strings.TrimSpace(in.TimeZone)
+	if tz == "" {
+		tz = "UTC"
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return nil, httperrors.BadRequest.Msg(fmt.Sprintf("unknown time zone %q", tz))
+	}
+
+	s := loadCheckInSchedule(rc, kind)
+	if s == nil {
+		s = &m.CheckInSchedule{
+			ID:           app.NewID(),
+			AccountID:    rc.AccountID(),
+			UserID:       rc.UserID(),
+			Kind:         kind,
+			CreationTime: rc.Now,
+		}
+	}
+	s.LocalTime = localTime
+	s.Weekday = time.Weekday(in.Weekday)
+	s.TimeZone = tz
+	s.NextRunTime = s.NextRunAfter(rc.Now)
+	edb.Put(rc, s)
+	return app.Redirect("checkins.list"), nil
+}
+
+func (app *App) handleCheckInAction(rc *RC, in *struct {
+	Kind   string `form:"kind,path" json:"-"`
+	Action string `form:"action,path" json:"-"`
+}) (any, error) {
+	kind, err := m.ParseCheckInKind(in.Kind)
+	if err != nil {
+		return nil, httperrors.NotFound
+	}
+	s := loadCheckInSchedule(rc, kind)
+	if s == nil {
+		return nil, httperrors.NotFound
+	}
+
+	switch in.Action {
+	case "pause":
+		s.Paused = true
+		edb.Put(rc, s)
+	case "resume":
+		s.Paused = false
+		s.NextRunTime = s.NextRunAfter(rc.Now) // don't catch up on the missed ones
+		edb.Put(rc, s)
+	case "delete":
+		rc.DBTx().DeleteByKey(CheckInSchedules, s.ID)
+	default:
+		return nil, httperrors.BadRequest.Msg("invalid action")
+	}
+	return app.Redirect("checkins.list"), nil
+}
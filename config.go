@@ -10,4 +10,11 @@ const (
 	MaxMsgTokenCount          = 768
 	MaxSystemPromptTokenCount = 1024
 	MaxResponseTokenCount     = 512
+
+	// Earlier turns of a chat are sent verbatim while they fit into
+	// MaxHistoryTokenCount; once they don't, the oldest turns are folded into
+	// a rolling summary until only HistoryLowWatermarkTokenCount remain.
+	MaxHistoryTokenCount          = 1536
+	HistoryLowWatermarkTokenCount = 768
+	MaxSummaryTokenCount          = 256
 )
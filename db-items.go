@@ -8,21 +8,47 @@ import (
 	m "github.com/andreyvit/buddyd/model"
 )
 
-func loadAccountEmbeddings(rc *RC, accountID m.AccountID) *m.AccountEmbeddings {
-	embs := new(m.AccountEmbeddings)
+// loadAccountEmbeddings loads the embeddings of the content the user can
+// access under the folder ACLs. Zero userID loads the entire library, for
+// staff tooling; a user that no longer exists only sees unrestricted folders.
+func loadAccountEmbeddings(rc *RC, accountID m.AccountID, typ m.EmbeddingType, userID m.UserID) *m.AccountEmbeddings {
+	embs := &m.AccountEmbeddings{Type: typ}
 	embs.Embeddings = edb.All(edb.ExactIndexScan[m.ContentEmbedding](rc, EmbeddingsByAccountType, m.ContentEmbeddingAccountTypeKey{
 		AccountID: accountID,
-		Type:      m.CurrentEmbeddingType,
+		Type:      typ,
 	}))
+	if userID != 0 {
+		if folders := loadAccountLibrary(rc, accountID).AccessibleFolders(edb.Get[m.User](rc, userID), accountID); folders != nil {
+			itemFolders := loadItemFolders(rc, accountID)
+			embs = embs.FilterItems(func(id m.ItemID) bool {
+				return folders[itemFolders[id]]
+			})
+		}
+	}
 	flogger.Log(rc, "Loaded %d embeddings", len(embs.Embeddings))
 	return embs
 }
 
+func loadItemFolders(rc *RC, accountID m.AccountID) map[m.ItemID]m.FolderID {
+	itemFolders := make(map[m.ItemID]m.FolderID)
+	for _, item := range edb.All(edb.ExactIndexScan[m.Item](rc, ItemsByAccount, accountID)) {
+		itemFolders[item.ID] = item.FolderID
+	}
+	return itemFolders
+}
+
 func deleteContentByItem(rc *RC, itemID m.ItemID) {
 	edb.DeleteAll(rc.DBTx().IndexScan(ContentByIRO, edb.ExactScan(m.ContentIROKey{ItemID: itemID}).Prefix(1)))
 	edb.DeleteAll(rc.DBTx().IndexScan(EmbeddingsByItem, edb.ExactScan(itemID)))
 }
 
+func deleteContent(rc *RC, contentID m.ContentID) {
+	rc.DBTx().DeleteByKey(Content, contentID)
+	for _, typ := range []m.EmbeddingType{m.EmbeddingTypeAda002, m.EmbeddingTypeHash} {
+		rc.DBTx().DeleteByKey(Embeddings, m.ContentEmbeddingKey{ContentID: contentID, Type: typ})
+	}
+}
+
 func deleteItem(rc *RC, itemID m.ItemID) {
 	deleteContentByItem(rc, itemID)
 	rc.DBTx().DeleteByKey(Items, itemID)
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"context"
+
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+func (app *App) computeEmbedding(ctx context.Context, text string, typ m.EmbeddingType) (m.Embedding, openai.Price, error) {
+	return app.aiProvider().ComputeEmbedding(ctx, text, typ)
+}
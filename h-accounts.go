@@ -4,6 +4,7 @@ import (
 	"crypto/subtle"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/andreyvit/edb"
@@ -12,6 +13,7 @@ import (
 	"github.com/andreyvit/mvp/flogger"
 	mvpm "github.com/andreyvit/mvp/mvpmodel"
 
+	"github.com/andreyvit/buddyd/internal/webauthn"
 	m "github.com/andreyvit/buddyd/model"
 )
 
@@ -24,10 +26,11 @@ const (
 )
 
 func (app *App) showSignIn(rc *mvp.RC, in *struct {
-	Email    string `json:"email"`
-	CodeSent int    `json:"code_sent"`
-	EmailErr string `json:"email_err"`
-	CodeErr  string `json:"code_err"`
+	Email     string   `json:"email"`
+	CodeSent  int      `json:"code_sent"`
+	EmailErr  string   `json:"email_err"`
+	CodeErr   string   `json:"code_err"`
+	AccountID flake.ID `json:"account"`
 }) (any, error) {
 	if rc.IsLoggedIn() {
 		return app.openApp(fullRC.From(rc))
@@ -61,6 +64,17 @@ func (app *App) showSignIn(rc *mvp.RC, in *struct {
 		}
 	}
 
+	var account *m.Account
+	var hasSSO bool
+	if in.AccountID != 0 {
+		account = edb.Get[m.Account](rc, in.AccountID)
+		if account != nil && account.Disabled {
+			account = nil
+		}
+		_, ssoCfg := loadSSOConfig(rc, in.AccountID)
+		hasSSO = ssoCfg != nil
+	}
+
 	return &mvp.ViewData{
 		View:   "accounts/signin",
 		Title:  "Sign In",
@@ -71,35 +85,46 @@ func (app *App) showSignIn(rc *mvp.RC, in *struct {
 			ErrorMsg string
 			EmailMsg *mvp.Msg
 			CodeMsg  *mvp.Msg
+			Account  *m.Account
+			HasSSO   bool
 		}{
 			Email:    in.Email,
 			CodeSent: in.CodeSent,
 			ErrorMsg: "",
 			EmailMsg: emailMsg,
 			CodeMsg:  codeMsg,
+			Account:  account,
+			HasSSO:   hasSSO,
 		},
 	}, nil
 }
 
 func (app *App) handleSignIn(rc *mvp.RC, in *struct {
-	IsSaving bool   `json:"-" form:",issave"`
-	Email    string `json:"email"`
-	Code     string `json:"code"`
-	Resend   bool   `json:"resend"`
+	IsSaving  bool     `json:"-" form:",issave"`
+	Email     string   `json:"email"`
+	Code      string   `json:"code"`
+	Resend    bool     `json:"resend"`
+	AccountID flake.ID `json:"account"`
 }) (any, error) {
 	if in.Email == "" {
-		return app.Redirect("signin", url.Values{
+		return app.Redirect("signin", signInAccountParam(url.Values{
 			"email":     {in.Email},
 			"email_err": {"Email is required."},
-		}), nil
+		}, in.AccountID)), nil
 	}
 
-	a := edb.Get[m.UserSignInAttempt](rc, in.Email)
+	// keyed by the canonical email, so that variations of the address share
+	// the failure counter
+	key := mvp.CanonicalEmail(in.Email)
+	a := edb.Get[m.UserSignInAttempt](rc, key)
 	if a == nil {
 		a = &m.UserSignInAttempt{
-			Email: in.Email,
+			Email: key,
 		}
 	}
+	if a.IsLocked(rc.Now) {
+		return app.signInLockedOut(rc, a, in.Email, in.AccountID), nil
+	}
 
 	if a.Code != "" {
 		exp := a.Time.Add(app.Settings().SignInCodeExpiration.Value())
@@ -111,10 +136,27 @@ func (app *App) handleSignIn(rc *mvp.RC, in *struct {
 	var codeErr string
 	if in.Code != "" && a.Code != "" {
 		if 1 == subtle.ConstantTimeCompare([]byte(in.Code), []byte(a.Code)) {
-			return app.finishSignIn(rc, a.Email)
-		} else {
-			codeErr = "Code is incorrect."
+			rc.DBTx().DeleteByKey(UserSignInAttempts, a.Email)
+			return app.finishSignIn(rc, in.Email, in.AccountID)
 		}
+		settings := app.Settings()
+		locked := a.RecordFailure(rc.Now, settings.SignInMaxCodeFailures, settings.SignInLockoutDuration.Value(), settings.SignInMaxLockoutDuration.Value())
+		edb.Put(rc, a)
+		if locked {
+			flogger.Log(rc, "WARNING: sign-in codes for %s locked until %v after too many wrong guesses", a.Email, a.LockedUntil)
+			app.SendEmail(rc, &mvp.Email{
+				To:      in.Email,
+				Subject: "LibroAI Sign In Locked",
+				View:    "emails/signin-lockout",
+				Data: map[string]any{
+					"Email": in.Email,
+					"Wait":  formatWait(a.LockedUntil.Sub(rc.Now)),
+				},
+				Category: "signin",
+			})
+			return app.signInLockedOut(rc, a, in.Email, in.AccountID), nil
+		}
+		codeErr = "Code is incorrect."
 	}
 
 	var sent int
@@ -148,19 +190,146 @@ func (app *App) handleSignIn(rc *mvp.RC, in *struct {
 			Category: "signin",
 		})
 	}
-	return app.Redirect("signin", url.Values{
+	return app.Redirect("signin", signInAccountParam(url.Values{
 		"email":     {in.Email},
 		"code_sent": {strconv.Itoa(sent)},
 		"code_err":  {codeErr},
-	}), nil
+	}, in.AccountID)), nil
+}
+
+func (app *App) signInLockedOut(rc *mvp.RC, a *m.UserSignInAttempt, email string, accountID m.AccountID) *mvp.Redirect {
+	return app.Redirect("signin", signInAccountParam(url.Values{
+		"email":     {email},
+		"email_err": {"Too many incorrect codes. Please try again in " + formatWait(a.LockedUntil.Sub(rc.Now)) + "."},
+	}, accountID))
 }
 
-func (app *App) finishSignIn(rc *mvp.RC, email string) (any, error) {
+// formatWait describes a wait in whole minutes or hours, rounding up.
+func formatWait(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	switch {
+	case minutes <= 1:
+		return "a minute"
+	case minutes < 120:
+		return strconv.Itoa(minutes) + " minutes"
+	default:
+		return strconv.Itoa((minutes+59)/60) + " hours"
+	}
+}
+
+// signInAccountParam keeps the account of an account-specific sign-in link
+// across the sign-in redirects.
+func signInAccountParam(params url.Values, accountID m.AccountID) url.Values {
+	if accountID != 0 {
+		params.Set("account", accountID.String())
+	}
+	return params
+}
+
+// deleteExpiredSignInAttempts removes passkey challenges, SSO attempts and
+// Telegram link tokens that have been abandoned halfway, forgets sign-in
+// codes and their failure counters after a while, and forgets consumed SAML
+// assertions once they could no longer be replayed.
+func (app *App) deleteExpiredSignInAttempts(rc *RC) error {
+	retention := app.Settings().SignInAttemptRetention.Value()
+	return app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		for _, a := range edb.All(edb.TableScan[m.UserSignInAttempt](rc, edb.FullScan())) {
+			if a.IsStale(rc.Now, retention) {
+				rc.DBTx().DeleteByKey(UserSignInAttempts, a.Email)
+			}
+		}
+		for _, ch := range edb.All(edb.TableScan[m.PasskeyChallenge](rc, edb.FullScan())) {
+			if rc.Now.Sub(ch.CreationTime) > webauthn.Timeout {
+				rc.DBTx().DeleteByKey(PasskeyChallenges, ch.Challenge)
+			}
+		}
+		for _, attempt := range edb.All(edb.TableScan[m.SSOLoginAttempt](rc, edb.FullScan())) {
+			if attempt.IsExpired(rc.Now, ssoAttemptTTL) {
+				rc.DBTx().DeleteByKey(SSOLoginAttempts, attempt.ID)
+			}
+		}
+		for _, a := range edb.All(edb.TableScan[m.SAMLAssertion](rc, edb.FullScan())) {
+			if a.IsExpired(rc.Now) {
+				rc.DBTx().DeleteByKey(SAMLAssertions, a.ID)
+			}
+		}
+		for _, link := range edb.All(edb.TableScan[m.ConnectorLink](rc, edb.FullScan())) {
+			if link.IsExpired(rc.Now) {
+				rc.DBTx().DeleteByKey(ConnectorLinks, link.Token)
+			}
+		}
+		return nil
+	})
+}
+
+// signInFailure shows an error on the sign-in page, for sign-in methods that
+// leave the page (SSO, passkeys).
+func (app *App) signInFailure(accountID m.AccountID, msg string) *mvp.Redirect {
+	return app.Redirect("signin", signInAccountParam(url.Values{
+		"email_err": {msg},
+	}, accountID))
+}
+
+// signupLinkURL is the sign-in link that lets people join an account with
+// the open sign-up policy.
+func (app *App) signupLinkURL(account *m.Account) string {
+	return strings.TrimSuffix(app.Settings().BaseURL, "/") + app.URL("signin", "?account", account.ID)
+}
+
+// finishSignIn starts a session for a user who has confirmed their email,
+// adding them to every account whose sign-up policy admits them; linkAccountID
+// is the account whose sign-in link they've followed, if any. People who
+// aren't users and aren't admitted anywhere end up on the waitlist.
+func (app *App) finishSignIn(rc *mvp.RC, email string, linkAccountID m.AccountID) (any, error) {
 	flogger.Log(rc, "Signed in as %s", email)
 	emailNorm := mvp.CanonicalEmail(email)
 
-	if u := edb.Lookup[m.User](rc, UsersByEmail, emailNorm); u != nil {
-		app.startSession(rc, u)
+	u := edb.Lookup[m.User](rc, UsersByEmail, emailNorm)
+	var accounts []*m.Account
+	var sources []m.UserSource
+	for _, acc := range edb.All(edb.TableScan[m.Account](rc, edb.FullScan())) {
+		if source := acc.SignupSource(emailNorm, acc.ID == linkAccountID); source != m.UserSourceDefault {
+			accounts = append(accounts, acc)
+			sources = append(sources, source)
+		}
+	}
+	if len(accounts) > 0 {
+		if u == nil {
+			name, _, _ := strings.Cut(email, "@")
+			u = &m.User{
+				ID:        app.NewID(),
+				Role:      m.UserSystemRoleRegular,
+				Email:     email,
+				EmailNorm: emailNorm,
+				Name:      name,
+			}
+		}
+		var modified bool
+		for i, acc := range accounts {
+			// never bring back users who have been deactivated or banned
+			if u.Membership(acc.ID) != nil {
+				continue
+			}
+			flogger.Log(rc, "Sign-up policy %v of account %v admits %s (source %d)", acc.SignupPolicy, acc.ID, email, sources[i])
+			u.Memberships = append(u.Memberships, &m.UserMembership{
+				CreationTime: rc.Now,
+				AccountID:    acc.ID,
+				Role:         m.UserAccountRoleConsumer,
+				Status:       m.UserStatusActive,
+				Source:       sources[i],
+			})
+			modified = true
+		}
+		if modified {
+			edb.Put(rc, u)
+			if wl := edb.Lookup[m.Waitlister](rc, WaitlistersByEmail, emailNorm); wl != nil {
+				rc.DBTx().DeleteByKey(Waitlisters, wl.ID)
+			}
+		}
+	}
+
+	if u != nil {
+		app.startSession(rc, u, linkAccountID)
 		return app.openApp(fullRC.From(rc))
 	}
 
@@ -174,7 +343,7 @@ func (app *App) finishSignIn(rc *mvp.RC, email string) (any, error) {
 		}
 		edb.Put(rc, wl)
 	}
-	app.startSession(rc, wl)
+	app.startSession(rc, wl, 0)
 	return app.Redirect("landing.waitlist"), nil
 }
 
@@ -186,14 +355,21 @@ func (app *App) openApp(rc *RC) (*mvp.Redirect, error) {
 	}
 }
 
-func (app *App) startSession(rc *mvp.RC, actor m.Actor) {
+// startSession signs the actor in, opening preferredAccountID if they're
+// a member of it, or their first account otherwise.
+func (app *App) startSession(rc *mvp.RC, actor m.Actor, preferredAccountID m.AccountID) {
 	sess := &m.Session{
 		ID:           app.NewID(),
 		Actor:        mvpm.RefTo(actor),
 		LastActivity: rc.Now,
+		CreationTime: rc.Now,
+		UserAgent:    rc.Request.Request.UserAgent(),
+		IP:           clientIP(rc.Request.Request),
 	}
 	if user, ok := actor.(*m.User); ok {
-		if len(user.Memberships) > 0 {
+		if preferredAccountID != 0 && user.Membership(preferredAccountID) != nil {
+			sess.AccountID = preferredAccountID
+		} else if len(user.Memberships) > 0 {
 			sess.AccountID = user.Memberships[0].AccountID
 		}
 	}
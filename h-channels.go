@@ -12,15 +12,39 @@ var (
 	chatChannelFamily = &mvplive.ChannelFamily{
 		Name: "chat",
 	}
+
+	// chatModChannelFamily carries the moderator rendering of chats, which
+	// includes tool results, prompts and notes, so only staff may subscribe.
+	chatModChannelFamily = &mvplive.ChannelFamily{
+		Name: "chat-mod",
+	}
 )
 
-func (app *App) handleChatEventStream(rc *mvp.RC, in *struct {
+func (app *App) handleChatEventStream(rc *RC, in *struct {
 	ChatID      m.ChatID `form:"chat,path" json:"-"`
 	LastEventID uint64   `form:"Last-Event-ID,header,optional" json:"-"`
 }) (any, error) {
-	app.Subscribe(rc, rc, rc.RespWriter, mvplive.Channel{
-		Family: chatChannelFamily,
-		Topic:  in.ChatID.String(),
-	}, flake.ID(in.LastEventID))
+	chat, err := loadModChat(rc, in.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	if chat.UserID != rc.UserID() {
+		if err := rc.Check(m.PermissionAccessAdminArea, nil); err != nil {
+			return nil, mvp.ErrForbidden.Wrap(err)
+		}
+	}
+	app.Subscribe(rc.BaseRC(), rc.BaseRC(), rc.RespWriter, chatChannel(chat.ID), flake.ID(in.LastEventID))
+	return mvp.ResponseHandled{}, nil
+}
+
+func (app *App) handleModChatEventStream(rc *RC, in *struct {
+	ChatID      m.ChatID `form:"chat,path" json:"-"`
+	LastEventID uint64   `form:"Last-Event-ID,header,optional" json:"-"`
+}) (any, error) {
+	chat, err := loadModChat(rc, in.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	app.Subscribe(rc.BaseRC(), rc.BaseRC(), rc.RespWriter, chatModChannel(chat.ID), flake.ID(in.LastEventID))
 	return mvp.ResponseHandled{}, nil
 }
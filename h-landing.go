@@ -6,7 +6,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/andreyvit/edb"
 	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
 )
 
 func (app *App) showLandingHome(rc *mvp.RC, in *struct{}) (*mvp.ViewData, error) {
@@ -32,6 +36,25 @@ func (app *App) handleLandingSignup(rc *mvp.RC, in *struct {
 	CompanyName string `json:"organization"`
 	FullName    string `json:"name"`
 }) (*mvp.Redirect, error) {
+	emailNorm := mvp.CanonicalEmail(in.Email)
+	if emailNorm == "" {
+		return nil, httperrors.BadRequest.Msg("email is required")
+	}
+	if edb.Lookup[m.User](rc, UsersByEmail, emailNorm) == nil {
+		wl := edb.Lookup[m.Waitlister](rc, WaitlistersByEmail, emailNorm)
+		if wl == nil {
+			wl = &m.Waitlister{
+				ID:        app.NewID(),
+				Email:     in.Email,
+				EmailNorm: emailNorm,
+			}
+		}
+		wl.FullName = strings.TrimSpace(in.FullName)
+		wl.CompanyName = strings.TrimSpace(in.CompanyName)
+		wl.SignupTime = rc.Now
+		edb.Put(rc, wl)
+	}
+
 	app.SendEmail(rc, &mvp.Email{
 		From:    "libroai@tarantsov.com",
 		To:      "andrey@tarantsov.com",
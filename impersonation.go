@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+var errImpersonating = errors.New("This action is not available while impersonating a user.")
+
+// readOnlyImpersonationMiddleware refuses every request that could change
+// something while a superadmin is impersonating a user, except for stopping
+// the impersonation. Impersonation is meant for looking, not acting.
+func (app *App) readOnlyImpersonationMiddleware(rc *RC) (any, error) {
+	if !rc.IsImpersonating() {
+		return nil, nil
+	}
+	switch rc.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		return nil, nil
+	}
+	if rc.Request.URL.Path == app.URL("impersonation.stop") {
+		return nil, nil
+	}
+	return nil, mvp.ErrForbidden.Wrap(errImpersonating)
+}
+
+// auditLogLimit is how many recent events the audit log page shows.
+const auditLogLimit = 200
+
+func (app *App) recordAuditEvent(rc *RC, action m.AuditAction, userID m.UserID, accountID m.AccountID) {
+	ev := &m.AuditEvent{
+		ID:        app.NewID(),
+		Time:      rc.Now,
+		Action:    action,
+		ActorID:   rc.OriginalUser.ID,
+		UserID:    userID,
+		AccountID: accountID,
+		SessionID: rc.Session.ID,
+		IP:        clientIP(rc.Request.Request),
+	}
+	edb.Put(rc, ev)
+}
+
+// startImpersonation makes the current session act as another user, so that
+// superadmins can see exactly what the user sees. Superadmins cannot be
+// impersonated, which keeps impersonation from escalating privileges.
+func (app *App) startImpersonation(rc *RC, in *struct {
+	UserID flake.ID `form:"user,path" json:"-"`
+}) (any, error) {
+	u := edb.Get[m.User](rc, in.UserID)
+	if u == nil {
+		return nil, httperrors.Errorf(404, "", "User not found")
+	}
+	if u.ID == rc.OriginalUser.ID || u.Role.IsSuper() {
+		return nil, httperrors.BadRequest.Msg("cannot impersonate this user")
+	}
+
+	accountID := rc.AccountID()
+	if u.Membership(accountID) == nil {
+		accountID = 0
+		if len(u.Memberships) > 0 {
+			accountID = u.Memberships[0].AccountID
+		}
+	}
+	rc.Session.ImpersonatedUserID = u.ID
+	rc.Session.AccountID = accountID
+	edb.Put(rc, rc.Session)
+	app.recordAuditEvent(rc, m.AuditActionImpersonationStart, u.ID, accountID)
+	flogger.Log(rc, "%s started impersonating %s", rc.OriginalUser.Email, u.Email)
+	return app.Redirect("chat.home"), nil
+}
+
+func (app *App) stopImpersonation(rc *RC, in *struct{}) (any, error) {
+	if !rc.IsImpersonating() {
+		return app.Redirect("chat.home"), nil
+	}
+	app.recordAuditEvent(rc, m.AuditActionImpersonationStop, rc.User.ID, rc.AccountID())
+	flogger.Log(rc, "%s stopped impersonating %s", rc.OriginalUser.Email, rc.User.Email)
+	rc.Session.ImpersonatedUserID = 0
+	edb.Put(rc, rc.Session)
+	return app.Redirect("admin.users"), nil
+}
+
+type AuditEventVM struct {
+	*m.AuditEvent
+	Actor *m.User
+	User  *m.User
+}
+
+func (app *App) showAuditLog(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	events := edb.All(edb.TableScan[m.AuditEvent](rc, edb.FullScan()))
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+	if len(events) > auditLogLimit {
+		events = events[:auditLogLimit]
+	}
+
+	users := make(map[m.UserID]*m.User)
+	loadUser := func(id m.UserID) *m.User {
+		if id == 0 {
+			return nil
+		}
+		if u, ok := users[id]; ok {
+			return u
+		}
+		u := edb.Get[m.User](rc, id)
+		users[id] = u
+		return u
+	}
+	vms := make([]*AuditEventVM, len(events))
+	for i, ev := range events {
+		vms[i] = &AuditEventVM{
+			AuditEvent: ev,
+			Actor:      loadUser(ev.ActorID),
+			User:       loadUser(ev.UserID),
+		}
+	}
+
+	return &mvp.ViewData{
+		View:         "superadmin/audit",
+		Title:        "Audit Log",
+		SemanticPath: "superadmin/audit",
+		Data: struct {
+			Events []*AuditEventVM
+		}{
+			Events: vms,
+		},
+	}, nil
+}
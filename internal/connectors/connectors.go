@@ -0,0 +1,88 @@
+// Package connectors talks to the chat platforms (Slack, Telegram) where
+// users can talk to the bot without opening LibroAI.
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Message is an incoming user message, normalized across platforms.
+type Message struct {
+	Conversation string // Slack channel or Telegram chat ID
+	Thread       string // Slack thread timestamp; empty on Telegram
+	MessageID    string
+	UserID       string // platform user ID
+	UserName     string
+	Text         string
+	IsDirect     bool // a DM rather than a channel or group message
+}
+
+// ThreadKey identifies the conversation the message belongs to. Each
+// participant of a channel thread gets a separate LibroAI chat.
+func (msg *Message) ThreadKey() string {
+	return msg.Conversation + "/" + msg.Thread + "/" + msg.UserID
+}
+
+// Client posts the bot's answers back to the platform.
+type Client interface {
+	// Post sends a new message and returns its ID for later edits.
+	Post(ctx context.Context, conversation, thread, text string) (string, error)
+	// Edit replaces the text of a message sent by Post.
+	Edit(ctx context.Context, conversation, messageID, text string) error
+}
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleRequest     = errors.New("webhook request is too old")
+)
+
+// APIError is an error reported by the platform's API.
+type APIError struct {
+	Method  string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Method, e.Message)
+}
+
+func postJSON(ctx context.Context, httpClient *http.Client, url string, header http.Header, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return doJSON(httpClient, req, out)
+}
+
+func doJSON(httpClient *http.Client, req *http.Request, out any) error {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("HTTP %d: %w", resp.StatusCode, err)
+	}
+	return nil
+}
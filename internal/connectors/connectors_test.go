@@ -0,0 +1,240 @@
+package connectors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func signSlack(secret string, ts time.Time, body []byte) http.Header {
+	tsStr := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + tsStr + ":"))
+	mac.Write(body)
+	return http.Header{
+		"X-Slack-Request-Timestamp": {tsStr},
+		"X-Slack-Signature":         {"v0=" + hex.EncodeToString(mac.Sum(nil))},
+	}
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	const secret = "8f742231b10e8888abcd99yyyzzz85a5"
+	now := time.Unix(1686300000, 0)
+	body := loadFixture(t, "slack-dm.json")
+
+	if err := VerifySlackSignature(secret, signSlack(secret, now, body), body, now.Add(time.Minute)); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := VerifySlackSignature(secret, signSlack("other", now, body), body, now); err != ErrInvalidSignature {
+		t.Errorf("wrong secret: %v", err)
+	}
+	if err := VerifySlackSignature(secret, signSlack(secret, now, body), append(body, ' '), now); err != ErrInvalidSignature {
+		t.Errorf("tampered body: %v", err)
+	}
+	if err := VerifySlackSignature(secret, signSlack(secret, now, body), body, now.Add(10*time.Minute)); err != ErrStaleRequest {
+		t.Errorf("replayed request: %v", err)
+	}
+	if err := VerifySlackSignature(secret, http.Header{}, body, now); err != ErrInvalidSignature {
+		t.Errorf("unsigned request: %v", err)
+	}
+}
+
+func TestVerifyTelegramSecret(t *testing.T) {
+	h := http.Header{"X-Telegram-Bot-Api-Secret-Token": {"s3cret"}}
+	if err := VerifyTelegramSecret("s3cret", h); err != nil {
+		t.Errorf("valid secret: %v", err)
+	}
+	if err := VerifyTelegramSecret("other", h); err != ErrInvalidSignature {
+		t.Errorf("wrong secret: %v", err)
+	}
+	if err := VerifyTelegramSecret("", http.Header{}); err != ErrInvalidSignature {
+		t.Errorf("unconfigured secret: %v", err)
+	}
+}
+
+func TestSlackFixtures(t *testing.T) {
+	env, err := ParseSlackEnvelope(loadFixture(t, "slack-url-verification.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Type != "url_verification" || env.Challenge == "" {
+		t.Errorf("url_verification = %+v", env)
+	}
+
+	tests := []struct {
+		fixture  string
+		expected *Message
+	}{
+		{"slack-dm.json", &Message{Conversation: "D024BE91L", MessageID: "1686300000.000100", UserID: "U0G9QF9C6", Text: "How do I plan my week?", IsDirect: true}},
+		{"slack-app-mention.json", &Message{Conversation: "C0LAN2Q65", Thread: "1686300100.000200", MessageID: "1686300100.000200", UserID: "U0G9QF9C6", Text: "what's in the second lesson?"}},
+		{"slack-bot-message.json", nil},
+		{"slack-url-verification.json", nil},
+	}
+	for _, tt := range tests {
+		env, err := ParseSlackEnvelope(loadFixture(t, tt.fixture))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.fixture, err)
+		}
+		msg, _ := env.UserMessage()
+		checkMessage(t, tt.fixture, msg, tt.expected)
+	}
+}
+
+func TestTelegramFixtures(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected *Message
+	}{
+		{"telegram-private.json", &Message{Conversation: "1111111", MessageID: "1365", UserID: "1111111", UserName: "Alice Smith", Text: "How do I plan my week?", IsDirect: true}},
+		{"telegram-group.json", &Message{Conversation: "-100123456789", MessageID: "88", UserID: "2222222", UserName: "Bob", Text: "what's in the second lesson?"}},
+		{"telegram-group-chatter.json", nil},
+	}
+	for _, tt := range tests {
+		upd, err := ParseTelegramUpdate(loadFixture(t, tt.fixture))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.fixture, err)
+		}
+		msg, _ := upd.UserMessage("LibroAIBot")
+		checkMessage(t, tt.fixture, msg, tt.expected)
+	}
+
+	upd, _ := ParseTelegramUpdate(loadFixture(t, "telegram-start.json"))
+	msg, _ := upd.UserMessage("LibroAIBot")
+	if param, ok := StartParam(msg.Text); !ok || param != "42-0c448d9ba9697edc" {
+		t.Errorf("StartParam(%q) = %q, %v", msg.Text, param, ok)
+	}
+	if _, ok := StartParam("How do I start?"); ok {
+		t.Errorf("StartParam accepted a regular message")
+	}
+}
+
+func checkMessage(t *testing.T, fixture string, actual, expected *Message) {
+	t.Helper()
+	switch {
+	case actual == nil && expected == nil:
+	case actual == nil || expected == nil:
+		t.Errorf("%s: Message = %+v, wanted %+v", fixture, actual, expected)
+	case *actual != *expected:
+		t.Errorf("%s: Message = %+v, wanted %+v", fixture, *actual, *expected)
+	}
+}
+
+// stubAPI records the calls made to a fake platform API.
+type stubAPI struct {
+	mut   sync.Mutex
+	calls []stubCall
+	reply func(path string) any
+}
+
+type stubCall struct {
+	Path   string
+	Auth   string
+	Query  string
+	Params map[string]any
+}
+
+func (s *stubAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	call := stubCall{Path: r.URL.Path, Auth: r.Header.Get("Authorization"), Query: r.URL.RawQuery}
+	if len(body) > 0 {
+		json.Unmarshal(body, &call.Params)
+	}
+	s.mut.Lock()
+	s.calls = append(s.calls, call)
+	s.mut.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.reply(r.URL.Path))
+}
+
+func TestSlackClient(t *testing.T) {
+	stub := &stubAPI{reply: func(path string) any {
+		switch path {
+		case "/api/users.info":
+			return map[string]any{"ok": true, "user": map[string]any{"id": "U0G9QF9C6", "profile": map[string]any{"email": "alice@example.com"}}}
+		case "/api/chat.update":
+			return map[string]any{"ok": false, "error": "message_not_found"}
+		default:
+			return map[string]any{"ok": true, "channel": "C0LAN2Q65", "ts": "1686300101.000300"}
+		}
+	}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &SlackClient{BaseURL: srv.URL + "/api/", Token: "xoxb-test"}
+
+	email, err := c.UserEmail(ctx, "U0G9QF9C6")
+	if err != nil || email != "alice@example.com" {
+		t.Errorf("UserEmail = %q, %v", email, err)
+	}
+	ts, err := c.Post(ctx, "C0LAN2Q65", "1686300100.000200", "…")
+	if err != nil || ts != "1686300101.000300" {
+		t.Errorf("Post = %q, %v", ts, err)
+	}
+	err = c.Edit(ctx, "C0LAN2Q65", ts, "Lesson two covers weekly planning.")
+	if err == nil || err.Error() != "chat.update: message_not_found" {
+		t.Errorf("Edit error = %v", err)
+	}
+
+	if len(stub.calls) != 3 {
+		t.Fatalf("calls = %+v", stub.calls)
+	}
+	if c := stub.calls[0]; c.Query != "user=U0G9QF9C6" || c.Auth != "Bearer xoxb-test" {
+		t.Errorf("users.info call = %+v", c)
+	}
+	if c := stub.calls[1]; c.Params["channel"] != "C0LAN2Q65" || c.Params["thread_ts"] != "1686300100.000200" || c.Auth != "Bearer xoxb-test" {
+		t.Errorf("chat.postMessage call = %+v", c)
+	}
+	if c := stub.calls[2]; c.Params["ts"] != ts || c.Params["text"] != "Lesson two covers weekly planning." {
+		t.Errorf("chat.update call = %+v", c)
+	}
+}
+
+func TestTelegramClient(t *testing.T) {
+	stub := &stubAPI{reply: func(path string) any {
+		return map[string]any{"ok": true, "result": map[string]any{"message_id": 1366}}
+	}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &TelegramClient{BaseURL: srv.URL, Token: "123:ABC"}
+
+	id, err := c.Post(ctx, "1111111", "", "…")
+	if err != nil || id != "1366" {
+		t.Errorf("Post = %q, %v", id, err)
+	}
+	if err := c.Edit(ctx, "1111111", id, "Start with your calendar."); err != nil {
+		t.Errorf("Edit: %v", err)
+	}
+
+	if len(stub.calls) != 2 {
+		t.Fatalf("calls = %+v", stub.calls)
+	}
+	if c := stub.calls[0]; c.Path != "/bot123:ABC/sendMessage" || c.Params["chat_id"] != "1111111" {
+		t.Errorf("sendMessage call = %+v", c)
+	}
+	if c := stub.calls[1]; c.Path != "/bot123:ABC/editMessageText" || c.Params["message_id"] != float64(1366) || c.Params["text"] != "Start with your calendar." {
+		t.Errorf("editMessageText call = %+v", c)
+	}
+}
@@ -0,0 +1,196 @@
+package connectors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SlackAPIBaseURL = "https://slack.com/api/"
+
+	// slackMaxRequestAge guards against replayed webhooks, per Slack's recommendation.
+	slackMaxRequestAge = 5 * time.Minute
+)
+
+// VerifySlackSignature checks the X-Slack-Signature header of an Events API request.
+func VerifySlackSignature(signingSecret string, header http.Header, body []byte, now time.Time) error {
+	tsStr := header.Get("X-Slack-Request-Timestamp")
+	sig := header.Get("X-Slack-Signature")
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil || sig == "" || signingSecret == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return ErrStaleRequest
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + tsStr + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// IsSlackRetry returns whether Slack is redelivering an event we have
+// already received (it retries when we're slow to respond).
+func IsSlackRetry(header http.Header) bool {
+	return header.Get("X-Slack-Retry-Num") != ""
+}
+
+// SlackEnvelope is the outer payload of an Events API request.
+type SlackEnvelope struct {
+	Type      string     `json:"type"` // url_verification or event_callback
+	Challenge string     `json:"challenge"`
+	TeamID    string     `json:"team_id"`
+	EventID   string     `json:"event_id"`
+	Event     SlackEvent `json:"event"`
+}
+
+type SlackEvent struct {
+	Type        string `json:"type"` // message or app_mention
+	Subtype     string `json:"subtype"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+}
+
+func ParseSlackEnvelope(body []byte) (*SlackEnvelope, error) {
+	var env SlackEnvelope
+	err := json.Unmarshal(body, &env)
+	if err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+var slackMentionRe = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+// UserMessage returns the user message to answer, if any. The bot answers DMs,
+// and mentions in channels, replying in a thread.
+func (env *SlackEnvelope) UserMessage() (*Message, bool) {
+	e := &env.Event
+	if env.Type != "event_callback" || e.User == "" || e.BotID != "" || e.Subtype != "" {
+		return nil, false
+	}
+	msg := &Message{
+		Conversation: e.Channel,
+		Thread:       e.ThreadTS,
+		MessageID:    e.TS,
+		UserID:       e.User,
+		Text:         strings.TrimSpace(slackMentionRe.ReplaceAllString(e.Text, "")),
+	}
+	switch {
+	case e.Type == "message" && e.ChannelType == "im":
+		msg.IsDirect = true
+	case e.Type == "app_mention":
+		if msg.Thread == "" {
+			msg.Thread = e.TS
+		}
+	default:
+		return nil, false
+	}
+	if msg.Text == "" {
+		return nil, false
+	}
+	return msg, true
+}
+
+// SlackClient calls Slack's Web API with a bot token.
+type SlackClient struct {
+	BaseURL    string // defaults to SlackAPIBaseURL
+	Token      string
+	HTTPClient *http.Client
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+	User  struct {
+		Profile struct {
+			Email string `json:"email"`
+		} `json:"profile"`
+	} `json:"user"`
+}
+
+func (c *SlackClient) Post(ctx context.Context, channel, thread, text string) (string, error) {
+	resp, err := c.call(ctx, "chat.postMessage", map[string]string{
+		"channel":   channel,
+		"thread_ts": thread,
+		"text":      text,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.TS, nil
+}
+
+func (c *SlackClient) Edit(ctx context.Context, channel, messageID, text string) error {
+	_, err := c.call(ctx, "chat.update", map[string]string{
+		"channel": channel,
+		"ts":      messageID,
+		"text":    text,
+	})
+	return err
+}
+
+// UserEmail returns the email of a workspace member. Requires the users:read.email scope.
+func (c *SlackClient) UserEmail(ctx context.Context, userID string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.methodURL("users.info")+"?"+url.Values{"user": {userID}}.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	var resp slackResponse
+	err = doJSON(c.HTTPClient, req, &resp)
+	if err == nil && !resp.OK {
+		err = &APIError{"users.info", resp.Error}
+	}
+	if err != nil {
+		return "", err
+	}
+	return resp.User.Profile.Email, nil
+}
+
+func (c *SlackClient) call(ctx context.Context, method string, params map[string]string) (*slackResponse, error) {
+	for k, v := range params {
+		if v == "" {
+			delete(params, k)
+		}
+	}
+	var resp slackResponse
+	err := postJSON(ctx, c.HTTPClient, c.methodURL(method), http.Header{
+		"Authorization": {"Bearer " + c.Token},
+	}, params, &resp)
+	if err == nil && !resp.OK {
+		err = &APIError{method, resp.Error}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *SlackClient) methodURL(method string) string {
+	base := c.BaseURL
+	if base == "" {
+		base = SlackAPIBaseURL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + method
+}
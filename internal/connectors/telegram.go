@@ -0,0 +1,146 @@
+package connectors
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const TelegramAPIBaseURL = "https://api.telegram.org/"
+
+// VerifyTelegramSecret checks the secret token we've passed to setWebhook,
+// which Telegram sends back with every update.
+func VerifyTelegramSecret(secret string, header http.Header) error {
+	actual := header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(actual), []byte(secret)) != 1 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type TelegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *TelegramMessage `json:"message"`
+}
+
+type TelegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *TelegramUser `json:"from"`
+	Chat      TelegramChat  `json:"chat"`
+	Text      string        `json:"text"`
+}
+
+type TelegramUser struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+type TelegramChat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"` // private, group, supergroup or channel
+}
+
+func ParseTelegramUpdate(body []byte) (*TelegramUpdate, error) {
+	var upd TelegramUpdate
+	err := json.Unmarshal(body, &upd)
+	if err != nil {
+		return nil, err
+	}
+	return &upd, nil
+}
+
+// UserMessage returns the user message to answer, if any. The bot answers
+// private chats, and messages mentioning @botUsername in groups.
+func (upd *TelegramUpdate) UserMessage(botUsername string) (*Message, bool) {
+	tm := upd.Message
+	if tm == nil || tm.From == nil || tm.From.IsBot || strings.TrimSpace(tm.Text) == "" {
+		return nil, false
+	}
+	msg := &Message{
+		Conversation: strconv.FormatInt(tm.Chat.ID, 10),
+		MessageID:    strconv.FormatInt(tm.MessageID, 10),
+		UserID:       strconv.FormatInt(tm.From.ID, 10),
+		UserName:     strings.TrimSpace(tm.From.FirstName + " " + tm.From.LastName),
+		Text:         strings.TrimSpace(tm.Text),
+		IsDirect:     tm.Chat.Type == "private",
+	}
+	if !msg.IsDirect {
+		mention := "@" + botUsername
+		if botUsername == "" || !strings.Contains(msg.Text, mention) {
+			return nil, false
+		}
+		msg.Text = strings.TrimSpace(strings.ReplaceAll(msg.Text, mention, ""))
+	}
+	return msg, msg.Text != ""
+}
+
+// StartParam returns the deep link parameter of a /start command, which is
+// how a Telegram account gets linked to a LibroAI user.
+func StartParam(text string) (string, bool) {
+	cmd, param, _ := strings.Cut(strings.TrimSpace(text), " ")
+	if cmd != "/start" {
+		return "", false
+	}
+	return strings.TrimSpace(param), true
+}
+
+// TelegramClient calls the Telegram Bot API.
+type TelegramClient struct {
+	BaseURL    string // defaults to TelegramAPIBaseURL
+	Token      string
+	HTTPClient *http.Client
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Result      struct {
+		MessageID int64 `json:"message_id"`
+	} `json:"result"`
+}
+
+func (c *TelegramClient) Post(ctx context.Context, chatID, thread, text string) (string, error) {
+	resp, err := c.call(ctx, "sendMessage", map[string]any{
+		"chat_id": chatID,
+		"text":    text,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(resp.Result.MessageID, 10), nil
+}
+
+func (c *TelegramClient) Edit(ctx context.Context, chatID, messageID, text string) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return err
+	}
+	_, err = c.call(ctx, "editMessageText", map[string]any{
+		"chat_id":    chatID,
+		"message_id": id,
+		"text":       text,
+	})
+	return err
+}
+
+func (c *TelegramClient) call(ctx context.Context, method string, params map[string]any) (*telegramResponse, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = TelegramAPIBaseURL
+	}
+	var resp telegramResponse
+	err := postJSON(ctx, c.HTTPClient, strings.TrimSuffix(base, "/")+"/bot"+c.Token+"/"+method, nil, params, &resp)
+	if err == nil && !resp.OK {
+		err = &APIError{method, resp.Description}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,87 @@
+// Package domainverify proves that an account controls an email domain,
+// by having its owner publish a token in a DNS TXT record of the domain.
+package domainverify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RecordPrefix starts the TXT record value, followed by the token.
+const RecordPrefix = "libroai-verification="
+
+var (
+	ErrInvalidDomain = errors.New("invalid domain name")
+	ErrRecordMissing = errors.New("verification TXT record not found")
+)
+
+// Resolver looks up TXT records. *net.Resolver implements it; tests stub it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NewToken returns a random verification token.
+func NewToken() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Record returns the TXT record value the domain owner needs to publish.
+func Record(token string) string {
+	return RecordPrefix + token
+}
+
+// NormalizeDomain lowercases the domain, also accepting an email address or
+// @domain, and checks that it looks like a registrable host name.
+func NormalizeDomain(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		s = s[i+1:]
+	}
+	s = strings.TrimSuffix(strings.ToLower(s), ".")
+	if len(s) > 253 || !strings.Contains(s, ".") {
+		return "", ErrInvalidDomain
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", ErrInvalidDomain
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return "", ErrInvalidDomain
+			}
+		}
+	}
+	return s, nil
+}
+
+// Verify checks that the domain has a TXT record with the token.
+// A domain that doesn't exist is reported as ErrRecordMissing.
+func Verify(ctx context.Context, r Resolver, domain, token string) error {
+	if token == "" {
+		return ErrRecordMissing
+	}
+	records, err := r.LookupTXT(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return ErrRecordMissing
+		}
+		return fmt.Errorf("looking up TXT records of %s: %w", domain, err)
+	}
+	expected := Record(token)
+	for _, rec := range records {
+		if strings.TrimSpace(rec) == expected {
+			return nil
+		}
+	}
+	return ErrRecordMissing
+}
@@ -0,0 +1,84 @@
+package domainverify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if name == "timeout.example" {
+		return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+	records, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func TestVerify(t *testing.T) {
+	const token = "0123456789abcdef"
+	r := stubResolver{
+		"example.com": {"v=spf1 include:_spf.google.com ~all", " " + Record(token) + " "},
+		"other.com":   {Record("fedcba9876543210")},
+		"empty.com":   nil,
+	}
+	tests := []struct {
+		domain   string
+		token    string
+		expected error
+	}{
+		{"example.com", token, nil},
+		{"other.com", token, ErrRecordMissing},
+		{"empty.com", token, ErrRecordMissing},
+		{"missing.com", token, ErrRecordMissing},
+		{"example.com", "", ErrRecordMissing},
+	}
+	for _, tt := range tests {
+		err := Verify(context.Background(), r, tt.domain, tt.token)
+		if err != tt.expected {
+			t.Errorf("Verify(%q, %q) = %v, wanted %v", tt.domain, tt.token, err, tt.expected)
+		}
+	}
+
+	err := Verify(context.Background(), r, "timeout.example", token)
+	var dnsErr *net.DNSError
+	if err == nil || err == ErrRecordMissing || !errors.As(err, &dnsErr) {
+		t.Errorf("Verify(timeout) = %v, wanted the DNS error", err)
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Example.COM", "example.com"},
+		{" @example.com ", "example.com"},
+		{"alice@mail.example.com", "mail.example.com"},
+		{"example.com.", "example.com"},
+		{"xn--80ak6aa92e.com", "xn--80ak6aa92e.com"},
+		{"localhost", ""},
+		{"-bad.com", ""},
+		{"a..com", ""},
+		{"exa mple.com", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		actual, err := NormalizeDomain(tt.input)
+		if actual != tt.expected || (tt.expected == "") != (err != nil) {
+			t.Errorf("NormalizeDomain(%q) = %q, %v, wanted %q", tt.input, actual, err, tt.expected)
+		}
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	a, b := NewToken(), NewToken()
+	if len(a) != 32 || a == b {
+		t.Errorf("NewToken = %q, %q", a, b)
+	}
+}
@@ -0,0 +1,366 @@
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	nsSAMLProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsSAMLAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	samlStatusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBindingHTTPPost   = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlBearer            = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlNameIDUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+
+	// samlClockSkew is how much we tolerate the IdP clock being off.
+	samlClockSkew = 3 * time.Minute
+)
+
+var ErrEncryptedAssertion = errors.New("encrypted SAML assertions are not supported, turn off assertion encryption in the IdP")
+
+var ErrReplayedAssertion = errors.New("SAML assertion has already been used")
+
+// SAMLAssertionStore remembers consumed assertions, so that a captured
+// response cannot be posted again while it is still valid.
+type SAMLAssertionStore interface {
+	// ConsumeAssertion records the assertion ID until expiry and returns
+	// false if it has been consumed before.
+	ConsumeAssertion(id string, expiry time.Time) bool
+}
+
+// SAMLServiceProvider is our side of a SAML 2.0 integration with one IdP.
+// We send unsigned AuthnRequests via the HTTP-Redirect binding and accept
+// signed responses via the HTTP-POST binding. IdP-initiated login is not
+// supported, because it cannot be tied to a request we've made.
+type SAMLServiceProvider struct {
+	EntityID string // our entity ID, usually the metadata URL
+	ACSURL   string // our assertion consumer service URL
+
+	IdPEntityID    string // checked against the assertion issuer if set
+	IdPSSOURL      string
+	IdPCertificate *x509.Certificate
+	Assertions     SAMLAssertionStore // required, rejects replays
+
+	// Attribute names to read; common defaults are tried when empty.
+	EmailAttribute  string
+	NameAttribute   string
+	GroupsAttribute string
+}
+
+// ParseCertificatePEM parses the IdP signing certificate, as found in the IdP
+// metadata (which often omits the PEM header, so we accept bare base64 too).
+func ParseCertificatePEM(s string) (*x509.Certificate, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "-----") {
+		s = "-----BEGIN CERTIFICATE-----\n" + s + "\n-----END CERTIFICATE-----"
+	}
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("invalid PEM certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// AuthnRequestURL returns the IdP URL to send the user to. requestID must be
+// remembered and passed to ParseResponse.
+func (sp *SAMLServiceProvider) AuthnRequestURL(requestID, relayState string, now time.Time) (string, error) {
+	var req bytes.Buffer
+	fmt.Fprintf(&req, `<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`,
+		nsSAMLProtocol, nsSAMLAssertion, xmlEscape(requestID), now.UTC().Format(time.RFC3339), xmlEscape(sp.IdPSSOURL), xmlEscape(sp.ACSURL), samlBindingHTTPPost)
+	fmt.Fprintf(&req, `<saml:Issuer>%s</saml:Issuer>`, xmlEscape(sp.EntityID))
+	fmt.Fprintf(&req, `<samlp:NameIDPolicy Format="%s" AllowCreate="true"/>`, samlNameIDUnspecified)
+	req.WriteString(`</samlp:AuthnRequest>`)
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	w.Write(req.Bytes())
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(sp.IdPSSOURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid IdP SSO URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		q.Set("RelayState", relayState)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Metadata returns the SP metadata XML to give to the IdP.
+func (sp *SAMLServiceProvider) Metadata() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">`, xmlEscape(sp.EntityID))
+	fmt.Fprintf(&buf, `<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">`, nsSAMLProtocol)
+	fmt.Fprintf(&buf, `<md:NameIDFormat>%s</md:NameIDFormat>`, "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress")
+	fmt.Fprintf(&buf, `<md:AssertionConsumerService Binding="%s" Location="%s" index="0" isDefault="true"/>`, samlBindingHTTPPost, xmlEscape(sp.ACSURL))
+	buf.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+	return buf.Bytes()
+}
+
+// ParseResponse validates the base64-encoded SAMLResponse form value posted
+// to the ACS URL and returns the identity it asserts.
+func (sp *SAMLServiceProvider) ParseResponse(samlResponse, requestID string, now time.Time) (*Identity, error) {
+	if sp.IdPCertificate == nil {
+		return nil, errors.New("IdP certificate is not configured")
+	}
+	if sp.Assertions == nil {
+		return nil, errors.New("SAML assertion store is not configured")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(samlResponse), ""))
+	if err != nil {
+		return nil, fmt.Errorf("SAMLResponse is not base64: %w", err)
+	}
+	resp, err := parseXML(raw)
+	if err != nil {
+		return nil, fmt.Errorf("SAMLResponse: %w", err)
+	}
+	if !resp.Is(nsSAMLProtocol, "Response") {
+		return nil, errors.New("SAMLResponse is not a Response")
+	}
+	if dest := resp.Attr("Destination"); dest != "" && dest != sp.ACSURL {
+		return nil, fmt.Errorf("SAML response is meant for %s", dest)
+	}
+	if requestID == "" || resp.Attr("InResponseTo") != requestID {
+		return nil, errors.New("SAML response does not match our request")
+	}
+	if status := samlStatus(resp); status != samlStatusSuccess {
+		return nil, fmt.Errorf("IdP refused to sign in: %s", status)
+	}
+
+	if resp.Child(nsSAMLAssertion, "EncryptedAssertion") != nil {
+		return nil, ErrEncryptedAssertion
+	}
+	assertions := resp.ChildrenNamed(nsSAMLAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("SAML response has %d assertions, expected one", len(assertions))
+	}
+	assertion := assertions[0]
+
+	// Either the whole response or the assertion must be signed; whichever
+	// signatures are present must be valid.
+	respErr := verifySignature(resp, sp.IdPCertificate)
+	if respErr != nil && respErr != ErrNotSigned {
+		return nil, fmt.Errorf("SAML response: %w", respErr)
+	}
+	assertionErr := verifySignature(assertion, sp.IdPCertificate)
+	if assertionErr != nil && assertionErr != ErrNotSigned {
+		return nil, fmt.Errorf("SAML assertion: %w", assertionErr)
+	}
+	if respErr == ErrNotSigned && assertionErr == ErrNotSigned {
+		return nil, fmt.Errorf("SAML response: %w", ErrNotSigned)
+	}
+
+	if sp.IdPEntityID != "" {
+		if issuer := assertion.Child(nsSAMLAssertion, "Issuer"); issuer == nil || issuer.Text() != sp.IdPEntityID {
+			return nil, errors.New("SAML assertion comes from an unexpected issuer")
+		}
+	}
+	if err := sp.checkConditions(assertion, now); err != nil {
+		return nil, err
+	}
+	subject := assertion.Child(nsSAMLAssertion, "Subject")
+	if subject == nil {
+		return nil, errors.New("SAML assertion has no subject")
+	}
+	if err := sp.checkSubjectConfirmation(subject, requestID, now); err != nil {
+		return nil, err
+	}
+	nameID := subject.Child(nsSAMLAssertion, "NameID")
+	if nameID == nil || nameID.Text() == "" {
+		return nil, errors.New("SAML assertion has no NameID")
+	}
+	id := assertion.Attr("ID")
+	if id == "" {
+		return nil, errors.New("SAML assertion has no ID")
+	}
+	if !sp.Assertions.ConsumeAssertion(id, assertionExpiry(assertion, subject, now)) {
+		return nil, ErrReplayedAssertion
+	}
+
+	attrs := samlAttributes(assertion)
+	ident := &Identity{
+		Subject: nameID.Text(),
+		Email:   firstValue(attrs, sp.EmailAttribute, "email", "mail", "emailaddress", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress", "urn:oid:0.9.2342.19200300.100.1.3"),
+		Name:    firstValue(attrs, sp.NameAttribute, "name", "displayName", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name", "urn:oid:2.16.840.1.113730.3.1.241"),
+		Groups:  allValues(attrs, sp.GroupsAttribute, "groups", "Groups", "memberOf", "http://schemas.microsoft.com/ws/2008/06/identity/claims/groups"),
+	}
+	if ident.Email == "" && strings.Contains(ident.Subject, "@") {
+		ident.Email = ident.Subject
+	}
+	if ident.Name == "" {
+		ident.Name = strings.TrimSpace(firstValue(attrs, "", "givenName", "firstName", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname") + " " + firstValue(attrs, "", "sn", "surname", "lastName", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname"))
+	}
+	return ident, nil
+}
+
+func samlStatus(resp *xmlElement) string {
+	if status := resp.Child(nsSAMLProtocol, "Status"); status != nil {
+		if code := status.Child(nsSAMLProtocol, "StatusCode"); code != nil {
+			value := code.Attr("Value")
+			if sub := code.Child(nsSAMLProtocol, "StatusCode"); sub != nil {
+				value += " (" + sub.Attr("Value") + ")"
+			}
+			return value
+		}
+	}
+	return "no status"
+}
+
+func (sp *SAMLServiceProvider) checkConditions(assertion *xmlElement, now time.Time) error {
+	cond := assertion.Child(nsSAMLAssertion, "Conditions")
+	if cond == nil {
+		return errors.New("SAML assertion has no conditions")
+	}
+	if err := checkTimeWindow(cond.Attr("NotBefore"), cond.Attr("NotOnOrAfter"), now); err != nil {
+		return fmt.Errorf("SAML assertion %w", err)
+	}
+	restrictions := cond.ChildrenNamed(nsSAMLAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return errors.New("SAML assertion has no audience restriction")
+	}
+	// each AudienceRestriction must be satisfied
+	for _, r := range restrictions {
+		var ok bool
+		for _, aud := range r.ChildrenNamed(nsSAMLAssertion, "Audience") {
+			if aud.Text() == sp.EntityID {
+				ok = true
+			}
+		}
+		if !ok {
+			return errors.New("SAML assertion is meant for another service provider")
+		}
+	}
+	return nil
+}
+
+func (sp *SAMLServiceProvider) checkSubjectConfirmation(subject *xmlElement, requestID string, now time.Time) error {
+	for _, sc := range subject.ChildrenNamed(nsSAMLAssertion, "SubjectConfirmation") {
+		if sc.Attr("Method") != samlBearer {
+			continue
+		}
+		data := sc.Child(nsSAMLAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if data.Attr("Recipient") != sp.ACSURL {
+			continue
+		}
+		if irt := data.Attr("InResponseTo"); irt != "" && irt != requestID {
+			continue
+		}
+		if data.Attr("NotOnOrAfter") == "" || checkTimeWindow(data.Attr("NotBefore"), data.Attr("NotOnOrAfter"), now) != nil {
+			continue
+		}
+		return nil
+	}
+	return errors.New("SAML assertion has no valid bearer subject confirmation")
+}
+
+// assertionExpiry returns when the assertion can no longer be accepted, and
+// thus needs no longer be remembered to reject replays.
+func assertionExpiry(assertion, subject *xmlElement, now time.Time) time.Time {
+	expiry := now
+	extend := func(notOnOrAfter string) {
+		if t, err := time.Parse(time.RFC3339, notOnOrAfter); err == nil && t.After(expiry) {
+			expiry = t
+		}
+	}
+	if cond := assertion.Child(nsSAMLAssertion, "Conditions"); cond != nil {
+		extend(cond.Attr("NotOnOrAfter"))
+	}
+	for _, sc := range subject.ChildrenNamed(nsSAMLAssertion, "SubjectConfirmation") {
+		if data := sc.Child(nsSAMLAssertion, "SubjectConfirmationData"); data != nil {
+			extend(data.Attr("NotOnOrAfter"))
+		}
+	}
+	return expiry.Add(samlClockSkew)
+}
+
+func checkTimeWindow(notBefore, notOnOrAfter string, now time.Time) error {
+	if notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return fmt.Errorf("has invalid NotBefore %q", notBefore)
+		}
+		if now.Add(samlClockSkew).Before(t) {
+			return errors.New("is not valid yet")
+		}
+	}
+	if notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil {
+			return fmt.Errorf("has invalid NotOnOrAfter %q", notOnOrAfter)
+		}
+		if !now.Add(-samlClockSkew).Before(t) {
+			return errors.New("has expired")
+		}
+	}
+	return nil
+}
+
+func samlAttributes(assertion *xmlElement) map[string][]string {
+	attrs := make(map[string][]string)
+	for _, stmt := range assertion.ChildrenNamed(nsSAMLAssertion, "AttributeStatement") {
+		for _, a := range stmt.ChildrenNamed(nsSAMLAssertion, "Attribute") {
+			var values []string
+			for _, v := range a.ChildrenNamed(nsSAMLAssertion, "AttributeValue") {
+				if s := v.Text(); s != "" {
+					values = append(values, s)
+				}
+			}
+			for _, name := range []string{a.Attr("Name"), a.Attr("FriendlyName")} {
+				if name != "" {
+					attrs[name] = append(attrs[name], values...)
+				}
+			}
+		}
+	}
+	return attrs
+}
+
+// firstValue returns the first value of the configured attribute, or of the
+// first default attribute present if none is configured.
+func firstValue(attrs map[string][]string, configured string, defaults ...string) string {
+	if values := allValues(attrs, configured, defaults...); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func allValues(attrs map[string][]string, configured string, defaults ...string) []string {
+	if configured != "" {
+		return attrs[configured]
+	}
+	for _, name := range defaults {
+		if values := attrs[name]; len(values) > 0 {
+			return values
+		}
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,27 @@
+// Package sso implements single sign-on with a customer's identity provider,
+// via OpenID Connect (authorization code flow with PKCE) or SAML 2.0.
+package sso
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// Identity is a user as asserted by the identity provider.
+type Identity struct {
+	Subject string // IdP's stable user ID
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+// RandomID returns a random URL-safe string, for OIDC state and nonce
+// values and SAML request IDs (which must not start with a digit, hence
+// the prefix).
+func RandomID() string {
+	var b [24]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return "_" + base64.RawURLEncoding.EncodeToString(b[:])
+}
@@ -0,0 +1,493 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdP is an in-process identity provider speaking both OIDC and SAML.
+type fakeIdP struct {
+	*httptest.Server
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+
+	mut   sync.Mutex
+	codes map[string]fakeGrant // authorization code -> grant
+}
+
+type fakeGrant struct {
+	challenge string
+	claims    map[string]any
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake-idp"},
+		NotBefore:    time.Unix(1600000000, 0),
+		NotAfter:     time.Unix(2600000000, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, cert: cert, codes: make(map[string]fakeGrant)}
+	idp.Server = httptest.NewServer(http.HandlerFunc(idp.serveOIDC))
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdP) serveOIDC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	case "/jwks":
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]any{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	case "/token":
+		r.ParseForm()
+		idp.mut.Lock()
+		grant, ok := idp.codes[r.Form.Get("code")]
+		delete(idp.codes, r.Form.Get("code"))
+		idp.mut.Unlock()
+		if user, pass, _ := r.BasicAuth(); user != "client-1" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"error": "invalid_client"})
+		} else if !ok || PKCEChallenge(r.Form.Get("code_verifier")) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+		} else {
+			json.NewEncoder(w).Encode(map[string]any{"id_token": idp.signJWT(grant.claims)})
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorize plays the user approving the login at the IdP, returning the
+// code the IdP would redirect back with.
+func (idp *fakeIdP) authorize(t *testing.T, authURL string, claims map[string]any) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client-1" {
+		t.Fatalf("bad authorization request: %s", authURL)
+	}
+	claims["nonce"] = q.Get("nonce")
+	code = RandomID()
+	idp.mut.Lock()
+	idp.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), claims: claims}
+	idp.mut.Unlock()
+	return code, q.Get("state")
+}
+
+func (idp *fakeIdP) signJWT(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]any{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newFakeIdP(t)
+	now := time.Now()
+	ctx := context.Background()
+	c := &OIDCClient{
+		Issuer:       idp.URL,
+		ClientID:     "client-1",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://app.example/sso/1/oidc/callback",
+	}
+	md, err := c.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func() map[string]any {
+		return map[string]any{
+			"iss":            idp.URL,
+			"aud":            "client-1",
+			"sub":            "user-42",
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"name":           "Alice Smith",
+			"groups":         []string{"staff", "everyone"},
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+		}
+	}
+
+	state, nonce, verifier := RandomID(), RandomID(), NewPKCEVerifier()
+	code, returnedState := idp.authorize(t, c.AuthCodeURL(md, state, nonce, verifier), claims())
+	if returnedState != state {
+		t.Errorf("state = %q, wanted %q", returnedState, state)
+	}
+	ident, err := c.Exchange(ctx, md, code, verifier, nonce, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Subject != "user-42" || ident.Email != "alice@example.com" || ident.Name != "Alice Smith" || strings.Join(ident.Groups, ",") != "staff,everyone" {
+		t.Errorf("identity = %+v", ident)
+	}
+
+	// a code intercepted without the verifier is useless
+	code, _ = idp.authorize(t, c.AuthCodeURL(md, state, nonce, verifier), claims())
+	if _, err := c.Exchange(ctx, md, code, NewPKCEVerifier(), nonce, now); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange with wrong verifier: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(claims map[string]any)
+		nonce  string
+		err    string
+	}{
+		{"wrong nonce", nil, "other", "nonce mismatch"},
+		{"wrong audience", func(cl map[string]any) { cl["aud"] = "client-2" }, "", "not issued for us"},
+		{"wrong issuer", func(cl map[string]any) { cl["iss"] = "https://evil.example" }, "", "issuer"},
+		{"expired", func(cl map[string]any) { cl["exp"] = now.Add(-time.Hour).Unix() }, "", "expired"},
+	}
+	for _, tt := range tests {
+		cl := claims()
+		if tt.modify != nil {
+			tt.modify(cl)
+		}
+		code, _ := idp.authorize(t, c.AuthCodeURL(md, state, nonce, verifier), cl)
+		n := nonce
+		if tt.nonce != "" {
+			n = tt.nonce
+		}
+		_, err := c.Exchange(ctx, md, code, verifier, n, now)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, wanted %q", tt.name, err, tt.err)
+		}
+	}
+
+	for _, verified := range []any{false, "true", nil} {
+		cl := claims()
+		if verified == nil {
+			delete(cl, "email_verified")
+		} else {
+			cl["email_verified"] = verified
+		}
+		code, _ = idp.authorize(t, c.AuthCodeURL(md, state, nonce, verifier), cl)
+		if ident, err := c.Exchange(ctx, md, code, verifier, nonce, now); err != nil || ident.Email != "" {
+			t.Errorf("email_verified = %v: %+v, %v", verified, ident, err)
+		}
+	}
+
+	parts := strings.Split(idp.signJWT(claims()), ".")
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2]
+	if _, err := c.VerifyIDToken(ctx, md, forged, nonce, now); err == nil || !strings.Contains(err.Error(), "bad signature") {
+		t.Errorf("forged token: %v", err)
+	}
+}
+
+const (
+	testEntityID = "https://app.example/sso/1/saml/metadata"
+	testACSURL   = "https://app.example/sso/1/saml/acs"
+	testIdPID    = "https://idp.example/saml"
+)
+
+type samlFixture struct {
+	RequestID    string
+	Destination  string
+	Recipient    string
+	Audience     string
+	Issuer       string
+	NotOnOrAfter time.Time
+	Status       string
+}
+
+func (f *samlFixture) assertion(id string) string {
+	return fmt.Sprintf(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="%s" Version="2.0" IssueInstant="2024-01-01T00:00:00Z">
+    <saml:Issuer>%s</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">alice@example.com</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="%s" NotOnOrAfter="%s" Recipient="%s"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="%s" NotOnOrAfter="%s">
+      <saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname"><saml:AttributeValue xsi:type="xs:string">Alice</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname"><saml:AttributeValue xsi:type="xs:string">Smith &amp; Co</saml:AttributeValue></saml:Attribute>
+      <saml:Attribute Name="groups"><saml:AttributeValue>staff</saml:AttributeValue><saml:AttributeValue>admins</saml:AttributeValue></saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>`,
+		id, f.Issuer, f.RequestID, f.NotOnOrAfter.UTC().Format(time.RFC3339), f.Recipient,
+		f.NotOnOrAfter.Add(-10*time.Minute).UTC().Format(time.RFC3339), f.NotOnOrAfter.UTC().Format(time.RFC3339), f.Audience)
+}
+
+func (f *samlFixture) response(assertion string) string {
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_resp1" Version="2.0" IssueInstant="2024-01-01T00:00:00Z" Destination="%s" InResponseTo="%s">
+  <samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>
+  %s
+</samlp:Response>`, f.Destination, f.RequestID, f.Status, assertion)
+}
+
+func newSAMLFixture(requestID string, now time.Time) *samlFixture {
+	return &samlFixture{
+		RequestID:    requestID,
+		Destination:  testACSURL,
+		Recipient:    testACSURL,
+		Audience:     testEntityID,
+		Issuer:       testIdPID,
+		NotOnOrAfter: now.Add(5 * time.Minute),
+		Status:       samlStatusSuccess,
+	}
+}
+
+// sign inserts an enveloped signature of the element with the given ID as
+// its first child (after Issuer, for assertions), like real IdPs do.
+func (idp *fakeIdP) sign(t *testing.T, doc, id string) string {
+	t.Helper()
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	el := findByID(root, id)
+	if el == nil {
+		t.Fatalf("no element with ID %s", id)
+	}
+	digest := sha256.Sum256(canonicalize(el, nil, []string{"xs"}))
+	signedInfo := fmt.Sprintf(`<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/><ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/><ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"><ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"/></ds:Transform></ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+		id, base64.StdEncoding.EncodeToString(digest[:]))
+	si, err := parseXML([]byte(signedInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(canonicalize(si, nil, nil))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">%s<ds:SignatureValue>%s</ds:SignatureValue></ds:Signature>`,
+		signedInfo, base64.StdEncoding.EncodeToString(sig))
+
+	// insert after the element's Issuer, or right after its start tag
+	start := strings.Index(doc, `ID="`+id+`"`)
+	pos := start + strings.Index(doc[start:], ">") + 1
+	if rest := strings.TrimLeft(doc[pos:], " \n"); strings.HasPrefix(rest, "<saml:Issuer>") {
+		pos = len(doc) - len(rest) + strings.Index(rest, "</saml:Issuer>") + len("</saml:Issuer>")
+	}
+	return doc[:pos] + signature + doc[pos:]
+}
+
+func findByID(el *xmlElement, id string) *xmlElement {
+	if el.Attr("ID") == id {
+		return el
+	}
+	for _, c := range el.Children {
+		if c, ok := c.(*xmlElement); ok {
+			if found := findByID(c, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func TestSAMLLogin(t *testing.T) {
+	idp := newFakeIdP(t)
+	now := time.Now()
+	assertions := memAssertionStore{}
+	sp := &SAMLServiceProvider{
+		EntityID:       testEntityID,
+		ACSURL:         testACSURL,
+		IdPEntityID:    testIdPID,
+		IdPSSOURL:      "https://idp.example/saml/sso?tenant=7",
+		IdPCertificate: idp.cert,
+		Assertions:     assertions,
+	}
+
+	requestID := RandomID()
+	authURL, err := sp.AuthnRequestURL(requestID, "relay-1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := url.Parse(authURL); u.Query().Get("tenant") != "7" || u.Query().Get("SAMLRequest") == "" || u.Query().Get("RelayState") != "relay-1" {
+		t.Errorf("AuthnRequestURL = %s", authURL)
+	}
+
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	f := newSAMLFixture(requestID, now)
+	signedAssertion := idp.sign(t, f.response(f.assertion("_a1")), "_a1")
+	ident, err := sp.ParseResponse(encode(signedAssertion), requestID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Subject != "alice@example.com" || ident.Email != "alice@example.com" || ident.Name != "Alice Smith & Co" || strings.Join(ident.Groups, ",") != "staff,admins" {
+		t.Errorf("identity = %+v", ident)
+	}
+
+	if exp := assertions["_a1"]; exp.Before(f.NotOnOrAfter) {
+		t.Errorf("assertion remembered until %v, wanted at least %v", exp, f.NotOnOrAfter)
+	}
+	if _, err := sp.ParseResponse(encode(signedAssertion), requestID, now); err != ErrReplayedAssertion {
+		t.Errorf("replayed: %v", err)
+	}
+	if _, err := sp.ParseResponse(encode(idp.sign(t, f.response(f.assertion("_a1")), "_resp1")), requestID, now); err != ErrReplayedAssertion {
+		t.Errorf("replayed in a re-signed response: %v", err)
+	}
+
+	signedResponse := idp.sign(t, f.response(f.assertion("_a2")), "_resp1")
+	if _, err := sp.ParseResponse(encode(signedResponse), requestID, now); err != nil {
+		t.Errorf("signed response: %v", err)
+	}
+
+	if _, err := sp.ParseResponse(encode(f.response(f.assertion("_a1"))), requestID, now); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("unsigned: %v", err)
+	}
+	tampered := strings.Replace(signedAssertion, ">staff<", ">owners<", 1)
+	if _, err := sp.ParseResponse(encode(tampered), requestID, now); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("tampered: %v", err)
+	}
+
+	// signature wrapping: a signed assertion moved aside, a forged one in its place
+	evil := newSAMLFixture(requestID, now)
+	wrapped := strings.Replace(signedAssertion, "<saml:Assertion ", evil.assertion("_evil")+"<saml:Assertion ", 1)
+	if _, err := sp.ParseResponse(encode(wrapped), requestID, now); err == nil {
+		t.Errorf("wrapped assertion accepted")
+	}
+
+	other := newSAMLFixture(requestID, now)
+	other.Audience = "https://other.example"
+	if _, err := sp.ParseResponse(encode(idp.sign(t, other.response(other.assertion("_a1")), "_a1")), requestID, now); err == nil || !strings.Contains(err.Error(), "another service provider") {
+		t.Errorf("wrong audience: %v", err)
+	}
+
+	if _, err := sp.ParseResponse(encode(signedAssertion), requestID, now.Add(time.Hour)); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expired: %v", err)
+	}
+	if _, err := sp.ParseResponse(encode(signedAssertion), RandomID(), now); err == nil || !strings.Contains(err.Error(), "does not match our request") {
+		t.Errorf("unsolicited: %v", err)
+	}
+
+	failed := newSAMLFixture(requestID, now)
+	failed.Status = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+	if _, err := sp.ParseResponse(encode(failed.response("")), requestID, now); err == nil || !strings.Contains(err.Error(), "Responder") {
+		t.Errorf("failed status: %v", err)
+	}
+
+	otherIdP := newFakeIdP(t)
+	if _, err := sp.ParseResponse(encode(otherIdP.sign(t, f.response(f.assertion("_a1")), "_a1")), requestID, now); err == nil || !strings.Contains(err.Error(), "invalid XML signature") {
+		t.Errorf("signed by another IdP: %v", err)
+	}
+
+	doctype := `<!DOCTYPE x [<!ENTITY e "boom">]>` + signedAssertion
+	if _, err := sp.ParseResponse(encode(doctype), requestID, now); err == nil {
+		t.Errorf("DTD accepted")
+	}
+}
+
+// memAssertionStore is a SAMLAssertionStore that never forgets.
+type memAssertionStore map[string]time.Time
+
+func (s memAssertionStore) ConsumeAssertion(id string, expiry time.Time) bool {
+	if _, ok := s[id]; ok {
+		return false
+	}
+	s[id] = expiry
+	return true
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		id       string
+		prefixes []string
+		expected string
+	}{
+		// namespace declarations are pushed down to where they're used,
+		// attributes sorted, empty elements expanded, text escaped
+		{
+			`<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns:unused="urn:u"><a:child ID="c1" z="1" b:y="2" a="&quot;&#9;"/><b:x>1 &lt; 2 &gt; 0 &amp;&#13;</b:x></a:root>`,
+			"", nil,
+			`<a:root xmlns:a="urn:a"><a:child xmlns:b="urn:b" ID="c1" a="&quot;&#x9;" z="1" b:y="2"></a:child><b:x xmlns:b="urn:b">1 &lt; 2 &gt; 0 &amp;&#xD;</b:x></a:root>`,
+		},
+		// a subtree gets the namespaces it uses from its ancestors, but not the others
+		{
+			`<a:root xmlns:a="urn:a" xmlns="urn:d" xmlns:xs="urn:xs"><a:child ID="c1"><inner>t</inner><!-- comment --></a:child></a:root>`,
+			"c1", nil,
+			`<a:child xmlns:a="urn:a" ID="c1"><inner xmlns="urn:d">t</inner></a:child>`,
+		},
+		// inclusive prefixes are rendered even when not visibly used
+		{
+			`<a:root xmlns:a="urn:a" xmlns:xs="urn:xs"><a:child ID="c1"><a:v>xs:string</a:v></a:child></a:root>`,
+			"c1", []string{"xs"},
+			`<a:child xmlns:a="urn:a" xmlns:xs="urn:xs" ID="c1"><a:v>xs:string</a:v></a:child>`,
+		},
+		// the default namespace is undeclared when a child leaves it
+		{
+			`<root xmlns="urn:d"><child xmlns=""><x/></child></root>`,
+			"", nil,
+			`<root xmlns="urn:d"><child xmlns=""><x></x></child></root>`,
+		},
+	}
+	for _, tt := range tests {
+		root, err := parseXML([]byte(tt.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		el := root
+		if tt.id != "" {
+			el = findByID(root, tt.id)
+		}
+		actual := string(canonicalize(el, nil, tt.prefixes))
+		if actual != tt.expected {
+			t.Errorf("canonicalize(%s)\n     got %s\n  wanted %s", tt.input, actual, tt.expected)
+		}
+	}
+}
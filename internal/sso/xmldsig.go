@@ -0,0 +1,429 @@
+package sso
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// We verify SAML signatures ourselves, which needs exclusive XML
+// canonicalization (https://www.w3.org/TR/xml-exc-c14n/). encoding/xml
+// resolves namespaces and forgets prefixes, so we parse into our own tree
+// that keeps them.
+
+const (
+	nsXML      = "http://www.w3.org/XML/1998/namespace"
+	nsDSig     = "http://www.w3.org/2000/09/xmldsig#"
+	nsExcC14N  = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algExcC14N = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+	algEnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algSHA256             = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512             = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+var (
+	ErrNotSigned        = errors.New("XML element is not signed")
+	ErrInvalidSignature = errors.New("invalid XML signature")
+)
+
+type xmlElement struct {
+	Prefix   string
+	Local    string
+	Attrs    []xmlAttr         // excluding namespace declarations
+	NSDecls  map[string]string // prefix ("" for default) to URI, declared on this element
+	Children []any             // *xmlElement or string
+	Parent   *xmlElement
+}
+
+type xmlAttr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+func parseXML(data []byte) (*xmlElement, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root, cur *xmlElement
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if cur == nil && root != nil {
+				return nil, errors.New("XML has multiple root elements")
+			}
+			el := &xmlElement{
+				Prefix: tok.Name.Space,
+				Local:  tok.Name.Local,
+				Parent: cur,
+			}
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					el.declare("", a.Value)
+				case a.Name.Space == "xmlns":
+					el.declare(a.Name.Local, a.Value)
+				default:
+					el.Attrs = append(el.Attrs, xmlAttr{a.Name.Space, a.Name.Local, a.Value})
+				}
+			}
+			if cur == nil {
+				root = el
+			} else {
+				cur.Children = append(cur.Children, el)
+			}
+			cur = el
+		case xml.EndElement:
+			if cur == nil || tok.Name.Space != cur.Prefix || tok.Name.Local != cur.Local {
+				return nil, fmt.Errorf("unexpected XML end element %s", tok.Name.Local)
+			}
+			cur = cur.Parent
+		case xml.CharData:
+			if cur != nil {
+				cur.Children = append(cur.Children, string(tok))
+			} else if len(bytes.TrimSpace(tok)) > 0 {
+				return nil, errors.New("XML has text outside of the root element")
+			}
+		case xml.Directive:
+			return nil, errors.New("XML directives (DTDs) are not allowed")
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, errors.New("incomplete XML document")
+	}
+	return root, nil
+}
+
+func (el *xmlElement) declare(prefix, uri string) {
+	if el.NSDecls == nil {
+		el.NSDecls = make(map[string]string)
+	}
+	el.NSDecls[prefix] = uri
+}
+
+// lookupNS returns the namespace URI the prefix is bound to at this element.
+func (el *xmlElement) lookupNS(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for e := el; e != nil; e = e.Parent {
+		if uri, ok := e.NSDecls[prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+func (el *xmlElement) NS() string {
+	uri, _ := el.lookupNS(el.Prefix)
+	return uri
+}
+
+func (el *xmlElement) Is(ns, local string) bool {
+	return el.Local == local && el.NS() == ns
+}
+
+func (el *xmlElement) Attr(local string) string {
+	for _, a := range el.Attrs {
+		if a.Prefix == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (el *xmlElement) Child(ns, local string) *xmlElement {
+	for _, c := range el.Children {
+		if c, ok := c.(*xmlElement); ok && c.Is(ns, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (el *xmlElement) ChildrenNamed(ns, local string) []*xmlElement {
+	var result []*xmlElement
+	for _, c := range el.Children {
+		if c, ok := c.(*xmlElement); ok && c.Is(ns, local) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (el *xmlElement) Text() string {
+	var buf strings.Builder
+	for _, c := range el.Children {
+		if s, ok := c.(string); ok {
+			buf.WriteString(s)
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// canonicalize serializes el using exclusive canonicalization without
+// comments, leaving out the skip element (the enveloped signature).
+// inclusivePrefixes come from the InclusiveNamespaces PrefixList.
+func canonicalize(el, skip *xmlElement, inclusivePrefixes []string) []byte {
+	c := &canonicalizer{skip: skip, inclusive: inclusivePrefixes}
+	c.element(el, nil)
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf       bytes.Buffer
+	skip      *xmlElement
+	inclusive []string
+}
+
+func (c *canonicalizer) element(el *xmlElement, rendered map[string]string) {
+	utilized := []string{el.Prefix}
+	for _, a := range el.Attrs {
+		if a.Prefix != "" && a.Prefix != "xml" {
+			utilized = append(utilized, a.Prefix)
+		}
+	}
+	for _, p := range c.inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		if _, ok := el.lookupNS(p); ok {
+			utilized = append(utilized, p)
+		}
+	}
+
+	var decls []string
+	var newRendered map[string]string
+	for _, p := range utilized {
+		if p == "xml" || slices.Contains(decls, p) {
+			continue
+		}
+		uri, _ := el.lookupNS(p)
+		prev, ok := rendered[p]
+		if ok && prev == uri || !ok && uri == "" {
+			continue
+		}
+		decls = append(decls, p)
+		if newRendered == nil {
+			newRendered = make(map[string]string, len(rendered)+1)
+			for k, v := range rendered {
+				newRendered[k] = v
+			}
+		}
+		newRendered[p] = uri
+	}
+	if newRendered != nil {
+		rendered = newRendered
+	}
+	sort.Strings(decls)
+
+	attrs := make([]xmlAttr, len(el.Attrs))
+	copy(attrs, el.Attrs)
+	attrNS := func(a xmlAttr) string {
+		if a.Prefix == "" {
+			return ""
+		}
+		uri, _ := el.lookupNS(a.Prefix)
+		return uri
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ni, nj := attrNS(attrs[i]), attrNS(attrs[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	name := qname(el.Prefix, el.Local)
+	c.buf.WriteByte('<')
+	c.buf.WriteString(name)
+	for _, p := range decls {
+		c.buf.WriteString(" xmlns")
+		if p != "" {
+			c.buf.WriteByte(':')
+			c.buf.WriteString(p)
+		}
+		c.buf.WriteString(`="`)
+		c.buf.WriteString(escapeC14NAttr(rendered[p]))
+		c.buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		c.buf.WriteByte(' ')
+		c.buf.WriteString(qname(a.Prefix, a.Local))
+		c.buf.WriteString(`="`)
+		c.buf.WriteString(escapeC14NAttr(a.Value))
+		c.buf.WriteByte('"')
+	}
+	c.buf.WriteByte('>')
+	for _, child := range el.Children {
+		switch child := child.(type) {
+		case *xmlElement:
+			if child != c.skip {
+				c.element(child, rendered)
+			}
+		case string:
+			c.buf.WriteString(escapeC14NText(child))
+		}
+	}
+	c.buf.WriteString("</")
+	c.buf.WriteString(name)
+	c.buf.WriteByte('>')
+}
+
+func qname(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	c14nTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeC14NText(s string) string {
+	return c14nTextEscaper.Replace(s)
+}
+
+func escapeC14NAttr(s string) string {
+	return c14nAttrEscaper.Replace(s)
+}
+
+// verifySignature checks the enveloped signature of el, which must sign el
+// itself (by its ID attribute) and nothing else. This way the element we go
+// on to read is the element that was signed, which defeats signature
+// wrapping attacks.
+func verifySignature(el *xmlElement, cert *x509.Certificate) error {
+	sig := el.Child(nsDSig, "Signature")
+	if sig == nil {
+		return ErrNotSigned
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: IdP certificate does not have an RSA key", ErrInvalidSignature)
+	}
+
+	signedInfo := sig.Child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return fmt.Errorf("%w: no SignedInfo", ErrInvalidSignature)
+	}
+	c14nMethod := signedInfo.Child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.Attr("Algorithm") != algExcC14N {
+		return fmt.Errorf("%w: unsupported canonicalization method", ErrInvalidSignature)
+	}
+	var sigHash crypto.Hash
+	switch m := signedInfo.Child(nsDSig, "SignatureMethod"); {
+	case m == nil:
+		return fmt.Errorf("%w: no SignatureMethod", ErrInvalidSignature)
+	case m.Attr("Algorithm") == algRSASHA256:
+		sigHash = crypto.SHA256
+	case m.Attr("Algorithm") == algRSASHA512:
+		sigHash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported signature method %s", ErrInvalidSignature, m.Attr("Algorithm"))
+	}
+
+	refs := signedInfo.ChildrenNamed(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return fmt.Errorf("%w: expected a single Reference", ErrInvalidSignature)
+	}
+	ref := refs[0]
+	if id := el.Attr("ID"); id == "" || ref.Attr("URI") != "#"+id {
+		return fmt.Errorf("%w: signature does not reference the signed element", ErrInvalidSignature)
+	}
+
+	var enveloped, excC14N bool
+	var prefixes []string
+	if transforms := ref.Child(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.ChildrenNamed(nsDSig, "Transform") {
+			switch t.Attr("Algorithm") {
+			case algEnvelopedSignature:
+				enveloped = true
+			case algExcC14N:
+				excC14N = true
+				prefixes = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("%w: unsupported transform %s", ErrInvalidSignature, t.Attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || !excC14N {
+		return fmt.Errorf("%w: expected enveloped signature with exclusive canonicalization", ErrInvalidSignature)
+	}
+
+	var digestHash crypto.Hash
+	switch m := ref.Child(nsDSig, "DigestMethod"); {
+	case m == nil:
+		return fmt.Errorf("%w: no DigestMethod", ErrInvalidSignature)
+	case m.Attr("Algorithm") == algSHA256:
+		digestHash = crypto.SHA256
+	case m.Attr("Algorithm") == algSHA512:
+		digestHash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported digest method %s", ErrInvalidSignature, m.Attr("Algorithm"))
+	}
+	expectedDigest, err := decodeBase64(ref.Child(nsDSig, "DigestValue"))
+	if err != nil {
+		return fmt.Errorf("%w: bad DigestValue", ErrInvalidSignature)
+	}
+	if !bytes.Equal(hashBytes(digestHash, canonicalize(el, sig, prefixes)), expectedDigest) {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+
+	sigValue, err := decodeBase64(sig.Child(nsDSig, "SignatureValue"))
+	if err != nil {
+		return fmt.Errorf("%w: bad SignatureValue", ErrInvalidSignature)
+	}
+	signed := canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod))
+	if err := rsa.VerifyPKCS1v15(pub, sigHash, hashBytes(sigHash, signed), sigValue); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+func inclusivePrefixes(transform *xmlElement) []string {
+	if in := transform.Child(nsExcC14N, "InclusiveNamespaces"); in != nil {
+		return strings.Fields(in.Attr("PrefixList"))
+	}
+	return nil
+}
+
+func decodeBase64(el *xmlElement) ([]byte, error) {
+	if el == nil {
+		return nil, errors.New("missing")
+	}
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(el.Text()), ""))
+}
+
+func hashBytes(h crypto.Hash, data []byte) []byte {
+	switch h {
+	case crypto.SHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	default:
+		panic("unsupported hash")
+	}
+}
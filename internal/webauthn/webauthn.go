@@ -0,0 +1,303 @@
+// Package webauthn implements the relying party side of passkey (WebAuthn)
+// registration and sign-in.
+//
+// We request no attestation, so registration trusts whatever authenticator
+// the user has; only possession of the key is proven. Since a passkey is
+// the only factor of a sign-in, user verification is always required.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	Timeout = 5 * time.Minute
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid WebAuthn response")
+	// ErrCounterRegressed means the authenticator's signature counter went
+	// backwards, which suggests that the credential has been cloned.
+	ErrCounterRegressed = errors.New("signature counter did not increase")
+)
+
+// RelyingParty is the website users register passkeys with.
+type RelyingParty struct {
+	ID     string // domain name, e.g. example.com
+	Name   string
+	Origin string // e.g. https://example.com
+}
+
+// Base64URL is binary data that JSON-encodes as unpadded base64url, like
+// the WebAuthn JSON serialization does.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(EncodeBase64URL(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := DecodeBase64URL(s)
+	*b = v
+	return err
+}
+
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBase64URL decodes base64url data with or without padding.
+func DecodeBase64URL(s string) ([]byte, error) {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// NewChallenge returns a random challenge for a single ceremony.
+func NewChallenge() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// User is the account a passkey is registered for. ID must not contain
+// personal information.
+type User struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type CredentialDescriptor struct {
+	Type string    `json:"type"`
+	ID   Base64URL `json:"id"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CreationOptions are the options of navigator.credentials.create().
+type CreationOptions struct {
+	Challenge              Base64URL              `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+}
+
+// RequestOptions are the options of navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+}
+
+// CreationOptions asks for a discoverable credential, so that users can
+// later sign in without entering their email. exclude lists the user's
+// existing credential IDs.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user User, exclude [][]byte) *CreationOptions {
+	opts := &CreationOptions{
+		Challenge:   challenge,
+		RP:          RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:        user,
+		Timeout:     Timeout.Milliseconds(),
+		Attestation: "none",
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		ExcludeCredentials: descriptors(exclude),
+	}
+	for _, alg := range SupportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	return opts
+}
+
+// RequestOptions lets the user pick any of their passkeys for this site.
+func (rp *RelyingParty) RequestOptions(challenge []byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          Timeout.Milliseconds(),
+		UserVerification: "required",
+		AllowCredentials: []CredentialDescriptor{},
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, len(ids))
+	for i, id := range ids {
+		result[i] = CredentialDescriptor{Type: "public-key", ID: id}
+	}
+	return result
+}
+
+// Credential is a registered passkey.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create()
+// to the given challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	v, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+	att, _ := v.(map[any]any)
+	authData, _ := att["authData"].([]byte)
+	ad, err := rp.parseAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if ad.flags&flagAttested == 0 || ad.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrInvalidResponse)
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        ad.credentialID,
+		PublicKey: ad.publicKey,
+		SignCount: ad.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() made
+// with cred, and returns the new signature counter to store.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, cred *Credential, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	ad, err := rp.parseAuthData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return 0, fmt.Errorf("%w: bad signature", ErrInvalidResponse)
+	}
+	// authenticators that don't count always report zero
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		return 0, ErrCounterRegressed
+	}
+	return ad.signCount, nil
+}
+
+func (rp *RelyingParty) checkClientData(clientDataJSON []byte, typ string, challenge []byte) error {
+	var cd struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("%w: type %q", ErrInvalidResponse, cd.Type)
+	}
+	if c, err := DecodeBase64URL(cd.Challenge); err != nil || len(challenge) == 0 || !bytes.Equal(c, challenge) {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if cd.Origin != rp.Origin || cd.CrossOrigin {
+		return fmt.Errorf("%w: origin %q", ErrInvalidResponse, cd.Origin)
+	}
+	return nil
+}
+
+type authData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (rp *RelyingParty) parseAuthData(b []byte) (*authData, error) {
+	if len(b) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(b[:32], rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: relying party ID mismatch", ErrInvalidResponse)
+	}
+	ad := &authData{
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+	if ad.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user not verified", ErrInvalidResponse)
+	}
+	if ad.flags&flagAttested != 0 {
+		rest := b[37:]
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > 1023 || len(rest) < n {
+			return nil, fmt.Errorf("%w: bad credential ID", ErrInvalidResponse)
+		}
+		ad.credentialID = rest[:n:n]
+		rest = rest[n:]
+		// the key is followed by extensions if there are any
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad credential public key", ErrInvalidResponse)
+		}
+		ad.publicKey = rest[: len(rest)-len(after) : len(rest)-len(after)]
+	}
+	return ad, nil
+}
@@ -0,0 +1,330 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+var testRP = &RelyingParty{
+	ID:     "example.com",
+	Name:   "Example",
+	Origin: "https://example.com",
+}
+
+// softAuthenticator is a passkey authenticator living in memory.
+type softAuthenticator struct {
+	rpID      string
+	origin    string
+	credID    []byte
+	signer    crypto.Signer
+	cose      []byte
+	counting  bool // non-counting authenticators always report zero
+	counter   uint32
+	noVerify  bool
+	hashInput bool // ECDSA signs a digest, Ed25519 the message itself
+}
+
+func newES256Authenticator(t *testing.T, counting bool) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{
+		rpID:      testRP.ID,
+		origin:    testRP.Origin,
+		credID:    randomBytes(16),
+		signer:    key,
+		cose:      encodeCBOR(map[any]any{1: 2, 3: AlgES256, -1: 1, -2: key.X.FillBytes(make([]byte, 32)), -3: key.Y.FillBytes(make([]byte, 32))}),
+		counting:  counting,
+		hashInput: true,
+	}
+}
+
+func newEd25519Authenticator(t *testing.T) *softAuthenticator {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{
+		rpID:   testRP.ID,
+		origin: testRP.Origin,
+		credID: randomBytes(32),
+		signer: priv,
+		cose:   encodeCBOR(map[any]any{1: 1, 3: AlgEdDSA, -1: 6, -2: []byte(pub)}),
+	}
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge []byte) []byte {
+	return must(json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.origin,
+		"crossOrigin": false,
+	}))
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := byte(flagUserPresent | flagUserVerified)
+	if a.noVerify {
+		flags = flagUserPresent
+	}
+	if attested {
+		flags |= flagAttested
+	}
+	if a.counting {
+		a.counter++
+	}
+	b := append([]byte(nil), rpIDHash[:]...)
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, a.counter)
+	if attested {
+		b = append(b, make([]byte, 16)...) // AAGUID
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.credID)))
+		b = append(b, a.credID...)
+		b = append(b, a.cose...)
+	}
+	return b
+}
+
+func (a *softAuthenticator) create(challenge []byte) (clientDataJSON, attestationObject []byte) {
+	clientDataJSON = a.clientData("webauthn.create", challenge)
+	attestationObject = encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": a.authData(true),
+	})
+	return
+}
+
+func (a *softAuthenticator) get(challenge []byte) (clientDataJSON, authenticatorData, signature []byte) {
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authenticatorData = a.authData(false)
+	hash := sha256.Sum256(clientDataJSON)
+	msg := append(append([]byte(nil), authenticatorData...), hash[:]...)
+	if a.hashInput {
+		digest := sha256.Sum256(msg)
+		signature = must(a.signer.Sign(rand.Reader, digest[:], crypto.SHA256))
+	} else {
+		signature = must(a.signer.Sign(rand.Reader, msg, crypto.Hash(0)))
+	}
+	return
+}
+
+func TestRegisterAndSignIn(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		auth func(t *testing.T) *softAuthenticator
+	}{
+		{"ES256 counting", func(t *testing.T) *softAuthenticator { return newES256Authenticator(t, true) }},
+		{"ES256 non-counting", func(t *testing.T) *softAuthenticator { return newES256Authenticator(t, false) }},
+		{"Ed25519", newEd25519Authenticator},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := tc.auth(t)
+			challenge := NewChallenge()
+			cd, att := a.create(challenge)
+			cred, err := testRP.VerifyRegistration(challenge, cd, att)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(cred.ID, a.credID) || !bytes.Equal(cred.PublicKey, a.cose) || cred.SignCount != a.counter {
+				t.Fatalf("registered %+v", cred)
+			}
+
+			for i := 0; i < 2; i++ {
+				challenge = NewChallenge()
+				cd, ad, sig := a.get(challenge)
+				count, err := testRP.VerifyAssertion(challenge, cred, cd, ad, sig)
+				if err != nil {
+					t.Fatalf("sign-in %d: %v", i, err)
+				}
+				if count != a.counter {
+					t.Errorf("sign-in %d: counter %d, wanted %d", i, count, a.counter)
+				}
+				cred.SignCount = count
+			}
+		})
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	challenge := NewChallenge()
+	tests := []struct {
+		name   string
+		modify func(a *softAuthenticator)
+		chal   []byte
+	}{
+		{"wrong challenge", nil, NewChallenge()},
+		{"wrong origin", func(a *softAuthenticator) { a.origin = "https://evil.example" }, challenge},
+		{"wrong RP ID", func(a *softAuthenticator) { a.rpID = "evil.example" }, challenge},
+		{"not verified", func(a *softAuthenticator) { a.noVerify = true }, challenge},
+	}
+	for _, tt := range tests {
+		a := newES256Authenticator(t, true)
+		if tt.modify != nil {
+			tt.modify(a)
+		}
+		cd, att := a.create(challenge)
+		_, err := testRP.VerifyRegistration(tt.chal, cd, att)
+		if !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("%s: got %v, wanted ErrInvalidResponse", tt.name, err)
+		}
+	}
+
+	a := newES256Authenticator(t, true)
+	cd := a.clientData("webauthn.create", challenge)
+	att := encodeCBOR(map[any]any{"fmt": "none", "attStmt": map[any]any{}, "authData": a.authData(false)})
+	if _, err := testRP.VerifyRegistration(challenge, cd, att); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("without credential: got %v, wanted ErrInvalidResponse", err)
+	}
+
+	a.cose = encodeCBOR(map[any]any{1: 2, 3: -36, -1: 3})
+	cd, att = a.create(challenge)
+	if _, err := testRP.VerifyRegistration(challenge, cd, att); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("ES512 key: got %v, wanted ErrUnsupportedKey", err)
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	a := newES256Authenticator(t, true)
+	challenge := NewChallenge()
+	cd, att := a.create(challenge)
+	cred := must(testRP.VerifyRegistration(challenge, cd, att))
+
+	challenge = NewChallenge()
+	cd, ad, sig := a.get(challenge)
+	if _, err := testRP.VerifyAssertion(NewChallenge(), cred, cd, ad, sig); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("wrong challenge: got %v", err)
+	}
+	if _, err := testRP.VerifyAssertion(challenge, cred, cd, ad, append(sig[:len(sig)-1:len(sig)-1], sig[len(sig)-1]^1)); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("tampered signature: got %v", err)
+	}
+	other := newES256Authenticator(t, true)
+	cd2, ad2, sig2 := other.get(challenge)
+	if _, err := testRP.VerifyAssertion(challenge, cred, cd2, ad2, sig2); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("other authenticator: got %v", err)
+	}
+	if _, err := testRP.VerifyAssertion(challenge, cred, a.clientData("webauthn.create", challenge), ad, sig); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("registration client data: got %v", err)
+	}
+
+	// a clone replays the counter value the original has already used
+	count := must(testRP.VerifyAssertion(challenge, cred, cd, ad, sig))
+	cred.SignCount = count
+	challenge = NewChallenge()
+	a.counter--
+	cd, ad, sig = a.get(challenge)
+	if _, err := testRP.VerifyAssertion(challenge, cred, cd, ad, sig); err != ErrCounterRegressed {
+		t.Errorf("cloned authenticator: got %v, wanted ErrCounterRegressed", err)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	v, rest, err := decodeCBOR(append(encodeCBOR(map[any]any{"a": []any{1, -300, "x", []byte{1, 2}}, 7: 70000}), 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, []byte{0xff}) {
+		t.Errorf("rest = %x", rest)
+	}
+	m := v.(map[any]any)
+	arr := m["a"].([]any)
+	if arr[0] != int64(1) || arr[1] != int64(-300) || arr[2] != "x" || !bytes.Equal(arr[3].([]byte), []byte{1, 2}) || m[int64(7)] != int64(70000) {
+		t.Errorf("decoded %#v", v)
+	}
+
+	for _, b := range [][]byte{
+		{},
+		{0x59, 0x01},       // truncated length
+		{0x43, 1, 2},       // truncated bytes
+		{0x9f},             // indefinite array
+		{0xc1, 0x00},       // tag
+		{0xa1, 0x80, 0x00}, // array as a map key
+	} {
+		if _, _, err := decodeCBOR(b); err == nil {
+			t.Errorf("decodeCBOR(%x) succeeded", b)
+		}
+	}
+}
+
+// encodeCBOR encodes ints, strings, byte strings, arrays and maps (with
+// canonically sorted keys, like authenticators produce).
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		case n < 1<<32:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		default:
+			return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+		}
+	}
+	switch v := v.(type) {
+	case int:
+		if v >= 0 {
+			return head(0, uint64(v))
+		}
+		return head(1, uint64(-1-v))
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case []any:
+		b := head(4, uint64(len(v)))
+		for _, item := range v {
+			b = append(b, encodeCBOR(item)...)
+		}
+		return b
+	case map[any]any:
+		var keys [][]byte
+		encoded := map[string][]byte{}
+		for k, item := range v {
+			kb := encodeCBOR(k)
+			keys = append(keys, kb)
+			encoded[string(kb)] = encodeCBOR(item)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return bytes.Compare(keys[i], keys[j]) < 0
+		})
+		b := head(5, uint64(len(v)))
+		for _, kb := range keys {
+			b = append(append(b, kb...), encoded[string(kb)]...)
+		}
+		return b
+	default:
+		panic("encodeCBOR: unsupported type")
+	}
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	must(rand.Read(b))
+	return b
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
+	"html/template"
 	"sort"
+	"strings"
 
 	"github.com/andreyvit/edb"
 	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/forms"
 	"github.com/andreyvit/mvp/httperrors"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 
 	m "github.com/andreyvit/buddyd/model"
 )
@@ -23,6 +28,9 @@ func (app *App) showLibraryFolder(rc *RC, in *struct {
 
 func (app *App) doShowLibraryFolder(rc *RC, folderID m.FolderID) (*mvp.ViewData, error) {
 	folder := rc.Library.Folder(folderID)
+	if folder == nil {
+		return nil, httperrors.Errorf(404, "", "Folder not found")
+	}
 
 	items := edb.All(edb.ExactIndexScan[m.Item](rc, ItemsByFolder, folderID))
 	sort.Slice(items, func(i, j int) bool {
@@ -33,14 +41,25 @@ func (app *App) doShowLibraryFolder(rc *RC, folderID m.FolderID) (*mvp.ViewData,
 		Folder: folder,
 		Items:  items,
 	}
+	for _, id := range folder.ChildenIDs {
+		if sub := rc.Library.Folder(id); sub != nil {
+			vm.Subfolders = append(vm.Subfolders, sub)
+		}
+	}
+	var access string
+	if folder.ACL != nil {
+		access = folder.ACL.Describe(loadAccountGroups(rc, rc.AccountID()))
+	}
 	return &mvp.ViewData{
 		View:         "lib/folder",
 		Title:        folder.Name,
 		SemanticPath: folder.SemanticPath(),
 		Data: struct {
 			Folder *m.FolderWithItemsVM
+			Access string
 		}{
 			Folder: vm,
+			Access: access,
 		},
 	}, nil
 }
@@ -49,11 +68,15 @@ func (app *App) showLibraryItem(rc *RC, in *struct {
 	ItemID m.ItemID `form:"item,path" json:"-"`
 }) (*mvp.ViewData, error) {
 	item := edb.Get[m.Item](rc, in.ItemID)
-	if item == nil {
+	if item == nil || item.AccountID != rc.AccountID() {
 		return nil, httperrors.Errorf(404, "", "Item not found")
 	}
 
+	// also hides items of restricted folders
 	fldr := rc.Library.Folder(item.FolderID)
+	if fldr == nil {
+		return nil, httperrors.Errorf(404, "", "Item not found")
+	}
 
 	contents := edb.All(edb.PrefixIndexScan[m.Content](rc, ContentByIRO, 1, m.ContentIROKey{ItemID: item.ID}))
 
@@ -89,3 +112,86 @@ func (app *App) showLibraryItem(rc *RC, in *struct {
 		},
 	}, nil
 }
+
+func (app *App) handleLibraryFolderAccess(rc *RC, in *struct {
+	FolderID m.FolderID `form:"folder,path" json:"-"`
+	IsSaving bool       `json:"-" form:",issave"`
+}) (any, error) {
+	if err := rc.Check(m.PermissionManageLibrary, nil); err != nil {
+		return nil, mvp.ErrForbidden.Wrap(err)
+	}
+	fldr := rc.Library.Folder(in.FolderID)
+	if fldr == nil {
+		return nil, httperrors.Errorf(404, "", "Folder not found")
+	}
+	if fldr.IsRoot() {
+		return nil, httperrors.BadRequest.Msg("the root folder is always accessible")
+	}
+
+	groups := loadAccountGroups(rc, rc.AccountID())
+	var roles, groupNames string
+	if fldr.ACL != nil {
+		roles = fldr.ACL.RolesString()
+		groupNames = strings.Join(fldr.ACL.GroupNames(groups), ", ")
+	}
+
+	form := &forms.Form{
+		Group: forms.Group{
+			Styles: []*forms.Style{
+				adminFormStyle,
+				horizontalFormStyle,
+			},
+			Children: []forms.Child{
+				&forms.Item{
+					Name:  "roles",
+					Label: "Restrict to roles (consumer, assistant). Owners and admins always have access; leave roles and groups empty to open the folder to everyone.",
+					Child: &forms.InputText{
+						Binding: forms.Var(&roles),
+					},
+				},
+				&forms.Item{
+					Name:  "groups",
+					Label: "Or to members of groups (comma-separated group names)",
+					Child: &forms.InputText{
+						Binding: forms.Var(&groupNames),
+					},
+				},
+				saveFormButtonBar(),
+			},
+		},
+	}
+
+	if in.IsSaving && form.ProcessRequest(rc.Request.Request) {
+		parsedRoles, err := m.ParseFolderRoles(roles)
+		if err != nil {
+			return nil, httperrors.BadRequest.Msg(err.Error())
+		}
+		var groupIDs []m.UserGroupID
+		for _, name := range strings.Split(groupNames, ",") {
+			if strings.TrimSpace(name) == "" {
+				continue
+			}
+			g := m.FindUserGroup(groups, name)
+			if g == nil {
+				return nil, httperrors.BadRequest.Msg(fmt.Sprintf("unknown group %q", strings.TrimSpace(name)))
+			}
+			if !slices.Contains(groupIDs, g.ID) {
+				groupIDs = append(groupIDs, g.ID)
+			}
+		}
+		fldr.ACL = m.NewFolderACL(parsedRoles, groupIDs)
+		edb.Put(rc, fldr)
+		return app.Redirect("lib.folder", ":folder", fldr.ID), nil
+	}
+
+	return &mvp.ViewData{
+		View:         "form",
+		Title:        "Access to " + fldr.Name,
+		SemanticPath: fldr.SemanticPath(),
+		Data: struct {
+			Form template.HTML
+		}{
+			Form: app.RenderForm(rc.BaseRC(), form),
+		},
+	}, nil
+}
@@ -5,8 +5,12 @@ import (
 	"github.com/andreyvit/edb"
 )
 
+func loadAccountFolders(rc *RC, accountID m.AccountID) []*m.Folder {
+	return edb.All(edb.IndexScan[m.Folder](rc, FoldersByAccountParent, edb.ExactScan(m.AccountObjectKey{AccountID: accountID}).Prefix(1)))
+}
+
 func loadAccountLibrary(rc *RC, accountID m.AccountID) *m.AccountLibrary {
-	folders := edb.All(edb.IndexScan[m.Folder](rc, FoldersByAccountParent, edb.ExactScan(m.AccountObjectKey{AccountID: accountID}).Prefix(1)))
+	folders := loadAccountFolders(rc, accountID)
 
 	library := m.NewAccountLibrary(len(folders))
 
@@ -20,7 +24,9 @@ func loadCurrentAccountLibrary(rc *RC) {
 	rc.Library = loadAccountLibrary(rc, rc.AccountID())
 }
 
+// loadAccountLibraryMiddleware loads the part of the library the user can see.
 func loadAccountLibraryMiddleware(rc *RC) (any, error) {
 	loadCurrentAccountLibrary(rc)
+	rc.Library = rc.Library.Restrict(rc.Library.AccessibleFolders(rc.User, rc.AccountID()))
 	return nil, nil
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"embed"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -19,6 +20,7 @@ import (
 	"github.com/andreyvit/mvp/jwt"
 	mvpm "github.com/andreyvit/mvp/mvpmodel"
 
+	"github.com/andreyvit/buddyd/internal/domainverify"
 	m "github.com/andreyvit/buddyd/model"
 )
 
@@ -83,6 +85,26 @@ type Settings struct {
 
 	SignInCodeExpiration     jsonext.Duration
 	SignInCodeResendInterval jsonext.Duration
+
+	// After SignInMaxCodeFailures wrong codes, the email is locked out for
+	// SignInLockoutDuration, doubling with every lockout up to the max.
+	// Failure counts are forgotten after SignInAttemptRetention.
+	SignInMaxCodeFailures    int
+	SignInLockoutDuration    jsonext.Duration
+	SignInMaxLockoutDuration jsonext.Duration
+	SignInAttemptRetention   jsonext.Duration
+
+	// Sessions unused for this long are signed out; zero keeps them forever.
+	SessionIdleTimeout jsonext.Duration
+
+	// Email replies to chats are accepted when both are set; the secret signs
+	// reply addresses and authenticates Postmark's inbound webhook.
+	InboundEmailDomain string
+	InboundEmailSecret string
+
+	// FakeAI replaces OpenAI with an in-process fake (see m.FakeProvider),
+	// for local development and tests without an API key.
+	FakeAI bool
 }
 
 type DeploymentSettings struct {
@@ -96,9 +118,14 @@ type App struct {
 	users                atomic.Value
 	httpClient           *http.Client
 	dangerousRateLimiter *rate.Limiter
+	domainResolver       domainverify.Resolver
+	fakeAI               *m.FakeProvider
 
 	runtimeAccountsByID map[m.AccountID]*m.RuntimeAccount
 	runtimeAccountsMut  sync.RWMutex
+
+	chatStreamListeners map[m.ChatID]func(text string)
+	chatStreamMut       sync.Mutex
 }
 
 func (app *App) Settings() *Settings {
@@ -130,6 +157,12 @@ func (rc *RC) UserID() m.AccountID {
 	return rc.User.ID
 }
 
+// IsImpersonating returns whether a superadmin is acting as another user;
+// rc.User is then the impersonated user and rc.OriginalUser the superadmin.
+func (rc *RC) IsImpersonating() bool {
+	return rc.Session != nil && rc.Session.ImpersonatedUserID != 0 && rc.User != rc.OriginalUser
+}
+
 func (rc *RC) Check(perm m.Permission, obj mvpm.Object) error {
 	return m.CheckAccess(rc.User, perm, rc.AccountID(), obj)
 }
@@ -162,6 +195,8 @@ func newApp() *App {
 			Timeout: 2 * time.Minute,
 		},
 		dangerousRateLimiter: rate.NewLimiter(rate.Every(time.Second*5), 5),
+		domainResolver:       net.DefaultResolver,
+		fakeAI:               &m.FakeProvider{},
 	}
 }
 
@@ -1,15 +1,39 @@
 package main
 
 import (
+	"github.com/andreyvit/edb"
 	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
 )
 
-func (app *App) showAccountActivity(rc *mvp.RC, in *struct{}) (*mvp.ViewData, error) {
+func (app *App) showAccountActivity(rc *RC, in *struct{}) (*mvp.ViewData, error) {
 	return &mvp.ViewData{
 		View:         "mod/activity",
 		Title:        "Activity",
 		SemanticPath: "mod/activity",
 		Data: struct {
-		}{},
+			Groups      []*m.UserGroup
+			FilterGroup *m.UserGroup
+		}{
+			Groups:      loadAccountGroups(rc, rc.AccountID()),
+			FilterGroup: modFilterGroup(rc),
+		},
 	}, nil
 }
+
+func (app *App) setModChatFilter(rc *RC, in *struct {
+	GroupID flake.ID `json:"group"`
+}) (any, error) {
+	if in.GroupID != 0 {
+		g := edb.Get[m.UserGroup](rc, in.GroupID)
+		if g == nil || g.AccountID != rc.AccountID() {
+			return nil, httperrors.Errorf(404, "", "Group not found")
+		}
+	}
+	rc.Session.ModGroupID = in.GroupID
+	edb.Put(rc, rc.Session)
+	return app.Redirect("mod.activity"), nil
+}
@@ -7,5 +7,27 @@ import (
 
 func loadAllChatListMiddleware(rc *RC) (any, error) {
 	rc.Chats = wrapChatList(rc, edb.All(edb.ReverseExactIndexScan[m.Chat](rc, ChatsByAccount, rc.AccountID())))
+	if g := modFilterGroup(rc); g != nil {
+		chats := rc.Chats[:0]
+		for _, chat := range rc.Chats {
+			if chat.Author != nil && chat.Author.Membership(rc.AccountID()).InGroup(g.ID) {
+				chats = append(chats, chat)
+			}
+		}
+		rc.Chats = chats
+	}
 	return nil, nil
 }
+
+// modFilterGroup returns the group the moderator limited the chat list to,
+// if it still exists in the current account.
+func modFilterGroup(rc *RC) *m.UserGroup {
+	if rc.Session == nil || rc.Session.ModGroupID == 0 {
+		return nil
+	}
+	g := edb.Get[m.UserGroup](rc, rc.Session.ModGroupID)
+	if g == nil || g.AccountID != rc.AccountID() {
+		return nil
+	}
+	return g
+}
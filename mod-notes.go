@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+const maxNoteLength = 4000
+
+func loadChatNotes(rc *RC, cc *m.ChatContent) []*m.ChatNoteVM {
+	notes := edb.All(edb.ExactIndexScan[m.ChatNote](rc, ChatNotesByChat, cc.ChatID))
+	result := make([]*m.ChatNoteVM, 0, len(notes))
+	for _, note := range notes {
+		vm := &m.ChatNoteVM{ChatNote: note}
+		if note.MessageID != 0 {
+			if _, msg := cc.FindMessage(note.MessageID); msg != nil {
+				vm.MessageExcerpt = m.Excerpt(msg.Text, 80)
+			}
+		}
+		result = append(result, vm)
+	}
+	return result
+}
+
+func (app *App) addChatNote(rc *RC, in *struct {
+	ChatID    flake.ID `form:"chat,path" json:"-"`
+	MessageID flake.ID `json:"message"`
+	Text      string   `json:"text"`
+}) (any, error) {
+	chat := must(loadModChat(rc, in.ChatID))
+	text := strings.TrimSpace(in.Text)
+	if text == "" {
+		return app.Redirect("mod.chat.view", ":chat", chat.ID), nil
+	}
+	if len(text) > maxNoteLength {
+		return nil, httperrors.BadRequest.Msg("note too long")
+	}
+	if in.MessageID != 0 {
+		cc := loadChatContent(rc, chat.ID)
+		if _, msg := cc.FindMessage(in.MessageID); msg == nil {
+			return nil, httperrors.NotFound
+		}
+	}
+
+	var staff []*m.User
+	for _, u := range rc.Account.UsersByID {
+		if u.ID != rc.UserID() && u.MembershipRole(rc.AccountID()).HasBackofficeAccess() {
+			staff = append(staff, u)
+		}
+	}
+	mentioned := m.FindMentions(text, staff)
+
+	note := &m.ChatNote{
+		ID:         app.NewID(),
+		AccountID:  rc.AccountID(),
+		ChatID:     chat.ID,
+		MessageID:  in.MessageID,
+		AuthorID:   rc.UserID(),
+		AuthorName: rc.User.Name,
+		Time:       rc.Now,
+		Text:       text,
+	}
+	for _, u := range mentioned {
+		note.MentionedIDs = append(note.MentionedIDs, u.ID)
+	}
+	edb.Put(rc, note)
+
+	chatURL := strings.TrimSuffix(app.Settings().BaseURL, "/") + app.URL("mod.chat.view", ":chat", chat.ID)
+	for _, u := range mentioned {
+		flogger.Log(rc, "Notifying %s of a mention in a note on chat %v", u.Email, chat.ID)
+		app.SendEmail(rc, &mvp.Email{
+			To:      u.Email,
+			Subject: rc.Account.EmailSubject(rc.User.Name + " mentioned you in a chat note"),
+			View:    "emails/note-mention",
+			Data: map[string]any{
+				"AuthorName": rc.User.Name,
+				"ChatTitle":  chat.TitleWithFallback(),
+				"Text":       text,
+				"URL":        chatURL,
+			},
+			Category: "mention",
+		})
+	}
+
+	return app.Redirect("mod.chat.view", ":chat", chat.ID), nil
+}
+
+func (app *App) deleteChatNote(rc *RC, in *struct {
+	ChatID flake.ID `form:"chat,path" json:"-"`
+	NoteID flake.ID `form:"note,path" json:"-"`
+}) (any, error) {
+	chat := must(loadModChat(rc, in.ChatID))
+	note := edb.Get[m.ChatNote](rc, in.NoteID)
+	if note == nil || note.ChatID != chat.ID {
+		return nil, httperrors.NotFound
+	}
+	if note.AuthorID != rc.UserID() {
+		return nil, httperrors.Errorf(403, "", "Only the author can delete a note.")
+	}
+	rc.DBTx().DeleteByKey(ChatNotes, note.ID)
+	return app.Redirect("mod.chat.view", ":chat", chat.ID), nil
+}
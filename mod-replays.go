@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+const (
+	defaultReplayCount = 20
+	maxReplayCount     = 200
+)
+
+func (app *App) listReplayRuns(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	runs := edb.All(edb.ReverseExactIndexScan[m.ReplayRun](rc, ReplayRunsByAccount, rc.AccountID()))
+	return &mvp.ViewData{
+		View:         "mod/replays",
+		Title:        "Answer Replays",
+		SemanticPath: "mod/replays",
+		Data: struct {
+			Runs []*m.ReplayRun
+		}{
+			Runs: runs,
+		},
+	}, nil
+}
+
+func (app *App) handleNewReplayRun(rc *RC, in *struct {
+	IsSaving       bool   `json:"-" form:",issave"`
+	Name           string `json:"name"`
+	Model          string `json:"model"`
+	PromptTemplate string `json:"prompt"`
+	Count          int    `json:"count"`
+	DownvotedOnly  bool   `json:"downvoted_only"`
+	RecordingIDs   string `json:"recordings"`
+	ChatID         string `json:"chat"`
+	Since          string `json:"since"`
+	Until          string `json:"until"`
+}) (any, error) {
+	if !in.IsSaving {
+		return &mvp.ViewData{
+			View:         "mod/replay-new",
+			Title:        "New Answer Replay",
+			SemanticPath: "mod/replays",
+			Data: struct {
+				Model          string
+				PromptTemplate string
+				Count          int
+			}{
+				Model:          DefaultModel,
+				PromptTemplate: promptTemplateFor(rc.Account.Account, nil),
+				Count:          defaultReplayCount,
+			},
+		}, nil
+	}
+
+	if in.Count <= 0 || in.Count > maxReplayCount {
+		return nil, httperrors.BadRequest.Msg("invalid number of recordings")
+	}
+	run := &m.ReplayRun{
+		ID:             app.NewID(),
+		AccountID:      rc.AccountID(),
+		Name:           strings.TrimSpace(in.Name),
+		CreationTime:   rc.Now,
+		CreatorID:      rc.UserID(),
+		Model:          strings.TrimSpace(in.Model),
+		PromptTemplate: strings.TrimSpace(in.PromptTemplate),
+	}
+	if run.PromptTemplate == strings.TrimSpace(promptTemplateFor(rc.Account.Account, nil)) {
+		run.PromptTemplate = "" // replay the recorded system prompt verbatim
+	}
+
+	recIDs, err := m.ParseAnswerRecordingIDs(in.RecordingIDs)
+	if err != nil {
+		return nil, httperrors.BadRequest.Msg(err.Error())
+	}
+	if len(recIDs) > maxReplayCount {
+		return nil, httperrors.BadRequest.Msg("too many recordings")
+	}
+	filter, err := m.ParseReplayFilter(in.ChatID, in.Since, in.Until)
+	if err != nil {
+		return nil, httperrors.BadRequest.Msg(err.Error())
+	}
+
+	if len(recIDs) > 0 {
+		for _, id := range recIDs {
+			rec := edb.Get[m.AnswerRecording](rc, id)
+			if rec == nil || rec.AccountID != rc.AccountID() {
+				return nil, httperrors.Errorf(404, "", "Recording %v not found", id)
+			}
+			if rec.Failed {
+				return nil, httperrors.BadRequest.Msg(fmt.Sprintf("recording %v has no answer", id))
+			}
+			run.Results = append(run.Results, &m.ReplayResult{RecordingID: rec.ID})
+		}
+	} else {
+		idx, key := AnswerRecordingsByAccount, rc.AccountID()
+		if filter.ChatID != 0 {
+			chat := edb.Get[m.Chat](rc, filter.ChatID)
+			if chat == nil || chat.AccountID != rc.AccountID() {
+				return nil, httperrors.Errorf(404, "", "Chat not found")
+			}
+			idx, key = AnswerRecordingsByChat, filter.ChatID
+		}
+		for c := edb.ReverseExactIndexScan[m.AnswerRecording](rc, idx, key); c.Next(); {
+			if len(run.Results) >= in.Count {
+				break
+			}
+			rec := c.Row()
+			if rec.Failed || rec.AccountID != rc.AccountID() || !filter.Matches(rec) {
+				continue
+			}
+			if in.DownvotedOnly && !isRecordedAnswerVotedDown(rc, rec) {
+				continue
+			}
+			run.Results = append(run.Results, &m.ReplayResult{RecordingID: rec.ID})
+		}
+	}
+	if len(run.Results) == 0 {
+		return nil, httperrors.BadRequest.Msg("no recorded answers match")
+	}
+	if run.Name == "" {
+		run.Name = rc.Now.Format("Replay Jan 02 15:04")
+	}
+
+	edb.Put(rc, run)
+	app.EnqueueReplayRun(rc, run.ID)
+	return app.Redirect("mod.replays.view", ":run", run.ID), nil
+}
+
+func isRecordedAnswerVotedDown(rc *RC, rec *m.AnswerRecording) bool {
+	cc := edb.Get[m.ChatContent](rc, rec.ChatID)
+	if cc == nil {
+		return false
+	}
+	_, msg := cc.FindMessage(rec.MessageID)
+	return msg != nil && msg.VotedDown
+}
+
+func (app *App) showReplayRun(rc *RC, in *struct {
+	RunID flake.ID `form:"run,path" json:"-"`
+}) (*mvp.ViewData, error) {
+	run := edb.Get[m.ReplayRun](rc, in.RunID)
+	if run == nil || run.AccountID != rc.AccountID() {
+		return nil, httperrors.Errorf(404, "", "Replay not found")
+	}
+
+	vm := &m.ReplayRunVM{
+		ReplayRun:   run,
+		Comparisons: make([]*m.ReplayComparisonVM, 0, len(run.Results)),
+	}
+	for _, r := range run.Results {
+		rec := edb.Get[m.AnswerRecording](rc, r.RecordingID)
+		if rec == nil {
+			continue
+		}
+		vm.Comparisons = append(vm.Comparisons, &m.ReplayComparisonVM{
+			Recording: rec,
+			Result:    r,
+		})
+	}
+
+	return &mvp.ViewData{
+		View:         "mod/replay",
+		Title:        run.Name,
+		SemanticPath: "mod/replays",
+		Data: struct {
+			Run *m.ReplayRunVM
+		}{
+			Run: vm,
+		},
+	}, nil
+}
+
+func (app *App) EnqueueReplayRun(rc *RC, runID m.ReplayRunID) {
+	app.EnqueueEphemeral(jobReplayAnswers, runID.String(), func(rc *mvp.RC) error {
+		return app.runReplay(fullRC.From(rc), runID)
+	})
+}
+
+// runReplay re-runs recorded answers one by one, saving each result in its own
+// transaction so that a partially completed run can be viewed (and resumed).
+func (app *App) runReplay(rc *RC, runID m.ReplayRunID) error {
+	for {
+		var run *m.ReplayRun
+		var rec *m.AnswerRecording
+		var contents []*m.Content
+		idx := -1
+		err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+			run = edb.Get[m.ReplayRun](rc, runID)
+			if run == nil {
+				return nil
+			}
+			for i, r := range run.Results {
+				if !r.Done {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				return nil
+			}
+			rec = edb.Get[m.AnswerRecording](rc, run.Results[idx].RecordingID)
+			if rec != nil && run.PromptTemplate != "" {
+				for _, id := range rec.ContextContentIDs {
+					if c := edb.Get[m.Content](rc, id); c != nil {
+						contents = append(contents, c)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if run == nil {
+			return nil
+		}
+		if idx < 0 {
+			return app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+				run := edb.Get[m.ReplayRun](rc, runID)
+				run.State = m.ReplayRunStateFinished
+				edb.Put(rc, run)
+				return nil
+			})
+		}
+
+		result := &m.ReplayResult{
+			RecordingID: run.Results[idx].RecordingID,
+			Done:        true,
+		}
+		if rec == nil {
+			result.Error = "recording has been deleted"
+		} else {
+			app.replayAnswer(rc, run, rec, contents, result)
+		}
+		flogger.Log(rc, "Replay(%v): %d/%d done, err=%v", runID, idx+1, len(run.Results), result.Error)
+
+		err = app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+			run := edb.Get[m.ReplayRun](rc, runID)
+			if run == nil || idx >= len(run.Results) {
+				return nil
+			}
+			run.Results[idx] = result
+			run.State = m.ReplayRunStateRunning
+			edb.Put(rc, run)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (app *App) replayAnswer(rc *RC, run *m.ReplayRun, rec *m.AnswerRecording, contents []*m.Content, result *m.ReplayResult) {
+	systemPrompt := rec.SystemPrompt
+	if run.PromptTemplate != "" {
+		frame := splitPrompt(run.PromptTemplate)
+		systemPrompt = m.InsertMessageContent(frame.Prefix, frame.Suffix, frame.Sep, contents)
+	}
+	history := rec.ChatHistory(systemPrompt)
+
+	opt := openai.DefaultChatOptions()
+	opt.Model = cond(run.Model != "", run.Model, rec.Model)
+	opt.MaxTokens = rec.MaxTokens
+	opt.Temperature = rec.Temperature
+
+	msgs, usage, err := openai.Chat(rc, history, opt, app.httpClient, app.Settings().OpenAICreds)
+	result.PromptTokens = usage.PromptTokens
+	result.CompletionTokens = usage.CompletionTokens
+	result.Cost = openai.Cost(usage.PromptTokens, usage.CompletionTokens, opt.Model)
+	if err != nil {
+		result.Error = err.Error()
+	} else if len(msgs) > 0 {
+		result.Answer = msgs[0].Content
+	}
+}
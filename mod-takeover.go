@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/httperrors"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// takeOverChat pauses the bot so that a moderator can reply as a human.
+// An answer that is already being generated is allowed to finish.
+func (app *App) takeOverChat(rc *RC, in *struct {
+	ChatID flake.ID `form:"chat,path" json:"-"`
+}) (any, error) {
+	chat := must(loadModChat(rc, in.ChatID))
+	cc := loadChatContent(rc, chat.ID)
+
+	chat.BotPaused = true
+	chat.PausedByID = rc.UserID()
+	chat.PauseTime = rc.Now
+
+	edb.Put(rc, chat)
+	pushChatContent(rc, chat, cc)
+	return app.Redirect("mod.chat.view", ":chat", chat.ID), nil
+}
+
+// handBackChat resumes the bot. If the user has written something the coach
+// hasn't replied to, the bot answers it right away.
+func (app *App) handBackChat(rc *RC, in *struct {
+	ChatID flake.ID `form:"chat,path" json:"-"`
+}) (any, error) {
+	chat := must(loadModChat(rc, in.ChatID))
+	cc := loadChatContent(rc, chat.ID)
+
+	chat.BotPaused = false
+	chat.PausedByID = 0
+
+	var rollforward bool
+	if t := cc.LastTurn(); t != nil && t.Role == m.MessageRoleUser {
+		botTurn := app.addTurn(cc, m.MessageRoleBot)
+		app.addBotPendingMsg(botTurn)
+		rollforward = true
+	}
+
+	edb.Put(rc, chat, cc)
+	if rollforward {
+		app.EnqueueChatRollforward(rc, chat.ID)
+	}
+	pushChatContent(rc, chat, cc)
+	return app.Redirect("mod.chat.view", ":chat", chat.ID), nil
+}
+
+func (app *App) sendStaffMessage(rc *RC, in *struct {
+	ChatID  flake.ID `form:"chat,path" json:"-"`
+	Message string   `json:"message"`
+}) (any, error) {
+	if in.Message == "" {
+		return app.Redirect("mod.chat.view", ":chat", in.ChatID), nil
+	}
+	if openai.TokenCount(in.Message, DefaultModel) > MaxMsgTokenCount {
+		return nil, fmt.Errorf("message too long")
+	}
+
+	chat := must(loadModChat(rc, in.ChatID))
+	if !chat.BotPaused {
+		return nil, httperrors.BadRequest.Msg("take over the chat before replying")
+	}
+	cc := loadChatContent(rc, chat.ID)
+	if t := cc.LastTurn(); t != nil && t.IsLastMessagePending() {
+		return nil, httperrors.BadRequest.Msg("wait for the bot to finish its answer")
+	}
+
+	staffTurn := app.addTurn(cc, m.MessageRoleStaff)
+	app.addStaffMsg(staffTurn, in.Message, rc.User)
+
+	edb.Put(rc, chat, cc)
+	pushChatContent(rc, chat, cc)
+	return app.Redirect("mod.chat.view", ":chat", chat.ID), nil
+}
@@ -0,0 +1,115 @@
+package m
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/exp/slices"
+)
+
+// SignupPolicy decides who can join an account by simply signing in.
+type SignupPolicy int
+
+const (
+	// SignupPolicyWhitelist only lets in users added via the whitelist.
+	SignupPolicyWhitelist = SignupPolicy(0)
+	// SignupPolicyDomains lets in anyone with an email in a verified domain.
+	SignupPolicyDomains = SignupPolicy(1)
+	// SignupPolicyOpen lets in anyone signing in via the account's sign-in
+	// link, as well as anyone with an email in a verified domain.
+	SignupPolicyOpen = SignupPolicy(2)
+)
+
+var _signupPolicyStrings = []string{
+	"whitelist",
+	"domains",
+	"open",
+}
+
+func (v SignupPolicy) String() string {
+	return _signupPolicyStrings[v]
+}
+
+func ParseSignupPolicy(s string) (SignupPolicy, error) {
+	if i := slices.Index(_signupPolicyStrings, strings.ToLower(strings.TrimSpace(s))); i >= 0 {
+		return SignupPolicy(i), nil
+	} else {
+		return SignupPolicyWhitelist, fmt.Errorf("invalid SignupPolicy %q", s)
+	}
+}
+
+func (v SignupPolicy) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+func (v *SignupPolicy) UnmarshalText(b []byte) error {
+	var err error
+	*v, err = ParseSignupPolicy(string(b))
+	return err
+}
+func (v SignupPolicy) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeUint(uint64(v))
+}
+func (v *SignupPolicy) DecodeMsgpack(dec *msgpack.Decoder) error {
+	n, err := dec.DecodeUint()
+	*v = SignupPolicy(n)
+	return err
+}
+
+// AccountDomain is an email domain claimed by an account. Until its owner
+// publishes Token in a DNS TXT record, it doesn't let anyone in.
+type AccountDomain struct {
+	Domain           string    `msgpack:"d"`
+	Token            string    `msgpack:"t"`
+	CreationTime     time.Time `msgpack:"@"`
+	VerificationTime time.Time `msgpack:"@v,omitempty"`
+	LastCheckTime    time.Time `msgpack:"@c,omitempty"`
+	LastCheckError   string    `msgpack:"err,omitempty"`
+}
+
+func (d *AccountDomain) IsVerified() bool {
+	return !d.VerificationTime.IsZero()
+}
+
+func (acc *Account) Domain(domain string) *AccountDomain {
+	for _, d := range acc.Domains {
+		if d.Domain == domain {
+			return d
+		}
+	}
+	return nil
+}
+
+// HasVerifiedDomain returns whether the email belongs to a verified domain
+// of the account.
+func (acc *Account) HasVerifiedDomain(email string) bool {
+	d := acc.Domain(EmailDomain(email))
+	return d != nil && d.IsVerified()
+}
+
+// SignupSource returns how a user with the given normalized email can join
+// the account by signing in, or UserSourceDefault if they can't. Open accounts
+// only admit arbitrary users who came via the account's own sign-in link
+// (viaLink), so that they don't collect everyone signing in to any account.
+func (acc *Account) SignupSource(emailNorm string, viaLink bool) UserSource {
+	if acc.Disabled || acc.IsTemplate || acc.SignupPolicy == SignupPolicyWhitelist {
+		return UserSourceDefault
+	}
+	if acc.HasVerifiedDomain(emailNorm) {
+		return UserSourceDomain
+	}
+	if acc.SignupPolicy == SignupPolicyOpen && viaLink {
+		return UserSourceSignup
+	}
+	return UserSourceDefault
+}
+
+// EmailDomain returns the lowercased domain part of the email.
+func EmailDomain(email string) string {
+	i := strings.LastIndexByte(email, '@')
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(email[i+1:])
+}
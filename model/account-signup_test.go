@@ -0,0 +1,74 @@
+package m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccountSignupSource(t *testing.T) {
+	verified := func() []*AccountDomain {
+		return []*AccountDomain{
+			{Domain: "example.com", Token: "t1", VerificationTime: time.Unix(1700000000, 0)},
+			{Domain: "pending.com", Token: "t2"},
+		}
+	}
+	whitelist := &Account{Domains: verified()}
+	domains := &Account{SignupPolicy: SignupPolicyDomains, Domains: verified()}
+	open := &Account{SignupPolicy: SignupPolicyOpen, Domains: verified()}
+	disabled := &Account{SignupPolicy: SignupPolicyOpen, Domains: verified(), Disabled: true}
+
+	tests := []struct {
+		acc      *Account
+		email    string
+		viaLink  bool
+		expected UserSource
+	}{
+		{whitelist, "alice@example.com", true, UserSourceDefault},
+		{domains, "alice@example.com", false, UserSourceDomain},
+		{domains, "alice@EXAMPLE.com", false, UserSourceDomain},
+		{domains, "alice@pending.com", false, UserSourceDefault},
+		{domains, "alice@sub.example.com", false, UserSourceDefault},
+		{domains, "alice@example.com.evil.io", false, UserSourceDefault},
+		{domains, "example.com", false, UserSourceDefault},
+		{domains, "bob@gmail.com", true, UserSourceDefault},
+		{open, "alice@example.com", false, UserSourceDomain},
+		{open, "bob@gmail.com", true, UserSourceSignup},
+		{open, "bob@gmail.com", false, UserSourceDefault},
+		{disabled, "bob@gmail.com", true, UserSourceDefault},
+	}
+	for _, tt := range tests {
+		actual := tt.acc.SignupSource(tt.email, tt.viaLink)
+		if actual != tt.expected {
+			t.Errorf("%v.SignupSource(%q, %v) = %v, wanted %v", tt.acc.SignupPolicy, tt.email, tt.viaLink, actual, tt.expected)
+		}
+	}
+}
+
+func TestIsHexColor(t *testing.T) {
+	for _, s := range []string{"#fff", "#7e22CE"} {
+		if !IsHexColor(s) {
+			t.Errorf("IsHexColor(%q) = false", s)
+		}
+	}
+	for _, s := range []string{"", "red", "#ffff", "#7e22ce; background: url(x)"} {
+		if IsHexColor(s) {
+			t.Errorf("IsHexColor(%q) = true", s)
+		}
+	}
+}
+
+func TestEmailSubject(t *testing.T) {
+	tests := []struct {
+		acc      *Account
+		expected string
+	}{
+		{nil, "[LibroAI] Reminder"},
+		{&Account{}, "[LibroAI] Reminder"},
+		{&Account{Branding: AccountBranding{AssistantName: "Coach Kim"}}, "[Coach Kim] Reminder"},
+	}
+	for _, tt := range tests {
+		if actual := tt.acc.EmailSubject("Reminder"); actual != tt.expected {
+			t.Errorf("EmailSubject(Reminder) = %q, wanted %q", actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package m
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/exp/slices"
+)
+
+type AuditAction int
+
+const (
+	AuditActionNone               = AuditAction(0)
+	AuditActionImpersonationStart = AuditAction(1)
+	AuditActionImpersonationStop  = AuditAction(2)
+)
+
+var _auditActionStrings = []string{
+	"none",
+	"impersonation-start",
+	"impersonation-stop",
+}
+
+var _auditActionTexts = []string{
+	"None",
+	"Started impersonating",
+	"Stopped impersonating",
+}
+
+func (v AuditAction) String() string {
+	return _auditActionStrings[v]
+}
+
+func (v AuditAction) Text() string {
+	return _auditActionTexts[v]
+}
+
+func ParseAuditAction(s string) (AuditAction, error) {
+	if i := slices.Index(_auditActionStrings, s); i >= 0 {
+		return AuditAction(i), nil
+	} else {
+		return AuditActionNone, fmt.Errorf("invalid AuditAction %q", s)
+	}
+}
+
+func (v AuditAction) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+func (v *AuditAction) UnmarshalText(b []byte) error {
+	var err error
+	*v, err = ParseAuditAction(string(b))
+	return err
+}
+func (v AuditAction) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeUint(uint64(v))
+}
+func (v *AuditAction) DecodeMsgpack(dec *msgpack.Decoder) error {
+	n, err := dec.DecodeUint()
+	*v = AuditAction(n)
+	return err
+}
+
+// AuditEvent records a privileged action taken by staff, so that it can be
+// reviewed later. Events are never modified or deleted.
+type AuditEvent struct {
+	ID        flake.ID    `msgpack:"-"`
+	Time      time.Time   `msgpack:"@"`
+	Action    AuditAction `msgpack:"act"`
+	ActorID   UserID      `msgpack:"ac"`
+	UserID    UserID      `msgpack:"u,omitempty"` // the user acted upon
+	AccountID AccountID   `msgpack:"a,omitempty"`
+	SessionID flake.ID    `msgpack:"s,omitempty"`
+	IP        string      `msgpack:"ip,omitempty"`
+}
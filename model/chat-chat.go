@@ -2,6 +2,7 @@ package m
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/andreyvit/mvp/flake"
 	"github.com/andreyvit/openai"
@@ -19,11 +20,18 @@ type (
 		TitleCustomized bool         `msgpack:"tc,omitempty"`
 		TitleGenerated  bool         `msgpack:"tg,omitempty"`
 		TitleRegen      bool         `msgpack:"trg,omitempty"`
+		BotPaused       bool         `msgpack:"bp,omitempty"`
+		PausedByID      UserID       `msgpack:"bpu,omitempty"`
+		PauseTime       time.Time    `msgpack:"bpt,omitempty"`
+		MemoryTurns     int          `msgpack:"mt,omitempty"`
+		ConnectorID     ConnectorID  `msgpack:"con,omitempty"`
+		ExternalThread  string       `msgpack:"ext,omitempty"` // ConnectorKey of the platform thread
 	}
 
 	ChatContent struct {
-		ChatID ChatID  `msgpack:"-"`
-		Turns  []*Turn `msgpack:"t"`
+		ChatID  ChatID       `msgpack:"-"`
+		Turns   []*Turn      `msgpack:"t"`
+		Summary *ChatSummary `msgpack:"sum,omitempty"`
 		// LastEventID uint64  `msgpack:"le"`
 	}
 
@@ -31,6 +39,9 @@ type (
 		*Chat
 		Author   *User
 		Messages []*MessageVM
+		Summary  *ChatSummary
+
+		ModeratorView bool
 	}
 )
 
@@ -140,6 +151,7 @@ func WrapChat(chat *Chat, content *ChatContent) *ChatVM {
 	chatVM := &ChatVM{
 		Chat:     chat,
 		Messages: make([]*MessageVM, 0, len(content.Turns)),
+		Summary:  content.Summary,
 	}
 	for _, t := range content.Turns {
 		msg := t.LastMessage()
@@ -147,3 +159,19 @@ func WrapChat(chat *Chat, content *ChatContent) *ChatVM {
 	}
 	return chatVM
 }
+
+// SetModeratorView marks the view as rendered for moderators, which makes
+// message views include prompt token accounting.
+func (chat *ChatVM) SetModeratorView() {
+	chat.ModeratorView = true
+	for _, msg := range chat.Messages {
+		msg.ShowStats = true
+	}
+}
+
+func (chat *ChatVM) MessageListHTMLElementID() string {
+	if chat.ModeratorView {
+		return "message-list-mod"
+	}
+	return "message-list"
+}
@@ -0,0 +1,193 @@
+package m
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PostmarkInboundEmail is the payload of Postmark's inbound email webhook.
+type PostmarkInboundEmail struct {
+	From              string            `json:"From"`
+	FromFull          PostmarkAddress   `json:"FromFull"`
+	To                string            `json:"To"`
+	ToFull            []PostmarkAddress `json:"ToFull"`
+	CcFull            []PostmarkAddress `json:"CcFull"`
+	OriginalRecipient string            `json:"OriginalRecipient"`
+	MailboxHash       string            `json:"MailboxHash"`
+	Subject           string            `json:"Subject"`
+	MessageID         string            `json:"MessageID"`
+	TextBody          string            `json:"TextBody"`
+	StrippedTextReply string            `json:"StrippedTextReply"`
+}
+
+type PostmarkAddress struct {
+	Email       string `json:"Email"`
+	Name        string `json:"Name"`
+	MailboxHash string `json:"MailboxHash"`
+}
+
+const chatReplyMailboxPrefix = "chat-"
+
+// ChatReplyMailbox returns the local part of the address that routes email
+// replies into the chat. The signature makes the address unguessable.
+func ChatReplyMailbox(secret string, chatID ChatID) string {
+	id := strconv.FormatUint(uint64(chatID), 10)
+	return chatReplyMailboxPrefix + id + "-" + idSignature(secret, id)
+}
+
+// idSignature authenticates IDs embedded in addresses and links we hand out.
+func idSignature(secret, id string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// ParseChatReplyMailbox returns the chat ID encoded in a mailbox produced by
+// ChatReplyMailbox, verifying the signature.
+func ParseChatReplyMailbox(secret, mailbox string) (ChatID, bool) {
+	rest, ok := strings.CutPrefix(strings.ToLower(mailbox), chatReplyMailboxPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, sig, ok := strings.Cut(rest, "-")
+	if !ok || !hmac.Equal([]byte(sig), []byte(idSignature(secret, id))) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return ChatID(n), true
+}
+
+// ReplyChatID finds the chat the email has been sent to, looking at Postmark's
+// mailbox hashes (the part after + in the address) and the recipients' local parts.
+func (e *PostmarkInboundEmail) ReplyChatID(secret string) (ChatID, bool) {
+	candidates := []string{e.MailboxHash, e.OriginalRecipient}
+	for _, addrs := range [][]PostmarkAddress{e.ToFull, e.CcFull} {
+		for _, a := range addrs {
+			candidates = append(candidates, a.MailboxHash, a.Email)
+		}
+	}
+	for _, c := range candidates {
+		local, _, _ := strings.Cut(c, "@")
+		if _, hash, ok := strings.Cut(local, "+"); ok {
+			local = hash
+		}
+		if chatID, ok := ParseChatReplyMailbox(secret, local); ok {
+			return chatID, true
+		}
+	}
+	return 0, false
+}
+
+// InboundEmailTokenMatches checks the token in the webhook URL against the
+// configured secret. An unconfigured secret matches nothing.
+func InboundEmailTokenMatches(token, secret string) bool {
+	return secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// EmailReplyStore looks up the records an email reply is checked against.
+type EmailReplyStore interface {
+	Chat(id ChatID) *Chat
+	UserByEmail(email string) *User
+	Account(id AccountID) *Account
+}
+
+// EmailReply is an email accepted as the next user turn of a chat.
+type EmailReply struct {
+	Chat   *Chat
+	Sender *User
+	Text   string
+}
+
+// WakesBot returns whether the bot should answer the reply. Paused chats only
+// record it for the moderators.
+func (r *EmailReply) WakesBot() bool {
+	return !r.Chat.BotPaused
+}
+
+// AcceptReply checks that the email replies to a chat, comes from the chat's
+// author and that the author can still use the chat's account.
+func (e *PostmarkInboundEmail) AcceptReply(secret string, store EmailReplyStore) (*EmailReply, error) {
+	chatID, ok := e.ReplyChatID(secret)
+	if !ok {
+		return nil, fmt.Errorf("not addressed to a chat")
+	}
+	text := e.ReplyText()
+	if text == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	chat := store.Chat(chatID)
+	if chat == nil {
+		return nil, fmt.Errorf("chat %v not found", chatID)
+	}
+	sender := store.UserByEmail(e.FromFull.Email)
+	if sender == nil || sender.ID != chat.UserID {
+		return nil, fmt.Errorf("sender is not the author of chat %v", chatID)
+	}
+	account := store.Account(chat.AccountID)
+	memb := sender.Membership(chat.AccountID)
+	if account == nil || account.Disabled || memb == nil || !memb.Status.ActiveOrInvited() {
+		return nil, fmt.Errorf("sender has no access to account %v", chat.AccountID)
+	}
+	return &EmailReply{Chat: chat, Sender: sender, Text: text}, nil
+}
+
+// ReplyText returns the new text of the reply, without the quoted earlier messages.
+func (e *PostmarkInboundEmail) ReplyText() string {
+	if s := strings.TrimSpace(e.StrippedTextReply); s != "" {
+		return s
+	}
+	return StripQuotedReply(e.TextBody)
+}
+
+// StripQuotedReply drops the quoted original message and the signature from
+// a plain-text email reply.
+func StripQuotedReply(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var kept []string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if isQuoteHeader(trimmed, lines[i+1:]) || line == "-- " || trimmed == "--" {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+func isQuoteHeader(line string, following []string) bool {
+	switch {
+	case strings.HasPrefix(line, "-----Original Message-----"):
+		return true
+	case strings.HasPrefix(line, "________________________________"):
+		return true
+	case strings.HasPrefix(line, "From:") && len(following) > 0 && hasHeaderPrefix(following[0]):
+		return true // Outlook-style header block
+	case strings.HasPrefix(line, "On ") && strings.HasSuffix(line, "wrote:"):
+		return true
+	case strings.HasPrefix(line, "On ") && len(following) > 0 && strings.HasSuffix(strings.TrimSpace(following[0]), "wrote:"):
+		return true // Gmail wraps long attribution lines
+	default:
+		return false
+	}
+}
+
+func hasHeaderPrefix(line string) bool {
+	for _, p := range []string{"Sent:", "Date:", "To:", "Subject:", "Cc:"} {
+		if strings.HasPrefix(strings.TrimSpace(line), p) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package m
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/andreyvit/mvp/flake"
@@ -9,15 +10,23 @@ import (
 type MessageID = flake.ID
 
 type Message struct {
-	ID                MessageID    `msgpack:"#"`
-	Role              MessageRole  `msgpack:"r"`
-	State             MessageState `msgpack:"s"`
-	Text              string       `msgpack:"t"`
-	TurnID            TurnID       `msgpack:"tid"`
-	TurnIndex         int          `msgpack:"ti"`
-	EmbeddingAda002   Embedding    `msgpack:"e2,omitempty"`
-	ContextContentIDs []ContentID  `msgpack:"cc,omitempty"`
-	ContextDistances  []float64    `msgpack:"cd,omitempty"`
+	ID                MessageID      `msgpack:"#"`
+	Role              MessageRole    `msgpack:"r"`
+	State             MessageState   `msgpack:"s"`
+	Text              string         `msgpack:"t"`
+	TurnID            TurnID         `msgpack:"tid"`
+	TurnIndex         int            `msgpack:"ti"`
+	EmbeddingAda002   Embedding      `msgpack:"e2,omitempty"`
+	EmbeddingHash     Embedding      `msgpack:"eh,omitempty"`
+	ContextContentIDs []ContentID    `msgpack:"cc,omitempty"`
+	ContextDistances  []float64      `msgpack:"cd,omitempty"`
+	ContextScores     []float64      `msgpack:"cr,omitempty"`
+	PromptStats       *PromptStats   `msgpack:"ps,omitempty"`
+	SearchQueries     []string       `msgpack:"sq,omitempty"`
+	AuthorID          UserID         `msgpack:"au,omitempty"`
+	AuthorName        string         `msgpack:"an,omitempty"`
+	MemoryIDs         []UserMemoryID `msgpack:"mem,omitempty"`
+	ToolCall          *ToolCall      `msgpack:"tc,omitempty"`
 
 	VotedUp   bool `msgpack:"vu,omitempty"`
 	VotedDown bool `msgpack:"vd,omitempty"`
@@ -30,6 +39,28 @@ func (msg *Message) IDOrZero() MessageID {
 	return msg.ID
 }
 
+func (msg *Message) Embedding(typ EmbeddingType) Embedding {
+	switch typ {
+	case EmbeddingTypeAda002:
+		return msg.EmbeddingAda002
+	case EmbeddingTypeHash:
+		return msg.EmbeddingHash
+	default:
+		panic(fmt.Errorf("invalid EmbeddingType %d", typ))
+	}
+}
+
+func (msg *Message) SetEmbedding(typ EmbeddingType, emb Embedding) {
+	switch typ {
+	case EmbeddingTypeAda002:
+		msg.EmbeddingAda002 = emb
+	case EmbeddingTypeHash:
+		msg.EmbeddingHash = emb
+	default:
+		panic(fmt.Errorf("invalid EmbeddingType %d", typ))
+	}
+}
+
 func (msg *Message) Voted() bool {
 	return msg.VotedUp || msg.VotedDown
 }
@@ -41,6 +72,7 @@ func (msg *Message) HTMLElementID() string {
 type MessageVM struct {
 	*Message
 	ChatID      ChatID
+	ShowStats   bool
 	IsVotedUp   bool
 	IsVotedDown bool
 }
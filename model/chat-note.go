@@ -0,0 +1,63 @@
+package m
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+)
+
+type ChatNoteID = flake.ID
+
+// ChatNote is a staff-only note on a chat (or on a specific message of it).
+// Notes are stored separately from ChatContent, so they never reach the user's
+// view or the LLM history.
+type ChatNote struct {
+	ID           ChatNoteID `msgpack:"-"`
+	AccountID    AccountID  `msgpack:"a"`
+	ChatID       ChatID     `msgpack:"c"`
+	MessageID    MessageID  `msgpack:"m,omitempty"`
+	AuthorID     UserID     `msgpack:"u"`
+	AuthorName   string     `msgpack:"un"`
+	Time         time.Time  `msgpack:"@"`
+	Text         string     `msgpack:"t"`
+	MentionedIDs []UserID   `msgpack:"mu,omitempty"`
+}
+
+type ChatNoteVM struct {
+	*ChatNote
+	MessageExcerpt string
+}
+
+var mentionRe = regexp.MustCompile(`@([\pL\pN._-]+)`)
+
+// FindMentions returns the users among candidates that are @mentioned in text,
+// either by the local part of their email or by their first name (case-insensitive).
+func FindMentions(text string, candidates []*User) []*User {
+	var result []*User
+	seen := make(map[UserID]bool)
+	for _, match := range mentionRe.FindAllStringSubmatch(text, -1) {
+		handle := strings.ToLower(strings.TrimRight(match[1], "._-"))
+		for _, u := range candidates {
+			if seen[u.ID] {
+				continue
+			}
+			local, _, _ := strings.Cut(u.EmailNorm, "@")
+			if handle == strings.ToLower(local) || handle == strings.ToLower(u.FirstName()) {
+				seen[u.ID] = true
+				result = append(result, u)
+			}
+		}
+	}
+	return result
+}
+
+// Excerpt returns the beginning of text, up to n runes.
+func Excerpt(text string, n int) string {
+	r := []rune(strings.TrimSpace(text))
+	if len(r) <= n {
+		return string(r)
+	}
+	return strings.TrimSpace(string(r[:n])) + "…"
+}
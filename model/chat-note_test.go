@@ -0,0 +1,36 @@
+package m
+
+import "testing"
+
+func TestFindMentions(t *testing.T) {
+	alice := &User{ID: 1, Name: "Alice Smith", EmailNorm: "alice.s@example.com"}
+	bob := &User{ID: 2, Name: "Bob Jones", EmailNorm: "bjones@example.com"}
+	staff := []*User{alice, bob}
+
+	tests := []struct {
+		text     string
+		expected []UserID
+	}{
+		{"no mentions here", nil},
+		{"@alice please check", []UserID{1}},
+		{"cc @bjones, @Alice.", []UserID{2, 1}},
+		{"@alice.s and @alice again", []UserID{1}},
+		{"email me at x@example.com", nil},
+	}
+	for _, tt := range tests {
+		var actual []UserID
+		for _, u := range FindMentions(tt.text, staff) {
+			actual = append(actual, u.ID)
+		}
+		if len(actual) != len(tt.expected) {
+			t.Errorf("FindMentions(%q) = %v, wanted %v", tt.text, actual, tt.expected)
+			continue
+		}
+		for i := range actual {
+			if actual[i] != tt.expected[i] {
+				t.Errorf("FindMentions(%q) = %v, wanted %v", tt.text, actual, tt.expected)
+				break
+			}
+		}
+	}
+}
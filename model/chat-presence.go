@@ -0,0 +1,25 @@
+package m
+
+import "time"
+
+const (
+	TypingPresenceElementID   = "chat-presence-typing"
+	ThinkingPresenceElementID = "chat-presence-thinking"
+)
+
+// PresenceVM is a transient status line shown under the chat ("typing...",
+// "thinking..."). An empty Text clears it. If Until is set, the browser hides
+// the line after that time, so stale presence doesn't linger after the last
+// event, even when replayed to a reconnecting tab.
+type PresenceVM struct {
+	ElementID string
+	Text      string
+	Until     time.Time
+}
+
+func (p *PresenceVM) UntilUnixMilli() int64 {
+	if p.Until.IsZero() {
+		return 0
+	}
+	return p.Until.UnixMilli()
+}
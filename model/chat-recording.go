@@ -0,0 +1,243 @@
+package m
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/openai"
+)
+
+type AnswerRecordingID = flake.ID
+
+// AnswerRecording captures everything that went into producing a bot answer,
+// so that the answer can be reproduced later with a different prompt or model.
+type AnswerRecording struct {
+	ID                AnswerRecordingID `msgpack:"-"`
+	AccountID         AccountID         `msgpack:"a"`
+	ChatID            ChatID            `msgpack:"c"`
+	MessageID         MessageID         `msgpack:"m"`
+	Time              time.Time         `msgpack:"@"`
+	Model             string            `msgpack:"mdl"`
+	Temperature       float64           `msgpack:"temp"`
+	MaxTokens         int               `msgpack:"maxt"`
+	PromptTemplate    string            `msgpack:"pt"`
+	SystemPrompt      string            `msgpack:"sp"`
+	ContextContentIDs []ContentID       `msgpack:"cc,omitempty"`
+	History           []*RecordedMsg    `msgpack:"h"`
+	Answer            string            `msgpack:"ans"`
+	Failed            bool              `msgpack:"f,omitempty"`
+	PromptTokens      int               `msgpack:"ptok"`
+	CompletionTokens  int               `msgpack:"ctok"`
+	Cost              openai.Price      `msgpack:"$"`
+}
+
+// RecordedMsg is a turn of the conversation history sent to the model,
+// excluding the system prompt.
+type RecordedMsg struct {
+	Role MessageRole `msgpack:"r"`
+	Text string      `msgpack:"t"`
+}
+
+func (rec *AnswerRecording) LastUserText() string {
+	for i := len(rec.History) - 1; i >= 0; i-- {
+		if rec.History[i].Role == MessageRoleUser {
+			return rec.History[i].Text
+		}
+	}
+	return ""
+}
+
+// ChatHistory returns the messages to send to the model, using the given system prompt.
+func (rec *AnswerRecording) ChatHistory(systemPrompt string) []openai.Msg {
+	history := make([]openai.Msg, 0, len(rec.History)+1)
+	history = append(history, openai.SystemMsg(systemPrompt))
+	for _, msg := range rec.History {
+		history = append(history, openai.Msg{
+			Role:    msg.Role.OpenAIRole(),
+			Content: msg.Text,
+		})
+	}
+	return history
+}
+
+// ParseAnswerRecordingIDs parses a list of recording IDs separated by spaces,
+// commas or newlines.
+func ParseAnswerRecordingIDs(s string) ([]AnswerRecordingID, error) {
+	var ids []AnswerRecordingID
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid recording ID %q", field)
+		}
+		ids = append(ids, AnswerRecordingID(n))
+	}
+	return ids, nil
+}
+
+const replayFilterDateLayout = "2006-01-02"
+
+// ReplayFilter narrows down the recorded answers picked for a replay run.
+type ReplayFilter struct {
+	ChatID ChatID    // zero for any chat
+	Since  time.Time // zero for no lower bound
+	Until  time.Time // exclusive; zero for no upper bound
+}
+
+// ParseReplayFilter parses the filter form fields, all optional: a chat ID
+// and an inclusive range of YYYY-MM-DD dates.
+func ParseReplayFilter(chat, since, until string) (ReplayFilter, error) {
+	var f ReplayFilter
+	if chat = strings.TrimSpace(chat); chat != "" {
+		n, err := strconv.ParseUint(chat, 10, 64)
+		if err != nil || n == 0 {
+			return f, fmt.Errorf("invalid chat ID %q", chat)
+		}
+		f.ChatID = ChatID(n)
+	}
+	if since = strings.TrimSpace(since); since != "" {
+		t, err := time.Parse(replayFilterDateLayout, since)
+		if err != nil {
+			return f, fmt.Errorf("invalid date %q", since)
+		}
+		f.Since = t
+	}
+	if until = strings.TrimSpace(until); until != "" {
+		t, err := time.Parse(replayFilterDateLayout, until)
+		if err != nil {
+			return f, fmt.Errorf("invalid date %q", until)
+		}
+		f.Until = t.AddDate(0, 0, 1)
+	}
+	return f, nil
+}
+
+func (f ReplayFilter) Matches(rec *AnswerRecording) bool {
+	if f.ChatID != 0 && rec.ChatID != f.ChatID {
+		return false
+	}
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !rec.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+type ReplayRunID = flake.ID
+
+type ReplayRunState int
+
+const (
+	ReplayRunStatePending  = ReplayRunState(0)
+	ReplayRunStateRunning  = ReplayRunState(1)
+	ReplayRunStateFinished = ReplayRunState(2)
+)
+
+var _replayRunStateStrings = []string{
+	"pending",
+	"running",
+	"finished",
+}
+
+func (v ReplayRunState) String() string {
+	return _replayRunStateStrings[v]
+}
+
+// ReplayRun re-runs a set of recorded answers against a new prompt template
+// and/or model, to compare old and new answers before rolling out a change.
+type ReplayRun struct {
+	ID             ReplayRunID     `msgpack:"-"`
+	AccountID      AccountID       `msgpack:"a"`
+	Name           string          `msgpack:"n"`
+	CreationTime   time.Time       `msgpack:"@"`
+	CreatorID      UserID          `msgpack:"u"`
+	Model          string          `msgpack:"mdl,omitempty"`
+	PromptTemplate string          `msgpack:"pt,omitempty"`
+	State          ReplayRunState  `msgpack:"s"`
+	Results        []*ReplayResult `msgpack:"r"`
+}
+
+type ReplayResult struct {
+	RecordingID      AnswerRecordingID `msgpack:"rec"`
+	Done             bool              `msgpack:"d,omitempty"`
+	Answer           string            `msgpack:"ans,omitempty"`
+	Error            string            `msgpack:"err,omitempty"`
+	PromptTokens     int               `msgpack:"ptok"`
+	CompletionTokens int               `msgpack:"ctok"`
+	Cost             openai.Price      `msgpack:"$"`
+}
+
+func (run *ReplayRun) SemanticPath() string {
+	return fmt.Sprintf("mod/replays/%v", run.ID)
+}
+
+func (run *ReplayRun) DoneCount() int {
+	var n int
+	for _, r := range run.Results {
+		if r.Done {
+			n++
+		}
+	}
+	return n
+}
+
+type ReplayComparisonVM struct {
+	Recording *AnswerRecording
+	Result    *ReplayResult
+}
+
+// IsComplete returns whether the replay has produced an answer to compare.
+// Pending and failed replays are left out of the run's totals.
+func (vm *ReplayComparisonVM) IsComplete() bool {
+	return vm.Result.Done && vm.Result.Error == ""
+}
+
+func (vm *ReplayComparisonVM) TokenDelta() int {
+	return (vm.Result.PromptTokens + vm.Result.CompletionTokens) - (vm.Recording.PromptTokens + vm.Recording.CompletionTokens)
+}
+
+func (vm *ReplayComparisonVM) CostDelta() openai.Price {
+	return vm.Result.Cost - vm.Recording.Cost
+}
+
+type ReplayRunVM struct {
+	*ReplayRun
+	Comparisons []*ReplayComparisonVM
+}
+
+// TotalOldCost, TotalNewCost and TotalTokenDelta sum the completed
+// comparisons only, so that both sides cover the same questions.
+func (vm *ReplayRunVM) TotalOldCost() openai.Price {
+	var sum openai.Price
+	for _, c := range vm.Comparisons {
+		if c.IsComplete() {
+			sum += c.Recording.Cost
+		}
+	}
+	return sum
+}
+
+func (vm *ReplayRunVM) TotalNewCost() openai.Price {
+	var sum openai.Price
+	for _, c := range vm.Comparisons {
+		if c.IsComplete() {
+			sum += c.Result.Cost
+		}
+	}
+	return sum
+}
+
+func (vm *ReplayRunVM) TotalTokenDelta() int {
+	var sum int
+	for _, c := range vm.Comparisons {
+		if c.IsComplete() {
+			sum += c.TokenDelta()
+		}
+	}
+	return sum
+}
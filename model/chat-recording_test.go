@@ -0,0 +1,84 @@
+package m
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andreyvit/openai"
+)
+
+func TestReplayRunTotals(t *testing.T) {
+	comparison := func(oldCost, newCost openai.Price, oldTokens, newTokens int, result ReplayResult) *ReplayComparisonVM {
+		result.Cost = newCost
+		result.PromptTokens = newTokens
+		return &ReplayComparisonVM{
+			Recording: &AnswerRecording{Cost: oldCost, PromptTokens: oldTokens},
+			Result:    &result,
+		}
+	}
+	vm := &ReplayRunVM{Comparisons: []*ReplayComparisonVM{
+		comparison(10, 15, 100, 150, ReplayResult{Done: true}),
+		comparison(20, 5, 200, 50, ReplayResult{Done: true, Error: "rate limited"}),
+		comparison(30, 0, 300, 0, ReplayResult{}),
+		comparison(40, 30, 400, 300, ReplayResult{Done: true}),
+	}}
+
+	if a, e := vm.TotalOldCost(), openai.Price(50); a != e {
+		t.Errorf("TotalOldCost = %v, wanted %v", a, e)
+	}
+	if a, e := vm.TotalNewCost(), openai.Price(45); a != e {
+		t.Errorf("TotalNewCost = %v, wanted %v", a, e)
+	}
+	if a, e := vm.TotalTokenDelta(), -50; a != e {
+		t.Errorf("TotalTokenDelta = %v, wanted %v", a, e)
+	}
+}
+
+func TestParseAnswerRecordingIDs(t *testing.T) {
+	ids, err := ParseAnswerRecordingIDs("12, 34\n56 ")
+	if err != nil {
+		t.Fatalf("ParseAnswerRecordingIDs failed: %v", err)
+	}
+	if e := []AnswerRecordingID{12, 34, 56}; !reflect.DeepEqual(ids, e) {
+		t.Errorf("ParseAnswerRecordingIDs = %v, wanted %v", ids, e)
+	}
+	if _, err := ParseAnswerRecordingIDs("12 abc"); err == nil {
+		t.Errorf("ParseAnswerRecordingIDs(12 abc) succeeded, wanted an error")
+	}
+}
+
+func TestReplayFilter(t *testing.T) {
+	f, err := ParseReplayFilter("7", "2024-03-01", "2024-03-02")
+	if err != nil {
+		t.Fatalf("ParseReplayFilter failed: %v", err)
+	}
+	day := func(d, h int) time.Time {
+		return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		chatID   ChatID
+		time     time.Time
+		expected bool
+	}{
+		{7, day(1, 0), true},
+		{7, day(2, 23), true},
+		{7, day(3, 0), false},
+		{7, day(29, 12).AddDate(0, -1, 0), false},
+		{8, day(1, 12), false},
+	}
+	for _, tt := range tests {
+		rec := &AnswerRecording{ChatID: tt.chatID, Time: tt.time}
+		if actual := f.Matches(rec); actual != tt.expected {
+			t.Errorf("Matches(chat %v at %v) = %v, wanted %v", uint64(tt.chatID), tt.time, actual, tt.expected)
+		}
+	}
+
+	var empty ReplayFilter
+	if !empty.Matches(&AnswerRecording{ChatID: 8, Time: day(1, 12)}) {
+		t.Errorf("empty filter rejects a recording")
+	}
+	if _, err := ParseReplayFilter("", "March 1", ""); err == nil {
+		t.Errorf("ParseReplayFilter(March 1) succeeded, wanted an error")
+	}
+}
@@ -0,0 +1,65 @@
+package m
+
+import "github.com/andreyvit/openai"
+
+// ChatSummary is a rolling LLM-generated summary of the earliest turns of a chat,
+// which replaces those turns in the history sent to the model once the chat
+// outgrows the history token budget.
+type ChatSummary struct {
+	Text         string       `msgpack:"t"`
+	CoveredTurns int          `msgpack:"n"`
+	TokenCount   int          `msgpack:"tc"`
+	Updates      int          `msgpack:"u"`
+	Cost         openai.Price `msgpack:"c"`
+}
+
+func (sum *ChatSummary) CoveredTurnsOrZero() int {
+	if sum == nil {
+		return 0
+	}
+	return sum.CoveredTurns
+}
+
+// PromptStats records the token accounting of the request that produced a bot message.
+type PromptStats struct {
+	SystemTokens    int `msgpack:"s"`
+	SummaryTokens   int `msgpack:"su"`
+	HistoryTokens   int `msgpack:"h"`
+	TotalTokens     int `msgpack:"t"`
+	VerbatimTurns   int `msgpack:"vt"`
+	SummarizedTurns int `msgpack:"st"`
+	DroppedTurns    int `msgpack:"dt,omitempty"`
+}
+
+// PlanHistory decides which turns are sent to the model verbatim.
+// turnTokens[i] is the token count of turn i; the first summarized turns are
+// already covered by the rolling summary. Returns the index of the first turn
+// to send verbatim. If the result is greater than summarized, the summary must
+// be extended to cover the turns in between.
+//
+// As long as the unsummarized turns fit into budget, nothing changes. Once they
+// don't, we cut down to lowWatermark rather than to budget, so that the summary
+// is updated every few turns instead of on every answer. The last turn is always
+// kept verbatim.
+func PlanHistory(turnTokens []int, summarized int, budget, lowWatermark int) int {
+	n := len(turnTokens)
+	var total int
+	for i := summarized; i < n; i++ {
+		total += turnTokens[i]
+	}
+	if total <= budget {
+		return summarized
+	}
+
+	start := n
+	total = 0
+	for start > summarized {
+		t := turnTokens[start-1]
+		if start < n && total+t > lowWatermark {
+			break
+		}
+		total += t
+		start--
+	}
+	return start
+}
@@ -0,0 +1,25 @@
+package m
+
+import "testing"
+
+func TestPlanHistory(t *testing.T) {
+	tests := []struct {
+		tokens     []int
+		summarized int
+		expected   int
+	}{
+		{[]int{100, 100, 100}, 0, 0},                // fits
+		{[]int{100, 100, 100}, 1, 1},                // fits after summary
+		{[]int{400, 400, 400, 400}, 0, 3},           // cut down to low watermark
+		{[]int{400, 400, 400, 400}, 3, 3},           // fits after summary
+		{[]int{900, 900}, 0, 1},                     // last turn is always kept
+		{[]int{100, 900, 100, 100, 100}, 0, 2},      // stops at the first turn that doesn't fit
+		{[]int{500, 500, 500, 200, 200, 200}, 1, 3}, // never goes below summarized
+	}
+	for _, tt := range tests {
+		actual := PlanHistory(tt.tokens, tt.summarized, 1000, 600)
+		if actual != tt.expected {
+			t.Errorf("PlanHistory(%v, %d) = %d, wanted %d", tt.tokens, tt.summarized, actual, tt.expected)
+		}
+	}
+}
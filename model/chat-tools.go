@@ -0,0 +1,245 @@
+package m
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/andreyvit/openai"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/exp/slices"
+)
+
+// ToolCall records a tool invoked by the bot while producing an answer.
+type ToolCall struct {
+	Tool      string `msgpack:"n"`
+	Arguments string `msgpack:"a"` // JSON
+	Result    string `msgpack:"r"`
+	Failed    bool   `msgpack:"f,omitempty"`
+}
+
+// Transcript is how the call is shown to the model in later prompts.
+func (tc *ToolCall) Transcript() string {
+	if tc.Failed {
+		return fmt.Sprintf("Tool %s %s failed: %s", tc.Tool, tc.Arguments, tc.Result)
+	}
+	return fmt.Sprintf("Tool %s %s returned:\n%s", tc.Tool, tc.Arguments, tc.Result)
+}
+
+// ToolChoice asks the model which tool to call next; see RunToolCalls.
+type ToolChoice struct {
+	Provider     Provider
+	Model        string
+	MaxTokens    int
+	SystemPrompt string          // describes the available tools
+	Function     json.RawMessage // schema of the choice function, taking "tool" and its arguments
+	FunctionName string
+	AnswerTool   string       // the "tool" meaning the model is ready to answer
+	Transcript   string       // the conversation so far
+	Cost         openai.Price // spent on the choices made so far
+}
+
+// NextCall asks the model which tool to call given the calls made so far.
+// A nil call means the model is ready to answer.
+func (tc *ToolChoice) NextCall(ctx context.Context, calls []*ToolCall) (*ToolCall, error) {
+	var buf strings.Builder
+	buf.WriteString(tc.Transcript)
+	for _, call := range calls {
+		fmt.Fprintf(&buf, "%s\n\n", call.Transcript())
+	}
+	resp, err := tc.Provider.Chat(ctx, &ChatRequest{
+		Model:     tc.Model,
+		MaxTokens: tc.MaxTokens,
+		Messages: []openai.Msg{
+			openai.SystemMsg(tc.SystemPrompt),
+			{Role: openai.User, Content: buf.String()},
+		},
+		Function:     tc.Function,
+		FunctionName: tc.FunctionName,
+	})
+	if resp != nil {
+		tc.Cost += resp.Cost
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var args map[string]json.RawMessage
+	err = json.Unmarshal(resp.FunctionArgs, &args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tool choice: %w", err)
+	}
+	var tool string
+	if raw := args["tool"]; raw != nil {
+		err = json.Unmarshal(raw, &tool)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tool choice: %w", err)
+		}
+	}
+	if tool == "" || tool == tc.AnswerTool {
+		return nil, nil
+	}
+	delete(args, "tool")
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolCall{Tool: tool, Arguments: string(argsJSON)}, nil
+}
+
+// ToolRunner carries out the tool calls chosen by the model; see RunToolCalls.
+type ToolRunner interface {
+	// Allows returns whether the tool may be called in this chat.
+	Allows(tool string) bool
+	// Run executes an allowed call and returns its result.
+	Run(call *ToolCall) (string, error)
+}
+
+// RunToolCalls lets the model call tools until it decides to answer, repeats
+// a call or makes maxCalls calls. Failed and refused calls are recorded, so
+// the model sees them. Returns the calls made so far even on error.
+func RunToolCalls(ctx context.Context, choice *ToolChoice, runner ToolRunner, maxCalls int) ([]*ToolCall, error) {
+	var calls []*ToolCall
+	for len(calls) < maxCalls {
+		call, err := choice.NextCall(ctx, calls)
+		if err != nil {
+			return calls, err
+		}
+		if call == nil || isRepeatedToolCall(calls, call) {
+			break
+		}
+		if !runner.Allows(call.Tool) {
+			call.Result, call.Failed = "no such tool", true
+		} else if result, err := runner.Run(call); err != nil {
+			call.Result, call.Failed = err.Error(), true
+		} else {
+			call.Result = result
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+func isRepeatedToolCall(calls []*ToolCall, call *ToolCall) bool {
+	for _, c := range calls {
+		if c.Tool == call.Tool && c.Arguments == call.Arguments {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolTurnsStart returns the index of the first of the tool turns that
+// immediately precede the turn at the given index (or the index itself if
+// there are none).
+func (cc *ChatContent) ToolTurnsStart(at int) int {
+	start := at
+	for start > 0 && cc.Turns[start-1].Role == MessageRoleTool {
+		start--
+	}
+	return start
+}
+
+// ReplaceToolTurns replaces the tool turns that immediately precede the turn
+// at the given index with turns, e.g. when an answer is regenerated.
+func (cc *ChatContent) ReplaceToolTurns(at int, turns ...*Turn) {
+	start := cc.ToolTurnsStart(at)
+	cc.Turns = slices.Delete(cc.Turns, start, at)
+	cc.InsertTurns(start, turns...)
+}
+
+// InsertTurns inserts turns before the turn at the given index, renumbering
+// the turns and messages that follow.
+func (cc *ChatContent) InsertTurns(at int, turns ...*Turn) {
+	cc.Turns = slices.Insert(cc.Turns, at, turns...)
+	for i := at; i < len(cc.Turns); i++ {
+		t := cc.Turns[i]
+		t.Index = i
+		for _, msg := range t.Versions {
+			msg.TurnIndex = i
+		}
+	}
+}
+
+// ToolAccess determines who can have the bot call a particular tool.
+type ToolAccess int
+
+const (
+	ToolAccessOff      = ToolAccess(0)
+	ToolAccessStaff    = ToolAccess(1) // only in chats started by admins and coaches
+	ToolAccessEveryone = ToolAccess(2)
+)
+
+var _toolAccessStrings = []string{
+	"off",
+	"staff",
+	"everyone",
+}
+
+func (v ToolAccess) String() string {
+	return _toolAccessStrings[v]
+}
+
+func ParseToolAccess(s string) (ToolAccess, error) {
+	if i := slices.Index(_toolAccessStrings, strings.TrimSpace(s)); i >= 0 {
+		return ToolAccess(i), nil
+	} else {
+		return ToolAccessOff, fmt.Errorf("invalid ToolAccess %q", s)
+	}
+}
+
+func (v ToolAccess) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+func (v *ToolAccess) UnmarshalText(b []byte) error {
+	var err error
+	*v, err = ParseToolAccess(string(b))
+	return err
+}
+func (v ToolAccess) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeUint(uint64(v))
+}
+func (v *ToolAccess) DecodeMsgpack(dec *msgpack.Decoder) error {
+	n, err := dec.DecodeUint()
+	*v = ToolAccess(n)
+	return err
+}
+
+// ToolPermissions maps tool names to their access level in an account.
+// Tools not mentioned are off.
+type ToolPermissions map[string]ToolAccess
+
+// Allows returns whether the tool can be called in a chat whose author does
+// (isStaff) or does not have backoffice access.
+func (p ToolPermissions) Allows(tool string, isStaff bool) bool {
+	switch p[tool] {
+	case ToolAccessEveryone:
+		return true
+	case ToolAccessStaff:
+		return isStaff
+	default:
+		return false
+	}
+}
+
+func (p ToolPermissions) Any() bool {
+	for _, access := range p {
+		if access != ToolAccessOff {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterItems returns the embeddings that belong to the items accepted by keep.
+func (embs *AccountEmbeddings) FilterItems(keep func(ItemID) bool) *AccountEmbeddings {
+	result := &AccountEmbeddings{Type: embs.Type}
+	for _, e := range embs.Embeddings {
+		if keep(e.ItemID) {
+			result.Embeddings = append(result.Embeddings, e)
+		}
+	}
+	return result
+}
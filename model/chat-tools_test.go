@@ -0,0 +1,299 @@
+package m
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/andreyvit/openai"
+	"golang.org/x/exp/slices"
+)
+
+func TestInsertTurns(t *testing.T) {
+	turn := func(id TurnID, role MessageRole, index int) *Turn {
+		return &Turn{ID: id, Index: index, Role: role, Versions: []*Message{{ID: id * 10, Role: role, TurnID: id, TurnIndex: index}}}
+	}
+	cc := &ChatContent{Turns: []*Turn{
+		turn(1, MessageRoleUser, 0),
+		turn(2, MessageRoleBot, 1),
+	}}
+	cc.InsertTurns(1, turn(3, MessageRoleTool, 0), turn(4, MessageRoleTool, 0))
+
+	expected := []TurnID{1, 3, 4, 2}
+	if len(cc.Turns) != len(expected) {
+		t.Fatalf("len(Turns) = %d, wanted %d", len(cc.Turns), len(expected))
+	}
+	for i, id := range expected {
+		tt := cc.Turns[i]
+		if tt.ID != id || tt.Index != i || tt.LastMessage().TurnIndex != i {
+			t.Errorf("Turns[%d] = %v (index %d, message index %d), wanted %v", i, tt.ID, tt.Index, tt.LastMessage().TurnIndex, id)
+		}
+	}
+	if msg := cc.FreshMessage(&Message{ID: 20, TurnIndex: 3}); msg == nil {
+		t.Errorf("FreshMessage can't find the moved bot message")
+	}
+}
+
+func TestReplaceToolTurns(t *testing.T) {
+	turn := func(id TurnID, role MessageRole) *Turn {
+		return &Turn{ID: id, Role: role, Versions: []*Message{{ID: id * 10, Role: role, TurnID: id}}}
+	}
+	cc := &ChatContent{}
+	cc.InsertTurns(0, turn(1, MessageRoleUser), turn(2, MessageRoleTool), turn(3, MessageRoleTool), turn(4, MessageRoleBot))
+	if a, e := cc.ToolTurnsStart(3), 1; a != e {
+		t.Errorf("ToolTurnsStart(3) = %d, wanted %d", a, e)
+	}
+
+	// regenerating the answer replaces the tool calls of the previous version
+	cc.ReplaceToolTurns(3, turn(5, MessageRoleTool))
+	expected := []TurnID{1, 5, 4}
+	if len(cc.Turns) != len(expected) {
+		t.Fatalf("len(Turns) = %d, wanted %d", len(cc.Turns), len(expected))
+	}
+	for i, id := range expected {
+		tt := cc.Turns[i]
+		if tt.ID != id || tt.Index != i || tt.LastMessage().TurnIndex != i {
+			t.Errorf("Turns[%d] = %v (index %d, message index %d), wanted %v", i, tt.ID, tt.Index, tt.LastMessage().TurnIndex, id)
+		}
+	}
+
+	// and an answer without tool calls drops them
+	cc.ReplaceToolTurns(2)
+	if len(cc.Turns) != 2 || cc.Turns[1].ID != 4 || cc.Turns[1].Index != 1 {
+		t.Errorf("ReplaceToolTurns(2) left %d turns, wanted the user and bot turns", len(cc.Turns))
+	}
+}
+
+func TestToolPermissions(t *testing.T) {
+	perms := ToolPermissions{
+		"search_library":  ToolAccessEveryone,
+		"create_reminder": ToolAccessStaff,
+		"item_link":       ToolAccessOff,
+	}
+	tests := []struct {
+		tool     string
+		isStaff  bool
+		expected bool
+	}{
+		{"search_library", false, true},
+		{"search_library", true, true},
+		{"create_reminder", false, false},
+		{"create_reminder", true, true},
+		{"item_link", true, false},
+		{"unknown", true, false},
+	}
+	for _, tt := range tests {
+		if actual := perms.Allows(tt.tool, tt.isStaff); actual != tt.expected {
+			t.Errorf("Allows(%q, %v) = %v, wanted %v", tt.tool, tt.isStaff, actual, tt.expected)
+		}
+	}
+	if (ToolPermissions{"item_link": ToolAccessOff}).Any() {
+		t.Errorf("Any() = true for all tools off")
+	}
+}
+
+// fakeToolRunner runs any allowed tool, failing the calls listed in fail.
+type fakeToolRunner struct {
+	perms   ToolPermissions
+	isStaff bool
+	fail    map[string]string
+	ran     []string
+}
+
+func (r *fakeToolRunner) Allows(tool string) bool {
+	return r.perms.Allows(tool, r.isStaff)
+}
+
+func (r *fakeToolRunner) Run(call *ToolCall) (string, error) {
+	r.ran = append(r.ran, call.Tool+call.Arguments)
+	if msg := r.fail[call.Arguments]; msg != "" {
+		return "", errors.New(msg)
+	}
+	return "result of " + call.Arguments, nil
+}
+
+// fakeToolChoice returns a ToolChoice whose model picks the given
+// "tool" function arguments in order, and then answers.
+func fakeToolChoice(choices ...string) (*ToolChoice, *FakeProvider) {
+	p := &FakeProvider{}
+	for _, c := range choices {
+		p.ChatResponses = append(p.ChatResponses, &ChatResponse{FunctionArgs: json.RawMessage(c), Cost: 1})
+	}
+	return &ToolChoice{
+		Provider:     p,
+		Function:     json.RawMessage(`{}`),
+		FunctionName: "next_step",
+		AnswerTool:   "answer",
+		Transcript:   "User: hi\n\n",
+	}, p
+}
+
+func TestRunToolCalls(t *testing.T) {
+	perms := ToolPermissions{
+		"search_library":  ToolAccessEveryone,
+		"create_reminder": ToolAccessStaff,
+	}
+	search := func(q string) string {
+		return `{"tool": "search_library", "query": "` + q + `"}`
+	}
+	reminder := `{"tool": "create_reminder", "text": "x", "days": 1}`
+	describe := func(calls []*ToolCall) []string {
+		var result []string
+		for _, c := range calls {
+			s := c.Tool + c.Arguments + "=" + c.Result
+			if c.Failed {
+				s += "!"
+			}
+			result = append(result, s)
+		}
+		return result
+	}
+	tests := []struct {
+		name     string
+		choices  []string
+		isStaff  bool
+		fail     map[string]string
+		expected []string
+		ran      int
+	}{
+		{
+			name:     "answers right away",
+			choices:  []string{`{"tool": "answer"}`},
+			expected: nil,
+		},
+		{
+			name:    "stops at the cap",
+			choices: []string{search("a"), search("b"), search("c"), search("d")},
+			expected: []string{
+				`search_library{"query":"a"}=result of {"query":"a"}`,
+				`search_library{"query":"b"}=result of {"query":"b"}`,
+				`search_library{"query":"c"}=result of {"query":"c"}`,
+			},
+			ran: 3,
+		},
+		{
+			name:     "stops on a repeated call",
+			choices:  []string{search("a"), search("a"), search("b")},
+			expected: []string{`search_library{"query":"a"}=result of {"query":"a"}`},
+			ran:      1,
+		},
+		{
+			name:    "records a failed call",
+			choices: []string{search("a"), search("b"), `{"tool": "answer"}`},
+			fail:    map[string]string{`{"query":"a"}`: "index unavailable"},
+			expected: []string{
+				`search_library{"query":"a"}=index unavailable!`,
+				`search_library{"query":"b"}=result of {"query":"b"}`,
+			},
+			ran: 2,
+		},
+		{
+			name:    "refuses a staff tool to a non-staff author",
+			choices: []string{reminder, search("a"), `{"tool": "answer"}`},
+			expected: []string{
+				`create_reminder{"days":1,"text":"x"}=no such tool!`,
+				`search_library{"query":"a"}=result of {"query":"a"}`,
+			},
+			ran: 1,
+		},
+		{
+			name:     "lets staff call a staff tool",
+			choices:  []string{reminder, `{"tool": "answer"}`},
+			isStaff:  true,
+			expected: []string{`create_reminder{"days":1,"text":"x"}=result of {"days":1,"text":"x"}`},
+			ran:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			choice, p := fakeToolChoice(tt.choices...)
+			runner := &fakeToolRunner{perms: perms, isStaff: tt.isStaff, fail: tt.fail}
+			calls, err := RunToolCalls(context.Background(), choice, runner, 3)
+			if err != nil {
+				t.Fatalf("RunToolCalls() failed: %v", err)
+			}
+			if a, e := describe(calls), tt.expected; !slices.Equal(a, e) {
+				t.Errorf("RunToolCalls() = %q, wanted %q", a, e)
+			}
+			if len(runner.ran) != tt.ran {
+				t.Errorf("ran %q, wanted %d calls", runner.ran, tt.ran)
+			}
+			if a, e := choice.Cost, openai.Price(len(p.ChatRequests)); a != e {
+				t.Errorf("Cost = %v, wanted %v", a, e)
+			}
+		})
+	}
+}
+
+func TestToolChoiceTranscript(t *testing.T) {
+	choice, p := fakeToolChoice(`{"tool": "search_library", "query": "a"}`)
+	runner := &fakeToolRunner{perms: ToolPermissions{"search_library": ToolAccessEveryone}}
+	_, err := RunToolCalls(context.Background(), choice, runner, 3)
+	if err != nil {
+		t.Fatalf("RunToolCalls() failed: %v", err)
+	}
+	if len(p.ChatRequests) != 2 {
+		t.Fatalf("made %d chat requests, wanted 2", len(p.ChatRequests))
+	}
+	req := p.ChatRequests[1]
+	if req.FunctionName != "next_step" {
+		t.Errorf("FunctionName = %q, wanted next_step", req.FunctionName)
+	}
+	a := req.Messages[len(req.Messages)-1].Content
+	e := "User: hi\n\nTool search_library {\"query\":\"a\"} returned:\nresult of {\"query\":\"a\"}\n\n"
+	if a != e {
+		t.Errorf("second choice transcript = %q, wanted %q", a, e)
+	}
+}
+
+func TestRunToolCallsError(t *testing.T) {
+	choice, p := fakeToolChoice(`{"tool": "search_library", "query": "a"}`)
+	p.ChatErr = errors.New("completion failed")
+	runner := &fakeToolRunner{perms: ToolPermissions{"search_library": ToolAccessEveryone}}
+	calls, err := RunToolCalls(context.Background(), choice, runner, 3)
+	if err == nil || len(calls) != 1 {
+		t.Errorf("RunToolCalls() = %d calls, %v, wanted 1 call and an error", len(calls), err)
+	}
+}
+
+func TestSearchWithinFolder(t *testing.T) {
+	lib := NewAccountLibrary(3)
+	lib.AddFolder(&Folder{ID: 1, Name: "Library", ChildenIDs: []FolderID{2, 3}})
+	lib.AddFolder(&Folder{ID: 2, Name: "Planning", Slug: "planning", ParentID: 1, ChildenIDs: []FolderID{4}})
+	lib.AddFolder(&Folder{ID: 3, Name: "Health", Slug: "health", ParentID: 1})
+	lib.AddFolder(&Folder{ID: 4, Name: "Weekly Review", Slug: "weekly-review", ParentID: 2})
+
+	fldr := lib.FindFolder("PLANNING")
+	if fldr == nil || fldr.ID != 2 {
+		t.Fatalf("FindFolder(PLANNING) = %v, wanted folder 2", fldr)
+	}
+	subtree := lib.Subtree(fldr.ID)
+	if len(subtree) != 2 || !subtree[2] || !subtree[4] {
+		t.Fatalf("Subtree(2) = %v, wanted 2 and 4", subtree)
+	}
+
+	itemFolders := map[ItemID]FolderID{100: 2, 200: 3, 300: 4}
+	entry := func(id ContentID, item ItemID, text string) *ContentEmbedding {
+		return &ContentEmbedding{
+			ContentEmbeddingKey: ContentEmbeddingKey{ContentID: id, Type: EmbeddingTypeHash},
+			ItemID:              item,
+			Embedding:           HashEmbedding(text),
+		}
+	}
+	embs := &AccountEmbeddings{
+		Type: EmbeddingTypeHash,
+		Embeddings: []*ContentEmbedding{
+			entry(1, 100, "Plan your week on Sunday evening."),
+			entry(2, 200, "Plan your sleep: go to bed at the same time every evening."),
+			entry(3, 300, "Review the past week before planning the next one."),
+		},
+	}
+	filtered := embs.FilterItems(func(id ItemID) bool {
+		return subtree[itemFolders[id]]
+	})
+	actual := contentIDsOf(filtered.Select(HashEmbedding("how to plan my evening"), 5, 1e6).Entries)
+	if len(actual) != 2 || actual[0] == 2 || actual[1] == 2 {
+		t.Errorf("search within Planning = %v, wanted entries 1 and 3", actual)
+	}
+}
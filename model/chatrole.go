@@ -15,6 +15,8 @@ const (
 	MessageRoleUser   = MessageRole(1)
 	MessageRoleBot    = MessageRole(2)
 	MessageRoleSystem = MessageRole(3)
+	MessageRoleStaff  = MessageRole(4) // a coach or admin replying in place of the bot
+	MessageRoleTool   = MessageRole(5) // a tool called by the bot, with its result
 )
 
 func (v MessageRole) IsUser() bool {
@@ -26,13 +28,19 @@ func (v MessageRole) IsBot() bool {
 func (v MessageRole) IsSystem() bool {
 	return v == MessageRoleSystem
 }
+func (v MessageRole) IsStaff() bool {
+	return v == MessageRoleStaff
+}
+func (v MessageRole) IsTool() bool {
+	return v == MessageRoleTool
+}
 func (v MessageRole) OpenAIRole() openai.Role {
 	switch v {
 	case MessageRoleUser:
 		return openai.User
-	case MessageRoleBot:
+	case MessageRoleBot, MessageRoleStaff:
 		return openai.Assistant
-	case MessageRoleSystem:
+	case MessageRoleSystem, MessageRoleTool:
 		return openai.System
 	default:
 		panic(fmt.Errorf("invalid MessageRole %d", v))
@@ -44,6 +52,8 @@ var _messageRoleStrings = []string{
 	"user",
 	"bot",
 	"system",
+	"staff",
+	"tool",
 }
 
 func (v MessageRole) String() string {
@@ -0,0 +1,142 @@
+package m
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/exp/slices"
+)
+
+type CheckInScheduleID = flake.ID
+
+type CheckInKind int
+
+const (
+	CheckInKindNone         = CheckInKind(0)
+	CheckInKindDailyPlan    = CheckInKind(1)
+	CheckInKindWeeklyReview = CheckInKind(2)
+)
+
+var CheckInKinds = []CheckInKind{CheckInKindDailyPlan, CheckInKindWeeklyReview}
+
+var _checkInKindStrings = []string{
+	"none",
+	"daily-plan",
+	"weekly-review",
+}
+
+var _checkInKindTitles = []string{
+	"",
+	"Daily Plan",
+	"Weekly Review",
+}
+
+func (v CheckInKind) String() string {
+	return _checkInKindStrings[v]
+}
+
+func (v CheckInKind) Title() string {
+	return _checkInKindTitles[v]
+}
+
+func (v CheckInKind) IsWeekly() bool {
+	return v == CheckInKindWeeklyReview
+}
+
+func ParseCheckInKind(s string) (CheckInKind, error) {
+	if i := slices.Index(_checkInKindStrings, s); i > 0 {
+		return CheckInKind(i), nil
+	} else {
+		return CheckInKindNone, fmt.Errorf("invalid CheckInKind %q", s)
+	}
+}
+
+func (v CheckInKind) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+func (v *CheckInKind) UnmarshalText(b []byte) error {
+	var err error
+	*v, err = ParseCheckInKind(string(b))
+	return err
+}
+func (v CheckInKind) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeUint(uint64(v))
+}
+func (v *CheckInKind) DecodeMsgpack(dec *msgpack.Decoder) error {
+	n, err := dec.DecodeUint()
+	*v = CheckInKind(n)
+	return err
+}
+
+// CheckInSchedule is a user's agreement to receive a recurring check-in from
+// the bot, posted into a dedicated chat at a given local time.
+type CheckInSchedule struct {
+	ID           CheckInScheduleID `msgpack:"-"`
+	AccountID    AccountID         `msgpack:"a"`
+	UserID       UserID            `msgpack:"u"`
+	Kind         CheckInKind       `msgpack:"k"`
+	ChatID       ChatID            `msgpack:"c,omitempty"` // created on the first check-in
+	LocalTime    int               `msgpack:"lt"`          // minutes since local midnight
+	Weekday      time.Weekday      `msgpack:"wd,omitempty"`
+	TimeZone     string            `msgpack:"tz"`
+	Paused       bool              `msgpack:"p,omitempty"`
+	CreationTime time.Time         `msgpack:"@"`
+	NextRunTime  time.Time         `msgpack:"next"`
+	LastRunTime  time.Time         `msgpack:"last,omitempty"`
+}
+
+func (s *CheckInSchedule) Location() *time.Location {
+	if loc, err := time.LoadLocation(s.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// NextRunAfter returns the first moment strictly after t when the check-in is due.
+func (s *CheckInSchedule) NextRunAfter(t time.Time) time.Time {
+	loc := s.Location()
+	local := t.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i <= 8; i++ {
+		d := day.AddDate(0, 0, i)
+		if s.Kind.IsWeekly() && d.Weekday() != s.Weekday {
+			continue
+		}
+		run := time.Date(d.Year(), d.Month(), d.Day(), s.LocalTime/60, s.LocalTime%60, 0, 0, loc)
+		if run.After(t) {
+			return run
+		}
+	}
+	panic("unreachable")
+}
+
+func (s *CheckInSchedule) IsDue(now time.Time) bool {
+	return !s.Paused && !s.NextRunTime.IsZero() && !now.Before(s.NextRunTime)
+}
+
+func (s *CheckInSchedule) LocalTimeString() string {
+	return FormatLocalTime(s.LocalTime)
+}
+
+// FormatLocalTime formats minutes since midnight as HH:MM.
+func FormatLocalTime(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// ParseLocalTime parses HH:MM into minutes since midnight.
+func ParseLocalTime(s string) (int, error) {
+	hs, ms, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	h, err1 := strconv.Atoi(hs)
+	m, err2 := strconv.Atoi(ms)
+	if err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
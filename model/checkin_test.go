@@ -0,0 +1,57 @@
+package m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckInNextRunAfter(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+	daily := &CheckInSchedule{Kind: CheckInKindDailyPlan, LocalTime: 8 * 60, TimeZone: "America/New_York"}
+	weekly := &CheckInSchedule{Kind: CheckInKindWeeklyReview, LocalTime: 18*60 + 30, Weekday: time.Sunday, TimeZone: "America/New_York"}
+	broken := &CheckInSchedule{Kind: CheckInKindDailyPlan, LocalTime: 9 * 60, TimeZone: "Nowhere/Special"}
+
+	tests := []struct {
+		s        *CheckInSchedule
+		after    time.Time
+		expected time.Time
+	}{
+		{daily, time.Date(2023, 6, 7, 7, 0, 0, 0, ny), time.Date(2023, 6, 7, 8, 0, 0, 0, ny)},
+		{daily, time.Date(2023, 6, 7, 8, 0, 0, 0, ny), time.Date(2023, 6, 8, 8, 0, 0, 0, ny)},
+		{daily, time.Date(2023, 6, 7, 13, 0, 0, 0, time.UTC), time.Date(2023, 6, 8, 8, 0, 0, 0, ny)},
+		{daily, time.Date(2023, 3, 11, 9, 0, 0, 0, ny), time.Date(2023, 3, 12, 8, 0, 0, 0, ny)}, // DST starts
+		{weekly, time.Date(2023, 6, 7, 12, 0, 0, 0, ny), time.Date(2023, 6, 11, 18, 30, 0, 0, ny)},
+		{weekly, time.Date(2023, 6, 11, 18, 30, 0, 0, ny), time.Date(2023, 6, 18, 18, 30, 0, 0, ny)},
+		{broken, time.Date(2023, 6, 7, 10, 0, 0, 0, time.UTC), time.Date(2023, 6, 8, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		actual := tt.s.NextRunAfter(tt.after)
+		if !actual.Equal(tt.expected) {
+			t.Errorf("%v at %v NextRunAfter(%v) = %v, wanted %v", tt.s.Kind, tt.s.LocalTimeString(), tt.after, actual, tt.expected)
+		}
+	}
+}
+
+func TestParseLocalTime(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		ok       bool
+	}{
+		{"08:00", 480, true},
+		{" 7:05 ", 425, true},
+		{"23:59", 1439, true},
+		{"24:00", 0, false},
+		{"8", 0, false},
+		{"ab:cd", 0, false},
+	}
+	for _, tt := range tests {
+		actual, err := ParseLocalTime(tt.input)
+		if (err == nil) != tt.ok || actual != tt.expected {
+			t.Errorf("ParseLocalTime(%q) = %v, %v, wanted %v", tt.input, actual, err, tt.expected)
+		}
+	}
+}
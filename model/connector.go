@@ -0,0 +1,115 @@
+package m
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/exp/slices"
+)
+
+type (
+	ConnectorID         = flake.ID
+	ConnectorIdentityID = flake.ID
+)
+
+type ConnectorKind int
+
+const (
+	ConnectorKindNone     = ConnectorKind(0)
+	ConnectorKindSlack    = ConnectorKind(1)
+	ConnectorKindTelegram = ConnectorKind(2)
+)
+
+var _connectorKindStrings = []string{
+	"none",
+	"slack",
+	"telegram",
+}
+
+var _connectorKindTitles = []string{
+	"",
+	"Slack",
+	"Telegram",
+}
+
+func (v ConnectorKind) String() string {
+	return _connectorKindStrings[v]
+}
+
+func (v ConnectorKind) Title() string {
+	return _connectorKindTitles[v]
+}
+
+func ParseConnectorKind(s string) (ConnectorKind, error) {
+	if i := slices.Index(_connectorKindStrings, strings.ToLower(strings.TrimSpace(s))); i > 0 {
+		return ConnectorKind(i), nil
+	} else {
+		return ConnectorKindNone, fmt.Errorf("invalid ConnectorKind %q", s)
+	}
+}
+
+func (v ConnectorKind) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+func (v *ConnectorKind) UnmarshalText(b []byte) error {
+	var err error
+	*v, err = ParseConnectorKind(string(b))
+	return err
+}
+func (v ConnectorKind) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeUint(uint64(v))
+}
+func (v *ConnectorKind) DecodeMsgpack(dec *msgpack.Decoder) error {
+	n, err := dec.DecodeUint()
+	*v = ConnectorKind(n)
+	return err
+}
+
+// Connector lets an account's members talk to the bot from Slack or Telegram.
+type Connector struct {
+	ID           ConnectorID   `msgpack:"-"`
+	AccountID    AccountID     `msgpack:"a"`
+	Kind         ConnectorKind `msgpack:"k"`
+	Name         string        `msgpack:"n"`
+	Disabled     bool          `msgpack:"d,omitempty"`
+	BotToken     string        `msgpack:"tok"`
+	BotUsername  string        `msgpack:"bu,omitempty"` // Telegram only
+	Secret       string        `msgpack:"sec"`          // Slack signing secret or Telegram webhook secret token
+	APIBaseURL   string        `msgpack:"api,omitempty"`
+	CreationTime time.Time     `msgpack:"@"`
+}
+
+// ConnectorKey scopes a platform conversation or user ID to the connector,
+// for looking up chats (Chat.ExternalThread) and identities.
+func ConnectorKey(connectorID ConnectorID, external string) string {
+	return connectorID.String() + ":" + external
+}
+
+// ConnectorIdentity links a Slack or Telegram user to a LibroAI user.
+type ConnectorIdentity struct {
+	ID             ConnectorIdentityID `msgpack:"-"`
+	ConnectorID    ConnectorID         `msgpack:"c"`
+	ExternalUserID string              `msgpack:"x"`
+	UserID         UserID              `msgpack:"u"`
+	CreationTime   time.Time           `msgpack:"@"`
+}
+
+func (ident *ConnectorIdentity) Key() string {
+	return ConnectorKey(ident.ConnectorID, ident.ExternalUserID)
+}
+
+// ConnectorLink is a one-time token that links the user's Telegram account,
+// passed to the bot as the /start parameter. It is deleted once used.
+type ConnectorLink struct {
+	Token       string      `msgpack:"-"`
+	ConnectorID ConnectorID `msgpack:"c"`
+	UserID      UserID      `msgpack:"u"`
+	ExpiryTime  time.Time   `msgpack:"@e"`
+}
+
+func (link *ConnectorLink) IsExpired(now time.Time) bool {
+	return !now.Before(link.ExpiryTime)
+}
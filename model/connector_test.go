@@ -0,0 +1,17 @@
+package m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectorLinkExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	link := &ConnectorLink{Token: "abc", ConnectorID: 1, UserID: 42, ExpiryTime: now.Add(time.Minute)}
+	if link.IsExpired(now) {
+		t.Errorf("IsExpired before the expiry time")
+	}
+	if !link.IsExpired(now.Add(time.Minute)) {
+		t.Errorf("not IsExpired at the expiry time")
+	}
+}
@@ -8,6 +8,7 @@ import (
 const DistanceEps = 1e-6
 
 type AccountEmbeddings struct {
+	Type       EmbeddingType
 	Embeddings []*ContentEmbedding
 }
 
@@ -0,0 +1,142 @@
+package m
+
+import "golang.org/x/exp/slices"
+
+// RetrievalSettings are the knobs that control which library content
+// ends up in the system prompt.
+type RetrievalSettings struct {
+	MaxEntries      int
+	MaxDistance     float64
+	MaxPromptTokens int
+	// MMRLambda enables diversity-aware selection (see SelectDiverse) when below 1;
+	// zero means plain relevance order.
+	MMRLambda float64
+}
+
+// MMRPoolFactor is how many more candidates than MaxEntries are considered by MMR.
+const MMRPoolFactor = 3
+
+func (rs RetrievalSettings) UsesMMR() bool {
+	return rs.MMRLambda > 0 && rs.MMRLambda < 1
+}
+
+// PromptFrame describes the fixed parts of the system prompt that surround
+// the context entries; they count towards MaxPromptTokens.
+type PromptFrame struct {
+	Prefix string
+	Suffix string
+	Sep    string
+}
+
+// SelectForQueries returns the entries relevant to any of the given query embeddings,
+// best first. This is the retrieval step of RetrieveContext.
+func (embs *AccountEmbeddings) SelectForQueries(queries []Embedding, rs RetrievalSettings) EntriesAndDistances {
+	n := rs.MaxEntries
+	if rs.UsesMMR() {
+		n *= MMRPoolFactor
+	}
+	var entries EntriesAndDistances
+	for _, q := range queries {
+		entries.AppendAll(embs.Select(q, n, rs.MaxDistance))
+	}
+	if len(queries) > 1 {
+		entries = entries.SelectTop(n, rs.MaxDistance)
+	}
+	if rs.UsesMMR() {
+		entries = entries.SelectDiverse(rs.MaxEntries, rs.MMRLambda)
+	}
+	return entries
+}
+
+type GoldenQuestionResult struct {
+	Question       *GoldenQuestion
+	RankedItemIDs  []ItemID
+	PromptItemIDs  []ItemID
+	RecallAtK      float64
+	ReciprocalRank float64
+	PromptTokens   int
+}
+
+type RetrievalEvaluation struct {
+	Settings RetrievalSettings
+	K        int
+	Results  []*GoldenQuestionResult
+
+	MeanRecallAtK    float64
+	MRR              float64
+	MeanPromptTokens float64
+}
+
+// EvaluateRetrieval runs retrieval for each golden question and scores the result
+// against the expected items. queries[i] is the embedding of questions[i].
+//
+// Ranking is done at the item level: an item's rank is the rank of its best chunk.
+// RecallAtK is the share of expected items found among the top K items,
+// ReciprocalRank is 1/rank of the first expected item (0 if none was retrieved),
+// and PromptTokens is the system prompt size PickContext would produce.
+func EvaluateRetrieval(questions []*GoldenQuestion, queries []Embedding, embs *AccountEmbeddings, rs RetrievalSettings, k int, frame PromptFrame, model string) *RetrievalEvaluation {
+	ev := &RetrievalEvaluation{
+		Settings: rs,
+		K:        k,
+		Results:  make([]*GoldenQuestionResult, 0, len(questions)),
+	}
+	for i, q := range questions {
+		entries := embs.SelectForQueries([]Embedding{queries[i]}, rs)
+		included, tokens := PickContext(frame.Prefix, frame.Suffix, frame.Sep, rs.MaxPromptTokens, entries.Entries, model)
+
+		r := &GoldenQuestionResult{
+			Question:      q,
+			RankedItemIDs: uniqueItemIDs(entries.Entries),
+			PromptItemIDs: uniqueItemIDs(included),
+			PromptTokens:  tokens,
+		}
+		r.RecallAtK = RecallAtK(r.RankedItemIDs, q.ExpectedItemIDs, k)
+		r.ReciprocalRank = ReciprocalRank(r.RankedItemIDs, q.ExpectedItemIDs)
+		ev.Results = append(ev.Results, r)
+
+		ev.MeanRecallAtK += r.RecallAtK
+		ev.MRR += r.ReciprocalRank
+		ev.MeanPromptTokens += float64(r.PromptTokens)
+	}
+	if n := float64(len(ev.Results)); n > 0 {
+		ev.MeanRecallAtK /= n
+		ev.MRR /= n
+		ev.MeanPromptTokens /= n
+	}
+	return ev
+}
+
+func RecallAtK(ranked, expected []ItemID, k int) float64 {
+	if len(expected) == 0 {
+		return 0
+	}
+	if k > len(ranked) {
+		k = len(ranked)
+	}
+	var found int
+	for _, id := range expected {
+		if slices.Contains(ranked[:k], id) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(expected))
+}
+
+func ReciprocalRank(ranked, expected []ItemID) float64 {
+	for i, id := range ranked {
+		if slices.Contains(expected, id) {
+			return 1 / float64(i+1)
+		}
+	}
+	return 0
+}
+
+func uniqueItemIDs(entries []*ContentEmbedding) []ItemID {
+	result := make([]ItemID, 0, len(entries))
+	for _, e := range entries {
+		if !slices.Contains(result, e.ItemID) {
+			result = append(result, e.ItemID)
+		}
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package m
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andreyvit/openai"
+)
+
+func TestEvaluateRetrieval(t *testing.T) {
+	ctx := context.Background()
+	p := &FakeProvider{}
+	corpus := map[ItemID][]string{
+		1: {"Plan your week on Sunday evening: review goals, block deep work time, schedule workouts."},
+		2: {"Morning routine: wake up at the same time, drink water, no phone for the first hour."},
+		3: {"Sleep schedule: go to bed at the same time every night, avoid screens before sleep."},
+	}
+	embs := &AccountEmbeddings{Type: EmbeddingTypeHash}
+	var nextContentID ContentID
+	for itemID, chunks := range corpus {
+		for _, text := range chunks {
+			nextContentID++
+			c := &Content{ID: nextContentID, ItemID: itemID, Text: text}
+			e, _, err := ImportedContentEmbedding(ctx, p, c, embs.Type, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			embs.Embeddings = append(embs.Embeddings, e)
+		}
+	}
+	gs := &GoldenSet{Questions: []*GoldenQuestion{
+		{Text: "How should I plan my week?", ExpectedItemIDs: []ItemID{1}},
+		{Text: "What should my morning routine look like?", ExpectedItemIDs: []ItemID{2}},
+		{Text: "How do I fix my sleep schedule?", ExpectedItemIDs: []ItemID{3}},
+	}}
+	queries, computed, _, err := gs.EmbedQuestions(ctx, p, embs.Type)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if computed != len(gs.Questions) {
+		t.Errorf("EmbedQuestions computed %d embeddings, wanted %d", computed, len(gs.Questions))
+	}
+	if _, computed, _, _ := gs.EmbedQuestions(ctx, p, embs.Type); computed != 0 {
+		t.Errorf("EmbedQuestions recomputed %d cached embeddings", computed)
+	}
+
+	rs := RetrievalSettings{MaxEntries: 3, MaxDistance: 1e6, MaxPromptTokens: 1024}
+	frame := PromptFrame{Prefix: "You are a helpful assistant.", Sep: "\n\n---\n\n"}
+	ev := EvaluateRetrieval(gs.Questions, queries, embs, rs, 1, frame, openai.ModelChatGPT35Turbo)
+	if ev.MeanRecallAtK != 1 {
+		for _, r := range ev.Results {
+			t.Logf("%q => %v", r.Question.Text, r.RankedItemIDs)
+		}
+		t.Errorf("MeanRecallAtK = %v, wanted 1", ev.MeanRecallAtK)
+	}
+	if ev.MRR != 1 {
+		t.Errorf("MRR = %v, wanted 1", ev.MRR)
+	}
+	if ev.MeanPromptTokens <= 0 || ev.MeanPromptTokens > float64(rs.MaxPromptTokens) {
+		t.Errorf("MeanPromptTokens = %v, wanted within (0, %d]", ev.MeanPromptTokens, rs.MaxPromptTokens)
+	}
+}
+
+func TestRecallAndReciprocalRank(t *testing.T) {
+	ranked := []ItemID{5, 3, 7, 1}
+	if a, e := RecallAtK(ranked, []ItemID{3, 1}, 2), 0.5; a != e {
+		t.Errorf("RecallAtK = %v, wanted %v", a, e)
+	}
+	if a, e := RecallAtK(ranked, []ItemID{3, 1}, 10), 1.0; a != e {
+		t.Errorf("RecallAtK = %v, wanted %v", a, e)
+	}
+	if a, e := ReciprocalRank(ranked, []ItemID{7, 1}), 1.0/3; a != e {
+		t.Errorf("ReciprocalRank = %v, wanted %v", a, e)
+	}
+	if a, e := ReciprocalRank(ranked, []ItemID{9}), 0.0; a != e {
+		t.Errorf("ReciprocalRank = %v, wanted %v", a, e)
+	}
+}
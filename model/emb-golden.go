@@ -0,0 +1,137 @@
+package m
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/openai"
+)
+
+type GoldenSetID = flake.ID
+
+// GoldenSet is a hand-curated list of questions along with the library items
+// that a good retrieval is expected to surface for them.
+type GoldenSet struct {
+	ID        GoldenSetID       `msgpack:"-"`
+	AccountID AccountID         `msgpack:"a"`
+	Name      string            `msgpack:"n"`
+	Questions []*GoldenQuestion `msgpack:"q"`
+}
+
+type GoldenQuestion struct {
+	Text            string    `msgpack:"t"`
+	ExpectedItemIDs []ItemID  `msgpack:"i"`
+	EmbeddingAda002 Embedding `msgpack:"e2,omitempty"`
+	EmbeddingHash   Embedding `msgpack:"eh,omitempty"`
+}
+
+func (q *GoldenQuestion) Embedding(typ EmbeddingType) Embedding {
+	switch typ {
+	case EmbeddingTypeAda002:
+		return q.EmbeddingAda002
+	case EmbeddingTypeHash:
+		return q.EmbeddingHash
+	default:
+		panic(fmt.Errorf("invalid EmbeddingType %d", typ))
+	}
+}
+
+func (q *GoldenQuestion) SetEmbedding(typ EmbeddingType, emb Embedding) {
+	switch typ {
+	case EmbeddingTypeAda002:
+		q.EmbeddingAda002 = emb
+	case EmbeddingTypeHash:
+		q.EmbeddingHash = emb
+	default:
+		panic(fmt.Errorf("invalid EmbeddingType %d", typ))
+	}
+}
+
+// EmbedQuestions returns the embeddings of the questions of the given type,
+// computing the missing ones with p and caching them in the questions.
+// computed is the number of newly computed embeddings; save gs if it's non-zero.
+func (gs *GoldenSet) EmbedQuestions(ctx context.Context, p Provider, typ EmbeddingType) (queries []Embedding, computed int, cost openai.Price, err error) {
+	for _, q := range gs.Questions {
+		if q.Embedding(typ) == nil {
+			emb, spent, err := p.ComputeEmbedding(ctx, q.Text, typ)
+			cost += spent
+			if err != nil {
+				return nil, computed, cost, err
+			}
+			q.SetEmbedding(typ, emb)
+			computed++
+		}
+		queries = append(queries, q.Embedding(typ))
+	}
+	return queries, computed, cost, nil
+}
+
+func (gs *GoldenSet) SemanticPath() string {
+	return fmt.Sprintf("admin/golden/%v", gs.ID)
+}
+
+// FormatGoldenQuestions renders questions in the plain-text format used by the admin editor:
+// questions are separated by blank lines, the first line of each block is the question,
+// and each following line starting with ">" names an expected item.
+func FormatGoldenQuestions(questions []*GoldenQuestion, itemName func(ItemID) string) string {
+	var buf strings.Builder
+	for i, q := range questions {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(q.Text)
+		buf.WriteString("\n")
+		for _, id := range q.ExpectedItemIDs {
+			buf.WriteString("> ")
+			buf.WriteString(itemName(id))
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
+
+// ParseGoldenQuestions is the reverse of FormatGoldenQuestions. Existing questions
+// with the same text keep their cached embeddings. A line that follows expected
+// items starts a new question even without a blank line in between.
+func ParseGoldenQuestions(text string, existing []*GoldenQuestion, itemByName func(string) (ItemID, error)) ([]*GoldenQuestion, error) {
+	existingByText := make(map[string]*GoldenQuestion, len(existing))
+	for _, q := range existing {
+		existingByText[q.Text] = q
+	}
+
+	var result []*GoldenQuestion
+	var cur *GoldenQuestion
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			cur = nil
+		} else if name, ok := strings.CutPrefix(line, ">"); ok {
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: expected item without a question", i+1)
+			}
+			id, err := itemByName(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			cur.ExpectedItemIDs = append(cur.ExpectedItemIDs, id)
+		} else if cur != nil && len(cur.ExpectedItemIDs) == 0 {
+			cur.Text += " " + line
+		} else {
+			cur = &GoldenQuestion{Text: line}
+			result = append(result, cur)
+		}
+	}
+
+	for _, q := range result {
+		if len(q.ExpectedItemIDs) == 0 {
+			return nil, fmt.Errorf("question %q has no expected items", q.Text)
+		}
+		if old := existingByText[q.Text]; old != nil {
+			q.EmbeddingAda002 = old.EmbeddingAda002
+			q.EmbeddingHash = old.EmbeddingHash
+		}
+	}
+	return result, nil
+}
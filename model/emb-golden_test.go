@@ -0,0 +1,50 @@
+package m
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseGoldenQuestions(t *testing.T) {
+	items := map[string]ItemID{"Weekly Planning": 1, "Morning Routine": 2, "Sleep": 3}
+	itemByName := func(name string) (ItemID, error) {
+		if id, ok := items[name]; ok {
+			return id, nil
+		}
+		return 0, fmt.Errorf("unknown item %q", name)
+	}
+
+	tests := []struct {
+		input    string
+		expected []*GoldenQuestion
+	}{
+		{"How should I plan\nmy week?\n> Weekly Planning\n", []*GoldenQuestion{
+			{Text: "How should I plan my week?", ExpectedItemIDs: []ItemID{1}},
+		}},
+		{"Q1?\n> Weekly Planning\n\nQ2?\n> Sleep\n", []*GoldenQuestion{
+			{Text: "Q1?", ExpectedItemIDs: []ItemID{1}},
+			{Text: "Q2?", ExpectedItemIDs: []ItemID{3}},
+		}},
+		{"Q1?\n> Weekly Planning\nQ2?\n> Morning Routine\n> Sleep\n", []*GoldenQuestion{
+			{Text: "Q1?", ExpectedItemIDs: []ItemID{1}},
+			{Text: "Q2?", ExpectedItemIDs: []ItemID{2, 3}},
+		}},
+	}
+	for _, tt := range tests {
+		actual, err := ParseGoldenQuestions(tt.input, nil, itemByName)
+		if err != nil {
+			t.Errorf("ParseGoldenQuestions(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("ParseGoldenQuestions(%q) = %s, wanted %s", tt.input, formatGoldenQuestionsForTest(actual), formatGoldenQuestionsForTest(tt.expected))
+		}
+	}
+}
+
+func formatGoldenQuestionsForTest(questions []*GoldenQuestion) string {
+	return fmt.Sprintf("%q", FormatGoldenQuestions(questions, func(id ItemID) string {
+		return fmt.Sprint(uint64(id))
+	}))
+}
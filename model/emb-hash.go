@@ -0,0 +1,57 @@
+package m
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const HashEmbeddingDims = 256
+
+// HashEmbedding computes a cheap local embedding of the given text using
+// the hashing trick over lowercased words and word bigrams. It is nowhere
+// near as good as a real model, but it is deterministic and free, which
+// makes it useful for local development, tests and migration dry runs.
+//
+// Like OpenAI embeddings, the result is normalized, so CosineDistance applies.
+func HashEmbedding(text string) Embedding {
+	vec := make(Embedding, HashEmbeddingDims)
+	words := splitWords(text)
+	for i, w := range words {
+		addHashedFeature(vec, w, 1)
+		if i > 0 {
+			addHashedFeature(vec, words[i-1]+" "+w, 0.5)
+		}
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vec {
+			vec[i] /= norm
+		}
+	}
+	return vec
+}
+
+// splitWords returns lowercased words (runs of letters and digits) of text.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func addHashedFeature(vec Embedding, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	i := int(sum % uint64(len(vec)))
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	vec[i] += weight
+}
@@ -0,0 +1,80 @@
+package m
+
+import (
+	"time"
+
+	"github.com/andreyvit/openai"
+)
+
+type EmbeddingMigrationState int
+
+const (
+	EmbeddingMigrationStateRunning  = EmbeddingMigrationState(0)
+	EmbeddingMigrationStatePaused   = EmbeddingMigrationState(1)
+	EmbeddingMigrationStateFinished = EmbeddingMigrationState(2)
+	EmbeddingMigrationStateFailed   = EmbeddingMigrationState(3)
+)
+
+var _embeddingMigrationStateStrings = []string{
+	"running",
+	"paused",
+	"finished",
+	"failed",
+}
+
+func (v EmbeddingMigrationState) String() string {
+	return _embeddingMigrationStateStrings[v]
+}
+
+// EmbeddingMigration tracks re-embedding of all content, chat messages and
+// user memories of an account with a new embedding type. There is at most one migration
+// per account; starting a new one overwrites the previous record.
+type EmbeddingMigration struct {
+	AccountID  AccountID               `msgpack:"-"`
+	FromType   EmbeddingType           `msgpack:"f"`
+	ToType     EmbeddingType           `msgpack:"t"`
+	State      EmbeddingMigrationState `msgpack:"s"`
+	BatchSize  int                     `msgpack:"bs"`
+	RatePerSec float64                 `msgpack:"rps"`
+	StartTime  time.Time               `msgpack:"@s"`
+	UpdateTime time.Time               `msgpack:"@u"`
+	FinishTime time.Time               `msgpack:"@f,omitempty"`
+
+	ContentTotal  int          `msgpack:"ct"`
+	ContentDone   int          `msgpack:"cd"`
+	MessagesTotal int          `msgpack:"mt"`
+	MessagesDone  int          `msgpack:"md"`
+	MemoriesTotal int          `msgpack:"mmt,omitempty"`
+	MemoriesDone  int          `msgpack:"mmd,omitempty"`
+	Batches       int          `msgpack:"b"`
+	Cost          openai.Price `msgpack:"c"`
+	LastError     string       `msgpack:"err,omitempty"`
+}
+
+func (mig *EmbeddingMigration) IsActive() bool {
+	return mig.State == EmbeddingMigrationStateRunning
+}
+
+func (mig *EmbeddingMigration) ContentRemaining() int {
+	return mig.ContentTotal - mig.ContentDone
+}
+
+func (mig *EmbeddingMigration) MessagesRemaining() int {
+	return mig.MessagesTotal - mig.MessagesDone
+}
+
+func (mig *EmbeddingMigration) MemoriesRemaining() int {
+	return mig.MemoriesTotal - mig.MemoriesDone
+}
+
+func (mig *EmbeddingMigration) IsComplete() bool {
+	return mig.ContentRemaining() == 0 && mig.MessagesRemaining() == 0 && mig.MemoriesRemaining() == 0
+}
+
+func (mig *EmbeddingMigration) PercentDone() int {
+	total := mig.ContentTotal + mig.MessagesTotal + mig.MemoriesTotal
+	if total == 0 {
+		return 100
+	}
+	return (mig.ContentDone + mig.MessagesDone + mig.MemoriesDone) * 100 / total
+}
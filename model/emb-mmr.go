@@ -0,0 +1,54 @@
+package m
+
+// SelectDiverse picks up to maxCount entries using maximal marginal relevance:
+// each next entry maximizes lambda * relevance - (1 - lambda) * (similarity to
+// the most similar entry picked so far). With lambda = 1 this is the plain
+// relevance order; lower values trade relevance for diversity, so that the
+// context isn't filled with paraphrases of a single answer.
+//
+// Relevance is taken from Distances (which are really similarities, see SelectTop).
+func (ed EntriesAndDistances) SelectDiverse(maxCount int, lambda float64) EntriesAndDistances {
+	n := len(ed.Entries)
+	if maxCount > n {
+		maxCount = n
+	}
+	result := EntriesAndDistances{
+		Entries:   make([]*ContentEmbedding, 0, maxCount),
+		Distances: make([]float64, 0, maxCount),
+	}
+	if maxCount == 0 {
+		return result
+	}
+
+	picked := make([]bool, n)
+	maxSim := make([]float64, n) // similarity to the most similar picked entry
+	for len(result.Entries) < maxCount {
+		best := -1
+		var bestScore float64
+		for i := range ed.Entries {
+			if picked[i] {
+				continue
+			}
+			score := lambda * ed.Distances[i]
+			if len(result.Entries) > 0 {
+				score -= (1 - lambda) * maxSim[i]
+			}
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		picked[best] = true
+		result.Entries = append(result.Entries, ed.Entries[best])
+		result.Distances = append(result.Distances, ed.Distances[best])
+
+		for i, e := range ed.Entries {
+			if !picked[i] {
+				if sim := CosineDistance(e.Embedding, ed.Entries[best].Embedding); len(result.Entries) == 1 || sim > maxSim[i] {
+					maxSim[i] = sim
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,34 @@
+package m
+
+import "testing"
+
+func TestSelectDiverse(t *testing.T) {
+	entry := func(id ContentID, text string) *ContentEmbedding {
+		return &ContentEmbedding{
+			ContentEmbeddingKey: ContentEmbeddingKey{ContentID: id, Type: EmbeddingTypeHash},
+			Embedding:           HashEmbedding(text),
+		}
+	}
+	ed := EntriesAndDistances{
+		Entries: []*ContentEmbedding{
+			entry(1, "Plan your week on Sunday evening and review your goals."),
+			entry(2, "Plan your week on Sunday evening, and review your goals!"),
+			entry(3, "Drink a glass of water right after waking up."),
+		},
+		Distances: []float64{0.9, 0.89, 0.6},
+	}
+
+	tests := []struct {
+		lambda   float64
+		expected []ContentID
+	}{
+		{1, []ContentID{1, 2}},
+		{0.5, []ContentID{1, 3}},
+	}
+	for _, tt := range tests {
+		actual := contentIDsOf(ed.SelectDiverse(2, tt.lambda).Entries)
+		if len(actual) != len(tt.expected) || actual[0] != tt.expected[0] || actual[1] != tt.expected[1] {
+			t.Errorf("SelectDiverse(2, %v) = %v, wanted %v", tt.lambda, actual, tt.expected)
+		}
+	}
+}
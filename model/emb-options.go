@@ -0,0 +1,23 @@
+package m
+
+// RetrievalOptions are per-account switches for the optional stages
+// of the retrieval pipeline.
+type RetrievalOptions struct {
+	// QueryRewriting asks the LLM to turn the latest user message into
+	// a standalone search query before retrieval.
+	QueryRewriting bool `msgpack:"qr,omitempty"`
+	// MaxSubQueries is the number of additional sub-queries the rewriter
+	// may produce (only used with QueryRewriting).
+	MaxSubQueries int `msgpack:"sq,omitempty"`
+
+	// Reranker, if any, rescores the top RerankCandidates retrieved entries
+	// against the query; entries scoring below RerankThreshold (0..1) are dropped.
+	Reranker         RerankerType `msgpack:"rr,omitempty"`
+	RerankCandidates int          `msgpack:"rn,omitempty"`
+	RerankThreshold  float64      `msgpack:"rt,omitempty"`
+
+	// MMRLambda opts the account into diversity-aware context selection
+	// (see EntriesAndDistances.SelectDiverse) when below 1; zero or 1 keeps
+	// plain relevance order, which is the default.
+	MMRLambda float64 `msgpack:"mmr,omitempty"`
+}
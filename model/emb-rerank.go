@@ -0,0 +1,88 @@
+package m
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/exp/slices"
+)
+
+type RerankerType uint8
+
+const (
+	RerankerNone    = RerankerType(0)
+	RerankerLexical = RerankerType(1)
+	RerankerLLM     = RerankerType(2)
+)
+
+var _rerankerTypeStrings = []string{
+	"none",
+	"lexical",
+	"llm",
+}
+
+func (v RerankerType) String() string {
+	return _rerankerTypeStrings[v]
+}
+
+func ParseRerankerType(s string) (RerankerType, error) {
+	if i := slices.Index(_rerankerTypeStrings, s); i >= 0 {
+		return RerankerType(i), nil
+	} else {
+		return RerankerNone, fmt.Errorf("invalid RerankerType %q", s)
+	}
+}
+
+// LexicalRelevance scores text against query as the fraction of distinct
+// query words (ignoring very short ones) that occur in text, from 0 to 1.
+// It's a crude but free alternative to asking the LLM to judge relevance.
+func LexicalRelevance(query, text string) float64 {
+	textWords := make(map[string]bool)
+	for _, w := range splitWords(text) {
+		textWords[w] = true
+	}
+
+	seen := make(map[string]bool)
+	var total, found int
+	for _, w := range splitWords(query) {
+		if len([]rune(w)) < 3 || seen[w] {
+			continue
+		}
+		seen[w] = true
+		total++
+		if textWords[w] {
+			found++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(found) / float64(total)
+}
+
+// RerankEntries drops the entries scoring below threshold and orders the rest
+// by score (best first), keeping retrieval order for equal scores.
+// scores[i] corresponds to ed.Entries[i]. Returns the kept entries and their scores.
+func RerankEntries(ed EntriesAndDistances, scores []float64, threshold float64) (EntriesAndDistances, []float64) {
+	idx := make([]int, 0, len(ed.Entries))
+	for i := range ed.Entries {
+		if scores[i] >= threshold {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return scores[idx[a]] > scores[idx[b]]
+	})
+
+	result := EntriesAndDistances{
+		Entries:   make([]*ContentEmbedding, len(idx)),
+		Distances: make([]float64, len(idx)),
+	}
+	keptScores := make([]float64, len(idx))
+	for j, i := range idx {
+		result.Entries[j] = ed.Entries[i]
+		result.Distances[j] = ed.Distances[i]
+		keptScores[j] = scores[i]
+	}
+	return result, keptScores
+}
@@ -0,0 +1,48 @@
+package m
+
+import "testing"
+
+func TestLexicalRelevance(t *testing.T) {
+	tests := []struct {
+		query, text string
+		expected    float64
+	}{
+		{"morning routine", "Start your morning with a short routine.", 1},
+		{"morning routine ideas", "Start your morning with a walk.", 1.0 / 3},
+		{"what about mornings?", "Evening planning", 0},
+		{"to do", "to do lists", 0}, // short words are ignored
+	}
+	for _, tt := range tests {
+		actual := LexicalRelevance(tt.query, tt.text)
+		if actual != tt.expected {
+			t.Errorf("LexicalRelevance(%q, %q) = %v, wanted %v", tt.query, tt.text, actual, tt.expected)
+		}
+	}
+}
+
+func TestRerankEntries(t *testing.T) {
+	a, b, c := contentEmbeddingWithID(1), contentEmbeddingWithID(2), contentEmbeddingWithID(3)
+	ed := EntriesAndDistances{
+		Entries:   []*ContentEmbedding{a, b, c},
+		Distances: []float64{0.9, 0.8, 0.7},
+	}
+	result, scores := RerankEntries(ed, []float64{0.2, 0.5, 0.9}, 0.3)
+	if len(result.Entries) != 2 || result.Entries[0] != c || result.Entries[1] != b {
+		t.Fatalf("RerankEntries kept %v, wanted [3 2]", contentIDsOf(result.Entries))
+	}
+	if result.Distances[0] != 0.7 || scores[0] != 0.9 {
+		t.Errorf("RerankEntries returned distances %v and scores %v", result.Distances, scores)
+	}
+}
+
+func contentIDsOf(entries []*ContentEmbedding) []ContentID {
+	ids := make([]ContentID, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ContentID
+	}
+	return ids
+}
+
+func contentEmbeddingWithID(id ContentID) *ContentEmbedding {
+	return &ContentEmbedding{ContentEmbeddingKey: ContentEmbeddingKey{ContentID: id}}
+}
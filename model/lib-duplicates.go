@@ -0,0 +1,92 @@
+package m
+
+import (
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+)
+
+// DefaultDuplicateSimilarity is the similarity above which two content chunks
+// are flagged as near-duplicates.
+const DefaultDuplicateSimilarity = 0.97
+
+type ContentDuplicateState int
+
+const (
+	ContentDuplicatePending   = ContentDuplicateState(0)
+	ContentDuplicateDismissed = ContentDuplicateState(1)
+	ContentDuplicateResolved  = ContentDuplicateState(2)
+)
+
+// ContentDuplicate flags a pair of near-identical content chunks within an account
+// for admin review. ContentID is the newer chunk (the one being ingested).
+type ContentDuplicate struct {
+	ID                flake.ID              `msgpack:"-"`
+	AccountID         AccountID             `msgpack:"a"`
+	ContentID         ContentID             `msgpack:"c"`
+	ItemID            ItemID                `msgpack:"i"`
+	DuplicateOfID     ContentID             `msgpack:"dc"`
+	DuplicateOfItemID ItemID                `msgpack:"di"`
+	Similarity        float64               `msgpack:"sim"`
+	DetectionTime     time.Time             `msgpack:"t"`
+	State             ContentDuplicateState `msgpack:"s,omitempty"`
+}
+
+func (dup *ContentDuplicate) IsPending() bool {
+	return dup.State == ContentDuplicatePending
+}
+
+func (dup *ContentDuplicate) PairKey() ContentPairKey {
+	return MakeContentPairKey(dup.ContentID, dup.DuplicateOfID)
+}
+
+// ContentPairKey identifies an unordered pair of content chunks.
+type ContentPairKey struct {
+	A ContentID
+	B ContentID
+}
+
+func MakeContentPairKey(a, b ContentID) ContentPairKey {
+	if a > b {
+		a, b = b, a
+	}
+	return ContentPairKey{a, b}
+}
+
+type ContentPair struct {
+	Fresh      *ContentEmbedding
+	Existing   *ContentEmbedding
+	Similarity float64
+}
+
+// FindNearDuplicates compares fresh entries against all entries of the account
+// (which may include fresh ones) and returns the pairs with similarity of at
+// least threshold. Each unordered pair is reported once.
+func FindNearDuplicates(fresh, all []*ContentEmbedding, threshold float64) []ContentPair {
+	var result []ContentPair
+	seen := make(map[ContentPairKey]bool)
+	for _, f := range fresh {
+		for _, e := range all {
+			if e.ContentID == f.ContentID {
+				continue
+			}
+			key := MakeContentPairKey(f.ContentID, e.ContentID)
+			if seen[key] {
+				continue
+			}
+			if sim := CosineDistance(f.Embedding, e.Embedding); sim >= threshold {
+				seen[key] = true
+				result = append(result, ContentPair{f, e, sim})
+			}
+		}
+	}
+	return result
+}
+
+type ContentDuplicateVM struct {
+	*ContentDuplicate
+	Content         *Content
+	Item            *Item
+	DuplicateOf     *Content
+	DuplicateOfItem *Item
+}
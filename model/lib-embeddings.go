@@ -1,6 +1,10 @@
 package m
 
-import "github.com/andreyvit/openai"
+import (
+	"context"
+
+	"github.com/andreyvit/openai"
+)
 
 type Embedding = []float64
 
@@ -16,6 +20,30 @@ func (emb *ContentEmbedding) UpdateTokenCount(c *Content) {
 	emb.TokenCountGPT35 = openai.TokenCount(c.Text, openai.ModelChatGPT35Turbo)
 }
 
+// ImportedContentEmbedding returns the embedding of imported content c of
+// the given type. legacy is the ada002 embedding that came with the import,
+// if any; it is only reused when the account still uses ada002, otherwise
+// the embedding is computed by p, just like a migration would.
+func ImportedContentEmbedding(ctx context.Context, p Provider, c *Content, typ EmbeddingType, legacy Embedding) (*ContentEmbedding, openai.Price, error) {
+	var cost openai.Price
+	vec := legacy
+	if typ != EmbeddingTypeAda002 || len(vec) == 0 {
+		var err error
+		vec, cost, err = p.ComputeEmbedding(ctx, c.Text, typ)
+		if err != nil {
+			return nil, cost, err
+		}
+	}
+	emb := &ContentEmbedding{
+		ContentEmbeddingKey: ContentEmbeddingKey{ContentID: c.ID, Type: typ},
+		AccountID:           c.AccountID,
+		ItemID:              c.ItemID,
+		Embedding:           vec,
+	}
+	emb.UpdateTokenCount(c)
+	return emb, cost, nil
+}
+
 func (emb *ContentEmbedding) TokenCount(model string) int {
 	return emb.TokenCountGPT35
 }
@@ -0,0 +1,55 @@
+package m
+
+import (
+	"context"
+	"testing"
+)
+
+func TestImportedContentEmbedding(t *testing.T) {
+	account := &Account{ID: 1, EmbeddingType: EmbeddingTypeHash} // migrated off ada002
+	typ := account.EffectiveEmbeddingType()
+	legacy := make(Embedding, 1536)
+	legacy[0] = 1
+
+	p := &FakeProvider{}
+	texts := map[ItemID]string{
+		10: "Plan your week on Sunday evening: review goals, block deep work time, schedule workouts.",
+		20: "Morning routine: wake up at the same time, drink water, no phone for the first hour.",
+	}
+	embs := &AccountEmbeddings{Type: typ}
+	var nextContentID ContentID
+	for itemID, text := range texts {
+		nextContentID++
+		c := &Content{ID: nextContentID, AccountID: account.ID, ItemID: itemID, Text: text}
+		emb, _, err := ImportedContentEmbedding(context.Background(), p, c, typ, legacy)
+		if err != nil {
+			t.Fatalf("ImportedContentEmbedding(%q) failed: %v", text, err)
+		}
+		if emb.Type != typ {
+			t.Errorf("ImportedContentEmbedding(%q).Type = %v, wanted %v", text, emb.Type, typ)
+		}
+		embs.Embeddings = append(embs.Embeddings, emb)
+	}
+	if a, e := len(p.EmbeddedTexts), len(texts); a != e {
+		t.Errorf("embedded %d texts, wanted %d", a, e)
+	}
+
+	found := embs.Select(HashEmbedding("What should my morning routine look like?"), 1, 1e6)
+	if len(found.Entries) != 1 || found.Entries[0].ItemID != 20 {
+		t.Errorf("Select = %v, wanted item 20", found.Entries)
+	}
+}
+
+func TestImportedContentEmbeddingKeepsAda002(t *testing.T) {
+	legacy := make(Embedding, 1536)
+	legacy[0] = 1
+	p := &FakeProvider{}
+	c := &Content{ID: 1, AccountID: 1, ItemID: 10, Text: "Hello"}
+	emb, _, err := ImportedContentEmbedding(context.Background(), p, c, EmbeddingTypeAda002, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emb.Embedding) != len(legacy) || len(p.EmbeddedTexts) != 0 {
+		t.Errorf("ImportedContentEmbedding recomputed the ada002 embedding")
+	}
+}
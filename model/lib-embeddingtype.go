@@ -12,6 +12,7 @@ type EmbeddingType uint8
 const (
 	EmbeddingTypeNone   = EmbeddingType(0)
 	EmbeddingTypeAda002 = EmbeddingType(1)
+	EmbeddingTypeHash   = EmbeddingType(2)
 
 	CurrentEmbeddingType = EmbeddingTypeAda002
 )
@@ -19,6 +20,13 @@ const (
 var _embeddingTypeStrings = []string{
 	"",
 	"ada002",
+	"hash",
+}
+
+// IsLocal returns true for embedding types that are computed in-process
+// without calling an external API (and thus cost nothing).
+func (v EmbeddingType) IsLocal() bool {
+	return v == EmbeddingTypeHash
 }
 
 func (v EmbeddingType) String() string {
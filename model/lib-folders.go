@@ -2,8 +2,11 @@ package m
 
 import (
 	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/andreyvit/mvp/flake"
+	"golang.org/x/exp/slices"
 )
 
 type FolderID = flake.ID
@@ -15,6 +18,102 @@ type Folder struct {
 	Slug       string     `msgpack:"s"`
 	ParentID   FolderID   `msgpack:"p"`
 	ChildenIDs []FolderID `msgpack:"c"`
+	ACL        *FolderACL `msgpack:"acl,omitempty"` // nil means open to everyone who can see the parent
+}
+
+// FolderACL restricts a folder and its subfolders to some of the account's
+// members, both in the library UI and in retrieval. Members who can manage
+// the library see all folders regardless.
+type FolderACL struct {
+	Roles  []UserAccountRole `msgpack:"r,omitempty"`
+	Groups []UserGroupID     `msgpack:"g,omitempty"`
+}
+
+// NewFolderACL returns nil when nobody is listed, meaning no restriction.
+func NewFolderACL(roles []UserAccountRole, groups []UserGroupID) *FolderACL {
+	if len(roles) == 0 && len(groups) == 0 {
+		return nil
+	}
+	return &FolderACL{Roles: roles, Groups: groups}
+}
+
+// Allows returns whether the member has one of the roles or is in one of the
+// groups.
+func (acl *FolderACL) Allows(memb *UserMembership) bool {
+	if memb == nil || !memb.Status.ActiveOrInvited() {
+		return false
+	}
+	if slices.Contains(acl.Roles, memb.Role) {
+		return true
+	}
+	for _, id := range acl.Groups {
+		if memb.InGroup(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutGroup returns a copy of the ACL that no longer lists the group, or
+// nil if the group wasn't listed. Dropping the last group leaves an empty ACL,
+// so the folder stays closed to everyone but library managers.
+func (acl *FolderACL) WithoutGroup(id UserGroupID) *FolderACL {
+	i := slices.Index(acl.Groups, id)
+	if i < 0 {
+		return nil
+	}
+	groups := slices.Delete(slices.Clone(acl.Groups), i, i+1)
+	return &FolderACL{Roles: acl.Roles, Groups: groups}
+}
+
+func (acl *FolderACL) RolesString() string {
+	roles := make([]string, len(acl.Roles))
+	for i, role := range acl.Roles {
+		roles[i] = role.String()
+	}
+	return strings.Join(roles, ", ")
+}
+
+// GroupNames returns the names of the listed groups that still exist.
+func (acl *FolderACL) GroupNames(groups []*UserGroup) []string {
+	var names []string
+	for _, g := range groups {
+		if slices.Contains(acl.Groups, g.ID) {
+			names = append(names, g.Name)
+		}
+	}
+	return names
+}
+
+// Describe summarizes who the ACL admits, e.g. "assistant; Spring cohort".
+func (acl *FolderACL) Describe(groups []*UserGroup) string {
+	parts := acl.GroupNames(groups)
+	if len(acl.Roles) > 0 {
+		parts = append([]string{acl.RolesString()}, parts...)
+	}
+	if len(parts) == 0 {
+		return "library managers"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ParseFolderRoles parses a comma-separated list of roles for a FolderACL.
+// Owners and admins always have access, so they aren't accepted.
+func ParseFolderRoles(s string) ([]UserAccountRole, error) {
+	var roles []UserAccountRole
+	for _, str := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		role, err := ParseUserAccountRole(strings.ToLower(str))
+		if err != nil {
+			return nil, fmt.Errorf("unknown role %q", str)
+		}
+		if role == UserAccountRoleNone || AccountRolePermissions(role).Has(PermissionManageLibrary) {
+			return nil, fmt.Errorf("role %q always has access", str)
+		}
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
 }
 
 func (fldr *Folder) IsRoot() bool {
@@ -77,6 +176,86 @@ func (lib *AccountLibrary) FolderBySlug(slug string) *Folder {
 	return lib.FoldersBySlug[slug]
 }
 
+// FindFolder looks a folder up by its slug or by its case-insensitive name.
+func (lib *AccountLibrary) FindFolder(name string) *Folder {
+	if fldr := lib.FoldersBySlug[name]; fldr != nil {
+		return fldr
+	}
+	for _, fldr := range lib.Folders {
+		if strings.EqualFold(fldr.Name, name) {
+			return fldr
+		}
+	}
+	return nil
+}
+
+// Subtree returns the IDs of the given folder and all of its descendants.
+func (lib *AccountLibrary) Subtree(id FolderID) map[FolderID]bool {
+	result := make(map[FolderID]bool)
+	queue := []FolderID{id}
+	for len(queue) > 0 {
+		id, queue = queue[0], queue[1:]
+		if result[id] {
+			continue
+		}
+		result[id] = true
+		if fldr := lib.Folders[id]; fldr != nil {
+			queue = append(queue, fldr.ChildenIDs...)
+		}
+	}
+	return result
+}
+
+// AccessibleFolders returns the folders whose content u can see in the
+// library's account, or nil if u can see everything. A folder is accessible
+// when it and all of its ancestors allow u in.
+func (lib *AccountLibrary) AccessibleFolders(u *User, accountID AccountID) map[FolderID]bool {
+	var restricted bool
+	for _, fldr := range lib.Folders {
+		if fldr.ACL != nil {
+			restricted = true
+			break
+		}
+	}
+	if !restricted || (u != nil && CanAccess(u, PermissionManageLibrary, accountID, nil)) {
+		return nil
+	}
+	var memb *UserMembership
+	if u != nil {
+		memb = u.Membership(accountID)
+	}
+
+	result := make(map[FolderID]bool, len(lib.Folders))
+	var visit func(id FolderID)
+	visit = func(id FolderID) {
+		fldr := lib.Folders[id]
+		if fldr == nil || result[id] || (fldr.ACL != nil && !fldr.ACL.Allows(memb)) {
+			return
+		}
+		result[id] = true
+		for _, childID := range fldr.ChildenIDs {
+			visit(childID)
+		}
+	}
+	visit(lib.RootFolderID)
+	return result
+}
+
+// Restrict returns a copy of the library that only has the given folders,
+// or the library itself if folders is nil.
+func (lib *AccountLibrary) Restrict(folders map[FolderID]bool) *AccountLibrary {
+	if folders == nil {
+		return lib
+	}
+	result := NewAccountLibrary(len(folders))
+	for id := range folders {
+		if fldr := lib.Folders[id]; fldr != nil {
+			result.AddFolder(fldr)
+		}
+	}
+	return result
+}
+
 type FolderWithItemsVM struct {
 	*Folder
 	Subfolders []*Folder
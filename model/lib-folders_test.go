@@ -0,0 +1,91 @@
+package m
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFolderRoles(t *testing.T) {
+	roles, err := ParseFolderRoles(" consumer,Assistant consumer ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := []UserAccountRole{UserAccountRoleConsumer, UserAccountRoleAssistant}; !reflect.DeepEqual(roles, e) {
+		t.Errorf("roles = %v, wanted %v", roles, e)
+	}
+	if roles, err := ParseFolderRoles(""); roles != nil || err != nil {
+		t.Errorf("empty roles = %v, %v", roles, err)
+	}
+	if acl := NewFolderACL(nil, nil); acl != nil {
+		t.Errorf("empty ACL = %v", acl)
+	}
+	for _, s := range []string{"owner", "admin", "none", "boss"} {
+		if _, err := ParseFolderRoles(s); err == nil {
+			t.Errorf("ParseFolderRoles(%q) succeeded", s)
+		}
+	}
+}
+
+func TestAccessibleFolders(t *testing.T) {
+	const acc = AccountID(1)
+	lib := NewAccountLibrary(4)
+	lib.AddFolder(&Folder{ID: 1, ChildenIDs: []FolderID{2, 3}})
+	lib.AddFolder(&Folder{ID: 2, ParentID: 1, Slug: "free"})
+	lib.AddFolder(&Folder{ID: 3, ParentID: 1, Slug: "premium", ChildenIDs: []FolderID{4}, ACL: &FolderACL{Roles: []UserAccountRole{UserAccountRoleAssistant}}})
+	lib.AddFolder(&Folder{ID: 4, ParentID: 3, Slug: "lessons", ACL: &FolderACL{Groups: []UserGroupID{10}}})
+
+	member := func(role UserAccountRole, status UserStatus) *User {
+		return &User{Role: UserSystemRoleRegular, Memberships: []*UserMembership{{AccountID: acc, Role: role, Status: status}}}
+	}
+	open := map[FolderID]bool{1: true, 2: true}
+	all := map[FolderID]bool{1: true, 2: true, 3: true, 4: true}
+	inCohort := member(UserAccountRoleAssistant, UserStatusActive)
+	inCohort.Memberships[0].GroupIDs = []UserGroupID{10}
+	tests := []struct {
+		name     string
+		u        *User
+		expected map[FolderID]bool
+	}{
+		{"owner", member(UserAccountRoleOwner, UserStatusActive), nil},
+		{"assistant", member(UserAccountRoleAssistant, UserStatusActive), map[FolderID]bool{1: true, 2: true, 3: true}},
+		{"assistant in cohort", inCohort, all},
+		{"banned assistant", member(UserAccountRoleAssistant, UserStatusBanned), open},
+		{"consumer", member(UserAccountRoleConsumer, UserStatusActive), open},
+		{"no user", nil, open},
+	}
+	for _, tt := range tests {
+		if a := lib.AccessibleFolders(tt.u, acc); !reflect.DeepEqual(a, tt.expected) {
+			t.Errorf("%s: got %v, wanted %v", tt.name, a, tt.expected)
+		}
+	}
+
+	restricted := lib.Restrict(open)
+	if restricted.Folder(3) != nil || restricted.FolderBySlug("lessons") != nil || restricted.RootFolder() == nil {
+		t.Errorf("Restrict kept %v", restricted.Folders)
+	}
+
+	lib.Folders[3].ACL = nil
+	lib.Folders[4].ACL = nil
+	if a := lib.AccessibleFolders(member(UserAccountRoleConsumer, UserStatusActive), acc); a != nil {
+		t.Errorf("unrestricted library: got %v", a)
+	}
+}
+
+func TestFolderACLGroups(t *testing.T) {
+	groups := []*UserGroup{{ID: 10, Name: "BC12"}, {ID: 11, Name: "BC13"}}
+	acl := NewFolderACL([]UserAccountRole{UserAccountRoleAssistant}, []UserGroupID{11, 10})
+
+	if a, e := acl.Describe(groups), "assistant; BC12; BC13"; a != e {
+		t.Errorf("Describe = %q, wanted %q", a, e)
+	}
+	if a := acl.WithoutGroup(12); a != nil {
+		t.Errorf("WithoutGroup(unlisted) = %v", a)
+	}
+	without := acl.WithoutGroup(11).WithoutGroup(10)
+	if without == nil || len(without.Groups) != 0 || len(acl.Groups) != 2 {
+		t.Fatalf("WithoutGroup = %v, original %v", without, acl)
+	}
+	if a, e := (&FolderACL{}).Describe(groups), "library managers"; a != e {
+		t.Errorf("empty Describe = %q, wanted %q", a, e)
+	}
+}
@@ -20,6 +20,9 @@ const (
 	PermissionAccessChat
 
 	PermissionSwitchToAccount
+
+	PermissionViewLibrary
+	PermissionManageLibrary // includes seeing restricted folders
 )
 
 var _permissionStrings = []string{
@@ -34,6 +37,9 @@ var _permissionStrings = []string{
 	"access-chat",
 
 	"switch-to-account",
+
+	"view-library",
+	"manage-library",
 }
 
 func (v Permission) String() string {
@@ -56,3 +62,47 @@ func (v *Permission) UnmarshalText(b []byte) error {
 	*v, err = ParsePermission(string(b))
 	return err
 }
+
+// PermissionSet is a set of permissions granted by a role.
+type PermissionSet uint64
+
+func Permissions(perms ...Permission) PermissionSet {
+	var s PermissionSet
+	for _, perm := range perms {
+		s |= 1 << perm
+	}
+	return s
+}
+
+func (s PermissionSet) Has(perm Permission) bool {
+	return s&(1<<perm) != 0
+}
+
+var (
+	// accountScopedPermissions are checked against a specific account.
+	accountScopedPermissions = Permissions(PermissionAccessAdminArea, PermissionManageAccount, PermissionSwitchToAccount, PermissionViewLibrary, PermissionManageLibrary)
+
+	superadminPermissions = Permissions(PermissionAccessSuperadminArea, PermissionManageSuperadmins)
+
+	systemRolePermissions = map[UserSystemRole]PermissionSet{
+		UserSystemRoleSuperadmin: ^PermissionSet(0),
+		UserSystemRoleSuperQA:    Permissions(PermissionAccessSuperadminArea, PermissionSwitchToAccount),
+	}
+
+	accountRolePermissions = map[UserAccountRole]PermissionSet{
+		UserAccountRoleOwner:     Permissions(PermissionAccessAdminArea, PermissionManageAccount, PermissionAccessChat, PermissionSwitchToAccount, PermissionViewLibrary, PermissionManageLibrary),
+		UserAccountRoleAdmin:     Permissions(PermissionAccessAdminArea, PermissionManageAccount, PermissionAccessChat, PermissionSwitchToAccount, PermissionViewLibrary, PermissionManageLibrary),
+		UserAccountRoleAssistant: Permissions(PermissionAccessAdminArea, PermissionAccessChat, PermissionSwitchToAccount, PermissionViewLibrary),
+		UserAccountRoleConsumer:  Permissions(PermissionAccessChat, PermissionSwitchToAccount),
+	}
+)
+
+// SystemRolePermissions returns the permissions the role grants in every account.
+func SystemRolePermissions(role UserSystemRole) PermissionSet {
+	return systemRolePermissions[role]
+}
+
+// AccountRolePermissions returns the permissions the role grants within its account.
+func AccountRolePermissions(role UserAccountRole) PermissionSet {
+	return accountRolePermissions[role]
+}
@@ -0,0 +1,43 @@
+package m
+
+import "testing"
+
+func TestCheckAccess(t *testing.T) {
+	const acc = AccountID(1)
+	member := func(role UserAccountRole) *User {
+		return &User{Role: UserSystemRoleRegular, Memberships: []*UserMembership{{AccountID: acc, Role: role, Status: UserStatusActive}}}
+	}
+	superadmin := &User{Role: UserSystemRoleSuperadmin}
+	superQA := &User{Role: UserSystemRoleSuperQA}
+	stranger := &User{Role: UserSystemRoleRegular}
+
+	tests := []struct {
+		name     string
+		u        *User
+		perm     Permission
+		expected error
+	}{
+		{"superadmin area by superadmin", superadmin, PermissionAccessSuperadminArea, nil},
+		{"superadmin area by superqa", superQA, PermissionAccessSuperadminArea, nil},
+		{"superadmin area by owner", member(UserAccountRoleOwner), PermissionAccessSuperadminArea, ErrForbiddenNotSuperadmin},
+		{"manage superadmins by superqa", superQA, PermissionManageSuperadmins, ErrForbiddenNotSuperadmin},
+		{"admin area by superadmin", superadmin, PermissionAccessAdminArea, nil},
+		{"admin area by superqa", superQA, PermissionAccessAdminArea, ErrForbiddenWrongAccount},
+		{"admin area by assistant", member(UserAccountRoleAssistant), PermissionAccessAdminArea, nil},
+		{"admin area by consumer", member(UserAccountRoleConsumer), PermissionAccessAdminArea, ErrForbiddenNotStaff},
+		{"admin area by stranger", stranger, PermissionAccessAdminArea, ErrForbiddenWrongAccount},
+		{"manage account by admin", member(UserAccountRoleAdmin), PermissionManageAccount, nil},
+		{"manage account by assistant", member(UserAccountRoleAssistant), PermissionManageAccount, ErrForbiddenOther},
+		{"switch by consumer", member(UserAccountRoleConsumer), PermissionSwitchToAccount, nil},
+		{"switch by superqa", superQA, PermissionSwitchToAccount, nil},
+		{"view library by assistant", member(UserAccountRoleAssistant), PermissionViewLibrary, nil},
+		{"view library by consumer", member(UserAccountRoleConsumer), PermissionViewLibrary, ErrForbiddenNotStaff},
+		{"manage library by owner", member(UserAccountRoleOwner), PermissionManageLibrary, nil},
+		{"manage library by assistant", member(UserAccountRoleAssistant), PermissionManageLibrary, ErrForbiddenOther},
+	}
+	for _, tt := range tests {
+		if a := CheckAccess(tt.u, tt.perm, acc, nil); a != tt.expected {
+			t.Errorf("%s: got %v, wanted %v", tt.name, a, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package m
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/andreyvit/openai"
+)
+
+// Provider is the AI backend of the app. Production talks to OpenAI;
+// tests and local development use FakeProvider.
+type Provider interface {
+	ComputeEmbedding(ctx context.Context, text string, typ EmbeddingType) (Embedding, openai.Price, error)
+	// Chat runs a chat completion. The response carries the cost even on error.
+	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+}
+
+type ChatRequest struct {
+	Model       string
+	MaxTokens   int
+	Temperature float64
+	Messages    []openai.Msg
+
+	// Function, if set, is the JSON schema of a function the model is forced
+	// to call; its arguments are returned in ChatResponse.FunctionArgs.
+	Function     json.RawMessage
+	FunctionName string
+}
+
+type ChatResponse struct {
+	Text         string
+	FunctionArgs json.RawMessage
+	Cost         openai.Price
+}
+
+// FakeProvider is a Provider that never leaves the process. It embeds text
+// with HashEmbedding whatever the requested type, so retrieval works
+// end-to-end, and returns ChatResponses in order. Once they run out, it
+// fails with ChatErr if set, and gives an empty answer (and empty function
+// arguments) otherwise. It records the requests it gets.
+type FakeProvider struct {
+	ChatResponses []*ChatResponse
+	ChatErr       error
+
+	EmbeddedTexts []string
+	ChatRequests  []*ChatRequest
+
+	mut sync.Mutex
+}
+
+func (p *FakeProvider) ComputeEmbedding(ctx context.Context, text string, typ EmbeddingType) (Embedding, openai.Price, error) {
+	if typ == EmbeddingTypeNone {
+		return nil, 0, fmt.Errorf("embeddings: unsupported embedding type %v", typ)
+	}
+	p.mut.Lock()
+	p.EmbeddedTexts = append(p.EmbeddedTexts, text)
+	p.mut.Unlock()
+	return HashEmbedding(text), 0, nil
+}
+
+func (p *FakeProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.ChatRequests = append(p.ChatRequests, req)
+	if len(p.ChatResponses) == 0 {
+		if p.ChatErr != nil {
+			return &ChatResponse{}, p.ChatErr
+		}
+		resp := &ChatResponse{}
+		if req.Function != nil {
+			resp.FunctionArgs = json.RawMessage(`{}`)
+		}
+		return resp, nil
+	}
+	resp := p.ChatResponses[0]
+	p.ChatResponses = p.ChatResponses[1:]
+	return resp, nil
+}
@@ -0,0 +1,25 @@
+package m
+
+import (
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+)
+
+type ReminderID = flake.ID
+
+// Reminder is a follow-up the bot has promised to send the user.
+type Reminder struct {
+	ID           ReminderID `msgpack:"-"`
+	AccountID    AccountID  `msgpack:"a"`
+	UserID       UserID     `msgpack:"u"`
+	ChatID       ChatID     `msgpack:"c"`
+	Text         string     `msgpack:"t"`
+	CreationTime time.Time  `msgpack:"@"`
+	DueTime      time.Time  `msgpack:"due"`
+	SentTime     time.Time  `msgpack:"sent,omitempty"`
+}
+
+func (r *Reminder) IsSent() bool {
+	return !r.SentTime.IsZero()
+}
@@ -1,6 +1,7 @@
 package m
 
 import (
+	"regexp"
 	"time"
 
 	"github.com/andreyvit/mvp/flake"
@@ -14,9 +15,71 @@ const (
 type AccountID = flake.ID
 
 type Account struct {
-	ID       AccountID `msgpack:"-"`
-	Name     string    `msgpack:"n"`
-	Disabled bool      `msgpack:"dis,omitempty"`
+	ID            AccountID        `msgpack:"-"`
+	Name          string           `msgpack:"n"`
+	Disabled      bool             `msgpack:"dis,omitempty"`
+	EmbeddingType EmbeddingType    `msgpack:"et,omitempty"`
+	Retrieval     RetrievalOptions `msgpack:"ret"`
+	UserMemory    bool             `msgpack:"um,omitempty"`
+	Tools         ToolPermissions  `msgpack:"tools,omitempty"`
+
+	// CheckInTemplates override the default check-in prompts, by CheckInKind string.
+	CheckInTemplates map[string]string `msgpack:"cit,omitempty"`
+
+	// Prompt overrides the default bot prompt.
+	Prompt string `msgpack:"p,omitempty"`
+	// IsTemplate offers the account's library and settings as a starting
+	// point when approving new accounts.
+	IsTemplate bool `msgpack:"tpl,omitempty"`
+
+	Branding AccountBranding `msgpack:"br"`
+	// Language is the language the bot answers in by default, e.g. "Spanish".
+	Language     string           `msgpack:"lang,omitempty"`
+	SignupPolicy SignupPolicy     `msgpack:"sp,omitempty"`
+	Domains      []*AccountDomain `msgpack:"dom,omitempty"`
+}
+
+type AccountBranding struct {
+	LogoURL       string `msgpack:"logo,omitempty"`
+	AssistantName string `msgpack:"an,omitempty"`
+	AccentColor   string `msgpack:"ac,omitempty"` // CSS color, e.g. #7e22ce
+}
+
+const DefaultAssistantName = "LibroAI"
+
+// AssistantName returns the name the bot is presented under.
+func (acc *Account) AssistantName() string {
+	if acc.Branding.AssistantName != "" {
+		return acc.Branding.AssistantName
+	}
+	return DefaultAssistantName
+}
+
+// EmailSubject prefixes the subject of notification emails with the
+// assistant's name, e.g. "[LibroAI] Reminder".
+func (acc *Account) EmailSubject(subject string) string {
+	name := DefaultAssistantName
+	if acc != nil {
+		name = acc.AssistantName()
+	}
+	return "[" + name + "] " + subject
+}
+
+var hexColorRe = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// IsHexColor reports whether s is a #rgb or #rrggbb color, the only accent
+// colors we accept so that they can go into style attributes.
+func IsHexColor(s string) bool {
+	return hexColorRe.MatchString(s)
+}
+
+// EffectiveEmbeddingType returns the embedding type used for retrieval in this account.
+// Accounts created before per-account embedding types use CurrentEmbeddingType.
+func (acc *Account) EffectiveEmbeddingType() EmbeddingType {
+	if acc.EmbeddingType == EmbeddingTypeNone {
+		return CurrentEmbeddingType
+	}
+	return acc.EmbeddingType
 }
 
 type AccountObjectKey struct {
@@ -52,10 +115,13 @@ func AccountString(a AccountID, s string) AccountStringKey {
 // }
 
 type Waitlister struct {
-	ID        flake.ID  `msgpack:"-"`
-	Email     string    `msgpack:"e"`
-	EmailNorm string    `msgpack:"e!"`
-	LastLogin time.Time `msgpack:"@l"`
+	ID          flake.ID  `msgpack:"-"`
+	Email       string    `msgpack:"e"`
+	EmailNorm   string    `msgpack:"e!"`
+	LastLogin   time.Time `msgpack:"@l"`
+	FullName    string    `msgpack:"n,omitempty"`
+	CompanyName string    `msgpack:"co,omitempty"`
+	SignupTime  time.Time `msgpack:"@s,omitempty"` // filled the landing signup form
 }
 
 func (obj *Waitlister) FlakeID() flake.ID {
@@ -71,13 +137,75 @@ type Session struct {
 	AccountID          flake.ID  `msgpack:"a"`
 	ImpersonatedUserID flake.ID  `msgpack:"iu"`
 	LastActivity       time.Time `msgpack:"@l"`
-	Disabled           bool      `msgpack:"dis"`
+	Disabled           bool      `msgpack:"dis"` // signed out remotely
+	CreationTime       time.Time `msgpack:"@,omitempty"`
+	UserAgent          string    `msgpack:"ua,omitempty"`
+	IP                 string    `msgpack:"ip,omitempty"` // as of the last activity
+	ModGroupID         flake.ID  `msgpack:"mg,omitempty"` // moderator's chat list filter
+}
+
+// IsActive returns whether the session can still be used.
+func (sess *Session) IsActive(now time.Time, idleTimeout time.Duration) bool {
+	return !sess.Disabled && (idleTimeout <= 0 || now.Sub(sess.LastActivity) < idleTimeout)
 }
 
+// UserSignInAttempt is the sign-in code emailed to an address, keyed by the
+// canonical email. It also tracks wrong guesses, which survive across codes
+// until the record is cleaned up.
 type UserSignInAttempt struct {
-	Email string    `msgpack:"-"`
-	Code  string    `msgpack:"c"`
-	Time  time.Time `msgpack:"tm"`
+	Email       string    `msgpack:"-"`
+	Code        string    `msgpack:"c"`
+	Time        time.Time `msgpack:"tm"`
+	Failures    int       `msgpack:"f,omitempty"`  // since the last lockout
+	Lockouts    int       `msgpack:"lo,omitempty"` // determines the next lockout duration
+	LockedUntil time.Time `msgpack:"lu,omitempty"`
+}
+
+// IsLocked returns whether codes for this email are refused because of too
+// many wrong guesses.
+func (a *UserSignInAttempt) IsLocked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
+
+// RecordFailure counts a wrong code. Upon maxFailures, the code is
+// invalidated and the email is locked out for baseLockout, doubling with each
+// subsequent lockout up to maxLockout. Returns whether a lockout started.
+func (a *UserSignInAttempt) RecordFailure(now time.Time, maxFailures int, baseLockout, maxLockout time.Duration) bool {
+	a.Failures++
+	if a.Failures < maxFailures {
+		return false
+	}
+	d := baseLockout
+	for i := 0; i < a.Lockouts && d < maxLockout; i++ {
+		d *= 2
+	}
+	if d > maxLockout {
+		d = maxLockout
+	}
+	a.Code = ""
+	a.Failures = 0
+	a.Lockouts++
+	a.LockedUntil = now.Add(d)
+	return true
+}
+
+// IsStale returns whether the attempt can be forgotten: its code has
+// expired, and it hasn't been used or locked for the retention period.
+func (a *UserSignInAttempt) IsStale(now time.Time, retention time.Duration) bool {
+	last := a.Time
+	if a.LockedUntil.After(last) {
+		last = a.LockedUntil
+	}
+	return now.Sub(last) > retention
+}
+
+// PasskeyChallenge is a WebAuthn challenge handed out to a browser, keyed by
+// its base64url form. UserID is set when registering a new passkey.
+type PasskeyChallenge struct {
+	Challenge    string    `msgpack:"-"`
+	UserID       UserID    `msgpack:"u,omitempty"`
+	Name         string    `msgpack:"n,omitempty"` // of the passkey being registered
+	CreationTime time.Time `msgpack:"@"`
 }
 
 type Actor interface {
@@ -0,0 +1,55 @@
+package m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserSignInAttemptLockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := &UserSignInAttempt{Email: "alice@example.com", Code: "123456", Time: now}
+
+	for i := 1; i < 3; i++ {
+		if a.RecordFailure(now, 3, time.Minute, 10*time.Minute) {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+	if a.Code != "123456" || a.IsLocked(now) {
+		t.Fatalf("code invalidated early: %+v", a)
+	}
+
+	var durations []time.Duration
+	for n := 0; n < 5; n++ {
+		for i := 0; n > 0 && i < 2; i++ {
+			a.RecordFailure(now, 3, time.Minute, 10*time.Minute)
+		}
+		if !a.RecordFailure(now, 3, time.Minute, 10*time.Minute) {
+			t.Fatalf("lockout %d did not start", n)
+		}
+		if a.Code != "" || !a.IsLocked(now) {
+			t.Fatalf("lockout %d: %+v", n, a)
+		}
+		durations = append(durations, a.LockedUntil.Sub(now))
+	}
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute}
+	for i, d := range expected {
+		if durations[i] != d {
+			t.Errorf("lockout %d lasted %v, wanted %v", i, durations[i], d)
+		}
+	}
+	if a.IsLocked(now.Add(10 * time.Minute)) {
+		t.Errorf("still locked after the lockout")
+	}
+}
+
+func TestUserSignInAttemptIsStale(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := &UserSignInAttempt{Time: now.Add(-2 * time.Hour)}
+	if !a.IsStale(now, time.Hour) {
+		t.Errorf("old attempt not stale")
+	}
+	a.LockedUntil = now.Add(-30 * time.Minute)
+	if a.IsStale(now, time.Hour) {
+		t.Errorf("recently locked attempt is stale")
+	}
+}
@@ -0,0 +1,157 @@
+package m
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/exp/slices"
+)
+
+type SSOProtocol int
+
+const (
+	SSOProtocolNone = SSOProtocol(0)
+	SSOProtocolOIDC = SSOProtocol(1)
+	SSOProtocolSAML = SSOProtocol(2)
+)
+
+var _ssoProtocolStrings = []string{
+	"none",
+	"oidc",
+	"saml",
+}
+
+func (v SSOProtocol) String() string {
+	return _ssoProtocolStrings[v]
+}
+
+func ParseSSOProtocol(s string) (SSOProtocol, error) {
+	if i := slices.Index(_ssoProtocolStrings, strings.ToLower(strings.TrimSpace(s))); i >= 0 {
+		return SSOProtocol(i), nil
+	} else {
+		return SSOProtocolNone, fmt.Errorf("invalid SSOProtocol %q", s)
+	}
+}
+
+func (v SSOProtocol) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+func (v *SSOProtocol) UnmarshalText(b []byte) error {
+	var err error
+	*v, err = ParseSSOProtocol(string(b))
+	return err
+}
+func (v SSOProtocol) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeUint(uint64(v))
+}
+func (v *SSOProtocol) DecodeMsgpack(dec *msgpack.Decoder) error {
+	n, err := dec.DecodeUint()
+	*v = SSOProtocol(n)
+	return err
+}
+
+// SSOConfig connects an account to its identity provider. Users signing in
+// via SSO are created on the fly, but only with emails in the account's
+// verified domains, so that the IdP cannot impersonate anyone else.
+type SSOConfig struct {
+	AccountID AccountID   `msgpack:"-"`
+	Protocol  SSOProtocol `msgpack:"p"`
+
+	OIDCIssuer       string `msgpack:"oi,omitempty"`
+	OIDCClientID     string `msgpack:"oc,omitempty"`
+	OIDCClientSecret string `msgpack:"os,omitempty"`
+
+	SAMLIdPEntityID    string `msgpack:"se,omitempty"`
+	SAMLIdPSSOURL      string `msgpack:"su,omitempty"`
+	SAMLIdPCertificate string `msgpack:"sc,omitempty"`
+
+	// GroupsAttribute is the OIDC claim or SAML attribute listing the
+	// user's groups; empty means the protocol's usual one.
+	GroupsAttribute string          `msgpack:"ga,omitempty"`
+	GroupRoles      []*SSOGroupRole `msgpack:"gr,omitempty"`
+
+	UpdateTime time.Time `msgpack:"@u"`
+}
+
+// SSOGroupRole gives members of an IdP group a role in the account.
+type SSOGroupRole struct {
+	Group string          `msgpack:"g"`
+	Role  UserAccountRole `msgpack:"r"`
+}
+
+func (c *SSOConfig) IsEnabled() bool {
+	return c != nil && c.Protocol != SSOProtocolNone
+}
+
+// RoleFor returns the role of the first mapping matching any of the groups,
+// or UserAccountRoleConsumer if none does.
+func (c *SSOConfig) RoleFor(groups []string) UserAccountRole {
+	for _, gr := range c.GroupRoles {
+		if slices.Contains(groups, gr.Group) {
+			return gr.Role
+		}
+	}
+	return UserAccountRoleConsumer
+}
+
+// ParseSSOGroupRoles parses “group = role” lines. Owners can only be
+// appointed by hand, so the IdP cannot hand out ownership.
+func ParseSSOGroupRoles(s string) ([]*SSOGroupRole, error) {
+	var result []*SSOGroupRole
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		group, roleStr, ok := strings.Cut(line, "=")
+		group, roleStr = strings.TrimSpace(group), strings.TrimSpace(roleStr)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid group mapping %q, expected “group = role”", line)
+		}
+		role, err := ParseUserAccountRole(strings.ToLower(roleStr))
+		if err != nil || role == UserAccountRoleNone {
+			return nil, fmt.Errorf("invalid role %q for group %q", roleStr, group)
+		}
+		if role == UserAccountRoleOwner {
+			return nil, fmt.Errorf("group %q cannot grant the owner role", group)
+		}
+		result = append(result, &SSOGroupRole{Group: group, Role: role})
+	}
+	return result, nil
+}
+
+func FormatSSOGroupRoles(roles []*SSOGroupRole) string {
+	var buf strings.Builder
+	for _, gr := range roles {
+		fmt.Fprintf(&buf, "%s = %v\n", gr.Group, gr.Role)
+	}
+	return buf.String()
+}
+
+// SSOLoginAttempt remembers an SSO sign-in between sending the user to the
+// IdP and them coming back. ID doubles as the OIDC state and the SAML
+// request ID.
+type SSOLoginAttempt struct {
+	ID           string    `msgpack:"-"`
+	AccountID    AccountID `msgpack:"a"`
+	Nonce        string    `msgpack:"n,omitempty"`
+	CodeVerifier string    `msgpack:"v,omitempty"`
+	CreationTime time.Time `msgpack:"@"`
+}
+
+func (a *SSOLoginAttempt) IsExpired(now time.Time, ttl time.Duration) bool {
+	return now.Sub(a.CreationTime) > ttl
+}
+
+// SAMLAssertion remembers a consumed SAML assertion until it expires, so that
+// a captured response cannot be used to sign in again.
+type SAMLAssertion struct {
+	ID         AccountStringKey `msgpack:"-"` // account and assertion ID
+	ExpiryTime time.Time        `msgpack:"exp"`
+}
+
+func (a *SAMLAssertion) IsExpired(now time.Time) bool {
+	return !now.Before(a.ExpiryTime)
+}
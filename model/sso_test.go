@@ -0,0 +1,52 @@
+package m
+
+import (
+	"testing"
+)
+
+func TestParseSSOGroupRoles(t *testing.T) {
+	roles, err := ParseSSOGroupRoles("\n  Admins = admin\nsupport team=Assistant\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, e := FormatSSOGroupRoles(roles), "Admins = admin\nsupport team = assistant\n"; a != e {
+		t.Errorf("got %q, wanted %q", a, e)
+	}
+
+	for _, input := range []string{
+		"admins",
+		"= admin",
+		"admins = superuser",
+		"admins = none",
+		"admins = owner",
+	} {
+		if _, err := ParseSSOGroupRoles(input); err == nil {
+			t.Errorf("ParseSSOGroupRoles(%q) succeeded, wanted an error", input)
+		}
+	}
+}
+
+func TestSSOConfigRoleFor(t *testing.T) {
+	c := &SSOConfig{
+		Protocol: SSOProtocolOIDC,
+		GroupRoles: []*SSOGroupRole{
+			{Group: "admins", Role: UserAccountRoleAdmin},
+			{Group: "support", Role: UserAccountRoleAssistant},
+		},
+	}
+	tests := []struct {
+		groups   []string
+		expected UserAccountRole
+	}{
+		{nil, UserAccountRoleConsumer},
+		{[]string{"everyone"}, UserAccountRoleConsumer},
+		{[]string{"support"}, UserAccountRoleAssistant},
+		{[]string{"support", "admins"}, UserAccountRoleAdmin},
+		{[]string{"Admins"}, UserAccountRoleConsumer},
+	}
+	for _, tt := range tests {
+		if a := c.RoleFor(tt.groups); a != tt.expected {
+			t.Errorf("RoleFor(%q) = %v, wanted %v", tt.groups, a, tt.expected)
+		}
+	}
+}
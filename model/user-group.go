@@ -0,0 +1,109 @@
+package m
+
+import (
+	"strings"
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+	"golang.org/x/exp/slices"
+)
+
+type UserGroupID = flake.ID
+
+// UserGroup is a named set of an account's members, typically a coaching
+// cohort. Members are listed in UserMembership.GroupIDs. Groups can open
+// restricted folders, replace the bot prompt and limit usage.
+type UserGroup struct {
+	ID           UserGroupID `msgpack:"-"`
+	AccountID    AccountID   `msgpack:"a"`
+	Name         string      `msgpack:"n"`
+	Prompt       string      `msgpack:"p,omitempty"`  // replaces the account's bot prompt for members
+	MonthlyLimit int         `msgpack:"ml,omitempty"` // questions per member per calendar month, zero means unlimited
+	CreationTime time.Time   `msgpack:"@"`
+}
+
+func (memb *UserMembership) InGroup(id UserGroupID) bool {
+	return memb != nil && slices.Contains(memb.GroupIDs, id)
+}
+
+// AddToGroup returns whether the membership has changed.
+func (memb *UserMembership) AddToGroup(id UserGroupID) bool {
+	if memb.InGroup(id) {
+		return false
+	}
+	memb.GroupIDs = append(memb.GroupIDs, id)
+	return true
+}
+
+// RemoveFromGroup returns whether the membership has changed.
+func (memb *UserMembership) RemoveFromGroup(id UserGroupID) bool {
+	i := slices.Index(memb.GroupIDs, id)
+	if i < 0 {
+		return false
+	}
+	memb.GroupIDs = slices.Delete(memb.GroupIDs, i, i+1)
+	return true
+}
+
+// FindUserGroup looks a group up by its case-insensitive name.
+func FindUserGroup(groups []*UserGroup, name string) *UserGroup {
+	name = strings.TrimSpace(name)
+	for _, g := range groups {
+		if strings.EqualFold(g.Name, name) {
+			return g
+		}
+	}
+	return nil
+}
+
+// PromptGroup returns the first of the member's groups that has a prompt.
+func PromptGroup(groups []*UserGroup, memb *UserMembership) *UserGroup {
+	if memb == nil {
+		return nil
+	}
+	for _, id := range memb.GroupIDs {
+		for _, g := range groups {
+			if g.ID == id && g.Prompt != "" {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// MonthlyLimit returns the strictest limit among the member's groups, or
+// zero if none of them limit usage.
+func MonthlyLimit(groups []*UserGroup, memb *UserMembership) int {
+	var limit int
+	for _, g := range groups {
+		if g.MonthlyLimit > 0 && memb.InGroup(g.ID) && (limit == 0 || g.MonthlyLimit < limit) {
+			limit = g.MonthlyLimit
+		}
+	}
+	return limit
+}
+
+// MonthStart returns the beginning of the calendar month (UTC) of t.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// QuestionsInMonth returns the number of questions asked in the calendar
+// month of now.
+func (memb *UserMembership) QuestionsInMonth(now time.Time) int {
+	if memb == nil || !memb.QuestionMonth.Equal(MonthStart(now)) {
+		return 0
+	}
+	return memb.QuestionCount
+}
+
+// CountQuestion records a question asked at now, restarting the count when
+// a new month begins.
+func (memb *UserMembership) CountQuestion(now time.Time) {
+	month := MonthStart(now)
+	if !memb.QuestionMonth.Equal(month) {
+		memb.QuestionMonth, memb.QuestionCount = month, 0
+	}
+	memb.QuestionCount++
+}
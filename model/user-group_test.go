@@ -0,0 +1,67 @@
+package m
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserGroupSettings(t *testing.T) {
+	groups := []*UserGroup{
+		{ID: 1, Name: "BC12"},
+		{ID: 2, Name: "BC13", Prompt: "Be brief.", MonthlyLimit: 50},
+		{ID: 3, Name: "Trial", Prompt: "Be nice.", MonthlyLimit: 10},
+	}
+	memb := &UserMembership{GroupIDs: []UserGroupID{1, 3, 2}}
+
+	if g := FindUserGroup(groups, " bc13 "); g == nil || g.ID != 2 {
+		t.Errorf("FindUserGroup = %v", g)
+	}
+	if g := PromptGroup(groups, memb); g == nil || g.ID != 3 {
+		t.Errorf("PromptGroup = %v, wanted Trial", g)
+	}
+	if a := MonthlyLimit(groups, memb); a != 10 {
+		t.Errorf("MonthlyLimit = %d, wanted 10", a)
+	}
+	if a := MonthlyLimit(groups, &UserMembership{GroupIDs: []UserGroupID{1}}); a != 0 {
+		t.Errorf("MonthlyLimit without limits = %d", a)
+	}
+
+	if memb.AddToGroup(1) || !memb.RemoveFromGroup(1) || memb.InGroup(1) || memb.RemoveFromGroup(1) {
+		t.Errorf("group membership changes misreported: %v", memb.GroupIDs)
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	a := MonthStart(time.Date(2024, 3, 31, 23, 59, 0, 0, time.UTC))
+	if e := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !a.Equal(e) {
+		t.Errorf("MonthStart = %v, wanted %v", a, e)
+	}
+}
+
+func TestCountQuestion(t *testing.T) {
+	march := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC)
+
+	memb := &UserMembership{}
+	if a := memb.QuestionsInMonth(march); a != 0 {
+		t.Errorf("QuestionsInMonth before any questions = %d, wanted 0", a)
+	}
+	memb.CountQuestion(march.Add(-48 * time.Hour))
+	memb.CountQuestion(march)
+	if a := memb.QuestionsInMonth(march); a != 2 {
+		t.Errorf("QuestionsInMonth(march) = %d, wanted 2", a)
+	}
+	if a := memb.QuestionsInMonth(april); a != 0 {
+		t.Errorf("QuestionsInMonth(april) = %d, wanted 0", a)
+	}
+	memb.CountQuestion(april)
+	if a := memb.QuestionsInMonth(april); a != 1 {
+		t.Errorf("QuestionsInMonth(april) after a question = %d, wanted 1", a)
+	}
+	if a := memb.QuestionsInMonth(march); a != 0 {
+		t.Errorf("QuestionsInMonth(march) after the count restarted = %d, wanted 0", a)
+	}
+	if a := (*UserMembership)(nil).QuestionsInMonth(april); a != 0 {
+		t.Errorf("QuestionsInMonth without a membership = %d, wanted 0", a)
+	}
+}
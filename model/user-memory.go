@@ -0,0 +1,95 @@
+package m
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andreyvit/mvp/flake"
+)
+
+type UserMemoryID = flake.ID
+
+// UserMemory is a fact the assistant remembers about a user across chats,
+// extracted from their conversations (or entered by the user).
+type UserMemory struct {
+	ID              UserMemoryID `msgpack:"-"`
+	AccountID       AccountID    `msgpack:"a"`
+	UserID          UserID       `msgpack:"u"`
+	Text            string       `msgpack:"t"`
+	SourceChatID    ChatID       `msgpack:"c,omitempty"`
+	CreationTime    time.Time    `msgpack:"@"`
+	UpdateTime      time.Time    `msgpack:"@u,omitempty"`
+	EditedByUser    bool         `msgpack:"ed,omitempty"`
+	EmbeddingAda002 Embedding    `msgpack:"e2,omitempty"`
+	EmbeddingHash   Embedding    `msgpack:"eh,omitempty"`
+}
+
+func (mem *UserMemory) Embedding(typ EmbeddingType) Embedding {
+	switch typ {
+	case EmbeddingTypeAda002:
+		return mem.EmbeddingAda002
+	case EmbeddingTypeHash:
+		return mem.EmbeddingHash
+	default:
+		panic(fmt.Errorf("invalid EmbeddingType %d", typ))
+	}
+}
+
+func (mem *UserMemory) SetEmbedding(typ EmbeddingType, emb Embedding) {
+	switch typ {
+	case EmbeddingTypeAda002:
+		mem.EmbeddingAda002 = emb
+	case EmbeddingTypeHash:
+		mem.EmbeddingHash = emb
+	default:
+		panic(fmt.Errorf("invalid EmbeddingType %d", typ))
+	}
+}
+
+// SetText replaces the text of the memory, dropping the now stale embeddings.
+func (mem *UserMemory) SetText(text string) {
+	mem.Text = text
+	mem.EmbeddingAda002 = nil
+	mem.EmbeddingHash = nil
+}
+
+// SelectMemories returns up to maxCount memories most similar to any of the
+// queries, best first, skipping the ones below minSimilarity and the ones
+// without an embedding of the given type.
+func SelectMemories(memories []*UserMemory, queries []Embedding, typ EmbeddingType, maxCount int, minSimilarity float64) []*UserMemory {
+	type scored struct {
+		mem *UserMemory
+		sim float64
+	}
+	var candidates []scored
+	for _, mem := range memories {
+		emb := mem.Embedding(typ)
+		if emb == nil {
+			continue
+		}
+		best := -1.0
+		for _, q := range queries {
+			if q == nil {
+				continue
+			}
+			if sim := CosineDistance(q, emb); sim > best {
+				best = sim
+			}
+		}
+		if best >= minSimilarity {
+			candidates = append(candidates, scored{mem, best})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].sim > candidates[j].sim
+	})
+	if len(candidates) > maxCount {
+		candidates = candidates[:maxCount]
+	}
+	result := make([]*UserMemory, len(candidates))
+	for i, c := range candidates {
+		result[i] = c.mem
+	}
+	return result
+}
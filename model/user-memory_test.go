@@ -0,0 +1,41 @@
+package m
+
+import "testing"
+
+func TestSelectMemories(t *testing.T) {
+	memory := func(id UserMemoryID, text string) *UserMemory {
+		mem := &UserMemory{ID: id, Text: text}
+		mem.SetEmbedding(EmbeddingTypeHash, HashEmbedding(text))
+		return mem
+	}
+	memories := []*UserMemory{
+		memory(1, "The user wants to run a marathon next spring."),
+		memory(2, "The user works night shifts as a nurse."),
+		memory(3, "The user is learning to plan their week on Sundays."),
+		{ID: 4, Text: "The user has no embedding yet."},
+	}
+	queries := []Embedding{HashEmbedding("How should I plan my week?")}
+
+	actual := SelectMemories(memories, queries, EmbeddingTypeHash, 2, -1)
+	if len(actual) != 2 || actual[0].ID != 3 {
+		t.Errorf("SelectMemories(2) = %v, wanted memory 3 first", memoryIDsOf(actual))
+	}
+
+	actual = SelectMemories(memories, queries, EmbeddingTypeHash, 10, -1)
+	if len(actual) != 3 {
+		t.Errorf("SelectMemories(10) = %v, wanted 3 memories with embeddings", memoryIDsOf(actual))
+	}
+
+	actual = SelectMemories(memories, queries, EmbeddingTypeHash, 10, 2)
+	if len(actual) != 0 {
+		t.Errorf("SelectMemories(minSimilarity=2) = %v, wanted none", memoryIDsOf(actual))
+	}
+}
+
+func memoryIDsOf(memories []*UserMemory) []UserMemoryID {
+	ids := make([]UserMemoryID, len(memories))
+	for i, mem := range memories {
+		ids[i] = mem.ID
+	}
+	return ids
+}
@@ -1,6 +1,8 @@
 package m
 
 import (
+	"bytes"
+	"encoding/base64"
 	"errors"
 	"strings"
 	"time"
@@ -21,6 +23,17 @@ type (
 		EmailNorm   string            `msgpack:"e!"`
 		Name        string            `msgpack:"n"`
 		LoginMsg    string            `msgpack:"msg,omitempty"`
+		Passkeys    []*UserPasskey    `msgpack:"pk,omitempty"`
+	}
+
+	// UserPasskey is a WebAuthn credential the user can sign in with.
+	UserPasskey struct {
+		ID           []byte    `msgpack:"id"`
+		PublicKey    []byte    `msgpack:"k"` // COSE_Key
+		SignCount    uint32    `msgpack:"sc,omitempty"`
+		Name         string    `msgpack:"n"`
+		CreationTime time.Time `msgpack:"@"`
+		LastUseTime  time.Time `msgpack:"@u,omitempty"`
 	}
 
 	AccountUserKey struct {
@@ -37,6 +50,12 @@ type (
 		Status       UserStatus      `msgpack:"t"`
 		Source       UserSource      `msgpack:"s,omitempty"`
 		Comment      UserSource      `msgpack:"c,omitempty"`
+		GroupIDs     []UserGroupID   `msgpack:"g,omitempty"`
+
+		// QuestionCount counts the questions asked in the calendar month
+		// starting at QuestionMonth, for group monthly limits.
+		QuestionMonth time.Time `msgpack:"qm,omitempty"`
+		QuestionCount int       `msgpack:"qc,omitempty"`
 	}
 )
 
@@ -83,6 +102,24 @@ func (u *User) Membership(accountID AccountID) *UserMembership {
 	return nil
 }
 
+func (u *User) Passkey(id []byte) *UserPasskey {
+	for _, pk := range u.Passkeys {
+		if bytes.Equal(pk.ID, id) {
+			return pk
+		}
+	}
+	return nil
+}
+
+// PasskeyKey is the string form of a passkey ID, for indexing.
+func PasskeyKey(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func (pk *UserPasskey) Key() string {
+	return PasskeyKey(pk.ID)
+}
+
 func (u *User) MembershipRole(accountID AccountID) UserAccountRole {
 	if accountID == 0 {
 		return UserAccountRoleNone
@@ -103,6 +140,10 @@ type UserSource int
 const (
 	UserSourceDefault   = UserSource(0)
 	UserSourceWhitelist = UserSource(1)
+	UserSourceWaitlist  = UserSource(2)
+	UserSourceSignup    = UserSource(3) // joined via the account's open sign-in link
+	UserSourceDomain    = UserSource(4) // joined by having an email in the account's verified domain
+	UserSourceSSO       = UserSource(5) // signed in via the account's identity provider
 )
 
 var (
@@ -117,60 +158,24 @@ func CanAccess(u *User, perm Permission, accountID AccountID, obj mvpm.Object) b
 }
 
 func CheckAccess(u *User, perm Permission, accountID AccountID, obj mvpm.Object) error {
+	if accountID == 0 && accountScopedPermissions.Has(perm) {
+		panic("zero account ID")
+	}
+	if SystemRolePermissions(u.Role).Has(perm) {
+		return nil
+	}
 	ar := u.MembershipRole(accountID)
+	if AccountRolePermissions(ar).Has(perm) {
+		return nil
+	}
 
-	switch perm {
-	case PermissionSwitchToAccount:
-		if accountID == 0 {
-			panic("zero account ID")
-		}
-		if u.Role.IsSuper() {
-			return nil
-		}
-		if ar != UserAccountRoleNone {
-			return nil
-		}
-		return ErrForbiddenWrongAccount
-	case PermissionAccessSuperadminArea:
-		if u.Role.IsSuper() {
-			return nil
-		}
-		return ErrForbiddenNotSuperadmin
-	case PermissionManageSuperadmins:
-		if u.Role == UserSystemRoleSuperadmin {
-			return nil
-		}
+	switch {
+	case superadminPermissions.Has(perm):
 		return ErrForbiddenNotSuperadmin
-	case PermissionAccessAdminArea:
-		if accountID == 0 {
-			panic("zero account ID")
-		}
-		if u.Role == UserSystemRoleSuperadmin {
-			return nil
-		}
-		switch ar {
-		case UserAccountRoleOwner, UserAccountRoleAdmin, UserAccountRoleAssistant:
-			return nil
-		case UserAccountRoleNone:
-			return ErrForbiddenWrongAccount
-		case UserAccountRoleConsumer:
-			return ErrForbiddenNotStaff
-		}
-	case PermissionManageAccount:
-		if accountID == 0 {
-			panic("zero account ID")
-		}
-		if u.Role == UserSystemRoleSuperadmin {
-			return nil
-		}
-		switch ar {
-		case UserAccountRoleOwner, UserAccountRoleAdmin:
-			return nil
-		case UserAccountRoleNone:
-			return ErrForbiddenWrongAccount
-		case UserAccountRoleConsumer:
-			return ErrForbiddenNotStaff
-		}
+	case ar == UserAccountRoleNone && accountScopedPermissions.Has(perm):
+		return ErrForbiddenWrongAccount
+	case ar == UserAccountRoleConsumer && accountScopedPermissions.Has(perm):
+		return ErrForbiddenNotStaff
 	}
 	return ErrForbiddenOther
 }
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	"golang.org/x/exp/slices"
+
+	"github.com/andreyvit/buddyd/internal/webauthn"
+	m "github.com/andreyvit/buddyd/model"
+)
+
+const (
+	passkeyChallengeCookie = "passkey_challenge"
+	maxPasskeyNameLen      = 64
+)
+
+func (app *App) relyingParty() *webauthn.RelyingParty {
+	u := must(url.Parse(app.Settings().BaseURL))
+	return &webauthn.RelyingParty{
+		ID:     u.Hostname(),
+		Name:   "LibroAI",
+		Origin: u.Scheme + "://" + u.Host,
+	}
+}
+
+// passkeyUserHandle is the WebAuthn user ID of the user; the browser hands it
+// back when signing in with a discoverable credential.
+func passkeyUserHandle(u *m.User) []byte {
+	return []byte(u.ID.String())
+}
+
+type PasskeyCeremonyData struct {
+	Mode      string // create or get
+	Options   string // JSON
+	Action    string
+	AccountID m.AccountID
+}
+
+// newPasskeyChallenge stores a challenge and ties it to the browser via a
+// cookie, so that an attacker can't complete a ceremony in someone else's
+// browser (e.g. to sign them into the attacker's account).
+func (app *App) newPasskeyChallenge(rc *mvp.RC, userID m.UserID, name string) []byte {
+	challenge := webauthn.NewChallenge()
+	ch := &m.PasskeyChallenge{
+		Challenge:    webauthn.EncodeBase64URL(challenge),
+		UserID:       userID,
+		Name:         name,
+		CreationTime: rc.Now,
+	}
+	edb.Put(rc, ch)
+	http.SetCookie(rc.RespWriter, &http.Cookie{
+		Name:     passkeyChallengeCookie,
+		Value:    ch.Challenge,
+		Path:     "/",
+		MaxAge:   int(webauthn.Timeout.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return challenge
+}
+
+// takePasskeyChallenge consumes the challenge handed out to this browser.
+func (app *App) takePasskeyChallenge(rc *mvp.RC) *m.PasskeyChallenge {
+	cookie, err := rc.Request.Request.Cookie(passkeyChallengeCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	http.SetCookie(rc.RespWriter, &http.Cookie{
+		Name:     passkeyChallengeCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	ch := edb.Get[m.PasskeyChallenge](rc, cookie.Value)
+	if ch == nil {
+		return nil
+	}
+	rc.DBTx().DeleteByKey(PasskeyChallenges, ch.Challenge)
+	if rc.Now.Sub(ch.CreationTime) > webauthn.Timeout {
+		return nil
+	}
+	return ch
+}
+
+func decodePasskeyFields(fields ...string) ([][]byte, error) {
+	result := make([][]byte, len(fields))
+	for i, f := range fields {
+		b, err := webauthn.DecodeBase64URL(f)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = b
+	}
+	return result, nil
+}
+
+func (app *App) startPasskeySignIn(rc *mvp.RC, in *struct {
+	AccountID flake.ID `json:"account"`
+}) (any, error) {
+	challenge := app.newPasskeyChallenge(rc, 0, "")
+	return &mvp.ViewData{
+		View:   "accounts/passkey",
+		Title:  "Sign In",
+		Layout: "bare",
+		Data: &PasskeyCeremonyData{
+			Mode:      "get",
+			Options:   string(must(json.Marshal(app.relyingParty().RequestOptions(challenge)))),
+			Action:    app.URL("signin.passkey.verify"),
+			AccountID: in.AccountID,
+		},
+	}, nil
+}
+
+func (app *App) handlePasskeySignIn(rc *mvp.RC, in *struct {
+	AccountID         flake.ID `json:"account"`
+	CredentialID      string   `json:"credential_id"`
+	ClientData        string   `json:"client_data"`
+	AuthenticatorData string   `json:"authenticator_data"`
+	Signature         string   `json:"signature"`
+	UserHandle        string   `json:"user_handle"`
+}) (any, error) {
+	ch := app.takePasskeyChallenge(rc)
+	if ch == nil || ch.UserID != 0 {
+		return app.signInFailure(in.AccountID, "Your passkey sign-in has expired. Please try again."), nil
+	}
+	fields, err := decodePasskeyFields(in.CredentialID, in.ClientData, in.AuthenticatorData, in.Signature, in.UserHandle)
+	if err != nil {
+		return nil, httperrors.BadRequest.Msg("invalid passkey response")
+	}
+	credID, clientData, authData, sig, userHandle := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	u := edb.Lookup[m.User](rc, UsersByPasskey, m.PasskeyKey(credID))
+	if u == nil || (len(userHandle) > 0 && string(userHandle) != string(passkeyUserHandle(u))) {
+		return app.signInFailure(in.AccountID, "This passkey is not registered. Sign in with an email code, then add it on the Passkeys page."), nil
+	}
+	pk := u.Passkey(credID)
+	challenge := must(webauthn.DecodeBase64URL(ch.Challenge))
+	count, err := app.relyingParty().VerifyAssertion(challenge, &webauthn.Credential{
+		ID:        pk.ID,
+		PublicKey: pk.PublicKey,
+		SignCount: pk.SignCount,
+	}, clientData, authData, sig)
+	if errors.Is(err, webauthn.ErrCounterRegressed) {
+		flogger.Log(rc, "WARNING: passkey %q of %s may have been cloned: signature counter %d did not increase", pk.Name, u.Email, pk.SignCount)
+		return app.signInFailure(in.AccountID, "This passkey looks like a copy and cannot be used. Sign in with an email code instead."), nil
+	} else if err != nil {
+		flogger.Log(rc, "Passkey sign-in of %s failed: %v", u.Email, err)
+		return app.signInFailure(in.AccountID, "Passkey sign-in failed. Please try again."), nil
+	}
+	pk.SignCount = count
+	pk.LastUseTime = rc.Now
+	edb.Put(rc, u)
+
+	flogger.Log(rc, "Signed in as %s with passkey %q", u.Email, pk.Name)
+	app.startSession(rc, u, in.AccountID)
+	return app.openApp(fullRC.From(rc))
+}
+
+func (app *App) listPasskeys(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	passkeys := append([]*m.UserPasskey(nil), rc.User.Passkeys...)
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].CreationTime.After(passkeys[j].CreationTime)
+	})
+	return &mvp.ViewData{
+		View:         "accounts/passkeys",
+		Title:        "Passkeys",
+		SemanticPath: "account/passkeys",
+		Data: struct {
+			Passkeys []*m.UserPasskey
+		}{
+			Passkeys: passkeys,
+		},
+	}, nil
+}
+
+func (app *App) startPasskeyRegistration(rc *RC, in *struct {
+	Name string `json:"name"`
+}) (any, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if utf8.RuneCountInString(name) > maxPasskeyNameLen {
+		return nil, httperrors.BadRequest.Msg("passkey name is too long")
+	}
+	u := rc.User
+	exclude := make([][]byte, len(u.Passkeys))
+	for i, pk := range u.Passkeys {
+		exclude[i] = pk.ID
+	}
+	challenge := app.newPasskeyChallenge(&rc.RC, u.ID, name)
+	opts := app.relyingParty().CreationOptions(challenge, webauthn.User{
+		ID:          passkeyUserHandle(u),
+		Name:        u.Email,
+		DisplayName: u.Name,
+	}, exclude)
+	return &mvp.ViewData{
+		View:   "accounts/passkey",
+		Title:  "Add Passkey",
+		Layout: "bare",
+		Data: &PasskeyCeremonyData{
+			Mode:    "create",
+			Options: string(must(json.Marshal(opts))),
+			Action:  app.URL("passkeys.register"),
+		},
+	}, nil
+}
+
+func (app *App) registerPasskey(rc *RC, in *struct {
+	ClientData        string `json:"client_data"`
+	AttestationObject string `json:"attestation_object"`
+}) (any, error) {
+	u := rc.User
+	ch := app.takePasskeyChallenge(&rc.RC)
+	if ch == nil || ch.UserID != u.ID {
+		return nil, httperrors.BadRequest.Msg("This passkey request has expired. Please try again.")
+	}
+	fields, err := decodePasskeyFields(in.ClientData, in.AttestationObject)
+	if err != nil {
+		return nil, httperrors.BadRequest.Msg("invalid passkey response")
+	}
+	challenge := must(webauthn.DecodeBase64URL(ch.Challenge))
+	cred, err := app.relyingParty().VerifyRegistration(challenge, fields[0], fields[1])
+	if err != nil {
+		flogger.Log(rc, "Passkey registration of %s failed: %v", u.Email, err)
+		return nil, httperrors.BadRequest.Msg("The passkey could not be registered: " + err.Error())
+	}
+	if edb.Lookup[m.User](rc, UsersByPasskey, m.PasskeyKey(cred.ID)) != nil {
+		return nil, httperrors.BadRequest.Msg("This passkey is already registered.")
+	}
+	u.Passkeys = append(u.Passkeys, &m.UserPasskey{
+		ID:           cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		Name:         ch.Name,
+		CreationTime: rc.Now,
+	})
+	edb.Put(rc, u)
+	flogger.Log(rc, "Registered passkey %q for %s", ch.Name, u.Email)
+	return app.Redirect("passkeys.list"), nil
+}
+
+func (app *App) deletePasskey(rc *RC, in *struct {
+	PasskeyKey string `form:"passkey,path" json:"-"`
+}) (any, error) {
+	u := rc.User
+	i := slices.IndexFunc(u.Passkeys, func(pk *m.UserPasskey) bool {
+		return pk.Key() == in.PasskeyKey
+	})
+	if i < 0 {
+		return nil, httperrors.Errorf(404, "", "Passkey not found")
+	}
+	u.Passkeys = slices.Delete(u.Passkeys, i, i+1)
+	edb.Put(rc, u)
+	return app.Redirect("passkeys.list"), nil
+}
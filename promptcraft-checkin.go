@@ -0,0 +1,24 @@
+package main
+
+import m "github.com/andreyvit/buddyd/model"
+
+const (
+	// checkInHistoryTurns is the number of recent turns of the check-in chat
+	// shown to the model, so that consecutive check-ins build on each other.
+	checkInHistoryTurns = 6
+
+	checkInFormatPrompt = `Write a single short message (2-4 sentences) to the user, addressing them by first name. It is sent unprompted, so don't reply to anything, and end with one question the user can answer.`
+)
+
+var defaultCheckInTemplates = map[m.CheckInKind]string{
+	m.CheckInKindDailyPlan:    `You are a productivity coach checking in with the user in the morning. Help them pick the one most important thing to get done today and plan when they will do it. If they shared a plan in earlier check-ins, ask how it went.`,
+	m.CheckInKindWeeklyReview: `You are a productivity coach running the user's weekly review. Invite them to look back at the past week: what went well, what didn't, and what they'll focus on next week.`,
+}
+
+// checkInTemplateFor returns the account's check-in prompt for kind, falling back to the default one.
+func checkInTemplateFor(account *m.Account, kind m.CheckInKind) string {
+	if t := account.CheckInTemplates[kind.String()]; t != "" {
+		return t
+	}
+	return defaultCheckInTemplates[kind]
+}
@@ -0,0 +1,39 @@
+package main
+
+import "encoding/json"
+
+const (
+	memoryExtractionSystemPrompt = `You maintain long-term memory of a coaching assistant about its user. From the conversation below, extract new durable facts worth remembering in future conversations: the user's goals, circumstances, preferences, routines, commitments and notable progress. Do not repeat what is already remembered, do not record small talk or the assistant's advice, and skip anything sensitive the user would not expect to be remembered. Each fact must be a short standalone sentence in third person ("The user ..."). Return an empty list if there is nothing new.`
+	memoryExtractionFuncName     = "remember_facts"
+
+	memoryPromptIntro = "What you remember about the user from earlier conversations:"
+
+	// MaxMemoriesInPrompt is the number of user memories included in the system prompt.
+	MaxMemoriesInPrompt = 8
+	// memoryExtractionMinTurns is the number of new turns that makes a chat worth extracting memories from.
+	memoryExtractionMinTurns = 6
+)
+
+type MemoryExtractionFuncResult struct {
+	Facts []string `json:"facts"`
+}
+
+var (
+	memoryExtractionFunc = json.RawMessage(`{
+		"name": "remember_facts",
+		"description": "Save new facts about the user to long-term memory.",
+		"parameters": {
+			"type": "object",
+			"required": [
+				"facts"
+			],
+			"properties": {
+				"facts": {
+					"type": "array",
+					"items": {"type": "string"},
+					"description": "new standalone facts, possibly empty"
+				}
+			}
+		}
+	}`)
+)
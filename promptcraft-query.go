@@ -0,0 +1,40 @@
+package main
+
+import "encoding/json"
+
+const (
+	queryRewriteSystemPrompt = `You turn the latest user message of a coaching conversation into a standalone search query for a knowledge base. Resolve pronouns and references to earlier messages, keep the user's language, drop greetings and filler. If the message asks about several distinct topics, also list them as separate sub-queries.`
+	queryRewriteFuncName     = "set_search_queries"
+
+	// queryRewriteHistoryTurns is the number of recent turns shown to the rewriter.
+	queryRewriteHistoryTurns = 6
+)
+
+type QueryRewriteFuncResult struct {
+	Query      string   `json:"query"`
+	SubQueries []string `json:"sub_queries"`
+}
+
+var (
+	queryRewriteFunc = json.RawMessage(`{
+		"name": "set_search_queries",
+		"description": "Set the search queries used to find relevant knowledge base entries.",
+		"parameters": {
+			"type": "object",
+			"required": [
+				"query"
+			],
+			"properties": {
+				"query": {
+					"type": "string",
+					"description": "standalone search query for the latest user message"
+				},
+				"sub_queries": {
+					"type": "array",
+					"items": {"type": "string"},
+					"description": "separate queries for distinct topics, if any"
+				}
+			}
+		}
+	}`)
+)
@@ -0,0 +1,35 @@
+package main
+
+import "encoding/json"
+
+const (
+	rerankSystemPrompt = `You judge how useful each numbered knowledge base passage is for answering the user's query. Rate every passage from 0 (irrelevant) to 10 (directly answers the query), in the order given.`
+	rerankFuncName     = "set_relevance_scores"
+
+	// rerankPassageChars limits the length of each passage shown to the LLM judge.
+	rerankPassageChars = 800
+)
+
+type RerankFuncResult struct {
+	Scores []float64 `json:"scores"`
+}
+
+var (
+	rerankFunc = json.RawMessage(`{
+		"name": "set_relevance_scores",
+		"description": "Set the relevance scores of the passages.",
+		"parameters": {
+			"type": "object",
+			"required": [
+				"scores"
+			],
+			"properties": {
+				"scores": {
+					"type": "array",
+					"items": {"type": "number"},
+					"description": "one score from 0 to 10 per passage, in order"
+				}
+			}
+		}
+	}`)
+)
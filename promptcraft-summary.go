@@ -0,0 +1,7 @@
+package main
+
+const (
+	chatSummarySystemPrompt = `You maintain a running summary of a coaching conversation between a user and an assistant. Merge the previous summary (if any) with the new part of the conversation into a single updated summary. Keep the user's goals, circumstances, decisions, commitments and open questions; drop pleasantries. Write in the language of the conversation, in third person, max 150 words.`
+
+	chatSummaryIntro = "Summary of the earlier part of this conversation:\n\n"
+)
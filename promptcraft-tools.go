@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	toolChoiceSystemPrompt = `You are deciding how the assistant should proceed with the conversation below before it writes its answer. If a tool would help answer the user's latest message, call it; otherwise choose "answer". Do not call the same tool with the same arguments twice. Available tools:`
+	toolChoiceFuncName     = "next_step"
+	toolChoiceAnswer       = "answer"
+
+	// MaxToolCallsPerAnswer limits the number of tool calls made before answering.
+	MaxToolCallsPerAnswer = 3
+	// MaxToolResultTokenCount limits the size of a tool result fed back to the model.
+	MaxToolResultTokenCount = 800
+)
+
+// ToolArgs is the union of the arguments taken by all tools.
+type ToolArgs struct {
+	Query  string `json:"query,omitempty"`
+	Folder string `json:"folder,omitempty"`
+	Item   string `json:"item,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Days   int    `json:"days,omitempty"`
+}
+
+func toolChoiceSystemPromptFor(tools []*chatTool) string {
+	var buf strings.Builder
+	buf.WriteString(toolChoiceSystemPrompt)
+	for _, tool := range tools {
+		fmt.Fprintf(&buf, "\n- %s: %s", tool.Name, tool.Description)
+	}
+	return buf.String()
+}
+
+func toolChoiceFuncFor(tools []*chatTool) json.RawMessage {
+	names := []string{toolChoiceAnswer}
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	return must(json.Marshal(map[string]any{
+		"name":        toolChoiceFuncName,
+		"description": "Call a tool, or proceed to answering.",
+		"parameters": map[string]any{
+			"type":     "object",
+			"required": []string{"tool"},
+			"properties": map[string]any{
+				"tool":   map[string]any{"type": "string", "enum": names},
+				"query":  map[string]any{"type": "string", "description": "search query"},
+				"folder": map[string]any{"type": "string", "description": "library folder name"},
+				"item":   map[string]any{"type": "string", "description": "library item name"},
+				"text":   map[string]any{"type": "string", "description": "reminder text"},
+				"days":   map[string]any{"type": "integer", "description": "number of days from now"},
+			},
+		},
+	}))
+}
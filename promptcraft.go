@@ -10,8 +10,9 @@ import (
 )
 
 const (
-	MaxContextEntries          = 15
-	MaxContextDistance float64 = 1e6
+	MaxContextEntries            = 15
+	MaxContextDistance   float64 = 1e6
+	RecommendedMMRLambda float64 = 0.7 // for accounts that opt into MMR; off by default
 )
 
 const (
@@ -19,6 +20,45 @@ const (
 	prompt1   = `You are a helpful assistant bot made by productivity coach Demir Bentley, founder of LifeHack Bootcamp and LifeHack Method. You are responding as Demir. Answer comprehensively. Be concise, but comprehensive. Use the information below. || Help the user concicely.`
 )
 
+var defaultRetrievalSettings = m.RetrievalSettings{
+	MaxEntries:      MaxContextEntries,
+	MaxDistance:     MaxContextDistance,
+	MaxPromptTokens: MaxSystemPromptTokenCount,
+}
+
+// promptTemplateFor returns the group's or the account's bot prompt, falling back to the default one,
+// prefixed with the assistant name and default language from the account settings.
+// The group is nil unless the chat author belongs to a group with its own prompt.
+func promptTemplateFor(account *m.Account, group *m.UserGroup) string {
+	var preamble string
+	if account.Branding.AssistantName != "" {
+		preamble += "Your name is " + account.Branding.AssistantName + ". "
+	}
+	if account.Language != "" {
+		preamble += "Answer in " + account.Language + " unless the user writes in another language. "
+	}
+	if group != nil && group.Prompt != "" {
+		return preamble + group.Prompt
+	}
+	return preamble + editablePromptFor(account)
+}
+
+// editablePromptFor returns the account's bot prompt as edited in the settings.
+func editablePromptFor(account *m.Account) string {
+	if account.Prompt != "" {
+		return account.Prompt
+	}
+	return prompt1
+}
+
+func retrievalSettingsFor(opts m.RetrievalOptions) m.RetrievalSettings {
+	rs := defaultRetrievalSettings
+	if opts.MMRLambda != 0 {
+		rs.MMRLambda = opts.MMRLambda
+	}
+	return rs
+}
+
 // [CONTEXT]
 
 // Answer user's question using the above information where possible. Be concise, but comprehensive.
@@ -31,40 +71,59 @@ type PromptResult struct {
 	Prompt            string
 	ContextContentIDs []m.ContentID
 	ContextDistances  []float64
+	ContextScores     []float64
+	MemoryIDs         []m.UserMemoryID
 }
 
-func (app *App) BuildSystemPrompt(rc *RC, prompt string, cc *m.ChatContent, beforeTurnIndex int, embs *m.AccountEmbeddings) (PromptResult, error) {
-	var result PromptResult
-
-	prefix, suffix, _ := strings.Cut(prompt, "||")
-	prefix = strings.TrimSpace(prefix)
-	suffix = strings.TrimSpace(suffix)
+// RetrieveContext finds the content entries relevant to the chat, best first.
+// If rewrittenQueries is empty, retrieval uses the first and the last user messages.
+func RetrieveContext(cc *m.ChatContent, beforeTurnIndex int, embs *m.AccountEmbeddings, rewrittenQueries []m.Embedding, rs m.RetrievalSettings) m.EntriesAndDistances {
+	return embs.SelectForQueries(RetrievalQueries(cc, beforeTurnIndex, embs.Type, rewrittenQueries), rs)
+}
 
-	m1 := cc.FirstUserMessage(beforeTurnIndex)
-	m2 := cc.LastUserMessage(beforeTurnIndex)
+// RetrievalQueries returns rewrittenQueries if any, otherwise the embeddings
+// of the first and the last user messages.
+func RetrievalQueries(cc *m.ChatContent, beforeTurnIndex int, typ m.EmbeddingType, rewrittenQueries []m.Embedding) []m.Embedding {
+	queries := rewrittenQueries
+	if len(queries) == 0 {
+		m1 := cc.FirstUserMessage(beforeTurnIndex)
+		m2 := cc.LastUserMessage(beforeTurnIndex)
 
-	// flogger.Log(rc, "First message: %v", m1.Text)
-	// flogger.Log(rc, "Last message: %v", m2.Text)
+		// flogger.Log(rc, "First message: %v", m1.Text)
+		// flogger.Log(rc, "Last message: %v", m2.Text)
 
-	var entries m.EntriesAndDistances
-	if m1 != nil {
-		ed := embs.Select(m1.EmbeddingAda002, MaxContextEntries, MaxContextDistance)
-		// flogger.Log(rc, "First message context: %d", len(ed.Entries))
-		entries.AppendAll(ed)
-		// flogger.Log(rc, "Total context: %d", len(entries.Entries))
+		if m1 != nil {
+			queries = append(queries, m1.Embedding(typ))
+		}
+		if m2 != nil && m2 != m1 {
+			queries = append(queries, m2.Embedding(typ))
+		}
 	}
-	if m2 != nil && m2 != m1 {
-		ed := embs.Select(m2.EmbeddingAda002, MaxContextEntries, MaxContextDistance)
-		// flogger.Log(rc, "Second message context: %d", len(ed.Entries))
-		entries.AppendAll(ed)
-		// flogger.Log(rc, "Total context: %d", len(entries.Entries))
-		entries = entries.SelectTop(MaxContextEntries, MaxContextDistance)
-		// flogger.Log(rc, "Trimmed context: %d", len(entries.Entries))
+	return queries
+}
+
+// BuildSystemPrompt inserts as many of the given context entries into prompt
+// as fit into the token budget. scores are the optional reranker scores of entries.
+// memories are the facts about the user to remind the model of, if any.
+func (app *App) BuildSystemPrompt(rc *RC, prompt string, entries m.EntriesAndDistances, scores []float64, memories []*m.UserMemory) (PromptResult, error) {
+	var result PromptResult
+
+	frame := splitPrompt(prompt)
+	prefix, suffix := frame.Prefix, frame.Suffix
+	if len(memories) > 0 {
+		prefix += "\n\n" + formatPromptMemories(memories)
+		for _, mem := range memories {
+			result.MemoryIDs = append(result.MemoryIDs, mem.ID)
+		}
 	}
 
 	distancesByContentID := entries.DistancesByContentID()
+	scoresByContentID := make(map[m.ContentID]float64, len(scores))
+	for i, score := range scores {
+		scoresByContentID[entries.Entries[i].ContentID] = score
+	}
 
-	includedEntries, _ := m.PickContext(prefix, suffix, promptSep, MaxSystemPromptTokenCount, entries.Entries, DefaultModel)
+	includedEntries, _ := m.PickContext(prefix, suffix, promptSep, defaultRetrievalSettings.MaxPromptTokens, entries.Entries, DefaultModel)
 	includedContent := make([]*m.Content, 0, len(includedEntries))
 
 	app.MustRead(rc.BaseRC(), func() {
@@ -74,6 +133,9 @@ func (app *App) BuildSystemPrompt(rc *RC, prompt string, cc *m.ChatContent, befo
 				includedContent = append(includedContent, c)
 				result.ContextContentIDs = append(result.ContextContentIDs, c.ID)
 				result.ContextDistances = append(result.ContextDistances, distancesByContentID[c.ID])
+				if scores != nil {
+					result.ContextScores = append(result.ContextScores, scoresByContentID[c.ID])
+				}
 			} else {
 				flogger.Log(rc, "WARNING: entry refers to missing content %v (item %v)", e.ContentID, e.ItemID)
 			}
@@ -83,3 +145,12 @@ func (app *App) BuildSystemPrompt(rc *RC, prompt string, cc *m.ChatContent, befo
 	result.Prompt = m.InsertMessageContent(prefix, suffix, promptSep, includedContent)
 	return result, nil
 }
+
+func splitPrompt(prompt string) m.PromptFrame {
+	prefix, suffix, _ := strings.Cut(prompt, "||")
+	return m.PromptFrame{
+		Prefix: strings.TrimSpace(prefix),
+		Suffix: strings.TrimSpace(suffix),
+		Sep:    promptSep,
+	}
+}
@@ -12,6 +12,10 @@ var (
 	}, func(tx *edb.Tx, row *m.UserSignInAttempt, oldVer uint64) {
 	}, []*edb.Index{})
 
+	PasskeyChallenges = edb.AddTable[m.PasskeyChallenge](dbSchema, "passkey_challenges", 1, func(row *m.PasskeyChallenge, ib *edb.IndexBuilder) {
+	}, func(tx *edb.Tx, row *m.PasskeyChallenge, oldVer uint64) {
+	}, []*edb.Index{})
+
 	Accounts = edb.AddTable(dbSchema, "accounts", 1, func(row *m.Account, ib *edb.IndexBuilder) {
 	}, func(tx *edb.Tx, row *m.Account, oldVer uint64) {
 	}, []*edb.Index{})
@@ -21,13 +25,18 @@ var (
 			ib.Add(UsersByAccount, m.AccountID)
 		}
 		ib.Add(UsersByEmail, row.EmailNorm)
+		for _, pk := range row.Passkeys {
+			ib.Add(UsersByPasskey, pk.Key())
+		}
 	}, func(tx *edb.Tx, row *m.User, oldVer uint64) {
 	}, []*edb.Index{
 		UsersByAccount,
 		UsersByEmail,
+		UsersByPasskey,
 	})
 	UsersByAccount = edb.AddIndex[flake.ID]("by_account")
 	UsersByEmail   = edb.AddIndex[string]("by_email")
+	UsersByPasskey = edb.AddIndex[string]("by_passkey")
 
 	// Superadmins = edb.AddTable(dbSchema, "superadmins", 1, func(row *m.Superadmin, ib *edb.IndexBuilder) {
 	// 	ib.Add(SuperadminsByEmail, row.EmailNorm)
@@ -62,15 +71,20 @@ var (
 		ib.Add(ChatsByAccount, row.AccountID)
 		ib.Add(ChatsByUser, row.UserID)
 		ib.Add(ChatsByAccountUser, m.AccountUser(row.AccountID, row.UserID))
+		if row.ExternalThread != "" {
+			ib.Add(ChatsByExternalThread, row.ExternalThread)
+		}
 	}, func(tx *edb.Tx, row *m.Chat, oldVer uint64) {
 	}, []*edb.Index{
 		ChatsByUser,
 		ChatsByAccount,
 		ChatsByAccountUser,
+		ChatsByExternalThread,
 	})
-	ChatsByAccount     = edb.AddIndex[m.AccountID]("by_account")
-	ChatsByUser        = edb.AddIndex[m.UserID]("by_user")
-	ChatsByAccountUser = edb.AddIndex[m.AccountUserKey]("by_au")
+	ChatsByAccount        = edb.AddIndex[m.AccountID]("by_account")
+	ChatsByUser           = edb.AddIndex[m.UserID]("by_user")
+	ChatsByAccountUser    = edb.AddIndex[m.AccountUserKey]("by_au")
+	ChatsByExternalThread = edb.AddIndex[string]("by_ext")
 
 	ChatContent = edb.AddTable(dbSchema, "chat_content_02", 1, func(row *m.ChatContent, ib *edb.IndexBuilder) {
 	}, func(tx *edb.Tx, row *m.ChatContent, oldVer uint64) {
@@ -121,4 +135,149 @@ var (
 	})
 	EmbeddingsByAccountType = edb.AddIndex[m.ContentEmbeddingAccountTypeKey]("by_account_type")
 	EmbeddingsByItem        = edb.AddIndex[m.ItemID]("by_item")
+
+	EmbeddingMigrations = edb.AddTable(dbSchema, "embedding_migrations", 1, func(row *m.EmbeddingMigration, ib *edb.IndexBuilder) {
+	}, func(tx *edb.Tx, row *m.EmbeddingMigration, oldVer uint64) {
+	}, []*edb.Index{})
+
+	GoldenSets = edb.AddTable(dbSchema, "golden_sets", 1, func(row *m.GoldenSet, ib *edb.IndexBuilder) {
+		ib.Add(GoldenSetsByAccount, row.AccountID)
+	}, func(tx *edb.Tx, row *m.GoldenSet, oldVer uint64) {
+	}, []*edb.Index{
+		GoldenSetsByAccount,
+	})
+	GoldenSetsByAccount = edb.AddIndex[m.AccountID]("by_account")
+
+	AnswerRecordings = edb.AddTable(dbSchema, "answer_recordings", 1, func(row *m.AnswerRecording, ib *edb.IndexBuilder) {
+		ib.Add(AnswerRecordingsByAccount, row.AccountID)
+		ib.Add(AnswerRecordingsByChat, row.ChatID)
+	}, func(tx *edb.Tx, row *m.AnswerRecording, oldVer uint64) {
+	}, []*edb.Index{
+		AnswerRecordingsByAccount,
+		AnswerRecordingsByChat,
+	},
+		edb.SuppressContentWhenLogging)
+	AnswerRecordingsByAccount = edb.AddIndex[m.AccountID]("by_account")
+	AnswerRecordingsByChat    = edb.AddIndex[m.ChatID]("by_chat")
+
+	ReplayRuns = edb.AddTable(dbSchema, "replay_runs", 1, func(row *m.ReplayRun, ib *edb.IndexBuilder) {
+		ib.Add(ReplayRunsByAccount, row.AccountID)
+	}, func(tx *edb.Tx, row *m.ReplayRun, oldVer uint64) {
+	}, []*edb.Index{
+		ReplayRunsByAccount,
+	},
+		edb.SuppressContentWhenLogging)
+	ReplayRunsByAccount = edb.AddIndex[m.AccountID]("by_account")
+
+	ContentDuplicates = edb.AddTable(dbSchema, "content_duplicates", 1, func(row *m.ContentDuplicate, ib *edb.IndexBuilder) {
+		ib.Add(ContentDuplicatesByAccount, row.AccountID)
+		ib.Add(ContentDuplicatesByPair, row.PairKey())
+	}, func(tx *edb.Tx, row *m.ContentDuplicate, oldVer uint64) {
+	}, []*edb.Index{
+		ContentDuplicatesByAccount,
+		ContentDuplicatesByPair,
+	})
+	ContentDuplicatesByAccount = edb.AddIndex[m.AccountID]("by_account")
+	ContentDuplicatesByPair    = edb.AddIndex[m.ContentPairKey]("by_pair")
+
+	ChatNotes = edb.AddTable(dbSchema, "chat_notes", 1, func(row *m.ChatNote, ib *edb.IndexBuilder) {
+		ib.Add(ChatNotesByChat, row.ChatID)
+	}, func(tx *edb.Tx, row *m.ChatNote, oldVer uint64) {
+	}, []*edb.Index{
+		ChatNotesByChat,
+	},
+		edb.SuppressContentWhenLogging)
+	ChatNotesByChat = edb.AddIndex[m.ChatID]("by_chat")
+
+	UserMemories = edb.AddTable(dbSchema, "user_memories", 1, func(row *m.UserMemory, ib *edb.IndexBuilder) {
+		ib.Add(UserMemoriesByAccountUser, m.AccountUser(row.AccountID, row.UserID))
+	}, func(tx *edb.Tx, row *m.UserMemory, oldVer uint64) {
+	}, []*edb.Index{
+		UserMemoriesByAccountUser,
+	},
+		edb.SuppressContentWhenLogging)
+	UserMemoriesByAccountUser = edb.AddIndex[m.AccountUserKey]("by_au")
+
+	Reminders = edb.AddTable(dbSchema, "reminders", 1, func(row *m.Reminder, ib *edb.IndexBuilder) {
+		ib.Add(RemindersByAccountUser, m.AccountUser(row.AccountID, row.UserID))
+		if !row.IsSent() {
+			ib.Add(RemindersByDueTime, uint64(row.DueTime.Unix()))
+		}
+	}, func(tx *edb.Tx, row *m.Reminder, oldVer uint64) {
+	}, []*edb.Index{
+		RemindersByAccountUser,
+		RemindersByDueTime,
+	})
+	RemindersByAccountUser = edb.AddIndex[m.AccountUserKey]("by_au")
+	RemindersByDueTime     = edb.AddIndex[uint64]("by_due") // unsent only
+
+	CheckInSchedules = edb.AddTable(dbSchema, "checkin_schedules", 1, func(row *m.CheckInSchedule, ib *edb.IndexBuilder) {
+		ib.Add(CheckInSchedulesByAccountUser, m.AccountUser(row.AccountID, row.UserID))
+		if !row.Paused && !row.NextRunTime.IsZero() {
+			ib.Add(CheckInSchedulesByNextRun, uint64(row.NextRunTime.Unix()))
+		}
+	}, func(tx *edb.Tx, row *m.CheckInSchedule, oldVer uint64) {
+	}, []*edb.Index{
+		CheckInSchedulesByAccountUser,
+		CheckInSchedulesByNextRun,
+	})
+	CheckInSchedulesByAccountUser = edb.AddIndex[m.AccountUserKey]("by_au")
+	CheckInSchedulesByNextRun     = edb.AddIndex[uint64]("by_next") // active only
+
+	Connectors = edb.AddTable(dbSchema, "connectors", 1, func(row *m.Connector, ib *edb.IndexBuilder) {
+		ib.Add(ConnectorsByAccount, row.AccountID)
+	}, func(tx *edb.Tx, row *m.Connector, oldVer uint64) {
+	}, []*edb.Index{
+		ConnectorsByAccount,
+	},
+		edb.SuppressContentWhenLogging)
+	ConnectorsByAccount = edb.AddIndex[m.AccountID]("by_account")
+
+	UserGroups = edb.AddTable(dbSchema, "user_groups", 1, func(row *m.UserGroup, ib *edb.IndexBuilder) {
+		ib.Add(UserGroupsByAccount, row.AccountID)
+	}, func(tx *edb.Tx, row *m.UserGroup, oldVer uint64) {
+	}, []*edb.Index{
+		UserGroupsByAccount,
+	})
+	UserGroupsByAccount = edb.AddIndex[m.AccountID]("by_account")
+
+	ConnectorIdentities = edb.AddTable(dbSchema, "connector_identities", 1, func(row *m.ConnectorIdentity, ib *edb.IndexBuilder) {
+		ib.Add(ConnectorIdentitiesByKey, row.Key())
+	}, func(tx *edb.Tx, row *m.ConnectorIdentity, oldVer uint64) {
+	}, []*edb.Index{
+		ConnectorIdentitiesByKey,
+	})
+	ConnectorIdentitiesByKey = edb.AddIndex[string]("by_key")
+
+	ConnectorLinks = edb.AddTable(dbSchema, "connector_links", 1, func(row *m.ConnectorLink, ib *edb.IndexBuilder) {
+	}, func(tx *edb.Tx, row *m.ConnectorLink, oldVer uint64) {
+	}, []*edb.Index{},
+		edb.SuppressContentWhenLogging)
+
+	SSOConfigs = edb.AddTable(dbSchema, "sso_configs", 1, func(row *m.SSOConfig, ib *edb.IndexBuilder) {
+	}, func(tx *edb.Tx, row *m.SSOConfig, oldVer uint64) {
+	}, []*edb.Index{},
+		edb.SuppressContentWhenLogging)
+
+	SSOLoginAttempts = edb.AddTable(dbSchema, "sso_login_attempts", 1, func(row *m.SSOLoginAttempt, ib *edb.IndexBuilder) {
+	}, func(tx *edb.Tx, row *m.SSOLoginAttempt, oldVer uint64) {
+	}, []*edb.Index{},
+		edb.SuppressContentWhenLogging)
+
+	SAMLAssertions = edb.AddTable(dbSchema, "saml_assertions", 1, func(row *m.SAMLAssertion, ib *edb.IndexBuilder) {
+	}, func(tx *edb.Tx, row *m.SAMLAssertion, oldVer uint64) {
+	}, []*edb.Index{})
+
+	AuditEvents = edb.AddTable(dbSchema, "audit_events", 1, func(row *m.AuditEvent, ib *edb.IndexBuilder) {
+		ib.Add(AuditEventsByActor, row.ActorID)
+		if row.UserID != 0 {
+			ib.Add(AuditEventsByUser, row.UserID)
+		}
+	}, func(tx *edb.Tx, row *m.AuditEvent, oldVer uint64) {
+	}, []*edb.Index{
+		AuditEventsByActor,
+		AuditEventsByUser,
+	})
+	AuditEventsByActor = edb.AddIndex[m.UserID]("by_actor")
+	AuditEventsByUser  = edb.AddIndex[m.UserID]("by_user")
 )
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+// sessionActivityInterval throttles LastActivity updates, so that requests
+// don't each write to the database.
+const sessionActivityInterval = 5 * time.Minute
+
+// clientIP returns the address of the browser. We run behind Caddy, which
+// appends the address it sees to X-Forwarded-For.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			if i := strings.LastIndexByte(fwd, ','); i >= 0 {
+				fwd = fwd[i+1:]
+			}
+			return strings.TrimSpace(fwd)
+		}
+	}
+	return host
+}
+
+// noteSessionActivity schedules an update of the session's LastActivity if
+// it's stale. Runs on every authenticated request, possibly in a read-only
+// transaction, hence the job.
+func (app *App) noteSessionActivity(rc *RC) {
+	sess := rc.Session
+	if rc.Now.Sub(sess.LastActivity) < sessionActivityInterval {
+		return
+	}
+	sessID, now, ip := sess.ID, rc.Now, clientIP(rc.Request.Request)
+	app.EnqueueEphemeral(jobTouchSession, sessID.String(), func(rc *mvp.RC) error {
+		return app.InTx(rc, mvpm.SafeWriter, func() error {
+			sess := edb.Get[m.Session](rc, sessID)
+			if sess == nil || !sess.LastActivity.Before(now) {
+				return nil
+			}
+			sess.LastActivity = now
+			sess.IP = ip
+			edb.Put(rc, sess)
+			return nil
+		})
+	})
+}
+
+// deleteIdleSessions removes sessions that have been idle for longer than
+// SessionIdleTimeout, along with the ones signed out remotely.
+func (app *App) deleteIdleSessions(rc *RC) error {
+	timeout := app.Settings().SessionIdleTimeout.Value()
+	return app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		var n int
+		for _, sess := range edb.All(edb.TableScan[m.Session](rc, edb.FullScan())) {
+			if !sess.IsActive(rc.Now, timeout) {
+				rc.DBTx().DeleteByKey(Sessions, sess.ID)
+				n++
+			}
+		}
+		if n > 0 {
+			flogger.Log(rc, "Deleted %d idle or signed-out sessions", n)
+		}
+		return nil
+	})
+}
+
+type SessionItem struct {
+	*m.Session
+	Device    string
+	IsCurrent bool
+}
+
+func (app *App) listSessions(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	var items []*SessionItem
+	for _, sess := range edb.All(edb.ExactIndexScan[m.Session](rc, SessionsByActor, rc.Session.Actor.ID)) {
+		if sess.Disabled {
+			continue
+		}
+		device := m.DescribeUserAgent(sess.UserAgent)
+		if device == "" {
+			device = "Unknown device"
+		}
+		items = append(items, &SessionItem{
+			Session:   sess,
+			Device:    device,
+			IsCurrent: sess.ID == rc.Session.ID,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].IsCurrent != items[j].IsCurrent {
+			return items[i].IsCurrent
+		}
+		return items[i].LastActivity.After(items[j].LastActivity)
+	})
+	return &mvp.ViewData{
+		View:         "accounts/sessions",
+		Title:        "Devices",
+		SemanticPath: "account/sessions",
+		Data: struct {
+			Sessions []*SessionItem
+		}{
+			Sessions: items,
+		},
+	}, nil
+}
+
+func (app *App) revokeSession(rc *RC, in *struct {
+	SessionID flake.ID `form:"session,path" json:"-"`
+}) (any, error) {
+	sess := edb.Get[m.Session](rc, in.SessionID)
+	if sess == nil || sess.Actor.ID != rc.Session.Actor.ID {
+		return nil, httperrors.Errorf(404, "", "Session not found")
+	}
+	sess.Disabled = true
+	edb.Put(rc, sess)
+	flogger.Log(rc, "Signed out session %v", sess.ID)
+	if sess.ID == rc.Session.ID {
+		rc.DeleteAuthCookie()
+		return app.Redirect("signin"), nil
+	}
+	return app.Redirect("sessions.list"), nil
+}
+
+// revokeAllSessions signs the user out everywhere, including this browser.
+func (app *App) revokeAllSessions(rc *RC, in *struct{}) (any, error) {
+	for _, sess := range edb.All(edb.ExactIndexScan[m.Session](rc, SessionsByActor, rc.Session.Actor.ID)) {
+		if !sess.Disabled {
+			sess.Disabled = true
+			edb.Put(rc, sess)
+		}
+	}
+	flogger.Log(rc, "Signed out all sessions")
+	rc.DeleteAuthCookie()
+	return app.Redirect("signin"), nil
+}
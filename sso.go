@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+
+	"github.com/andreyvit/buddyd/internal/sso"
+	m "github.com/andreyvit/buddyd/model"
+)
+
+const (
+	ssoAttemptCookie  = "sso_attempt"
+	ssoAttemptTTL     = 10 * time.Minute
+	ssoRequestTimeout = 15 * time.Second
+)
+
+// loadSSOConfig returns the SSO configuration of an account that can be
+// signed into via SSO, or nil.
+func loadSSOConfig(rc *mvp.RC, accountID m.AccountID) (*m.Account, *m.SSOConfig) {
+	account := edb.Get[m.Account](rc, accountID)
+	if account == nil || account.Disabled || account.IsTemplate {
+		return nil, nil
+	}
+	cfg := edb.Get[m.SSOConfig](rc, accountID)
+	if !cfg.IsEnabled() {
+		return nil, nil
+	}
+	return account, cfg
+}
+
+func (app *App) ssoURL(route string, accountID m.AccountID) string {
+	return strings.TrimSuffix(app.Settings().BaseURL, "/") + app.URL(route, ":account", accountID)
+}
+
+func (app *App) oidcClient(cfg *m.SSOConfig) *sso.OIDCClient {
+	return &sso.OIDCClient{
+		Issuer:       cfg.OIDCIssuer,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  app.ssoURL("sso.oidc.callback", cfg.AccountID),
+		GroupsClaim:  cfg.GroupsAttribute,
+		HTTPClient:   app.httpClient,
+	}
+}
+
+func (app *App) samlServiceProvider(cfg *m.SSOConfig) (*sso.SAMLServiceProvider, error) {
+	sp := &sso.SAMLServiceProvider{
+		EntityID:        app.ssoURL("sso.saml.metadata", cfg.AccountID),
+		ACSURL:          app.ssoURL("sso.saml.acs", cfg.AccountID),
+		IdPEntityID:     cfg.SAMLIdPEntityID,
+		IdPSSOURL:       cfg.SAMLIdPSSOURL,
+		GroupsAttribute: cfg.GroupsAttribute,
+	}
+	if cfg.SAMLIdPCertificate != "" {
+		cert, err := sso.ParseCertificatePEM(cfg.SAMLIdPCertificate)
+		if err != nil {
+			return nil, err
+		}
+		sp.IdPCertificate = cert
+	}
+	return sp, nil
+}
+
+// startSSO sends the user to the account's identity provider. The attempt is
+// tied to the browser via a cookie, so that nobody can sign a victim into
+// the attacker's account by making them follow a callback link.
+func (app *App) startSSO(rc *mvp.RC, in *struct {
+	AccountID flake.ID `form:"account,path" json:"-"`
+}) (any, error) {
+	_, cfg := loadSSOConfig(rc, in.AccountID)
+	if cfg == nil {
+		return nil, httperrors.Errorf(404, "", "Single sign-on is not set up for this account.")
+	}
+	attempt := &m.SSOLoginAttempt{
+		ID:           sso.RandomID(),
+		AccountID:    cfg.AccountID,
+		CreationTime: rc.Now,
+	}
+
+	var target string
+	switch cfg.Protocol {
+	case m.SSOProtocolOIDC:
+		client := app.oidcClient(cfg)
+		ctx, cancel := context.WithTimeout(rc, ssoRequestTimeout)
+		defer cancel()
+		md, err := client.Discover(ctx)
+		if err != nil {
+			flogger.Log(rc, "WARNING: SSO of account %v: %v", cfg.AccountID, err)
+			return app.signInFailure(cfg.AccountID, "Cannot reach your identity provider. Please try again later."), nil
+		}
+		attempt.Nonce = sso.RandomID()
+		attempt.CodeVerifier = sso.NewPKCEVerifier()
+		target = client.AuthCodeURL(md, attempt.ID, attempt.Nonce, attempt.CodeVerifier)
+	case m.SSOProtocolSAML:
+		sp, err := app.samlServiceProvider(cfg)
+		if err == nil {
+			target, err = sp.AuthnRequestURL(attempt.ID, attempt.ID, rc.Now)
+		}
+		if err != nil {
+			flogger.Log(rc, "WARNING: SSO of account %v: %v", cfg.AccountID, err)
+			return app.signInFailure(cfg.AccountID, "Single sign-on is misconfigured. Please contact your administrator."), nil
+		}
+	}
+
+	edb.Put(rc, attempt)
+	http.SetCookie(rc.RespWriter, &http.Cookie{
+		Name:     ssoAttemptCookie,
+		Value:    attempt.ID,
+		Path:     "/sso/",
+		MaxAge:   int(ssoAttemptTTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		// SAML responses are POSTed to us from the IdP's domain
+		SameSite: http.SameSiteNoneMode,
+	})
+	return &mvp.Redirect{Path: target}, nil
+}
+
+// showOIDCCallback bounces the authorization response to finishOIDC,
+// because signing in needs a writable transaction, which GET requests
+// don't get.
+func (app *App) showOIDCCallback(rc *mvp.RC, in *struct {
+	AccountID        flake.ID `form:"account,path" json:"-"`
+	Code             string   `json:"code"`
+	State            string   `json:"state"`
+	Error            string   `json:"error"`
+	ErrorDescription string   `json:"error_description"`
+}) (any, error) {
+	if in.Error != "" {
+		flogger.Log(rc, "SSO of account %v: IdP returned %s %s", in.AccountID, in.Error, in.ErrorDescription)
+		return app.signInFailure(in.AccountID, "Your identity provider did not sign you in."), nil
+	}
+	return &mvp.ViewData{
+		View:   "accounts/sso-continue",
+		Title:  "Signing In",
+		Layout: "bare",
+		Data: struct {
+			Action string
+			Fields map[string]string
+		}{
+			Action: app.URL("sso.oidc.finish", ":account", in.AccountID),
+			Fields: map[string]string{
+				"code":  in.Code,
+				"state": in.State,
+			},
+		},
+	}, nil
+}
+
+func (app *App) finishOIDC(rc *mvp.RC, in *struct {
+	AccountID flake.ID `form:"account,path" json:"-"`
+	Code      string   `json:"code"`
+	State     string   `json:"state"`
+}) (any, error) {
+	account, cfg := loadSSOConfig(rc, in.AccountID)
+	if cfg == nil || cfg.Protocol != m.SSOProtocolOIDC {
+		return nil, httperrors.NotFound
+	}
+	attempt := app.takeSSOAttempt(rc, account.ID, in.State)
+	if attempt == nil {
+		return app.signInFailure(account.ID, "Your sign-in attempt has expired. Please try again."), nil
+	}
+
+	client := app.oidcClient(cfg)
+	ctx, cancel := context.WithTimeout(rc, ssoRequestTimeout)
+	defer cancel()
+	md, err := client.Discover(ctx)
+	var ident *sso.Identity
+	if err == nil {
+		ident, err = client.Exchange(ctx, md, in.Code, attempt.CodeVerifier, attempt.Nonce, rc.Now)
+	}
+	if err != nil {
+		flogger.Log(rc, "WARNING: SSO of account %v: %v", account.ID, err)
+		return app.signInFailure(account.ID, "Your identity provider did not sign you in."), nil
+	}
+	return app.finishSSO(rc, account, cfg, ident)
+}
+
+func (app *App) handleSAMLResponse(rc *mvp.RC, in *struct {
+	AccountID    flake.ID `form:"account,path" json:"-"`
+	SAMLResponse string   `json:"SAMLResponse"`
+	RelayState   string   `json:"RelayState"`
+}) (any, error) {
+	account, cfg := loadSSOConfig(rc, in.AccountID)
+	if cfg == nil || cfg.Protocol != m.SSOProtocolSAML {
+		return nil, httperrors.NotFound
+	}
+	// IdP-initiated sign-ins carry no attempt and are refused here
+	attempt := app.takeSSOAttempt(rc, account.ID, in.RelayState)
+	if attempt == nil {
+		return app.signInFailure(account.ID, "Your sign-in attempt has expired. Please start from the sign-in page."), nil
+	}
+
+	sp, err := app.samlServiceProvider(cfg)
+	var ident *sso.Identity
+	if err == nil {
+		sp.Assertions = &samlAssertionStore{rc: rc, accountID: account.ID}
+		ident, err = sp.ParseResponse(in.SAMLResponse, attempt.ID, rc.Now)
+	}
+	if err != nil {
+		flogger.Log(rc, "WARNING: SSO of account %v: %v", account.ID, err)
+		return app.signInFailure(account.ID, "Your identity provider did not sign you in."), nil
+	}
+	return app.finishSSO(rc, account, cfg, ident)
+}
+
+func (app *App) showSAMLMetadata(rc *mvp.RC, in *struct {
+	AccountID flake.ID `form:"account,path" json:"-"`
+}) (any, error) {
+	_, cfg := loadSSOConfig(rc, in.AccountID)
+	if cfg == nil || cfg.Protocol != m.SSOProtocolSAML {
+		return nil, httperrors.NotFound
+	}
+	sp, err := app.samlServiceProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rc.RespWriter.Header().Set("Content-Type", "application/samlmetadata+xml")
+	rc.RespWriter.Write(sp.Metadata())
+	return mvp.ResponseHandled{}, nil
+}
+
+// samlAssertionStore keeps consumed assertions of an account in the database.
+type samlAssertionStore struct {
+	rc        *mvp.RC
+	accountID m.AccountID
+}
+
+func (s *samlAssertionStore) ConsumeAssertion(id string, expiry time.Time) bool {
+	key := m.AccountString(s.accountID, id)
+	if a := edb.Get[m.SAMLAssertion](s.rc, key); a != nil && !a.IsExpired(s.rc.Now) {
+		return false
+	}
+	edb.Put(s.rc, &m.SAMLAssertion{ID: key, ExpiryTime: expiry})
+	return true
+}
+
+// takeSSOAttempt consumes the attempt identified by state, provided that it
+// has been started in this browser, for this account, not too long ago.
+func (app *App) takeSSOAttempt(rc *mvp.RC, accountID m.AccountID, state string) *m.SSOLoginAttempt {
+	http.SetCookie(rc.RespWriter, &http.Cookie{
+		Name:     ssoAttemptCookie,
+		Path:     "/sso/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	cookie, err := rc.Request.Request.Cookie(ssoAttemptCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return nil
+	}
+	attempt := edb.Get[m.SSOLoginAttempt](rc, state)
+	if attempt == nil {
+		return nil
+	}
+	rc.DBTx().DeleteByKey(SSOLoginAttempts, attempt.ID)
+	if attempt.AccountID != accountID || attempt.IsExpired(rc.Now, ssoAttemptTTL) {
+		return nil
+	}
+	return attempt
+}
+
+// finishSSO signs in the user asserted by the IdP, creating them and their
+// membership on the fly. The IdP's groups decide the role of members it has
+// created; roles of members added by hand are left alone.
+func (app *App) finishSSO(rc *mvp.RC, account *m.Account, cfg *m.SSOConfig, ident *sso.Identity) (any, error) {
+	emailNorm := mvp.CanonicalEmail(ident.Email)
+	if ident.Email == "" || !account.HasVerifiedDomain(emailNorm) {
+		flogger.Log(rc, "WARNING: SSO of account %v asserted %q (subject %q) outside of the verified domains", account.ID, ident.Email, ident.Subject)
+		return app.signInFailure(account.ID, "Your identity provider did not confirm an email address in this account's verified domains."), nil
+	}
+	role := cfg.RoleFor(ident.Groups)
+
+	u := edb.Lookup[m.User](rc, UsersByEmail, emailNorm)
+	if u == nil {
+		name := ident.Name
+		if name == "" {
+			name, _, _ = strings.Cut(ident.Email, "@")
+		}
+		u = &m.User{
+			ID:        app.NewID(),
+			Role:      m.UserSystemRoleRegular,
+			Email:     ident.Email,
+			EmailNorm: emailNorm,
+			Name:      name,
+		}
+	}
+	if memb := u.Membership(account.ID); memb == nil {
+		u.Memberships = append(u.Memberships, &m.UserMembership{
+			CreationTime: rc.Now,
+			AccountID:    account.ID,
+			Role:         role,
+			Status:       m.UserStatusActive,
+			Source:       m.UserSourceSSO,
+		})
+	} else if !memb.Status.ActiveOrInvited() {
+		flogger.Log(rc, "SSO of account %v refused %s with membership status %v", account.ID, ident.Email, memb.Status)
+		return app.signInFailure(account.ID, "You do not have access to this account."), nil
+	} else {
+		memb.Status = m.UserStatusActive
+		if memb.Source == m.UserSourceSSO {
+			memb.Role = role
+		}
+	}
+	flogger.Log(rc, "Signed in as %s via SSO of account %v (subject %q, role %v)", ident.Email, account.ID, ident.Subject, u.MembershipRole(account.ID))
+	edb.Put(rc, u)
+	if wl := edb.Lookup[m.Waitlister](rc, WaitlistersByEmail, emailNorm); wl != nil {
+		rc.DBTx().DeleteByKey(Waitlisters, wl.ID)
+	}
+
+	app.startSession(rc, u, account.ID)
+	return app.openApp(fullRC.From(rc))
+}
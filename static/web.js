@@ -59,3 +59,108 @@ Stimulus.register('menu', class extends Controller {
 
   }
 });
+
+// Notifies the server that the user is typing, at most once per interval.
+Stimulus.register('typing', class extends Controller {
+  static values = {
+    url: String,
+    interval: { type: Number, default: 3000 },
+  };
+
+  notify() {
+    let now = Date.now()
+    if (this.lastSent && now - this.lastSent < this.intervalValue) return;
+    this.lastSent = now
+    fetch(this.urlValue, { method: 'POST', credentials: 'same-origin' }).catch(() => {})
+  }
+});
+
+// Hides a presence line (e.g. "typing...") once it expires.
+Stimulus.register('presence', class extends Controller {
+  static values = {
+    until: Number,
+  };
+
+  connect() {
+    if (!this.untilValue) return;
+    let delay = this.untilValue - Date.now()
+    if (delay <= 0) {
+      this.element.textContent = ''
+    } else {
+      this.timer = setTimeout(() => { this.element.textContent = '' }, delay)
+    }
+  }
+
+  disconnect() {
+    clearTimeout(this.timer)
+  }
+});
+
+// Prefills an empty time zone field with the browser's time zone.
+Stimulus.register('timezone', class extends Controller {
+  connect() {
+    if (!this.element.value) {
+      this.element.value = Intl.DateTimeFormat().resolvedOptions().timeZone || ''
+    }
+  }
+});
+
+// Runs a WebAuthn ceremony with the options rendered by the server and posts
+// the result. Browsers may refuse to start without a click, hence the button.
+Stimulus.register('passkey', class extends Controller {
+  static targets = ['error']
+  static values = {
+    mode: String,
+    options: Object,
+  };
+
+  connect() {
+    if (!window.PublicKeyCredential) {
+      this.fail('This browser does not support passkeys.')
+      return
+    }
+    this.run()
+  }
+
+  async run() {
+    let decode = (s) => Uint8Array.from(atob(s.replace(/-/g, '+').replace(/_/g, '/')), (c) => c.charCodeAt(0))
+    let encode = (buf) => btoa(String.fromCharCode(...new Uint8Array(buf))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+
+    let opts = this.optionsValue
+    opts.challenge = decode(opts.challenge)
+    if (opts.user) opts.user.id = decode(opts.user.id)
+    for (let c of opts.excludeCredentials || []) c.id = decode(c.id)
+    for (let c of opts.allowCredentials || []) c.id = decode(c.id)
+
+    let cred
+    try {
+      if (this.modeValue == 'create') {
+        cred = await navigator.credentials.create({ publicKey: opts })
+      } else {
+        cred = await navigator.credentials.get({ publicKey: opts })
+      }
+    } catch (e) {
+      this.fail(e.name == 'NotAllowedError' ? 'The passkey prompt was dismissed or timed out.' : e.message)
+      return
+    }
+
+    let r = cred.response
+    let fields = {
+      credential_id: cred.rawId,
+      client_data: r.clientDataJSON,
+      attestation_object: r.attestationObject,
+      authenticator_data: r.authenticatorData,
+      signature: r.signature,
+      user_handle: r.userHandle,
+    }
+    for (let [name, value] of Object.entries(fields)) {
+      if (value) this.element.elements[name].value = encode(value)
+    }
+    this.element.submit()
+  }
+
+  fail(msg) {
+    this.errorTarget.textContent = msg
+    this.errorTarget.hidden = false
+  }
+});
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/andreyvit/edb"
 	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
 
 	m "github.com/andreyvit/buddyd/model"
 )
@@ -18,7 +23,11 @@ func (app *App) listSuperadminAccounts(rc *RC, in *struct{}) (*mvp.ViewData, err
 	curAccountID := rc.AccountID()
 
 	accounts := make([]*AccountVM, 0, len(rawAccounts))
+	var templates []*m.Account
 	for _, acc := range rawAccounts {
+		if acc != nil && acc.IsTemplate {
+			templates = append(templates, acc)
+		}
 		if acc != nil {
 			accounts = append(accounts, &AccountVM{
 				Account:   acc,
@@ -34,9 +43,80 @@ func (app *App) listSuperadminAccounts(rc *RC, in *struct{}) (*mvp.ViewData, err
 		Data: struct {
 			Waitlisters []*m.Waitlister
 			Accounts    []*AccountVM
+			Templates   []*m.Account
 		}{
 			Waitlisters: wls,
 			Accounts:    accounts,
+			Templates:   templates,
 		},
 	}, nil
 }
+
+// approveWaitlister creates an account for a waitlisted person, making them
+// its owner.
+func (app *App) approveWaitlister(rc *RC, in *struct {
+	WaitlisterID flake.ID `form:"waitlister,path" json:"-"`
+	AccountName  string   `json:"account_name"`
+	TemplateID   string   `json:"template"`
+}) (any, error) {
+	wl := edb.Get[m.Waitlister](rc, in.WaitlisterID)
+	if wl == nil {
+		return nil, httperrors.Errorf(404, "", "Waitlister not found")
+	}
+	name := strings.TrimSpace(in.AccountName)
+	if name == "" {
+		name = wl.CompanyName
+	}
+	if name == "" {
+		return nil, httperrors.BadRequest.Msg("account name is required")
+	}
+
+	var template *m.Account
+	if in.TemplateID != "" {
+		template = edb.Select(edb.FullTableScan[m.Account](rc), func(acc *m.Account) bool {
+			return acc.IsTemplate && acc.ID.String() == in.TemplateID
+		})
+		if template == nil {
+			return nil, httperrors.BadRequest.Msg("template account not found")
+		}
+	}
+
+	account := app.createAccount(rc, name, template)
+	user := edb.Lookup[m.User](rc, UsersByEmail, wl.EmailNorm)
+	if user == nil {
+		userName := wl.FullName
+		if userName == "" {
+			userName, _, _ = strings.Cut(wl.Email, "@")
+		}
+		user = &m.User{
+			ID:        app.NewID(),
+			Role:      m.UserSystemRoleRegular,
+			Email:     wl.Email,
+			EmailNorm: wl.EmailNorm,
+			Name:      userName,
+		}
+	}
+	user.Memberships = append(user.Memberships, &m.UserMembership{
+		CreationTime: rc.Now,
+		AccountID:    account.ID,
+		Role:         m.UserAccountRoleOwner,
+		Status:       m.UserStatusActive,
+		Source:       m.UserSourceWaitlist,
+	})
+	edb.Put(rc, user)
+	rc.DBTx().DeleteByKey(Waitlisters, wl.ID)
+
+	flogger.Log(rc, "Approved waitlister %s as owner of new account %v %q", wl.Email, account.ID, account.Name)
+	app.SendEmail(rc, &mvp.Email{
+		To:      user.Email,
+		Subject: "Your LibroAI account is ready",
+		View:    "emails/account-approved",
+		Data: map[string]any{
+			"Name":        user.FirstName(),
+			"AccountName": account.Name,
+			"URL":         strings.TrimSuffix(app.Settings().BaseURL, "/") + app.URL("signin"),
+		},
+		Category: "onboarding",
+	})
+	return app.Redirect("superadmin.accounts"), nil
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/forms"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+	"github.com/andreyvit/openai"
+	"golang.org/x/time/rate"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+const (
+	defaultEmbeddingMigrationBatchSize  = 50
+	defaultEmbeddingMigrationRatePerSec = 5
+)
+
+func (app *App) embeddingMigrationStartProcedure() *Procedure {
+	in := &struct {
+		TargetType string
+		BatchSize  string
+		RatePerSec string
+	}{
+		BatchSize:  strconv.Itoa(defaultEmbeddingMigrationBatchSize),
+		RatePerSec: strconv.Itoa(defaultEmbeddingMigrationRatePerSec),
+	}
+
+	return &Procedure{
+		Slug:  "migrate-embeddings",
+		Title: "Start or Resume Embedding Migration",
+		Form: &forms.Form{
+			Group: forms.Group{
+				Styles: []*forms.Style{
+					adminFormStyle,
+					verticalFormStyle,
+				},
+				Children: []forms.Child{
+					&forms.Item{
+						Name:  "target_type",
+						Label: "Target Embedding Type",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.TargetType),
+							Placeholder: "ada002",
+						},
+					},
+					&forms.Item{
+						Name:  "batch_size",
+						Label: "Batch Size",
+						Child: &forms.InputText{
+							Binding: forms.Var(&in.BatchSize),
+						},
+					},
+					&forms.Item{
+						Name:  "rate",
+						Label: "Embeddings Per Second",
+						Child: &forms.InputText{
+							Binding: forms.Var(&in.RatePerSec),
+						},
+					},
+				},
+			},
+		},
+		Handler: func(rc *RC) error {
+			account := edb.Get[m.Account](rc, rc.AccountID())
+			if account == nil {
+				return fmt.Errorf("no current account")
+			}
+			toType, err := m.ParseEmbeddingType(strings.TrimSpace(in.TargetType))
+			if err != nil {
+				return err
+			}
+			if toType == m.EmbeddingTypeNone {
+				return fmt.Errorf("target embedding type is required")
+			}
+			batchSize, err := strconv.Atoi(strings.TrimSpace(in.BatchSize))
+			if err != nil || batchSize <= 0 {
+				return fmt.Errorf("invalid batch size %q", in.BatchSize)
+			}
+			ratePerSec, err := strconv.ParseFloat(strings.TrimSpace(in.RatePerSec), 64)
+			if err != nil || ratePerSec <= 0 {
+				return fmt.Errorf("invalid rate %q", in.RatePerSec)
+			}
+
+			fromType := account.EffectiveEmbeddingType()
+			if fromType == toType {
+				return fmt.Errorf("account %s already uses %v embeddings", account.Name, toType)
+			}
+
+			mig := edb.Get[m.EmbeddingMigration](rc, account.ID)
+			if mig != nil && mig.ToType == toType && mig.State != m.EmbeddingMigrationStateFinished {
+				flogger.Log(rc, "Resuming migration of %s from %v to %v", account.Name, mig.FromType, mig.ToType)
+			} else {
+				mig = &m.EmbeddingMigration{
+					AccountID: account.ID,
+					FromType:  fromType,
+					ToType:    toType,
+					StartTime: rc.Now,
+				}
+				flogger.Log(rc, "Starting migration of %s from %v to %v", account.Name, mig.FromType, mig.ToType)
+			}
+			mig.State = m.EmbeddingMigrationStateRunning
+			mig.BatchSize = batchSize
+			mig.RatePerSec = ratePerSec
+			mig.UpdateTime = rc.Now
+			mig.LastError = ""
+			updateEmbeddingMigrationProgress(rc, mig)
+			edb.Put(rc, mig)
+			logEmbeddingMigration(rc, mig)
+
+			app.EnqueueEmbeddingMigration(rc, account.ID)
+			return nil
+		},
+	}
+}
+
+func (app *App) embeddingMigrationStatusProcedure() *Procedure {
+	return &Procedure{
+		Slug:  "migrate-embeddings-status",
+		Title: "Embedding Migration Status",
+		Form: &forms.Form{
+			Group: forms.Group{
+				Styles: []*forms.Style{
+					adminFormStyle,
+					verticalFormStyle,
+				},
+			},
+		},
+		Handler: func(rc *RC) error {
+			account := edb.Get[m.Account](rc, rc.AccountID())
+			if account == nil {
+				return fmt.Errorf("no current account")
+			}
+			flogger.Log(rc, "Account %s uses %v embeddings", account.Name, account.EffectiveEmbeddingType())
+			mig := edb.Get[m.EmbeddingMigration](rc, account.ID)
+			if mig == nil {
+				flogger.Log(rc, "No embedding migration has been started.")
+				return nil
+			}
+			if mig.State != m.EmbeddingMigrationStateFinished {
+				updateEmbeddingMigrationProgress(rc, mig)
+			}
+			logEmbeddingMigration(rc, mig)
+			return nil
+		},
+	}
+}
+
+func (app *App) embeddingMigrationPauseProcedure() *Procedure {
+	return &Procedure{
+		Slug:  "migrate-embeddings-pause",
+		Title: "Pause Embedding Migration",
+		Form: &forms.Form{
+			Group: forms.Group{
+				Styles: []*forms.Style{
+					adminFormStyle,
+					verticalFormStyle,
+				},
+			},
+		},
+		Handler: func(rc *RC) error {
+			mig := edb.Get[m.EmbeddingMigration](rc, rc.AccountID())
+			if mig == nil || !mig.IsActive() {
+				return fmt.Errorf("no running embedding migration")
+			}
+			mig.State = m.EmbeddingMigrationStatePaused
+			mig.UpdateTime = rc.Now
+			edb.Put(rc, mig)
+			logEmbeddingMigration(rc, mig)
+			return nil
+		},
+	}
+}
+
+func logEmbeddingMigration(rc *RC, mig *m.EmbeddingMigration) {
+	flogger.Log(rc, "Migration %v → %v: %v, %d%% done", mig.FromType, mig.ToType, mig.State, mig.PercentDone())
+	flogger.Log(rc, "Content: %d of %d", mig.ContentDone, mig.ContentTotal)
+	flogger.Log(rc, "Chat messages: %d of %d", mig.MessagesDone, mig.MessagesTotal)
+	flogger.Log(rc, "User memories: %d of %d", mig.MemoriesDone, mig.MemoriesTotal)
+	flogger.Log(rc, "Batches: %d, cost so far: %v", mig.Batches, mig.Cost)
+	if mig.LastError != "" {
+		flogger.Log(rc, "Last error: %s", mig.LastError)
+	}
+}
+
+func (app *App) EnqueueEmbeddingMigration(rc *RC, accountID m.AccountID) {
+	app.EnqueueEphemeral(jobMigrateEmbeddings, accountID.String(), func(rc *mvp.RC) error {
+		return app.runEmbeddingMigration(fullRC.From(rc), accountID)
+	})
+}
+
+type embeddingMigrationTask struct {
+	Content   *m.Content
+	ChatID    m.ChatID
+	Msg       *m.Message
+	Memory    *m.UserMemory
+	Embedding m.Embedding
+}
+
+func (t *embeddingMigrationTask) Text() string {
+	if t.Content != nil {
+		return t.Content.Text
+	}
+	if t.Memory != nil {
+		return t.Memory.Text
+	}
+	return t.Msg.Text
+}
+
+// runEmbeddingMigration re-embeds the content, chat messages and user memories of the account
+// in batches. Each batch is saved in its own transaction, so the migration
+// can be paused and resumed at any point (including after a restart),
+// picking up whatever still lacks an embedding of the target type.
+//
+// The account is switched to the new type in the same transaction that
+// verifies full coverage, so retrieval never sees a partially migrated library.
+func (app *App) runEmbeddingMigration(rc *RC, accountID m.AccountID) error {
+	var limiter *rate.Limiter
+	for {
+		var mig *m.EmbeddingMigration
+		var tasks []*embeddingMigrationTask
+		err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+			mig = edb.Get[m.EmbeddingMigration](rc, accountID)
+			if mig != nil && mig.IsActive() {
+				tasks = collectEmbeddingMigrationTasks(rc, mig, mig.BatchSize)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if mig == nil || !mig.IsActive() {
+			flogger.Log(rc, "EmbeddingMigration(%v): not running", accountID)
+			return nil
+		}
+		if limiter == nil {
+			limiter = rate.NewLimiter(rate.Limit(mig.RatePerSec), 1)
+		}
+
+		if len(tasks) == 0 {
+			var finished bool
+			err := app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+				finished = finishEmbeddingMigration(rc, accountID)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if finished {
+				flogger.Log(rc, "EmbeddingMigration(%v): finished", accountID)
+				return nil
+			}
+			continue // something new came in meanwhile
+		}
+
+		var cost openai.Price
+		var computeErr error
+		for _, t := range tasks {
+			if !mig.ToType.IsLocal() {
+				computeErr = limiter.Wait(rc)
+				if computeErr != nil {
+					break
+				}
+			}
+			var spent openai.Price
+			t.Embedding, spent, computeErr = app.computeEmbedding(rc, t.Text(), mig.ToType)
+			cost += spent
+			if computeErr != nil {
+				break
+			}
+		}
+
+		err = app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+			mig := edb.Get[m.EmbeddingMigration](rc, accountID)
+			if mig == nil {
+				return nil
+			}
+			saveEmbeddingMigrationBatch(rc, mig.ToType, tasks)
+			mig.Batches++
+			mig.Cost += cost
+			mig.UpdateTime = rc.Now
+			if computeErr != nil {
+				mig.State = m.EmbeddingMigrationStateFailed
+				mig.LastError = computeErr.Error()
+			}
+			updateEmbeddingMigrationProgress(rc, mig)
+			edb.Put(rc, mig)
+			flogger.Log(rc, "EmbeddingMigration(%v): batch %d done, %d%%, cost so far %v", accountID, mig.Batches, mig.PercentDone(), mig.Cost)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if computeErr != nil {
+			return computeErr
+		}
+	}
+}
+
+func collectEmbeddingMigrationTasks(rc *RC, mig *m.EmbeddingMigration, limit int) []*embeddingMigrationTask {
+	var tasks []*embeddingMigrationTask
+	for c := edb.ExactIndexScan[m.Content](rc, ContentByAccount, mig.AccountID); c.Next(); {
+		if len(tasks) >= limit {
+			return tasks
+		}
+		content := c.Row()
+		if !hasContentEmbedding(rc, content.ID, mig.ToType) {
+			tasks = append(tasks, &embeddingMigrationTask{Content: content})
+		}
+	}
+	for c := edb.ExactIndexScan[m.Chat](rc, ChatsByAccount, mig.AccountID); c.Next(); {
+		chat := c.Row()
+		cc := edb.Get[m.ChatContent](rc, chat.ID)
+		if cc == nil {
+			continue
+		}
+		for _, msg := range findMessagesWithMissingEmbeddings(cc, mig.ToType) {
+			if len(tasks) >= limit {
+				return tasks
+			}
+			tasks = append(tasks, &embeddingMigrationTask{ChatID: chat.ID, Msg: msg})
+		}
+	}
+	for _, mem := range loadAccountMemories(rc, mig.AccountID) {
+		if len(tasks) >= limit {
+			return tasks
+		}
+		if mem.Embedding(mig.ToType) == nil {
+			tasks = append(tasks, &embeddingMigrationTask{Memory: mem})
+		}
+	}
+	return tasks
+}
+
+func saveEmbeddingMigrationBatch(rc *RC, typ m.EmbeddingType, tasks []*embeddingMigrationTask) {
+	contentsByChat := make(map[m.ChatID]*m.ChatContent)
+	for _, t := range tasks {
+		if t.Embedding == nil {
+			continue
+		}
+		if t.Content != nil {
+			content := edb.Get[m.Content](rc, t.Content.ID)
+			if content == nil || content.Text != t.Content.Text {
+				continue // deleted or edited meanwhile, will be picked up again if still there
+			}
+			emb := &m.ContentEmbedding{
+				ContentEmbeddingKey: m.ContentEmbeddingKey{ContentID: content.ID, Type: typ},
+				AccountID:           content.AccountID,
+				ItemID:              content.ItemID,
+				Embedding:           t.Embedding,
+			}
+			emb.UpdateTokenCount(content)
+			edb.Put(rc, emb)
+		} else if t.Memory != nil {
+			mem := edb.Get[m.UserMemory](rc, t.Memory.ID)
+			if mem == nil || mem.Text != t.Memory.Text {
+				continue // deleted or edited meanwhile, will be picked up again if still there
+			}
+			mem.SetEmbedding(typ, t.Embedding)
+			edb.Put(rc, mem)
+		} else {
+			cc := contentsByChat[t.ChatID]
+			if cc == nil {
+				cc = edb.Get[m.ChatContent](rc, t.ChatID)
+				if cc == nil {
+					continue
+				}
+				contentsByChat[t.ChatID] = cc
+			}
+			if msg := cc.FreshMessage(t.Msg); msg != nil {
+				msg.SetEmbedding(typ, t.Embedding)
+			}
+		}
+	}
+	for _, cc := range contentsByChat {
+		edb.Put(rc, cc)
+	}
+}
+
+func finishEmbeddingMigration(rc *RC, accountID m.AccountID) bool {
+	mig := edb.Get[m.EmbeddingMigration](rc, accountID)
+	if mig == nil || !mig.IsActive() {
+		return true
+	}
+	if len(collectEmbeddingMigrationTasks(rc, mig, 1)) > 0 {
+		return false
+	}
+	account := edb.Get[m.Account](rc, accountID)
+	if account == nil {
+		return true
+	}
+	account.EmbeddingType = mig.ToType
+	edb.Put(rc, account)
+
+	mig.State = m.EmbeddingMigrationStateFinished
+	mig.UpdateTime = rc.Now
+	mig.FinishTime = rc.Now
+	updateEmbeddingMigrationProgress(rc, mig)
+	edb.Put(rc, mig)
+	return true
+}
+
+func updateEmbeddingMigrationProgress(rc *RC, mig *m.EmbeddingMigration) {
+	mig.ContentTotal, mig.ContentDone = 0, 0
+	for c := edb.ExactIndexScan[m.Content](rc, ContentByAccount, mig.AccountID); c.Next(); {
+		mig.ContentTotal++
+		if hasContentEmbedding(rc, c.Row().ID, mig.ToType) {
+			mig.ContentDone++
+		}
+	}
+
+	mig.MessagesTotal, mig.MessagesDone = 0, 0
+	for c := edb.ExactIndexScan[m.Chat](rc, ChatsByAccount, mig.AccountID); c.Next(); {
+		cc := edb.Get[m.ChatContent](rc, c.Row().ID)
+		if cc == nil {
+			continue
+		}
+		for _, turn := range cc.Turns {
+			if turn.Role == m.MessageRoleUser {
+				for _, msg := range turn.Versions {
+					mig.MessagesTotal++
+					if msg.Embedding(mig.ToType) != nil {
+						mig.MessagesDone++
+					}
+				}
+			}
+		}
+	}
+
+	mig.MemoriesTotal, mig.MemoriesDone = 0, 0
+	for _, mem := range loadAccountMemories(rc, mig.AccountID) {
+		mig.MemoriesTotal++
+		if mem.Embedding(mig.ToType) != nil {
+			mig.MemoriesDone++
+		}
+	}
+}
+
+func hasContentEmbedding(rc *RC, contentID m.ContentID, typ m.EmbeddingType) bool {
+	return edb.Get[m.ContentEmbedding](rc, m.ContentEmbeddingKey{ContentID: contentID, Type: typ}) != nil
+}
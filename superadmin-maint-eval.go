@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/forms"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+func (app *App) retrievalEvaluationProcedure() *Procedure {
+	in := &struct {
+		SetName string
+		K       string
+		ConfigA string
+		ConfigB string
+	}{
+		K:       "5",
+		ConfigA: formatRetrievalSettings(defaultRetrievalSettings),
+	}
+
+	return &Procedure{
+		Slug:  "evaluate-retrieval",
+		Title: "Evaluate Retrieval",
+		Form: &forms.Form{
+			Group: forms.Group{
+				Styles: []*forms.Style{
+					adminFormStyle,
+					verticalFormStyle,
+				},
+				Children: []forms.Child{
+					&forms.Item{
+						Name:  "set",
+						Label: "Golden Set (empty for all sets of the current account)",
+						Child: &forms.InputText{
+							Binding: forms.Var(&in.SetName),
+						},
+					},
+					&forms.Item{
+						Name:  "k",
+						Label: "K for recall@K",
+						Child: &forms.InputText{
+							Binding: forms.Var(&in.K),
+						},
+					},
+					&forms.Item{
+						Name:  "config_a",
+						Label: "Configuration A",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.ConfigA),
+							Placeholder: formatRetrievalSettings(defaultRetrievalSettings),
+						},
+					},
+					&forms.Item{
+						Name:  "config_b",
+						Label: "Configuration B (optional)",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.ConfigB),
+							Placeholder: "entries=10 tokens=768 mmr=0.7",
+						},
+					},
+				},
+			},
+		},
+		Handler: func(rc *RC) error {
+			account := edb.Get[m.Account](rc, rc.AccountID())
+			if account == nil {
+				return fmt.Errorf("no current account")
+			}
+			k, err := strconv.Atoi(strings.TrimSpace(in.K))
+			if err != nil || k <= 0 {
+				return fmt.Errorf("invalid K %q", in.K)
+			}
+			configs := []m.RetrievalSettings{}
+			for _, s := range []string{in.ConfigA, in.ConfigB} {
+				if strings.TrimSpace(s) == "" {
+					continue
+				}
+				rs, err := parseRetrievalSettings(s, defaultRetrievalSettings)
+				if err != nil {
+					return err
+				}
+				configs = append(configs, rs)
+			}
+			if len(configs) == 0 {
+				configs = append(configs, defaultRetrievalSettings)
+			}
+
+			var sets []*m.GoldenSet
+			for _, gs := range edb.All(edb.ExactIndexScan[m.GoldenSet](rc, GoldenSetsByAccount, account.ID)) {
+				if in.SetName == "" || strings.EqualFold(gs.Name, strings.TrimSpace(in.SetName)) {
+					sets = append(sets, gs)
+				}
+			}
+			if len(sets) == 0 {
+				return fmt.Errorf("no golden sets found")
+			}
+
+			typ := account.EffectiveEmbeddingType()
+			embs := loadAccountEmbeddings(rc, account.ID, typ, 0)
+			var questions []*m.GoldenQuestion
+			var queries []m.Embedding
+			var cost openai.Price
+			for _, gs := range sets {
+				setQueries, computed, spent, err := gs.EmbedQuestions(rc, app.aiProvider(), typ)
+				cost += spent
+				if err != nil {
+					return err
+				}
+				if computed > 0 {
+					edb.Put(rc, gs)
+				}
+				questions = append(questions, gs.Questions...)
+				queries = append(queries, setQueries...)
+			}
+			flogger.Log(rc, "Evaluating %d questions from %d golden sets against %d %v embeddings (question embedding cost: %v)", len(questions), len(sets), len(embs.Embeddings), typ, cost)
+
+			evals := make([]*m.RetrievalEvaluation, len(configs))
+			for i, rs := range configs {
+				evals[i] = m.EvaluateRetrieval(questions, queries, embs, rs, k, splitPrompt(promptTemplateFor(account, nil)), DefaultModel)
+			}
+			logRetrievalEvaluations(rc, evals)
+			return nil
+		},
+	}
+}
+
+func logRetrievalEvaluations(rc *RC, evals []*m.RetrievalEvaluation) {
+	row := func(label string, f func(idx int, ev *m.RetrievalEvaluation) string) {
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "%-16s", label)
+		for idx, ev := range evals {
+			fmt.Fprintf(&buf, " %36s", f(idx, ev))
+		}
+		flogger.Log(rc, "%s", buf.String())
+	}
+
+	flogger.Log(rc, "")
+	row("", func(idx int, ev *m.RetrievalEvaluation) string { return string(rune('A' + idx)) })
+	row("config", func(idx int, ev *m.RetrievalEvaluation) string { return formatRetrievalSettings(ev.Settings) })
+	row(fmt.Sprintf("recall@%d", evals[0].K), func(idx int, ev *m.RetrievalEvaluation) string { return fmt.Sprintf("%.3f", ev.MeanRecallAtK) })
+	row("MRR", func(idx int, ev *m.RetrievalEvaluation) string { return fmt.Sprintf("%.3f", ev.MRR) })
+	row("prompt tokens", func(idx int, ev *m.RetrievalEvaluation) string { return fmt.Sprintf("%.0f", ev.MeanPromptTokens) })
+
+	flogger.Log(rc, "")
+	for i, r := range evals[0].Results {
+		flogger.Log(rc, "Q: %s", r.Question.Text)
+		row("  recall / RR", func(idx int, ev *m.RetrievalEvaluation) string {
+			return fmt.Sprintf("%.2f / %.2f", ev.Results[i].RecallAtK, ev.Results[i].ReciprocalRank)
+		})
+		row("  tokens", func(idx int, ev *m.RetrievalEvaluation) string {
+			return strconv.Itoa(ev.Results[i].PromptTokens)
+		})
+	}
+}
+
+func formatRetrievalSettings(rs m.RetrievalSettings) string {
+	return fmt.Sprintf("entries=%d distance=%g tokens=%d mmr=%g", rs.MaxEntries, rs.MaxDistance, rs.MaxPromptTokens, rs.MMRLambda)
+}
+
+// parseRetrievalSettings parses space- or comma-separated key=value pairs
+// (as produced by formatRetrievalSettings), overriding values in base.
+func parseRetrievalSettings(s string, base m.RetrievalSettings) (m.RetrievalSettings, error) {
+	rs := base
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return rs, fmt.Errorf("invalid retrieval setting %q, expected key=value", field)
+		}
+		var err error
+		switch key {
+		case "entries":
+			rs.MaxEntries, err = strconv.Atoi(value)
+		case "distance":
+			rs.MaxDistance, err = strconv.ParseFloat(value, 64)
+		case "tokens":
+			rs.MaxPromptTokens, err = strconv.Atoi(value)
+		case "mmr":
+			rs.MMRLambda, err = strconv.ParseFloat(value, 64)
+		default:
+			return rs, fmt.Errorf("unknown retrieval setting %q", key)
+		}
+		if err != nil {
+			return rs, fmt.Errorf("invalid value of retrieval setting %q: %w", key, err)
+		}
+	}
+	return rs, nil
+}
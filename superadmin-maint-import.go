@@ -13,6 +13,7 @@ import (
 	"github.com/andreyvit/edb"
 	"github.com/andreyvit/mvp/flogger"
 	"github.com/andreyvit/mvp/forms"
+	"github.com/andreyvit/openai"
 
 	m "github.com/andreyvit/buddyd/model"
 )
@@ -46,6 +47,12 @@ func (app *App) importProcedure() *Procedure {
 		Handler: func(rc *RC) error {
 			flogger.Log(rc, "Root: %s", in.Path)
 
+			account := edb.Get[m.Account](rc, rc.AccountID())
+			if account == nil {
+				return fmt.Errorf("no current account")
+			}
+			typ := account.EffectiveEmbeddingType()
+
 			loadCurrentAccountLibrary(rc)
 
 			importedFolder := ensureFolderBySlug(rc, "imported", "Imported", rc.Library.RootFolderID)
@@ -63,6 +70,8 @@ func (app *App) importProcedure() *Procedure {
 			files := collectFiles(memEmbPath, ".json")
 
 			iis := make(map[string]*importableItem)
+			var freshEmbs []*m.ContentEmbedding
+			var cost openai.Price
 
 			for _, fn := range files {
 				base := filepath.Base(fn)
@@ -155,14 +164,13 @@ func (app *App) importProcedure() *Procedure {
 					}
 					edb.Put(rc, c)
 
-					emb := &m.ContentEmbedding{
-						ContentEmbeddingKey: m.ContentEmbeddingKey{ContentID: c.ID, Type: m.EmbeddingTypeAda002},
-						AccountID:           rc.AccountID(),
-						ItemID:              item.ID,
-						Embedding:           entry.TextEmbedding,
+					emb, spent, err := m.ImportedContentEmbedding(rc, app.aiProvider(), c, typ, entry.TextEmbedding)
+					cost += spent
+					if err != nil {
+						return err
 					}
-					emb.UpdateTokenCount(c)
 					edb.Put(rc, emb)
+					freshEmbs = append(freshEmbs, emb)
 				}
 			}
 
@@ -171,6 +179,11 @@ func (app *App) importProcedure() *Procedure {
 				deleteItem(rc, item.ID)
 			}
 
+			flogger.Log(rc, "Embedded %d chunks as %v, cost: %v", len(freshEmbs), typ, cost)
+
+			n := app.flagNearDuplicates(rc, rc.AccountID(), typ, freshEmbs, m.DefaultDuplicateSimilarity)
+			flogger.Log(rc, "Flagged %d near-duplicate pairs for review", n)
+
 			return nil
 		},
 	}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/forms"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+func (app *App) retrievalOptionsProcedure() *Procedure {
+	in := &struct {
+		QueryRewriting   string
+		MaxSubQueries    string
+		Reranker         string
+		RerankCandidates string
+		RerankThreshold  string
+		MMRLambda        string
+	}{}
+
+	return &Procedure{
+		Slug:  "retrieval-options",
+		Title: "Set Retrieval Options",
+		Form: &forms.Form{
+			Group: forms.Group{
+				Styles: []*forms.Style{
+					adminFormStyle,
+					verticalFormStyle,
+				},
+				Children: []forms.Child{
+					&forms.Item{
+						Name:  "query_rewriting",
+						Label: "Query rewriting (on/off, empty to keep)",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.QueryRewriting),
+							Placeholder: "off",
+						},
+					},
+					&forms.Item{
+						Name:  "max_sub_queries",
+						Label: "Max sub-queries (empty to keep)",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.MaxSubQueries),
+							Placeholder: "0",
+						},
+					},
+					&forms.Item{
+						Name:  "reranker",
+						Label: "Reranker (none/lexical/llm, empty to keep)",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.Reranker),
+							Placeholder: "none",
+						},
+					},
+					&forms.Item{
+						Name:  "rerank_candidates",
+						Label: "Rerank top N candidates (0 for all, empty to keep)",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.RerankCandidates),
+							Placeholder: "0",
+						},
+					},
+					&forms.Item{
+						Name:  "rerank_threshold",
+						Label: "Rerank relevance threshold (0..1, empty to keep)",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.RerankThreshold),
+							Placeholder: "0.3",
+						},
+					},
+					&forms.Item{
+						Name:  "mmr_lambda",
+						Label: "MMR lambda (0..1 enables diversity, 1 turns it off again, empty to keep)",
+						Child: &forms.InputText{
+							Binding:     forms.Var(&in.MMRLambda),
+							Placeholder: strconv.FormatFloat(RecommendedMMRLambda, 'g', -1, 64),
+						},
+					},
+				},
+			},
+		},
+		Handler: func(rc *RC) error {
+			account := edb.Get[m.Account](rc, rc.AccountID())
+			if account == nil {
+				return fmt.Errorf("no current account")
+			}
+			opts := &account.Retrieval
+			if s := strings.TrimSpace(in.QueryRewriting); s != "" {
+				v, err := parseOnOff(s)
+				if err != nil {
+					return err
+				}
+				opts.QueryRewriting = v
+			}
+			if s := strings.TrimSpace(in.MaxSubQueries); s != "" {
+				v, err := strconv.Atoi(s)
+				if err != nil || v < 0 || v > 5 {
+					return fmt.Errorf("invalid number of sub-queries %q, expected 0..5", s)
+				}
+				opts.MaxSubQueries = v
+			}
+			if s := strings.TrimSpace(in.Reranker); s != "" {
+				v, err := m.ParseRerankerType(strings.ToLower(s))
+				if err != nil {
+					return err
+				}
+				opts.Reranker = v
+			}
+			if s := strings.TrimSpace(in.RerankCandidates); s != "" {
+				v, err := strconv.Atoi(s)
+				if err != nil || v < 0 {
+					return fmt.Errorf("invalid number of rerank candidates %q", s)
+				}
+				opts.RerankCandidates = v
+			}
+			if s := strings.TrimSpace(in.RerankThreshold); s != "" {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil || v < 0 || v > 1 {
+					return fmt.Errorf("invalid rerank threshold %q, expected 0..1", s)
+				}
+				opts.RerankThreshold = v
+			}
+			if s := strings.TrimSpace(in.MMRLambda); s != "" {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil || v <= 0 || v > 1 {
+					return fmt.Errorf("invalid MMR lambda %q, expected 0..1", s)
+				}
+				opts.MMRLambda = v
+			}
+			edb.Put(rc, account)
+			logRetrievalOptions(rc, account)
+			return nil
+		},
+	}
+}
+
+func logRetrievalOptions(rc *RC, account *m.Account) {
+	opts := account.Retrieval
+	flogger.Log(rc, "Retrieval options of %s:", account.Name)
+	flogger.Log(rc, "Query rewriting: %v, max sub-queries: %d", opts.QueryRewriting, opts.MaxSubQueries)
+	flogger.Log(rc, "Reranker: %v, candidates: %d, threshold: %g", opts.Reranker, opts.RerankCandidates, opts.RerankThreshold)
+	flogger.Log(rc, "MMR lambda: %g", retrievalSettingsFor(opts).MMRLambda)
+}
+
+func (app *App) flagDuplicatesProcedure() *Procedure {
+	in := &struct {
+		Threshold string
+	}{
+		Threshold: strconv.FormatFloat(m.DefaultDuplicateSimilarity, 'g', -1, 64),
+	}
+
+	return &Procedure{
+		Slug:  "flag-duplicates",
+		Title: "Flag Near-Duplicate Content",
+		Form: &forms.Form{
+			Group: forms.Group{
+				Styles: []*forms.Style{
+					adminFormStyle,
+					verticalFormStyle,
+				},
+				Children: []forms.Child{
+					&forms.Item{
+						Name:  "threshold",
+						Label: "Similarity threshold",
+						Child: &forms.InputText{
+							Binding: forms.Var(&in.Threshold),
+						},
+					},
+				},
+			},
+		},
+		Handler: func(rc *RC) error {
+			account := edb.Get[m.Account](rc, rc.AccountID())
+			if account == nil {
+				return fmt.Errorf("no current account")
+			}
+			threshold, err := strconv.ParseFloat(strings.TrimSpace(in.Threshold), 64)
+			if err != nil || threshold <= 0 || threshold > 1 {
+				return fmt.Errorf("invalid threshold %q", in.Threshold)
+			}
+			typ := account.EffectiveEmbeddingType()
+			embs := loadAccountEmbeddings(rc, account.ID, typ, 0)
+			n := app.flagNearDuplicates(rc, account.ID, typ, embs.Embeddings, threshold)
+			flogger.Log(rc, "Flagged %d new near-duplicate pairs among %d chunks", n, len(embs.Embeddings))
+			return nil
+		},
+	}
+}
+
+func parseOnOff(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "yes", "true", "1":
+		return true, nil
+	case "off", "no", "false", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid value %q, expected on or off", s)
+	}
+}
@@ -21,6 +21,12 @@ type Procedure struct {
 func (app *App) Procedures() []*Procedure {
 	return []*Procedure{
 		app.importProcedure(),
+		app.embeddingMigrationStartProcedure(),
+		app.embeddingMigrationStatusProcedure(),
+		app.embeddingMigrationPauseProcedure(),
+		app.retrievalEvaluationProcedure(),
+		app.retrievalOptionsProcedure(),
+		app.flagDuplicatesProcedure(),
 	}
 }
 
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/andreyvit/edb"
+	"github.com/andreyvit/mvp"
+	"github.com/andreyvit/mvp/flake"
+	"github.com/andreyvit/mvp/flogger"
+	"github.com/andreyvit/mvp/httperrors"
+	mvpm "github.com/andreyvit/mvp/mvpmodel"
+	"github.com/andreyvit/openai"
+
+	m "github.com/andreyvit/buddyd/model"
+)
+
+func loadUserMemories(rc *RC, accountID m.AccountID, userID m.UserID) []*m.UserMemory {
+	return edb.All(edb.ExactIndexScan[m.UserMemory](rc, UserMemoriesByAccountUser, m.AccountUser(accountID, userID)))
+}
+
+// loadAccountMemories returns the memories of all users of the account.
+func loadAccountMemories(rc *RC, accountID m.AccountID) []*m.UserMemory {
+	return edb.All(edb.IndexScan[m.UserMemory](rc, UserMemoriesByAccountUser, edb.ExactScan(m.AccountUserKey{AccountID: accountID}).Prefix(1)))
+}
+
+func loadOwnUserMemory(rc *RC, memoryID m.UserMemoryID) (*m.UserMemory, error) {
+	mem := edb.Get[m.UserMemory](rc, memoryID)
+	if mem == nil || mem.AccountID != rc.AccountID() || mem.UserID != rc.UserID() {
+		return nil, httperrors.Errorf(404, "memory_not_found", "This memory does not exist.")
+	}
+	return mem, nil
+}
+
+// selectPromptMemories picks the memories of the chat's author that are
+// relevant to the given retrieval queries.
+func selectPromptMemories(rc *RC, chat *m.Chat, queries []m.Embedding, typ m.EmbeddingType) []*m.UserMemory {
+	memories := loadUserMemories(rc, chat.AccountID, chat.UserID)
+	return m.SelectMemories(memories, queries, typ, MaxMemoriesInPrompt, 0)
+}
+
+func formatPromptMemories(memories []*m.UserMemory) string {
+	var buf strings.Builder
+	buf.WriteString(memoryPromptIntro)
+	for _, mem := range memories {
+		buf.WriteString("\n- ")
+		buf.WriteString(mem.Text)
+	}
+	return buf.String()
+}
+
+// EnqueueMemoryExtraction schedules extraction of new facts about the user
+// from the turns of the chat that haven't been processed yet.
+func (app *App) EnqueueMemoryExtraction(rc *RC, chatID m.ChatID) {
+	app.EnqueueEphemeral(jobExtractMemories, chatID.String(), func(rc *mvp.RC) error {
+		return app.runMemoryExtraction(fullRC.From(rc), chatID)
+	})
+}
+
+// EnqueueMemoryEmbedding schedules computing the missing embeddings of the user's memories.
+func (app *App) EnqueueMemoryEmbedding(rc *RC, accountID m.AccountID, userID m.UserID) {
+	app.EnqueueEphemeral(jobEmbedMemories, accountID.String()+"-"+userID.String(), func(rc *mvp.RC) error {
+		return app.ensureMemoryEmbeddings(fullRC.From(rc), accountID, userID)
+	})
+}
+
+func (app *App) runMemoryExtraction(rc *RC, chatID m.ChatID) error {
+	var accountID m.AccountID
+	var userID m.UserID
+	var embType m.EmbeddingType
+	var existing []string
+	var turns []*m.RecordedMsg
+	var end int
+	var enabled bool
+	err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+		chat := edb.Get[m.Chat](rc, chatID)
+		cc := edb.Get[m.ChatContent](rc, chatID)
+		if chat == nil || cc == nil {
+			return nil
+		}
+		account := edb.Get[m.Account](rc, chat.AccountID)
+		enabled = account.UserMemory
+		accountID, userID = chat.AccountID, chat.UserID
+		embType = account.EffectiveEmbeddingType()
+		for _, mem := range loadUserMemories(rc, accountID, userID) {
+			existing = append(existing, mem.Text)
+		}
+		for i := chat.MemoryTurns; i < len(cc.Turns); i++ {
+			msg := cc.Turns[i].LastMessage()
+			if msg == nil || msg.State == m.MessageStatePending {
+				break
+			}
+			turns = append(turns, &m.RecordedMsg{Role: msg.Role, Text: msg.Text})
+			end = i + 1
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !enabled || !hasUserTurn(turns) {
+		return nil
+	}
+
+	facts, spent, err := app.extractMemories(rc, existing, turns)
+	if err != nil {
+		// leave MemoryTurns as is to retry on the next trigger
+		flogger.Log(rc, "WARNING: memory extraction for chat %v failed: %v", chatID, err)
+		return app.addChatCost(rc, chatID, spent)
+	}
+	flogger.Log(rc, "MemoryExtraction(%v): %d new facts from %d turns", chatID, len(facts), len(turns))
+
+	var memories []*m.UserMemory
+	for _, fact := range facts {
+		mem := &m.UserMemory{
+			ID:           app.NewID(),
+			AccountID:    accountID,
+			UserID:       userID,
+			Text:         fact,
+			SourceChatID: chatID,
+			CreationTime: rc.Now,
+		}
+		emb, cost, err := app.computeEmbedding(rc, fact, embType)
+		spent += cost
+		if err != nil {
+			// saved anyway, ensureMemoryEmbeddings will pick it up later
+			flogger.Log(rc, "WARNING: memory embedding failed: %v", err)
+		} else {
+			mem.SetEmbedding(embType, emb)
+		}
+		memories = append(memories, mem)
+	}
+
+	return app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		chat := edb.Get[m.Chat](rc, chatID)
+		chat.Cost += spent
+		if end > chat.MemoryTurns {
+			chat.MemoryTurns = end
+		}
+		edb.Put(rc, chat)
+		for _, mem := range memories {
+			edb.Put(rc, mem)
+		}
+		return nil
+	})
+}
+
+func hasUserTurn(turns []*m.RecordedMsg) bool {
+	for _, t := range turns {
+		if t.Role == m.MessageRoleUser {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *App) addChatCost(rc *RC, chatID m.ChatID, spent openai.Price) error {
+	if spent == 0 {
+		return nil
+	}
+	return app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		chat := edb.Get[m.Chat](rc, chatID)
+		chat.Cost += spent
+		edb.Put(rc, chat)
+		return nil
+	})
+}
+
+// extractMemories asks the LLM for the facts about the user found in turns
+// that aren't among the existing ones.
+func (app *App) extractMemories(rc *RC, existing []string, turns []*m.RecordedMsg) ([]string, openai.Price, error) {
+	var buf strings.Builder
+	if len(existing) > 0 {
+		buf.WriteString("Already remembered:\n")
+		for _, text := range existing {
+			fmt.Fprintf(&buf, "- %s\n", text)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("Conversation:\n\n")
+	for _, t := range turns {
+		fmt.Fprintf(&buf, "%s: %s\n\n", transcriptSpeaker(t.Role), t.Text)
+	}
+
+	opt := openai.DefaultChatOptions()
+	opt.Model = DefaultModel
+	opt.MaxTokens = MaxResponseTokenCount
+	opt.Temperature = 0
+	opt.Functions = []any{memoryExtractionFunc}
+	opt.FunctionCallMode = &openai.ForceFunctionCall{Name: memoryExtractionFuncName}
+
+	history := []openai.Msg{
+		openai.SystemMsg(memoryExtractionSystemPrompt),
+		{Role: openai.User, Content: buf.String()},
+	}
+	msgs, usage, err := openai.Chat(rc, history, opt, app.httpClient, app.Settings().OpenAICreds)
+	spent := openai.Cost(usage.PromptTokens, usage.CompletionTokens, opt.Model)
+	if err != nil {
+		return nil, spent, err
+	}
+
+	var result MemoryExtractionFuncResult
+	err = msgs[0].UnmarshalCallArguments(&result)
+	if err != nil {
+		return nil, spent, err
+	}
+
+	known := make(map[string]bool, len(existing))
+	for _, text := range existing {
+		known[strings.ToLower(text)] = true
+	}
+	var facts []string
+	for _, fact := range result.Facts {
+		fact = strings.TrimSpace(fact)
+		if fact == "" || known[strings.ToLower(fact)] {
+			continue
+		}
+		known[strings.ToLower(fact)] = true
+		facts = append(facts, fact)
+	}
+	return facts, spent, nil
+}
+
+// ensureMemoryEmbeddings computes the embeddings missing after the user has
+// edited their memories. Switching the account's embedding type is handled by
+// the embedding migration, which re-embeds all memories before the switch.
+func (app *App) ensureMemoryEmbeddings(rc *RC, accountID m.AccountID, userID m.UserID) error {
+	var embType m.EmbeddingType
+	var unembedded []*m.UserMemory
+	err := app.InTx(&rc.RC, mvpm.SafeReader, func() error {
+		account := edb.Get[m.Account](rc, accountID)
+		embType = account.EffectiveEmbeddingType()
+		for _, mem := range loadUserMemories(rc, accountID, userID) {
+			if mem.Embedding(embType) == nil {
+				unembedded = append(unembedded, mem)
+			}
+		}
+		return nil
+	})
+	if err != nil || len(unembedded) == 0 {
+		return err
+	}
+
+	embs := make([]m.Embedding, len(unembedded))
+	for i, mem := range unembedded {
+		emb, _, err := app.computeEmbedding(rc, mem.Text, embType)
+		if err != nil {
+			return err
+		}
+		embs[i] = emb
+	}
+
+	return app.InTx(&rc.RC, mvpm.SafeWriter, func() error {
+		for i, old := range unembedded {
+			mem := edb.Get[m.UserMemory](rc, old.ID)
+			if mem == nil || mem.Text != old.Text {
+				continue // deleted or edited again meanwhile
+			}
+			mem.SetEmbedding(embType, embs[i])
+			edb.Put(rc, mem)
+		}
+		return nil
+	})
+}
+
+func (app *App) showUserMemories(rc *RC, in *struct{}) (*mvp.ViewData, error) {
+	memories := loadUserMemories(rc, rc.AccountID(), rc.UserID())
+	sort.Slice(memories, func(i, j int) bool {
+		return memories[i].CreationTime.After(memories[j].CreationTime)
+	})
+	return &mvp.ViewData{
+		View:         "memory/memory",
+		Title:        "What the Assistant Remembers",
+		SemanticPath: "chat/memory",
+		Data: struct {
+			Enabled  bool
+			Memories []*m.UserMemory
+		}{
+			Enabled:  rc.Account.UserMemory,
+			Memories: memories,
+		},
+	}, nil
+}
+
+func (app *App) saveUserMemory(rc *RC, in *struct {
+	MemoryID flake.ID `form:"memory,path" json:"-"`
+	Text     string   `json:"text"`
+}) (any, error) {
+	mem := must(loadOwnUserMemory(rc, in.MemoryID))
+	text := strings.TrimSpace(in.Text)
+	if text == "" {
+		rc.DBTx().DeleteByKey(UserMemories, mem.ID)
+		return app.Redirect("memory.list"), nil
+	}
+	if openai.TokenCount(text, DefaultModel) > MaxMsgTokenCount {
+		return nil, httperrors.BadRequest.Msg("memory too long")
+	}
+	if text != mem.Text {
+		mem.SetText(text)
+		mem.EditedByUser = true
+		mem.UpdateTime = rc.Now
+		edb.Put(rc, mem)
+		app.EnqueueMemoryEmbedding(rc, mem.AccountID, mem.UserID)
+	}
+	return app.Redirect("memory.list"), nil
+}
+
+func (app *App) deleteUserMemory(rc *RC, in *struct {
+	MemoryID flake.ID `form:"memory,path" json:"-"`
+}) (any, error) {
+	mem := must(loadOwnUserMemory(rc, in.MemoryID))
+	rc.DBTx().DeleteByKey(UserMemories, mem.ID)
+	return app.Redirect("memory.list"), nil
+}
+
+func (app *App) clearUserMemories(rc *RC, in *struct{}) (any, error) {
+	for _, mem := range loadUserMemories(rc, rc.AccountID(), rc.UserID()) {
+		rc.DBTx().DeleteByKey(UserMemories, mem.ID)
+	}
+	return app.Redirect("memory.list"), nil
+}